@@ -27,13 +27,16 @@ import (
 	"github.com/grammarly/rocker-compose/src/compose/config"
 	"io"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/docker/docker/pkg/term"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/go-yaml/yaml"
 	"github.com/grammarly/rocker/src/dockerclient"
@@ -77,7 +80,7 @@ func main() {
 		cli.StringFlag{
 			Name:  "file, f",
 			Value: "compose.yml",
-			Usage: "Path to configuration file which should be run, if `-` is given as a value, then STDIN will be used",
+			Usage: "Path to configuration file or directory which should be run, if `-` is given as a value, then STDIN will be used",
 		},
 		cli.StringSliceFlag{
 			Name:  "var",
@@ -95,12 +98,17 @@ func main() {
 		},
 		cli.BoolFlag{
 			Name:  "print",
-			Usage: "just print the rendered compose config and exit",
+			Usage: "just print the rendered compose config with the secrets redacted and exit",
 		},
 		cli.BoolFlag{
 			Name:  "demand-artifacts",
 			Usage: "fail if artifacts not found for {{ image }} helpers",
 		},
+		cli.StringFlag{
+			Name:   "environment",
+			Usage:  "Environment (e.g. prod or staging) to label containers with, containers of other environments are not touched",
+			EnvVar: "ROCKER_COMPOSE_ENVIRONMENT",
+		},
 	}
 
 	app.Flags = append([]cli.Flag{
@@ -121,8 +129,27 @@ func main() {
 		cli.BoolTFlag{
 			Name: "colors",
 		},
+		cli.StringFlag{
+			Name:   "label-prefix",
+			Value:  string(config.DefaultLabelPrefix),
+			Usage:  "Prefix of the labels to manage containers with, containers labeled with another prefix are not touched",
+			EnvVar: "ROCKER_COMPOSE_LABEL_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "restart-override",
+			Usage:  "Restart policy to set for all containers regardless of the manifest, e.g. no, always or on-failure,N",
+			EnvVar: "ROCKER_COMPOSE_RESTART_OVERRIDE",
+		},
 	}, dockerclient.GlobalCliParams()...)
 
+	app.Before = func(ctx *cli.Context) error {
+		if ctx.GlobalString("label-prefix") == "" {
+			return fmt.Errorf("Label prefix cannot be empty")
+		}
+		_, err := initRestartOverride(ctx)
+		return err
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:   "run",
@@ -141,6 +168,29 @@ func main() {
 					Name:  "pull",
 					Usage: "Do pull images before running",
 				},
+				cli.BoolFlag{
+					Name:  "rollback",
+					Usage: "Revert the containers changed by the run if it fails partway",
+				},
+				cli.StringSliceFlag{
+					Name:  "only",
+					Value: &cli.StringSlice{},
+					Usage: "Run only the given containers of the manifest, leave the rest as they are. Can pass multiple of this.",
+				},
+				cli.StringSliceFlag{
+					Name:  "recreate-on",
+					Value: &cli.StringSlice{},
+					Usage: "Recreate containers only on changes of the given properties, e.g. image or env, changes of the others are ignored. Can pass multiple of this.",
+				},
+				cli.IntFlag{
+					Name:  "pull-concurrency",
+					Value: compose.DefaultPullConcurrency,
+					Usage: "Maximum number of images pulled at the same time",
+				},
+				cli.IntFlag{
+					Name:  "image-concurrency",
+					Usage: "Maximum number of containers of the same image started at the same time, no limit if not set",
+				},
 				cli.DurationFlag{
 					Name:  "wait",
 					Value: 1 * time.Second,
@@ -150,6 +200,64 @@ func main() {
 					Name:  "ansible",
 					Usage: "output json in ansible format for easy parsing",
 				},
+				cli.StringFlag{
+					Name:  "cpuset-check",
+					Value: "warn",
+					Usage: "check cpuset_cpus of containers against the number of host CPUs: warn|error|off",
+				},
+				cli.StringSliceFlag{
+					Name:   "meta",
+					Value:  &cli.StringSlice{},
+					Usage:  "Add key=value metadata label (e.g. git.revision) to created containers, changing it does not recreate containers",
+					EnvVar: "ROCKER_COMPOSE_META",
+				},
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Do not ask for confirmation before removing or recreating stateful containers, required in non-interactive mode",
+				},
+				cli.DurationFlag{
+					Name:  "watch",
+					Usage: "Keep running and recreate containers when their images are updated in the registry, checking them every given interval",
+				},
+				cli.DurationFlag{
+					Name:  "watch-max-backoff",
+					Usage: "Upper bound of the delay between retries of failed image checks in watch mode, 10 watch intervals by default",
+				},
+				cli.BoolFlag{
+					Name:  "zero-exit-code",
+					Usage: "Exit with 0 code if containers were changed, by default the exit code is 2 in this case",
+				},
+				cli.StringFlag{
+					Name:  "metrics-file",
+					Usage: "write metrics of the run in Prometheus text format to the file, '-' for stdout",
+				},
+				cli.StringFlag{
+					Name:  "metrics-pushgateway",
+					Usage: "push metrics of the run to the Prometheus pushgateway at the given URL",
+				},
+				cli.StringFlag{
+					Name:  "image",
+					Usage: "Run a single container of the given image instead of the manifest, arguments are used as its cmd",
+				},
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "Name of the single container given by --image, the image name by default",
+				},
+				cli.StringSliceFlag{
+					Name:  "env",
+					Value: &cli.StringSlice{},
+					Usage: "Set KEY=VALUE env var of the single container given by --image",
+				},
+				cli.StringSliceFlag{
+					Name:  "port",
+					Value: &cli.StringSlice{},
+					Usage: "Publish the port of the single container given by --image, the format is the same as of ports in the manifest",
+				},
+				cli.StringSliceFlag{
+					Name:  "volume",
+					Value: &cli.StringSlice{},
+					Usage: "Mount the volume to the single container given by --image, the format is the same as of volumes in the manifest",
+				},
 			}, composeFlags...),
 		},
 		{
@@ -161,6 +269,11 @@ func main() {
 					Name:  "ansible",
 					Usage: "output json in ansible format for easy parsing",
 				},
+				cli.IntFlag{
+					Name:  "pull-concurrency",
+					Value: compose.DefaultPullConcurrency,
+					Usage: "Maximum number of images pulled at the same time",
+				},
 			}, composeFlags...),
 		},
 		{
@@ -226,6 +339,30 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:   "export",
+			Usage:  "print the manifest of the given containers, e.g. started without rocker-compose",
+			Action: exportCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "naming",
+					Value: config.DefaultNaming,
+					Usage: "Naming strategy the containers are named with: dot (namespace.name), underscore (namespace_name) or dash (namespace-name)",
+				},
+			},
+		},
+		{
+			Name:   "graph",
+			Usage:  "print the dependency graph of containers in Graphviz DOT format",
+			Action: graphCommand,
+			Flags:  composeFlags,
+		},
+		{
+			Name:   "config",
+			Usage:  "print the resolved manifest with the secrets redacted",
+			Action: configCommand,
+			Flags:  composeFlags,
+		},
 		dockerclient.InfoCommandSpec(),
 	}
 
@@ -254,19 +391,64 @@ func runCommand(ctx *cli.Context) {
 
 	initLogs(ctx)
 
+	if ctx.Duration("watch") > 0 && (ctx.Bool("ansible") || ctx.Bool("attach") || ctx.Bool("dry")) {
+		fatalf(fmt.Errorf("--watch cannot be used with --ansible, --attach or --dry"))
+	}
+	if ctx.Duration("watch") > 0 && !ctx.Bool("yes") {
+		fatalf(fmt.Errorf("--watch requires --yes, recreations cannot be confirmed while watching unattended"))
+	}
+	if len(ctx.StringSlice("only")) > 0 && ctx.Bool("force") {
+		fatalf(fmt.Errorf("--only cannot be used with --force"))
+	}
+	if ctx.String("image") != "" && (len(ctx.StringSlice("only")) > 0 || ctx.Bool("force")) {
+		fatalf(fmt.Errorf("--image cannot be used with --only or --force"))
+	}
+
 	dockerCli := initDockerClient(ctx)
 	config := initComposeConfig(ctx, dockerCli)
 	auth := initAuthConfig(ctx)
 
+	if err := checkCpusets(ctx, config, dockerCli); err != nil {
+		fatalf(err)
+	}
+
+	metadata, err := compose.ParseMetadata(ctx.StringSlice("meta"), initLabelPrefix(ctx))
+	if err != nil {
+		fatalf(err)
+	}
+
+	restartOverride, err := initRestartOverride(ctx)
+	if err != nil {
+		fatalf(err)
+	}
+
+	// the single container given by --image leaves the other containers of its namespace intact
+	only := ctx.StringSlice("only")
+	if ctx.String("image") != "" {
+		for name := range config.Containers {
+			only = append(only, name)
+		}
+	}
+
 	compose, err := compose.New(&compose.Config{
-		Manifest: config,
-		Docker:   dockerCli,
-		Force:    ctx.Bool("force"),
-		DryRun:   ctx.Bool("dry"),
-		Attach:   ctx.Bool("attach"),
-		Wait:     ctx.Duration("wait"),
-		Pull:     ctx.Bool("pull"),
-		Auth:     auth,
+		Manifest:         config,
+		Docker:           dockerCli,
+		LabelPrefix:      initLabelPrefix(ctx),
+		Force:            ctx.Bool("force"),
+		DryRun:           ctx.Bool("dry"),
+		Attach:           ctx.Bool("attach"),
+		Wait:             ctx.Duration("wait"),
+		Pull:             ctx.Bool("pull"),
+		Auth:             auth,
+		Confirm:          initConfirm(ctx),
+		Metadata:         metadata,
+		Environment:      ctx.String("environment"),
+		PullConcurrency:  ctx.Int("pull-concurrency"),
+		Rollback:         ctx.Bool("rollback"),
+		Only:             only,
+		RecreateOn:       ctx.StringSlice("recreate-on"),
+		ImageConcurrency: ctx.Int("image-concurrency"),
+		RestartOverride:  restartOverride,
 	})
 
 	if err != nil {
@@ -280,13 +462,44 @@ func runCommand(ctx *cli.Context) {
 		}
 	}
 
-	if err := compose.RunAction(); err != nil {
-		fatalf(err)
+	runErr := compose.RunAction()
+
+	if err := exportMetrics(ctx, compose.Metrics()); err != nil {
+		log.Warn(err)
+	}
+
+	if runErr != nil {
+		fatalf(runErr)
+	}
+
+	if interval := ctx.Duration("watch"); interval > 0 {
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		err := compose.Watch(stop, interval, ctx.Duration("watch-max-backoff"))
+		select {
+		case <-stop:
+			// stopped by a signal, the error is ErrCanceled
+		default:
+			fatalf(err)
+		}
+		return
 	}
 
 	if ansibleResp != nil {
 		// ansibleResp.Success("done hehe").WriteTo(os.Stdout)
 		compose.WritePlan(ansibleResp).WriteTo(os.Stdout)
+		return
+	}
+
+	// ansible reads changes from the response, others may rely on the exit code
+	if !ctx.Bool("zero-exit-code") {
+		os.Exit(compose.Result().ExitCode())
 	}
 }
 
@@ -307,10 +520,12 @@ func pullCommand(ctx *cli.Context) {
 	auth := initAuthConfig(ctx)
 
 	compose, err := compose.New(&compose.Config{
-		Manifest: config,
-		Docker:   dockerCli,
-		DryRun:   ctx.Bool("dry"),
-		Auth:     auth,
+		Manifest:        config,
+		Docker:          dockerCli,
+		LabelPrefix:     initLabelPrefix(ctx),
+		DryRun:          ctx.Bool("dry"),
+		Auth:            auth,
+		PullConcurrency: ctx.Int("pull-concurrency"),
 	})
 	if err != nil {
 		fatalf(err)
@@ -355,12 +570,13 @@ func cleanCommand(ctx *cli.Context) {
 	auth := initAuthConfig(ctx)
 
 	compose, err := compose.New(&compose.Config{
-		Manifest:   config,
-		Docker:     dockerCli,
-		DryRun:     ctx.Bool("dry"),
-		Remove:     true,
-		Auth:       auth,
-		KeepImages: ctx.Int("keep"),
+		Manifest:    config,
+		Docker:      dockerCli,
+		LabelPrefix: initLabelPrefix(ctx),
+		DryRun:      ctx.Bool("dry"),
+		Remove:      true,
+		Auth:        auth,
+		KeepImages:  ctx.Int("keep"),
 	})
 	if err != nil {
 		fatalf(err)
@@ -398,9 +614,10 @@ func pinCommand(ctx *cli.Context) {
 	auth := initAuthConfig(ctx)
 
 	compose, err := compose.New(&compose.Config{
-		Manifest: config,
-		Docker:   dockerCli,
-		Auth:     auth,
+		Manifest:    config,
+		Docker:      dockerCli,
+		LabelPrefix: initLabelPrefix(ctx),
+		Auth:        auth,
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -446,11 +663,12 @@ func recoverCommand(ctx *cli.Context) {
 	auth := initAuthConfig(ctx)
 
 	compose, err := compose.New(&compose.Config{
-		Docker:  dockerCli,
-		DryRun:  ctx.Bool("dry"),
-		Wait:    ctx.Duration("wait"),
-		Recover: true,
-		Auth:    auth,
+		Docker:      dockerCli,
+		LabelPrefix: initLabelPrefix(ctx),
+		DryRun:      ctx.Bool("dry"),
+		Wait:        ctx.Duration("wait"),
+		Recover:     true,
+		Auth:        auth,
 	})
 
 	if err != nil {
@@ -462,6 +680,101 @@ func recoverCommand(ctx *cli.Context) {
 	}
 }
 
+func exportCommand(ctx *cli.Context) {
+	initLogs(ctx)
+
+	if len(ctx.Args()) == 0 {
+		log.Fatal("Expecting at least one container name or id to export")
+	}
+
+	naming, err := config.GetNamingStrategy(ctx.String("naming"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dockerCli := initDockerClient(ctx)
+	containers := map[string]*config.Container{}
+
+	for _, id := range ctx.Args() {
+		apiContainer, err := dockerCli.InspectContainer(id)
+		if err != nil {
+			log.Fatalf("Failed to inspect container %s, error: %s", id, err)
+		}
+
+		container, warnings := config.NewFromDockerConfig(apiContainer, naming, initLabelPrefix(ctx))
+		name := naming.Parse(apiContainer.Name).Name
+
+		// the manifest is keyed by the bare names, so containers of different
+		// namespaces such as a.web and b.web cannot be exported together
+		if _, ok := containers[name]; ok {
+			log.Fatalf("Container %s is given twice or several containers are named %s in different namespaces, "+
+				"export them separately", apiContainer.Name, name)
+		}
+
+		for _, warning := range warnings {
+			log.Warnf("Container %s: %s", name, warning)
+		}
+		containers[name] = container
+	}
+
+	data, err := yaml.Marshal(map[string]interface{}{"containers": containers})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := os.Stdout.Write(data); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func graphCommand(ctx *cli.Context) {
+	initLogs(ctx)
+
+	dockerCli := initDockerClient(ctx)
+	config := initComposeConfig(ctx, dockerCli)
+
+	compose, err := compose.New(&compose.Config{
+		Manifest:    config,
+		Docker:      dockerCli,
+		LabelPrefix: initLabelPrefix(ctx),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dot, err := compose.GraphAction()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := io.WriteString(os.Stdout, dot); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func configCommand(ctx *cli.Context) {
+	initLogs(ctx)
+
+	dockerCli := initDockerClient(ctx)
+	config := initComposeConfig(ctx, dockerCli)
+
+	// print the concrete values the containers would be created with
+	if config.HasHostPercents() {
+		if err := resolveHostPercents(config, dockerCli); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	data, err := config.RedactedYAML()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := os.Stdout.Write(data); err != nil {
+		log.Fatal(err)
+	}
+}
+
 func initLogs(ctx *cli.Context) {
 	logger := log.StandardLogger()
 
@@ -506,6 +819,10 @@ func initLogs(ctx *cli.Context) {
 func initComposeConfig(ctx *cli.Context, dockerCli *docker.Client) *config.Config {
 	file := ctx.String("file")
 
+	if ctx.String("image") != "" {
+		return initFlagsConfig(ctx, dockerCli)
+	}
+
 	if file == "" {
 		log.Fatalf("Manifest file is empty")
 		os.Exit(1)
@@ -556,6 +873,11 @@ func initComposeConfig(ctx *cli.Context, dockerCli *docker.Client) *config.Confi
 			log.Infof("Reading manifest from STDIN")
 		}
 		manifest, err = config.ReadConfig(file, os.Stdin, vars, funcs, print)
+	} else if isDir(file) {
+		if !print {
+			log.Infof("Reading manifests from directory: %s", file)
+		}
+		manifest, err = config.NewFromDir(file, vars, funcs, print)
 	} else {
 		if !print {
 			log.Infof("Reading manifest: %s", file)
@@ -567,14 +889,83 @@ func initComposeConfig(ctx *cli.Context, dockerCli *docker.Client) *config.Confi
 		log.Fatal(err)
 	}
 
+	for _, warning := range manifest.Warnings {
+		log.Warn(warning)
+	}
+
 	// Check the docker connection before we actually run
 	if err := dockerclient.Ping(dockerCli, 5000); err != nil {
 		log.Fatal(err)
 	}
 
+	if manifest.HasConditions() {
+		if err := filterByHostFacts(manifest, dockerCli); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	return manifest
 }
 
+// initFlagsConfig makes the manifest of the single container given by 'run --image' flags
+func initFlagsConfig(ctx *cli.Context, dockerCli *docker.Client) *config.Config {
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest, err := config.NewFromFlags("", config.ContainerFlags{
+		Name:    ctx.String("name"),
+		Image:   ctx.String("image"),
+		Env:     ctx.StringSlice("env"),
+		Ports:   ctx.StringSlice("port"),
+		Volumes: ctx.StringSlice("volume"),
+		Cmd:     ctx.Args(),
+	}, wd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check the docker connection before we actually run
+	if err := dockerclient.Ping(dockerCli, 5000); err != nil {
+		log.Fatal(err)
+	}
+
+	return manifest
+}
+
+// filterByHostFacts skips containers of the manifest whose "when" conditions
+// do not hold for the facts of the docker host
+func filterByHostFacts(manifest *config.Config, dockerCli *docker.Client) error {
+	info, err := dockerCli.Info()
+	if err != nil {
+		return fmt.Errorf("Failed to get docker info, error: %s", err)
+	}
+
+	skipped, err := manifest.FilterByFacts(config.HostFacts(info, os.Environ()))
+	if err != nil {
+		return err
+	}
+	for _, name := range skipped {
+		log.Infof("Skipping container %s because its when condition is false for this host", name)
+	}
+
+	return nil
+}
+
+// initLabelPrefix returns the prefix of the labels the containers are managed with
+func initLabelPrefix(ctx *cli.Context) config.LabelPrefix {
+	return config.LabelPrefix(ctx.GlobalString("label-prefix"))
+}
+
+// initRestartOverride returns the restart policy to set for all containers, nil if it is not given
+func initRestartOverride(ctx *cli.Context) (*config.RestartPolicy, error) {
+	if ctx.GlobalString("restart-override") == "" {
+		return nil, nil
+	}
+	return config.ParseRestartPolicy(ctx.GlobalString("restart-override"))
+}
+
 func initDockerClient(ctx *cli.Context) *docker.Client {
 	dockerClient, err := dockerclient.NewFromCli(ctx)
 	if err != nil {
@@ -583,6 +974,97 @@ func initDockerClient(ctx *cli.Context) *docker.Client {
 	return dockerClient
 }
 
+// resolveHostPercents converts memory and cpus of containers given as percentages
+// to concrete values using the total memory and the number of CPUs of the docker host
+func resolveHostPercents(manifest *config.Config, dockerCli *docker.Client) error {
+	info, err := dockerCli.Info()
+	if err != nil {
+		return fmt.Errorf("Failed to get docker info, error: %s", err)
+	}
+
+	return manifest.ResolveHostPercents(info.GetInt64("MemTotal"), info.GetInt("NCPU"))
+}
+
+// checkCpusets validates cpuset_cpus of the manifest against the number of CPUs
+// reported by the docker daemon, depending on the --cpuset-check mode
+func checkCpusets(ctx *cli.Context, manifest *config.Config, dockerCli *docker.Client) error {
+	mode := ctx.String("cpuset-check")
+	if mode == "off" {
+		return nil
+	}
+	if mode != "warn" && mode != "error" {
+		return fmt.Errorf("Unknown --cpuset-check mode %s, possible values are warn, error and off", mode)
+	}
+
+	info, err := dockerCli.Info()
+	if err != nil {
+		err = fmt.Errorf("Failed to get docker info, cannot check cpusets, error: %s", err)
+		if mode == "error" {
+			return err
+		}
+		log.Warn(err)
+		return nil
+	}
+
+	if err := manifest.CheckCpusets(info.GetInt("NCPU")); err != nil {
+		if mode == "error" {
+			return err
+		}
+		log.Warn(err)
+	}
+
+	return nil
+}
+
+// initConfirm returns the function asking for confirmation of destructive actions,
+// it prompts on the terminal or fails in non-interactive mode unless --yes is given
+func initConfirm(ctx *cli.Context) compose.ConfirmFunc {
+	if ctx.Bool("yes") {
+		return nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return func(removals []compose.Removal) (bool, error) {
+			names := []string{}
+			for _, removal := range removals {
+				names = append(names, removal.String())
+			}
+			return false, fmt.Errorf("The plan removes containers %s, use --yes to confirm in non-interactive mode",
+				strings.Join(names, ", "))
+		}
+	}
+	return compose.PromptConfirm(os.Stdin, os.Stderr)
+}
+
+// exportMetrics writes metrics of the run to the file and/or pushes them
+// to the pushgateway given by --metrics-file and --metrics-pushgateway
+func exportMetrics(ctx *cli.Context, metrics *compose.Metrics) error {
+	if metrics == nil {
+		return nil
+	}
+
+	if file := ctx.String("metrics-file"); file != "" {
+		fd := os.Stdout
+		if file != "-" {
+			var err error
+			if fd, err = os.Create(file); err != nil {
+				return fmt.Errorf("Failed to create metrics file %s, error: %s", file, err)
+			}
+			defer fd.Close()
+		}
+		if _, err := metrics.WriteTo(fd); err != nil {
+			return fmt.Errorf("Failed to write metrics, error: %s", err)
+		}
+	}
+
+	if gateway := ctx.String("metrics-pushgateway"); gateway != "" {
+		if err := metrics.Push(gateway, "rocker-compose"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func initAuthConfig(c *cli.Context) (auth *docker.AuthConfigurations) {
 	var err error
 	if c.GlobalIsSet("auth") {
@@ -622,11 +1104,13 @@ func initAnsubleResp(ctx *cli.Context) (ansibleResp *ansible.Response) {
 
 func doRemove(ctx *cli.Context, config *config.Config, dockerCli *docker.Client, auth *docker.AuthConfigurations) error {
 	compose, err := compose.New(&compose.Config{
-		Manifest: config,
-		Docker:   dockerCli,
-		DryRun:   ctx.Bool("dry"),
-		Remove:   true,
-		Auth:     auth,
+		Manifest:    config,
+		Docker:      dockerCli,
+		LabelPrefix: initLabelPrefix(ctx),
+		DryRun:      ctx.Bool("dry"),
+		Remove:      true,
+		Auth:        auth,
+		Environment: ctx.String("environment"),
 	})
 	if err != nil {
 		return err
@@ -655,6 +1139,12 @@ func toAbsolutePath(filePath string, shouldExist bool) (string, error) {
 	return filePath, nil
 }
 
+// isDir returns true if the given path exists and is a directory
+func isDir(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && info.IsDir()
+}
+
 // globalString fixes string arguments enclosed with double quotes
 // 'docker-machine config' gives such arguments
 func globalString(c *cli.Context, name string) string {
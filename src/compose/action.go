@@ -37,6 +37,19 @@ type runContainer action
 type removeContainer action
 type noAction action
 type waitContainerAction action
+type stopContainer action
+type quiesceContainer action
+type unquiesceContainer action
+
+type replaceContainer struct {
+	container *Container
+	existing  *Container
+}
+
+type startContainer struct {
+	container *Container
+	existing  *Container
+}
 
 // NoAction is an empty action which does nothing
 var NoAction = &noAction{}
@@ -98,6 +111,33 @@ func NewRemoveContainerAction(c *Container) Action {
 	return &removeContainer{container: c}
 }
 
+// NewReplaceContainerAction makes action that runs a new container first
+// and removes the existing one only after that
+func NewReplaceContainerAction(existing, c *Container) Action {
+	return &replaceContainer{container: c, existing: existing}
+}
+
+// NewStartContainerAction makes action that starts the existing stopped container
+// of the given spec without recreation
+func NewStartContainerAction(existing, c *Container) Action {
+	return &startContainer{container: c, existing: existing}
+}
+
+// NewStopContainerAction makes action that stops a container without removing it
+func NewStopContainerAction(c *Container) Action {
+	return &stopContainer{container: c}
+}
+
+// NewQuiesceContainerAction makes action that quiesces the existing container before it is recreated
+func NewQuiesceContainerAction(c *Container) Action {
+	return &quiesceContainer{container: c}
+}
+
+// NewUnquiesceContainerAction makes action that unquiesces the container after recreation
+func NewUnquiesceContainerAction(c *Container) Action {
+	return &unquiesceContainer{container: c}
+}
+
 // Execute runs the step
 func (a *stepAction) Execute(client Client) (err error) {
 	if a.async {
@@ -161,7 +201,9 @@ func (a *runContainer) String() string {
 
 // Execute removes a container
 func (a *removeContainer) Execute(client Client) (err error) {
-	err = client.RemoveContainer(a.container)
+	if err = client.RemoveContainer(a.container); err != nil {
+		return unquiesceBack(client, a.container, err)
+	}
 	return
 }
 
@@ -170,6 +212,103 @@ func (a *removeContainer) String() string {
 	return fmt.Sprintf("Removing container '%s'", a.container.Name)
 }
 
+// Execute renames the existing container to free its name, runs the new one
+// and removes the existing container. If the new container fails to run,
+// it is removed and the existing one gets its name back.
+func (a *replaceContainer) Execute(client Client) (err error) {
+	name := a.existing.DockerName()
+	if err = client.RenameContainer(a.existing, name+"_replaced"); err != nil {
+		return unquiesceBack(client, a.existing, err)
+	}
+
+	if err = client.RunContainer(a.container); err != nil {
+		if a.container.ID != "" {
+			if rmErr := client.RemoveContainer(a.container); rmErr != nil {
+				err = fmt.Errorf("%s, also failed to remove the new container: %s", err, rmErr)
+			}
+		}
+		if renameErr := client.RenameContainer(a.existing, name); renameErr != nil {
+			err = fmt.Errorf("%s, also failed to rename the existing container back: %s", err, renameErr)
+		}
+		return unquiesceBack(client, a.existing, err)
+	}
+
+	if err = client.RemoveContainer(a.existing); err != nil {
+		return unquiesceBack(client, a.existing, err)
+	}
+	return
+}
+
+// String returns the printable string representation of the replaceContainer action.
+func (a *replaceContainer) String() string {
+	return fmt.Sprintf("Replacing container '%s' (start first)", a.container.Name)
+}
+
+// Execute starts the existing container, the spec gets its id
+func (a *startContainer) Execute(client Client) (err error) {
+	a.container.ID = a.existing.ID
+	return client.StartContainer(a.container)
+}
+
+// String returns the printable string representation of the startContainer action.
+func (a *startContainer) String() string {
+	return fmt.Sprintf("Starting container '%s'", a.container.Name)
+}
+
+// Execute stops a container
+func (a *stopContainer) Execute(client Client) (err error) {
+	return client.StopContainer(a.container)
+}
+
+// String returns the printable string representation of the stopContainer action.
+func (a *stopContainer) String() string {
+	return fmt.Sprintf("Stopping container '%s'", a.container.Name)
+}
+
+// Execute quiesces the existing container, if it fails the container is unquiesced,
+// so it keeps accepting work, and the recreation is aborted
+func (a *quiesceContainer) Execute(client Client) (err error) {
+	if err = client.QuiesceContainer(a.container); err == nil {
+		a.container.quiesced = true
+		return
+	}
+	if unquiesceErr := client.UnquiesceContainer(a.container); unquiesceErr != nil {
+		return fmt.Errorf("%s, also failed to unquiesce it back: %s", err, unquiesceErr)
+	}
+	return
+}
+
+// String returns the printable string representation of the quiesceContainer action.
+func (a *quiesceContainer) String() string {
+	return fmt.Sprintf("Quiescing container '%s'", a.container.Name)
+}
+
+// Execute unquiesces a container
+func (a *unquiesceContainer) Execute(client Client) (err error) {
+	if err = client.UnquiesceContainer(a.container); err == nil {
+		a.container.quiesced = false
+	}
+	return
+}
+
+// unquiesceBack puts the quiesced existing container back to work when its recreation
+// fails before it is removed, the error of the recreation is returned
+func unquiesceBack(client Client, existing *Container, err error) error {
+	if !existing.quiesced {
+		return err
+	}
+	if unquiesceErr := client.UnquiesceContainer(existing); unquiesceErr != nil {
+		return fmt.Errorf("%s, also failed to unquiesce it back: %s", err, unquiesceErr)
+	}
+	existing.quiesced = false
+	return err
+}
+
+// String returns the printable string representation of the unquiesceContainer action.
+func (a *unquiesceContainer) String() string {
+	return fmt.Sprintf("Unquiescing container '%s'", a.container.Name)
+}
+
 // Execute waits for a container
 func (a *waitContainerAction) Execute(client Client) (err error) {
 	return client.WaitForContainer(a.container)
@@ -0,0 +1,168 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"errors"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/grammarly/rocker/src/imagename"
+)
+
+// ApplyOptions is a set of options for Apply, they have the same
+// meaning as the corresponding flags of 'rocker-compose run'
+type ApplyOptions struct {
+	DryRun           bool
+	Pull             bool
+	Remove           bool
+	Force            bool                  // recreate the containers not created by rocker-compose, see Compose.Force
+	Confirm          ConfirmFunc           // asked before removing containers, nil means no confirmation
+	Metadata         map[string]string     // labels added to created containers, see ParseMetadata
+	Environment      string                // scope of the reconciliation, see Compose.Environment
+	Rollback         bool                  // revert the changes if the run fails, see Compose.Rollback
+	Only             []string              // names of the containers to apply, see Compose.Only
+	RecreateOn       []string              // properties which changes recreate the containers, see Compose.RecreateOn
+	ImageConcurrency int                   // containers of the same image started at once, see Compose.ImageConcurrency
+	Cancel           <-chan struct{}       // closing it stops the run before the next step, nil is never closed
+	OnEvent          EventFunc             // called with the containers left as they are, the client reports the other transitions, see DockerClient.OnEvent
+	LabelPrefix      config.LabelPrefix    // prefix of the managed labels, config.DefaultLabelPrefix if empty, see DockerClient.LabelPrefix
+	RestartOverride  *config.RestartPolicy // replaces the restart policy of all containers, see config.OverrideRestart
+}
+
+// ErrCanceled is returned when the run is stopped by closing its cancel channel, see ApplyOptions.Cancel
+var ErrCanceled = errors.New("Canceled")
+
+// checkCanceled returns ErrCanceled if the cancel channel is closed
+func checkCanceled(cancel <-chan struct{}) error {
+	select {
+	case <-cancel:
+		return ErrCanceled
+	default:
+		return nil
+	}
+}
+
+// Exit codes of 'rocker-compose run' derived from the result, see ExitCode
+const (
+	ExitCodeNoChanges = 0
+	ExitCodeError     = 1
+	ExitCodeChanged   = 2
+)
+
+// Result is a structured outcome of the reconciliation
+type Result struct {
+	Created []*Container
+	Removed []*Container
+	Started []*Container // existing containers started because of desired_state
+	Stopped []*Container // existing containers stopped because of desired_state
+	Pulled  []*imagename.ImageName
+	Cleaned []*imagename.ImageName
+	Changed bool
+}
+
+// Apply brings the containers described by the given manifest to the desired
+// state using the given client. It is the library entry point of 'rocker-compose run',
+// so manifests built in code (see config.New) go the same way as ones read from files.
+//
+// The opts.Cancel channel is checked between the reconciliation steps, so closing it
+// stops the process with ErrCanceled before the next step is started.
+func Apply(client Client, manifest *config.Config, opts ApplyOptions) (*Result, error) {
+	// the docker client names and labels the containers the same way as the one of New
+	prefix := opts.LabelPrefix
+	if dockerClient, ok := client.(*DockerClient); ok {
+		if dockerClient.Naming == nil {
+			dockerClient.Naming = manifest.GetNaming()
+		}
+		if dockerClient.LabelPrefix == "" {
+			dockerClient.LabelPrefix = prefix
+		}
+		prefix = dockerClient.LabelPrefix
+	}
+	if prefix == "" {
+		prefix = config.DefaultLabelPrefix
+	}
+	prepareManifest(manifest, prefix, opts.RestartOverride)
+
+	compose := &Compose{
+		Manifest:         manifest,
+		DryRun:           opts.DryRun,
+		Pull:             opts.Pull,
+		Remove:           opts.Remove,
+		Confirm:          opts.Confirm,
+		Metadata:         opts.Metadata,
+		client:           client,
+		Environment:      opts.Environment,
+		Rollback:         opts.Rollback,
+		Only:             opts.Only,
+		RecreateOn:       opts.RecreateOn,
+		ImageConcurrency: opts.ImageConcurrency,
+		OnEvent:          opts.OnEvent,
+		Force:            opts.Force,
+	}
+
+	if _, err := compose.reconcile(opts.Cancel); err != nil {
+		return nil, err
+	}
+
+	return compose.Result(), nil
+}
+
+// Result collects the changes made by the last executed plan
+func (compose *Compose) Result() *Result {
+	result := &Result{
+		Created: []*Container{},
+		Removed: []*Container{},
+		Started: []*Container{},
+		Stopped: []*Container{},
+		Pulled:  compose.client.GetPulledImages(),
+		Cleaned: compose.client.GetRemovedImages(),
+	}
+
+	WalkActions(compose.executionPlan, func(action Action) {
+		if a, ok := action.(*removeContainer); ok {
+			result.Removed = append(result.Removed, a.container)
+		}
+		if a, ok := action.(*runContainer); ok {
+			result.Created = append(result.Created, a.container)
+		}
+		if a, ok := action.(*replaceContainer); ok {
+			result.Removed = append(result.Removed, a.existing)
+			result.Created = append(result.Created, a.container)
+		}
+		if a, ok := action.(*startContainer); ok {
+			result.Started = append(result.Started, a.container)
+		}
+		if a, ok := action.(*stopContainer); ok {
+			result.Stopped = append(result.Stopped, a.container)
+		}
+	})
+
+	// pulled and cleaned images are reported, but only the containers make a change
+	result.Changed = len(result.Removed)+len(result.Created)+len(result.Started)+len(result.Stopped) > 0
+
+	return result
+}
+
+// ExitCode returns the process exit code for the successful reconciliation:
+// ExitCodeChanged if any container was changed (or would be in dry run mode) and
+// ExitCodeNoChanges otherwise; failures are reported with ExitCodeError
+func (r *Result) ExitCode() int {
+	if r != nil && r.Changed {
+		return ExitCodeChanged
+	}
+	return ExitCodeNoChanges
+}
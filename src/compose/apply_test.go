@@ -0,0 +1,316 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/grammarly/rocker/src/imagename"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApplyProgrammaticConfig(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"db":   &config.Container{Image: &image},
+		"main": &config.Container{Image: &image, Links: config.Links{config.Link{ContainerName: config.ContainerName{Name: "db"}, Alias: "db"}}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &clientMock{}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertExpectations(t)
+	client.AssertNumberOfCalls(t, "RunContainer", 2)
+
+	created := []string{}
+	for _, container := range result.Created {
+		created = append(created, container.Name.String())
+	}
+	assert.Len(t, created, 2)
+	assert.Contains(t, created, "test.db")
+	assert.Contains(t, created, "test.main")
+	assert.Empty(t, result.Removed)
+	assert.True(t, result.Changed)
+	assert.Equal(t, ExitCodeChanged, result.ExitCode())
+}
+
+func TestApplyCancelled(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &clientMock{}
+	client.On("GetContainers").Return(nil)
+
+	cancel := make(chan struct{})
+	close(cancel)
+
+	_, err = Apply(client, manifest, ApplyOptions{Cancel: cancel})
+	assert.Equal(t, ErrCanceled, err)
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+}
+
+func TestApplyUnchangedExitCode(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := manifest.Containers["main"]
+	container := NewContainerFromConfig(config.NewContainerName("test", "main"), existing)
+	container.State.Running = true
+
+	client := &clientMock{actual: []*Container{container}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+	assert.False(t, result.Changed)
+	assert.Equal(t, ExitCodeNoChanges, result.ExitCode())
+}
+
+func TestApplyPreparesManifest(t *testing.T) {
+	image := "ubuntu:14.04"
+	newManifest := func() *config.Config {
+		manifest, err := config.New("test", map[string]*config.Container{
+			"main": &config.Container{Image: &image, Labels: config.StringMap{"rocker-compose-config": "image: ubuntu", "team": "ops"}},
+		}, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return manifest
+	}
+
+	// the existing container has the managed labels stripped as New does
+	existing := NewContainerFromConfig(config.NewContainerName("test", "main"), &config.Container{
+		Image:   &image,
+		Labels:  config.StringMap{"team": "ops"},
+		Restart: &config.RestartPolicy{Name: "no"},
+	})
+	existing.State.Running = true
+
+	manifest := newManifest()
+	client := &clientMock{actual: []*Container{existing}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{RestartOverride: &config.RestartPolicy{Name: "no"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+	assert.False(t, result.Changed, "the manifest built in code should not differ by the reserved labels")
+	assert.Equal(t, config.StringMap{"team": "ops"}, manifest.Containers["main"].Labels)
+
+	// the labels of another prefix are user ones
+	manifest = newManifest()
+	if _, err := Apply(client, manifest, ApplyOptions{LabelPrefix: "myorg-compose-", DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "image: ubuntu", manifest.Containers["main"].Labels["rocker-compose-config"])
+}
+
+func TestApplyPulledOnlyExitCode(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := manifest.Containers["main"]
+	container := NewContainerFromConfig(config.NewContainerName("test", "main"), existing)
+	container.State.Running = true
+
+	// the image is pulled, but the container is left as is
+	client := &clientMock{actual: []*Container{container}, pulled: []*imagename.ImageName{imagename.NewFromString(image)}}
+	client.On("GetContainers").Return(nil)
+	client.On("PullAll", mock.Anything, manifest.Vars).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{Pull: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+	assert.Len(t, result.Pulled, 1)
+	assert.False(t, result.Changed)
+	assert.Equal(t, ExitCodeNoChanges, result.ExitCode())
+}
+
+func TestApplyAdoptsUnmanagedContainers(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image, Cmd: config.Cmd{"serve"}},
+		"db":   &config.Container{Image: &image, Cmd: config.Cmd{"serve", "--replica"}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the containers started by `docker run`, test.cache is not in the manifest
+	newAdopted := func() []*Container {
+		adopted := []*Container{}
+		for _, name := range []string{"main", "db", "cache"} {
+			container, err := NewContainerFromDocker(&docker.Container{
+				ID:         "id-" + name,
+				Name:       "/test." + name,
+				Config:     &docker.Config{Image: image, Cmd: []string{"serve"}},
+				HostConfig: &docker.HostConfig{RestartPolicy: docker.NeverRestart()},
+				State:      docker.State{Running: true},
+			}, manifest.GetNaming(), config.DefaultLabelPrefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			adopted = append(adopted, container)
+		}
+		return adopted
+	}
+
+	// the container which differs from the manifest is left as is unless forced
+	adopted := newAdopted()
+	client := &clientMock{actual: adopted}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "RemoveContainer", mock.Anything)
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+	assert.False(t, result.Changed)
+
+	adopted = newAdopted()
+	client = &clientMock{actual: adopted}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RemoveContainer", adopted[1]).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err = Apply(client, manifest, ApplyOptions{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertExpectations(t)
+	client.AssertNumberOfCalls(t, "RemoveContainer", 1)
+	assert.Len(t, result.Created, 1)
+	assert.Equal(t, "test.db", result.Created[0].Name.String())
+	assert.Equal(t, []*Container{adopted[1]}, result.Removed)
+}
+
+func TestApplyResolvesHostPercents(t *testing.T) {
+	yml := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    memory: 25%
+    cpus: 50%`
+
+	manifest, err := config.ReadConfig("test.yml", strings.NewReader(yml), map[string]interface{}{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &clientMock{}
+	client.On("GetHostResources").Return(int64(8*1024*1024*1024), 4, nil)
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertExpectations(t)
+	assert.Len(t, result.Created, 1)
+	assert.EqualValues(t, 2*1024*1024*1024, result.Created[0].Config.Memory.Int64())
+	assert.Equal(t, 2.0, result.Created[0].Config.Cpus.Float64())
+}
+
+func TestApplyHostPercentsUnknownHost(t *testing.T) {
+	yml := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    memory: 25%`
+
+	manifest, err := config.ReadConfig("test.yml", strings.NewReader(yml), map[string]interface{}{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &clientMock{}
+	client.On("GetHostResources").Return(int64(0), 0, errors.New("Failed to get docker info, error: connection refused"))
+
+	_, err = Apply(client, manifest, ApplyOptions{})
+	assert.EqualError(t, err, "Failed to get docker info, error: connection refused")
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+}
+
+func TestResultExitCode(t *testing.T) {
+	assert.Equal(t, ExitCodeNoChanges, (*Result)(nil).ExitCode())
+	assert.Equal(t, ExitCodeNoChanges, (&Result{}).ExitCode())
+	assert.Equal(t, ExitCodeChanged, (&Result{Changed: true}).ExitCode())
+}
@@ -17,10 +17,15 @@
 package compose
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/grammarly/rocker-compose/src/compose/config"
 	"github.com/grammarly/rocker-compose/src/util"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/grammarly/rocker/src/dockerclient"
@@ -31,14 +36,23 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/fsouza/go-dockerclient"
+	"github.com/go-yaml/yaml"
 )
 
+// DefaultPullConcurrency is the number of images pulled at the same time by default
+const DefaultPullConcurrency = 4
+
 // Client interface describes a rocker-compose client that can do various operations
 // needed for rocker-compose to make changes.
 type Client interface {
 	GetContainers(global bool) ([]*Container, error)
 	RemoveContainer(container *Container) error
+	RenameContainer(container *Container, name string) error
 	RunContainer(container *Container) error
+	StartContainer(container *Container) error
+	StopContainer(container *Container) error
+	QuiesceContainer(container *Container) error
+	UnquiesceContainer(container *Container) error
 	EnsureContainerExist(name *Container) error
 	EnsureContainerState(name *Container) error
 	PullAll(containers []*Container, vars template.Vars) error
@@ -49,6 +63,7 @@ type Client interface {
 	WaitForContainer(container *Container) error
 	GetPulledImages() []*imagename.ImageName
 	GetRemovedImages() []*imagename.ImageName
+	GetHostResources() (memTotal int64, ncpu int, err error)
 	Pin(local, hub bool, vars template.Vars, containers []*Container) error
 }
 
@@ -60,42 +75,69 @@ type DockerClient struct {
 	Auth       *docker.AuthConfigurations
 	KeepImages int
 	Recover    bool
+	Force      bool
+
+	// PullConcurrency limits the number of images pulled at the same time,
+	// DefaultPullConcurrency is used if it is not set
+	PullConcurrency int
+
+	// OnEvent is called before the lifecycle transitions of the containers, see Event
+	OnEvent EventFunc
+
+	// Naming parses the names of the docker containers, config.DotNaming is used if it is not set
+	Naming config.NamingStrategy
+
+	// LabelPrefix is the prefix of the labels the containers are managed with,
+	// config.DefaultLabelPrefix is used if it is not set
+	LabelPrefix config.LabelPrefix
 
 	pulledImages  []*imagename.ImageName
 	removedImages []*imagename.ImageName
+	images        *imageCache
+	seedMutex     sync.Mutex // containers sharing a seeded volume are run in parallel
 }
 
 // ErrContainerBadState is an error that describes state inconsistency
 // that can be checked by EnsureContainerState function
 type ErrContainerBadState struct {
-	Container  *Container
-	Running    bool
-	OOMKilled  bool
-	ExitCode   int
-	ErrorStr   string
-	StartedAt  time.Time
-	FinishedAt time.Time
+	Container    *Container
+	Running      bool
+	OOMKilled    bool
+	ExitCode     int
+	ErrorStr     string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	RestartCount int
 }
 
-// Error returns string representation of the error
+// Error returns string representation of the error, see ContainerState.FailureReport
 func (e ErrContainerBadState) Error() string {
-	str := fmt.Sprintf("Container %s exited with code %d", e.Container.Name, e.ExitCode)
-	if e.ErrorStr != "" {
-		str = fmt.Sprintf("%s, error: %s", str, e.ErrorStr)
+	// the container may be running again if restarted by docker, report the last exit anyway
+	state := &ContainerState{
+		OOMKilled:    e.OOMKilled,
+		ExitCode:     e.ExitCode,
+		Error:        e.ErrorStr,
+		FinishedAt:   e.FinishedAt,
+		RestartCount: e.RestartCount,
 	}
-	return str
+	return fmt.Sprintf("Container %s %s", e.Container.Name, state.FailureReport())
 }
 
 // NewClient makes a new DockerClient object based on configuration params
 // that is given with input DockerClient object.
 func NewClient(initialClient *DockerClient) (*DockerClient, error) {
 	client := &DockerClient{
-		Docker:     initialClient.Docker,
-		Attach:     initialClient.Attach,
-		Wait:       initialClient.Wait,
-		Auth:       initialClient.Auth,
-		KeepImages: initialClient.KeepImages,
-		Recover:    initialClient.Recover,
+		Docker:          initialClient.Docker,
+		Attach:          initialClient.Attach,
+		Wait:            initialClient.Wait,
+		Auth:            initialClient.Auth,
+		KeepImages:      initialClient.KeepImages,
+		Recover:         initialClient.Recover,
+		Force:           initialClient.Force,
+		PullConcurrency: initialClient.PullConcurrency,
+		OnEvent:         initialClient.OnEvent,
+		Naming:          initialClient.Naming,
+		LabelPrefix:     initialClient.LabelPrefix,
 	}
 	return client, nil
 }
@@ -104,19 +146,22 @@ func NewClient(initialClient *DockerClient) (*DockerClient, error) {
 // It fetches the list and then inspects every container in parallel (pmap).
 // Timeouts after 30 seconds if some inspect operations hanged.
 func (client *DockerClient) GetContainers(global bool) ([]*Container, error) {
-	filters := map[string][]string{}
-	if !global {
-		filters["label"] = []string{"rocker-compose-id"}
-	}
-
-	apiContainers, err := client.Docker.ListContainers(docker.ListContainersOptions{
-		All:     true,
-		Filters: filters,
+	listed, err := client.Docker.ListContainers(docker.ListContainersOptions{
+		All: true,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	// unless global, only the managed containers are fetched along with the ones started by other
+	// means which names are within a namespace, they are adopted if the manifest has the same names
+	apiContainers := []docker.APIContainers{}
+	for _, apiContainer := range listed {
+		if global || isAdoptionCandidate(apiContainer, client.naming(), client.labelPrefix()) {
+			apiContainers = append(apiContainers, apiContainer)
+		}
+	}
+
 	containers := []*Container{}
 
 	if len(apiContainers) == 0 {
@@ -149,10 +194,11 @@ func (client *DockerClient) GetContainers(global bool) ([]*Container, error) {
 			if resp.err != nil {
 				return nil, fmt.Errorf("Failed to fetch container, error: %s", resp.err)
 			}
-			container, err := NewContainerFromDocker(resp.container)
+			container, err := NewContainerFromDocker(resp.container, client.naming(), client.labelPrefix())
 			if err != nil {
 				return nil, fmt.Errorf("Failed to initialize config container instance from docker api, error: %s", err)
 			}
+			client.readImageDefaults(container)
 			containers = append(containers, container)
 
 		case <-timeout:
@@ -164,23 +210,219 @@ func (client *DockerClient) GetContainers(global bool) ([]*Container, error) {
 	return containers, nil
 }
 
+// readImageDefaults reads the ports exposed by the container and the properties docker takes
+// from its image if they are not given, taking the image config into account, see
+// config.Container.ReadExposedPorts and ReadImageDefaults. If the image cannot be
+// inspected, e.g. it was removed, the properties given in the label are left as is.
+func (client *DockerClient) readImageDefaults(container *Container) {
+	if container.Config == nil || container.container == nil || container.container.Config == nil {
+		return
+	}
+
+	if client.images == nil {
+		client.images = newImageCache(client.Docker.InspectImage)
+	}
+
+	img, err := client.images.get(container.ImageID)
+	if err != nil {
+		log.Debugf("Failed to inspect image %.12s of container %s, error: %s", container.ImageID, container.Name, err)
+		return
+	}
+
+	// the spec of the container started by other means is inferred from its config, see Container.Adopted
+	if container.Adopted {
+		container.Config.StripImageDefaults(img.Config)
+	}
+
+	imageExposed := map[docker.Port]struct{}{}
+	if img.Config != nil {
+		imageExposed = img.Config.ExposedPorts
+	}
+	container.Config.ReadExposedPorts(container.container.Config.ExposedPorts, imageExposed)
+	container.Config.ReadImageDefaults(container.container.Config, container.container.ID, img.Config)
+}
+
 // RemoveContainer implements removing a container
 func (client *DockerClient) RemoveContainer(container *Container) error {
 	log.Infof("Removing container %s id:%.12s", container.Name, container.ID)
+	client.OnEvent.emit(container, EventRemoving)
+
+	runPreStop(container, client.execIn(container), time.Sleep)
 
 	if container.Config.KillTimeout != nil && *container.Config.KillTimeout > 0 {
 		if err := client.Docker.StopContainer(container.ID, *container.Config.KillTimeout); err != nil {
 			return fmt.Errorf("Failed to stop container, error: %s", err)
 		}
 	}
+	if err := client.Docker.RemoveContainer(removeContainerOptions(container.ID, container)); err != nil {
+		return fmt.Errorf("Failed to remove container, error: %s", err)
+	}
+
+	return nil
+}
+
+// StopContainer stops the container without removing it, e.g. for "desired_state: stopped",
+// pre_stop hooks are run first and kill_timeout is given to docker
+func (client *DockerClient) StopContainer(container *Container) error {
+	log.Infof("Stopping container %s id:%.12s", container.Name, container.ID)
+	client.OnEvent.emit(container, EventStopping)
+
+	runPreStop(container, client.execIn(container), time.Sleep)
+
+	timeout := uint(10)
+	if container.Config.KillTimeout != nil && *container.Config.KillTimeout > 0 {
+		timeout = *container.Config.KillTimeout
+	}
+	if err := client.Docker.StopContainer(container.ID, timeout); err != nil {
+		return fmt.Errorf("Failed to stop container, error: %s", err)
+	}
+
+	return nil
+}
+
+// QuiesceContainer runs the quiesce hook of the existing container before it is recreated
+func (client *DockerClient) QuiesceContainer(container *Container) error {
+	return runHook(container, "quiesce", container.Config.Quiesce, client.execIn(container))
+}
+
+// UnquiesceContainer runs the unquiesce hook of the container, either the new one once it is ready
+// or the existing one if its recreation failed
+func (client *DockerClient) UnquiesceContainer(container *Container) error {
+	return runHook(container, "unquiesce", container.Config.Unquiesce, client.execIn(container))
+}
+
+// removeLeftover removes the existing container having the name of the given one
+// which is going to be created, e.g. left stopped after some previous failure.
+// Running or unmanaged containers are removed only if Force is set.
+func (client *DockerClient) removeLeftover(container *Container) error {
+	existing, err := client.Docker.InspectContainer(container.DockerName())
+	if _, ok := err.(*docker.NoSuchContainer); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to inspect container %s, error: %s", container.Name, err)
+	}
+
+	if err := checkLeftover(existing, container.Name, client.Force, client.labelPrefix()); err != nil {
+		return err
+	}
+
+	log.Infof("Removing leftover container %s id:%.12s", container.Name, existing.ID)
+
+	// the leftover was created for the same container of the manifest, so it keeps the volumes the same way
+	if err := client.Docker.RemoveContainer(removeContainerOptions(existing.ID, container)); err != nil {
+		return fmt.Errorf("Failed to remove leftover container %s, error: %s", container.Name, err)
+	}
+
+	return nil
+}
+
+// removeContainerOptions returns the options to remove the container with the given id,
+// its anonymous volumes are removed along with it unless "keep_volumes" of the spec is set
+func removeContainerOptions(id string, container *Container) docker.RemoveContainerOptions {
 	keepVolumes := container.Config.KeepVolumes != nil && *container.Config.KeepVolumes
-	removeOptions := docker.RemoveContainerOptions{
-		ID:            container.ID,
+	return docker.RemoveContainerOptions{
+		ID:            id,
 		RemoveVolumes: !keepVolumes,
 		Force:         true,
 	}
-	if err := client.Docker.RemoveContainer(removeOptions); err != nil {
-		return fmt.Errorf("Failed to remove container, error: %s", err)
+}
+
+// naming returns the naming strategy the names of the docker containers are parsed with
+func (client *DockerClient) naming() config.NamingStrategy {
+	if client.Naming == nil {
+		return config.DotNaming
+	}
+	return client.Naming
+}
+
+// labelPrefix returns the prefix of the labels the containers are managed with
+func (client *DockerClient) labelPrefix() config.LabelPrefix {
+	if client.LabelPrefix == "" {
+		return config.DefaultLabelPrefix
+	}
+	return client.LabelPrefix
+}
+
+// isAdoptionCandidate returns true if the listed container is managed by rocker-compose
+// with the given prefix or its name is read as a name within a namespace, see NewContainerFromDocker
+func isAdoptionCandidate(apiContainer docker.APIContainers, naming config.NamingStrategy, prefix config.LabelPrefix) bool {
+	if _, managed := apiContainer.Labels[prefix.Label(config.LabelID)]; managed {
+		return true
+	}
+	for _, name := range apiContainer.Names {
+		// names of the linked containers are listed as well, e.g. "/app.main/db"
+		if strings.Count(name, "/") == 1 && naming.Parse(name).Namespace != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLeftover returns an error if the existing container with the given name
+// should not be removed automatically: if it is running or not managed by rocker-compose
+// within the same namespace, unless force is given.
+func checkLeftover(existing *docker.Container, name *config.ContainerName, force bool, prefix config.LabelPrefix) error {
+	if force {
+		return nil
+	}
+	if existing.State.Running {
+		return fmt.Errorf("Cannot create container %s: container with the same name is running, id:%.12s", name, existing.ID)
+	}
+
+	var labels map[string]string
+	if existing.Config != nil {
+		labels = existing.Config.Labels
+	}
+	_, managed := labels[prefix.Label(config.LabelID)]
+	if ns, ok := labels[prefix.Label(config.LabelNamespace)]; ok && ns != name.Namespace {
+		managed = false
+	}
+	if !managed {
+		return fmt.Errorf("Cannot create container %s: container with the same name is not managed by rocker-compose, id:%.12s", name, existing.ID)
+	}
+
+	return nil
+}
+
+// volumeInspector returns the named volume, it is satisfied by docker.Client.InspectVolume
+type volumeInspector func(name string) (*docker.Volume, error)
+
+// subpathBinds returns binds for the mounts of subpaths of named volumes, which are
+// resolved against the volume mountpoints on the docker host.
+func subpathBinds(container *Container, inspect volumeInspector) ([]string, error) {
+	binds := []string{}
+	for _, mount := range container.Config.Mounts {
+		if mount.Volume == "" || mount.Subpath == "" {
+			continue
+		}
+		volume, err := inspect(mount.Volume)
+		if err == docker.ErrNoSuchVolume {
+			return nil, fmt.Errorf("Container %s: volume %s is not found, it should exist to mount subpath %s",
+				container.Name, mount.Volume, mount.Subpath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to inspect volume %s, error: %s", mount.Volume, err)
+		}
+		if volume.Mountpoint == "" {
+			return nil, fmt.Errorf("Container %s: volume %s has no mountpoint", container.Name, mount.Volume)
+		}
+		binds = append(binds, mount.SubpathBind(volume.Mountpoint))
+	}
+	return binds, nil
+}
+
+// RenameContainer renames the existing container, it is used to free the name
+// of the container which is going to be replaced by a new one
+func (client *DockerClient) RenameContainer(container *Container, name string) error {
+	log.Infof("Renaming container %s id:%.12s to %s", container.Name, container.ID, name)
+
+	renameOptions := docker.RenameContainerOptions{
+		ID:   container.ID,
+		Name: name,
+	}
+	if err := client.Docker.RenameContainer(renameOptions); err != nil {
+		return fmt.Errorf("Failed to rename container, error: %s", err)
 	}
 
 	return nil
@@ -191,12 +433,45 @@ func (client *DockerClient) RemoveContainer(container *Container) error {
 func (client *DockerClient) RunContainer(container *Container) error {
 	log.Infof("Create container %s", container.Name)
 
-	opts, err := container.CreateContainerOptions()
+	if err := waitExternal(container, probeExternal, time.Sleep); err != nil {
+		return err
+	}
+
+	opts, err := container.CreateContainerOptions(client.labelPrefix())
 	if err != nil {
 		return fmt.Errorf("Failed to initialize container options, error: %s", err)
 	}
-	log.Debugf("Creating container with opts: %# v", pretty.Formatter(opts))
 
+	client.seedMutex.Lock()
+	err = seedVolumes(container, client.Docker, func(image string) error {
+		_, err := PullDockerImage(client.Docker, imagename.NewFromString(image), client.authForContainer(container))
+		return err
+	})
+	client.seedMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	binds, err := subpathBinds(container, client.Docker.InspectVolume)
+	if err != nil {
+		return err
+	}
+	opts.HostConfig.Binds = append(opts.HostConfig.Binds, binds...)
+
+	redacted := redactCreateOptions(container, opts, client.labelPrefix())
+	log.Debugf("Creating container with opts: %# v", pretty.Formatter(redacted))
+	log.Debugf("Equivalent command: %s", config.DockerRunCommand(redacted.Name, redacted.Config, redacted.HostConfig, client.labelPrefix()))
+
+	if err := client.removeLeftover(container); err != nil {
+		return err
+	}
+
+	// the values are added after the options are logged, they are usually secrets
+	if opts.Config.Env, err = envFromExec(container, opts.Config.Env, client.sourceExec); err != nil {
+		return err
+	}
+
+	client.OnEvent.emit(container, EventCreating)
 	apiContainer, err := client.Docker.CreateContainer(*opts)
 	if err != nil {
 		return fmt.Errorf("Failed to create container, error: %s", err)
@@ -224,6 +499,7 @@ func (client *DockerClient) RunContainer(container *Container) error {
 // not exited.
 func (client *DockerClient) StartContainer(container *Container) error {
 	log.Infof("Starting container %s id:%.12s from image %s", container.Name, container.ID, container.Image)
+	client.OnEvent.emit(container, EventStarting)
 
 	// TODO: HostConfig may be changed without re-creation of containers
 	// so of Volumes or Links are changed, we just need to restart container
@@ -236,7 +512,7 @@ func (client *DockerClient) StartContainer(container *Container) error {
 
 	if container.Config.State.IsRan() {
 		// TODO: refactor to use DockerClient.WaitForContainer() ?
-		exitCode, err := client.Docker.WaitContainer(container.Name.String())
+		exitCode, err := client.Docker.WaitContainer(container.DockerName())
 		if err != nil {
 			return err
 		}
@@ -254,13 +530,175 @@ func (client *DockerClient) StartContainer(container *Container) error {
 			return err
 		}
 	}
+
+	if !container.Config.State.IsRan() {
+		exec := client.execIn(container)
+		if err := waitReadiness(container, exec); err != nil {
+			return err
+		}
+		if err := waitStable(container, exec, client.restartsFunc(container)); err != nil {
+			return err
+		}
+		waitStartupDelay(container, time.Sleep)
+	}
+
 	return nil
 }
 
+// redactCreateOptions returns a copy of the create options that is safe to print, the secret
+// values are replaced in the env, labels and log options as well as in the managed config label
+func redactCreateOptions(container *Container, opts *docker.CreateContainerOptions, prefix config.LabelPrefix) *docker.CreateContainerOptions {
+	apiConfig := *opts.Config
+	apiConfig.Env = container.Config.RedactEnv(opts.Config.Env)
+	apiConfig.Labels = map[string]string{}
+	for k, v := range opts.Config.Labels {
+		if container.Config.IsSecretEnv(k) {
+			v = config.RedactedValue
+		}
+		apiConfig.Labels[k] = v
+	}
+
+	if _, ok := apiConfig.Labels[prefix.Label(config.LabelConfig)]; ok {
+		apiConfig.Labels[prefix.Label(config.LabelConfig)] = config.RedactedValue
+		if data, err := yaml.Marshal(container.Config.Redacted()); err == nil {
+			apiConfig.Labels[prefix.Label(config.LabelConfig)] = string(data)
+		}
+	}
+
+	redacted := *opts
+	redacted.Config = &apiConfig
+
+	if opts.HostConfig != nil && opts.HostConfig.LogConfig.Config != nil {
+		hostConfig := *opts.HostConfig
+		hostConfig.LogConfig.Config = map[string]string{}
+		for k, v := range opts.HostConfig.LogConfig.Config {
+			if container.Config.IsSecretEnv(k) {
+				v = config.RedactedValue
+			}
+			hostConfig.LogConfig.Config[k] = v
+		}
+		redacted.HostConfig = &hostConfig
+	}
+
+	return &redacted
+}
+
+// redactAuth returns a copy of the registry credentials that is safe to print
+func redactAuth(auth *docker.AuthConfigurations) *docker.AuthConfigurations {
+	if auth == nil {
+		return nil
+	}
+	redacted := &docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{}}
+	for registry, authConfig := range auth.Configs {
+		if authConfig.Password != "" {
+			authConfig.Password = config.RedactedValue
+		}
+		redacted.Configs[registry] = authConfig
+	}
+	return redacted
+}
+
+// restartsFunc returns the function that inspects the container for its restart count and state
+func (client *DockerClient) restartsFunc(container *Container) restartsFunc {
+	return func() (int, bool, error) {
+		inspect, err := client.Docker.InspectContainer(container.ID)
+		if err != nil {
+			return 0, false, fmt.Errorf("Failed to inspect container %s, error: %s", container.Name, err)
+		}
+		return inspect.RestartCount, inspect.State.Running && !inspect.State.Restarting, nil
+	}
+}
+
+// execIn returns the function running commands inside the running container, see execContainer
+func (client *DockerClient) execIn(container *Container) execFunc {
+	return func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		return client.execContainer(container, cmd, cancel)
+	}
+}
+
+// execContainer runs the command inside the running container,
+// waits for it to finish and returns its exit code and combined output
+func (client *DockerClient) execContainer(container *Container, cmd []string, cancel <-chan struct{}) (int, string, error) {
+	var output bytes.Buffer
+	exitCode, err := client.execContainerStreams(container, cmd, &output, &output, cancel)
+	return exitCode, output.String(), err
+}
+
+// execContainerStreams runs the command inside the running container writing its stdout
+// and stderr to the given writers, waits for it to finish and returns its exit code.
+// Once cancel is closed the exec session is closed on the next output of the command,
+// the docker api cannot kill the command itself.
+func (client *DockerClient) execContainerStreams(container *Container, cmd []string, stdout, stderr io.Writer, cancel <-chan struct{}) (int, error) {
+	exec, err := client.Docker.CreateExec(docker.CreateExecOptions{
+		Container:    container.ID,
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create exec in container %s, error: %s", container.Name, err)
+	}
+
+	if err := client.Docker.StartExec(exec.ID, docker.StartExecOptions{
+		OutputStream: &cancelWriter{stdout, cancel},
+		ErrorStream:  &cancelWriter{stderr, cancel},
+	}); err != nil {
+		return 0, fmt.Errorf("Failed to start exec in container %s, error: %s", container.Name, err)
+	}
+
+	inspect, err := client.Docker.InspectExec(exec.ID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to inspect exec in container %s, error: %s", container.Name, err)
+	}
+
+	return inspect.ExitCode, nil
+}
+
+// errStreamCanceled is returned by cancelWriter once its cancel channel is closed
+var errStreamCanceled = errors.New("stream is canceled")
+
+// cancelWriter fails the writes once cancel is closed, so the stream copied to it,
+// e.g. the output of an exec session, is closed by the docker client
+type cancelWriter struct {
+	w      io.Writer
+	cancel <-chan struct{}
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.cancel:
+		return 0, errStreamCanceled
+	default:
+		return w.w.Write(p)
+	}
+}
+
+// sourceExec returns the function running env_from_exec commands inside the running container
+// of the given name, see sourceExecFunc
+func (client *DockerClient) sourceExec(name config.ContainerName) (execFunc, error) {
+	inspect, err := client.Docker.InspectContainer(client.naming().Format(name))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect container %s, error: %s", name, err)
+	}
+	if !inspect.State.Running {
+		return nil, fmt.Errorf("Container %s is not running, cannot exec env_from_exec command in it", name)
+	}
+
+	source := &Container{ID: inspect.ID, Name: &name}
+	return func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		var stdout, stderr bytes.Buffer
+		exitCode, err := client.execContainerStreams(source, cmd, &stdout, &stderr, cancel)
+		if exitCode != 0 {
+			return exitCode, stderr.String(), err
+		}
+		return exitCode, stdout.String(), err
+	}, nil
+}
+
 // EnsureContainerExist implements ensuring that container exists in docker daemon
 func (client *DockerClient) EnsureContainerExist(container *Container) error {
 	log.Infof("Checking container exist %s", container.Name)
-	if _, err := client.Docker.InspectContainer(container.Name.String()); err != nil {
+	if _, err := client.Docker.InspectContainer(container.DockerName()); err != nil {
 		return err
 	}
 	return nil
@@ -270,18 +708,19 @@ func (client *DockerClient) EnsureContainerExist(container *Container) error {
 // equals expected state specified in the spec.
 func (client *DockerClient) EnsureContainerState(container *Container) error {
 	log.Debugf("Checking container state %s", container.Name)
-	inspect, err := client.Docker.InspectContainer(container.Name.String())
+	inspect, err := client.Docker.InspectContainer(container.DockerName())
 	if err != nil {
 		return err
 	}
 	err = ErrContainerBadState{
-		Container:  container,
-		Running:    inspect.State.Running,
-		OOMKilled:  inspect.State.OOMKilled,
-		ExitCode:   inspect.State.ExitCode,
-		ErrorStr:   inspect.State.Error,
-		StartedAt:  inspect.State.StartedAt,
-		FinishedAt: inspect.State.FinishedAt,
+		Container:    container,
+		Running:      inspect.State.Running,
+		OOMKilled:    inspect.State.OOMKilled,
+		ExitCode:     inspect.State.ExitCode,
+		ErrorStr:     inspect.State.Error,
+		StartedAt:    inspect.State.StartedAt,
+		FinishedAt:   inspect.State.FinishedAt,
+		RestartCount: inspect.RestartCount,
 	}
 	log.Debugf("Container state for %s: %# v", container.Name, inspect.State)
 
@@ -398,7 +837,7 @@ func (client *DockerClient) AttachToContainer(container *Container) error {
 		defer container.Io.Done(err)
 
 		err = client.Docker.AttachToContainer(docker.AttachToContainerOptions{
-			Container:    container.Name.String(),
+			Container:    container.DockerName(),
 			OutputStream: container.Io.Stdout,
 			ErrorStream:  container.Io.Stderr,
 			Stdout:       true,
@@ -454,13 +893,13 @@ func (client *DockerClient) WaitForContainer(container *Container) (err error) {
 		inspect  *docker.Container
 		exitCode int
 	)
-	if inspect, err = client.Docker.InspectContainer(container.Name.String()); err != nil {
+	if inspect, err = client.Docker.InspectContainer(container.DockerName()); err != nil {
 		return
 	}
 	// Wait only if the container if not long-running and still not exited
 	if !container.Config.State.Bool() && inspect.State.Running == true {
 		log.Infof("Waiting container to finish %s", container.Name)
-		if exitCode, err = client.Docker.WaitContainer(container.Name.String()); err != nil {
+		if exitCode, err = client.Docker.WaitContainer(container.DockerName()); err != nil {
 			return
 		}
 	}
@@ -482,6 +921,15 @@ func (client *DockerClient) GetPulledImages() []*imagename.ImageName {
 	return client.pulledImages
 }
 
+// GetHostResources returns the total memory in bytes and the number of CPUs of the docker host
+func (client *DockerClient) GetHostResources() (memTotal int64, ncpu int, err error) {
+	info, err := client.Docker.Info()
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed to get docker info, error: %s", err)
+	}
+	return info.GetInt64("MemTotal"), info.GetInt("NCPU"), nil
+}
+
 // GetRemovedImages returns the list of images removed by a recent run
 func (client *DockerClient) GetRemovedImages() []*imagename.ImageName {
 	return client.removedImages
@@ -543,12 +991,9 @@ func (client *DockerClient) listenReAttach(containers []*Container) {
 					log.Errorf("Failed to inspect container %.12s, error: %s", event.ID, err)
 					return
 				}
-				eventContainer, err := NewContainerFromDocker(inspect)
+				eventContainer, err := NewContainerFromDocker(inspect, client.naming(), client.labelPrefix())
 				if err != nil {
-					// Ignore ErrNotRockerCompose error
-					if _, ok := err.(config.ErrNotRockerCompose); !ok {
-						log.Errorf("Failed to init container %.12s from Docker API, error: %s", event.ID, err)
-					}
+					log.Errorf("Failed to init container %.12s from Docker API, error: %s", event.ID, err)
 					return
 				}
 				// Look for such container in the namespace
@@ -589,7 +1034,7 @@ func (client *DockerClient) flushContainerLogs(container *Container) {
 	}
 
 	err2 := client.Docker.Logs(docker.LogsOptions{
-		Container:    container.Name.String(),
+		Container:    container.DockerName(),
 		OutputStream: container.Io.Stdout,
 		ErrorStream:  container.Io.Stderr,
 		Stdout:       true,
@@ -600,6 +1045,50 @@ func (client *DockerClient) flushContainerLogs(container *Container) {
 	}
 }
 
+// checkImagePlatform logs the architecture of the container's image and warns
+// if it differs from the platform declared for the container
+func checkImagePlatform(container *Container, img *docker.Image) {
+	log.Debugf("Image %s for %s has architecture %s", container.Image, container.Name, img.Architecture)
+
+	if mismatch := imagePlatformMismatch(container.Config.Platform, img); mismatch != "" {
+		log.Warnf("Image %s for container %s: %s", container.Image, container.Name, mismatch)
+	}
+}
+
+// imagePlatformMismatch compares the given platform (os/arch[/variant]) with the
+// inspected image and returns the description of the difference if any.
+// Only architecture is compared, because the image inspect does not give OS
+// and variant in the api version we use.
+func imagePlatformMismatch(platform string, img *docker.Image) string {
+	if platform == "" || img.Architecture == "" {
+		return ""
+	}
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || parts[1] == img.Architecture {
+		return ""
+	}
+	return fmt.Sprintf("expected platform %s, but the image has architecture %s", platform, img.Architecture)
+}
+
+// authForContainer returns auth configurations to be used for accessing the image of
+// the given container, the container's pull_secret takes precedence over the client auth
+func (client *DockerClient) authForContainer(container *Container) *docker.AuthConfigurations {
+	if container.PullAuth == nil {
+		return client.Auth
+	}
+
+	registry := container.Image.Registry
+	if registry == "" || registry == "registry-1.docker.io" {
+		registry = "index.docker.io"
+	}
+
+	return &docker.AuthConfigurations{
+		Configs: map[string]docker.AuthConfiguration{
+			registry: *container.PullAuth,
+		},
+	}
+}
+
 // pullImageForContainers goes through all containers and inspects their images
 // it pulls images if they cannot be found locally or forceUpdate flag is set to true
 func (client *DockerClient) pullImageForContainers(forceUpdate bool, vars template.Vars, containers ...*Container) (err error) {
@@ -608,42 +1097,211 @@ func (client *DockerClient) pullImageForContainers(forceUpdate bool, vars templa
 		return err
 	}
 
-	var (
-		img    *docker.Image
-		pulled = map[string]*docker.Image{}
-	)
-
-	// check images for each container
 	for _, container := range containers {
 		if container.Image == nil {
-			err = fmt.Errorf("Cannot find image for container %s", container.Name)
-			return
-		}
-		// already pulled it for other container, skip
-		if img, ok := pulled[container.Image.String()]; ok {
-			container.ImageID = img.ID
-			continue
+			return fmt.Errorf("Cannot find image for container %s", container.Name)
 		}
+	}
 
-		isSha := container.Image.TagIsSha()
+	concurrency := client.PullConcurrency
+	if concurrency < 1 {
+		concurrency = DefaultPullConcurrency
+	}
+	keys, _ := groupPulls(containers)
+	concurrent := concurrency > 1 && len(keys) > 1
 
-		if img, err = client.Docker.InspectImage(container.Image.String()); err == docker.ErrNoSuchImage || (forceUpdate && !isSha) {
-			log.Infof("Pulling image: %s for %s", container.Image, container.Name)
-			if img, err = PullDockerImage(client.Docker, container.Image, client.Auth); err != nil {
-				err = fmt.Errorf("Failed to pull image %s for container %s, error: %s", container.Image, container.Name, err)
-				return
+	var mutex sync.Mutex
+
+	images, err := fetchImages(containers, concurrency, func(sharing []*Container) (*docker.Image, error) {
+		container := sharing[0]
+		img, err := client.Docker.InspectImage(container.Image.String())
+		if err != nil && err != docker.ErrNoSuchImage {
+			return nil, err
+		}
+		missing := err == docker.ErrNoSuchImage
+		previousID := ""
+		if img != nil {
+			previousID = img.ID
+		}
+
+		pull := false
+		for _, c := range sharing {
+			needs, err := needsPull(c, forceUpdate, missing)
+			if err != nil {
+				return nil, err
 			}
-			client.pulledImages = append(client.pulledImages, container.Image)
+			pull = pull || needs
 		}
-		if err != nil {
-			return
+		if pull {
+			log.Infof("Pulling image: %s for %s", container.Image, containerNames(sharing))
+			client.OnEvent.emit(container, EventPulling)
+			img, err = pullWithTimeout(sharing, func(cancel <-chan struct{}) (*docker.Image, error) {
+				return pullDockerImage(client.Docker, container.Image, client.authForContainer(container), concurrent, cancel)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to pull image %s for container %s, error: %s", container.Image, container.Name, err)
+			}
+			// the pull of the tag that still points to the same image changes nothing
+			if img.ID != previousID {
+				mutex.Lock()
+				client.pulledImages = append(client.pulledImages, container.Image)
+				mutex.Unlock()
+			}
 		}
+		return img, nil
+	})
+	if err != nil {
+		return err
+	}
 
+	for _, container := range containers {
+		img := images[newPullKey(container)]
 		container.ImageID = img.ID
-		pulled[container.Image.String()] = img
+		checkImagePlatform(container, img)
 	}
 
-	return
+	return nil
+}
+
+// containerNames returns the comma separated names of the containers
+func containerNames(containers []*Container) string {
+	names := []string{}
+	for _, container := range containers {
+		names = append(names, container.Name.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// pullWithTimeout calls the pull function and gives up waiting for it after "pull_timeout"
+// of the containers sharing the pull, then the pull is canceled by closing the channel given to it.
+// The longest timeout is used, there is no limit if any of the containers does not set it.
+func pullWithTimeout(sharing []*Container, pull func(cancel <-chan struct{}) (*docker.Image, error)) (*docker.Image, error) {
+	var timeout time.Duration
+	for _, container := range sharing {
+		var limit time.Duration
+		if container.Config != nil {
+			limit = container.Config.PullTimeout.Get(0)
+		}
+		if limit <= 0 {
+			return pull(nil)
+		}
+		if limit > timeout {
+			timeout = limit
+		}
+	}
+	if timeout <= 0 {
+		return pull(nil)
+	}
+
+	type result struct {
+		img *docker.Image
+		err error
+	}
+	start := time.Now()
+	// buffered, so the canceled pull does not block on sending its result
+	done := make(chan result, 1)
+	cancel := make(chan struct{})
+	go func() {
+		img, err := pull(cancel)
+		done <- result{img, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.img, r.err
+	case <-time.After(timeout):
+		close(cancel)
+		elapsed := time.Since(start) / time.Millisecond * time.Millisecond
+		return nil, fmt.Errorf("pull_timeout %s exceeded, gave up after %s", timeout, elapsed)
+	}
+}
+
+// needsPull decides whether the image of the container should be pulled according to its pull
+// policy, forceUpdate (e.g. 'rocker-compose run -pull') makes it pull the images by tag anyway
+// unless the policy is "never"
+func needsPull(container *Container, forceUpdate, missing bool) (bool, error) {
+	policy := config.PullMissing
+	if container.Config != nil {
+		policy = container.Config.GetPullPolicy()
+	}
+
+	switch policy {
+	case config.PullNever:
+		if missing {
+			return false, fmt.Errorf("Container %s: image %s is not found and pull_policy is %s",
+				container.Name, container.Image, config.PullNever)
+		}
+		return false, nil
+	case config.PullAlways:
+		return true, nil
+	}
+	return missing || (forceUpdate && !container.Image.TagIsSha()), nil
+}
+
+// pullKey identifies the containers that share the pull of the image: the same
+// image pulled with the same registry auth, see Container.PullAuth
+type pullKey struct {
+	image string
+	auth  docker.AuthConfiguration
+}
+
+func newPullKey(container *Container) pullKey {
+	key := pullKey{image: container.Image.String()}
+	if container.PullAuth != nil {
+		key.auth = *container.PullAuth
+	}
+	return key
+}
+
+// groupPulls groups the containers by their pulls in the order of the containers
+func groupPulls(containers []*Container) ([]pullKey, map[pullKey][]*Container) {
+	keys := []pullKey{}
+	groups := map[pullKey][]*Container{}
+	for _, container := range containers {
+		key := newPullKey(container)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], container)
+	}
+	return keys, groups
+}
+
+// fetchImages calls fetch once for every distinct pull of the containers, with the containers
+// sharing it, running at most the given number of calls at the same time. It returns the images
+// by pull, or the error of the first failed pull in the order of the containers.
+func fetchImages(containers []*Container, concurrency int, fetch func(sharing []*Container) (*docker.Image, error)) (map[pullKey]*docker.Image, error) {
+	var (
+		keys, groups = groupPulls(containers)
+		images       = map[pullKey]*docker.Image{}
+		errors       = map[pullKey]error{}
+		mutex        sync.Mutex
+		wg           sync.WaitGroup
+		sem          = make(chan struct{}, concurrency)
+	)
+
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key pullKey) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			img, err := fetch(groups[key])
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			images[key], errors[key] = img, err
+		}(key)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if errors[key] != nil {
+			return nil, errors[key]
+		}
+	}
+	return images, nil
 }
 
 // resolveVersions walks through the list of images and resolves their tags in case they are not strict
@@ -728,7 +1386,7 @@ func (client *DockerClient) resolveVersions(local, hub bool, vars template.Vars,
 				s3storage := s3.New(client.Docker, os.TempDir())
 				remote, err = s3storage.ListTags(container.Image.String())
 			} else {
-				remote, err = dockerclient.RegistryListTags(container.Image, client.Auth)
+				remote, err = dockerclient.RegistryListTags(container.Image, client.authForContainer(container))
 			}
 
 			if err != nil {
@@ -17,14 +17,20 @@
 package compose
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/grammarly/rocker-compose/src/compose/config"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/fsouza/go-dockerclient"
+	dtesting "github.com/fsouza/go-dockerclient/testing"
 	"github.com/grammarly/rocker/src/dockerclient"
 	"github.com/grammarly/rocker/src/imagename"
 	"github.com/grammarly/rocker/src/rocker/test"
@@ -241,3 +247,584 @@ func TestClientResolveVersions(t *testing.T) {
 
 	pretty.Println(containers)
 }
+
+func TestClientAuthForContainer(t *testing.T) {
+	configStr := `namespace: test
+credentials:
+  private:
+    username: robot
+    password: secret
+containers:
+  public:
+    image: ubuntu:14.04
+  private:
+    image: registry.example.com/app:1.0
+    pull_secret: private`
+
+	cfg, err := config.ReadConfig("test", strings.NewReader(configStr), template.Vars{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientAuth := &docker.AuthConfigurations{
+		Configs: map[string]docker.AuthConfiguration{
+			"registry.example.com": {Username: "global"},
+		},
+	}
+	client := &DockerClient{Auth: clientAuth}
+
+	for _, container := range GetContainersFromConfig(cfg) {
+		auth := client.authForContainer(container)
+
+		switch container.Name.Name {
+		case "public":
+			assert.Equal(t, clientAuth, auth)
+		case "private":
+			repoAuth, err := dockerclient.GetAuthForRegistry(auth, container.Image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "robot", repoAuth.Username)
+			assert.Equal(t, "secret", repoAuth.Password)
+		}
+	}
+}
+
+func TestRemoveContainerOptions(t *testing.T) {
+	container := newContainer("test", "main")
+	assert.Equal(t, docker.RemoveContainerOptions{ID: "123", RemoveVolumes: true, Force: true},
+		removeContainerOptions("123", container))
+
+	keep := true
+	container.Config.KeepVolumes = &keep
+	assert.Equal(t, docker.RemoveContainerOptions{ID: "123", Force: true}, removeContainerOptions("123", container),
+		"volumes should be kept with keep_volumes")
+}
+
+func TestClientCheckLeftover(t *testing.T) {
+	name := &config.ContainerName{Namespace: "test", Name: "main"}
+
+	stopped := &docker.Container{
+		ID:     "leftover",
+		Config: &docker.Config{Labels: map[string]string{"rocker-compose-id": "1", "rocker-compose-namespace": "test"}},
+	}
+	assert.NoError(t, checkLeftover(stopped, name, false, config.DefaultLabelPrefix))
+
+	// containers created before the namespace label was introduced
+	legacy := &docker.Container{
+		ID:     "leftover",
+		Config: &docker.Config{Labels: map[string]string{"rocker-compose-id": "1"}},
+	}
+	assert.NoError(t, checkLeftover(legacy, name, false, config.DefaultLabelPrefix))
+
+	running := &docker.Container{
+		ID:     "leftover",
+		State:  docker.State{Running: true},
+		Config: stopped.Config,
+	}
+	assert.EqualError(t, checkLeftover(running, name, false, config.DefaultLabelPrefix),
+		"Cannot create container test.main: container with the same name is running, id:leftover")
+	assert.NoError(t, checkLeftover(running, name, true, config.DefaultLabelPrefix))
+
+	for _, unmanaged := range []*docker.Container{
+		&docker.Container{ID: "unmanaged", Config: &docker.Config{}},
+		&docker.Container{ID: "unmanaged", Config: &docker.Config{Labels: map[string]string{"rocker-compose-id": "1", "rocker-compose-namespace": "other"}}},
+	} {
+		assert.EqualError(t, checkLeftover(unmanaged, name, false, config.DefaultLabelPrefix),
+			"Cannot create container test.main: container with the same name is not managed by rocker-compose, id:unmanaged")
+		assert.NoError(t, checkLeftover(unmanaged, name, true, config.DefaultLabelPrefix))
+	}
+}
+
+func TestClientImagePlatformMismatch(t *testing.T) {
+	img := &docker.Image{ID: "123", Architecture: "arm64"}
+
+	assert.Equal(t, "", imagePlatformMismatch("", img))
+	assert.Equal(t, "", imagePlatformMismatch("linux/arm64", img))
+	assert.Equal(t, "", imagePlatformMismatch("linux/amd64", &docker.Image{ID: "123"}))
+	assert.Equal(t, "expected platform linux/amd64, but the image has architecture arm64",
+		imagePlatformMismatch("linux/amd64", img))
+	assert.Equal(t, "expected platform linux/arm/v7, but the image has architecture arm64",
+		imagePlatformMismatch("linux/arm/v7", img))
+}
+
+func TestClientSubpathBinds(t *testing.T) {
+	container := &Container{
+		Name: config.NewContainerName("test", "main"),
+		Config: &config.Container{
+			Mounts: []config.Mount{
+				{Source: "/opt/etc", Target: "/etc/app"},
+				{Volume: "cache", Target: "/cache"},
+				{Volume: "data", Subpath: "sub", Target: "/data", ReadOnly: true},
+			},
+		},
+	}
+	inspect := func(name string) (*docker.Volume, error) {
+		if name != "data" {
+			return nil, docker.ErrNoSuchVolume
+		}
+		return &docker.Volume{Name: name, Mountpoint: "/var/lib/docker/volumes/data/_data"}, nil
+	}
+
+	binds, err := subpathBinds(container, inspect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"/var/lib/docker/volumes/data/_data/sub:/data:ro"}, binds)
+
+	container.Config.Mounts[2].Volume = "missing"
+	_, err = subpathBinds(container, inspect)
+	assert.EqualError(t, err, "Container test.main: volume missing is not found, it should exist to mount subpath sub")
+}
+
+func TestClientRedactCreateOptions(t *testing.T) {
+	image := "nginx:1.9"
+	logDriver := "splunk"
+	container := NewContainerFromConfig(config.NewContainerName("test", "web"), &config.Container{
+		Image:     &image,
+		Env:       config.StringMap{"PORT": "80", "DB_PASSWORD": "qwerty"},
+		Labels:    config.StringMap{"app.api_token": "abc123"},
+		LogDriver: &logDriver,
+		LogOpt:    config.StringMap{"splunk-token": "s3cr3t", "splunk-url": "https://splunk:8088"},
+		SecretEnv: config.Strings{"*-TOKEN"},
+	})
+
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redacted := redactCreateOptions(container, opts, config.DefaultLabelPrefix)
+	for _, secret := range []string{"qwerty", "abc123", "s3cr3t"} {
+		assert.NotContains(t, fmt.Sprintf("%# v", pretty.Formatter(redacted)), secret)
+	}
+	assert.Contains(t, redacted.Config.Env, "DB_PASSWORD="+config.RedactedValue)
+	assert.Contains(t, redacted.Config.Env, "PORT=80")
+	assert.Equal(t, config.RedactedValue, redacted.Config.Labels["app.api_token"])
+	assert.Equal(t, "https://splunk:8088", redacted.HostConfig.LogConfig.Config["splunk-url"])
+
+	// the actual options are applied to the container as is
+	assert.Contains(t, opts.Config.Env, "DB_PASSWORD=qwerty")
+	assert.Contains(t, opts.Config.Labels["rocker-compose-config"], "qwerty")
+	assert.Equal(t, "abc123", opts.Config.Labels["app.api_token"])
+	assert.Equal(t, "s3cr3t", opts.HostConfig.LogConfig.Config["splunk-token"])
+	assert.Equal(t, "qwerty", container.Config.Env["DB_PASSWORD"])
+}
+
+func TestClientRedactAuth(t *testing.T) {
+	auth := &docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{
+		"quay.io": {Username: "deploy", Password: "hunter2"},
+	}}
+
+	redacted := redactAuth(auth)
+	assert.NotContains(t, pretty.Sprintf("%# v", redacted), "hunter2")
+	assert.Equal(t, "deploy", redacted.Configs["quay.io"].Username)
+	assert.Equal(t, "hunter2", auth.Configs["quay.io"].Password)
+	assert.Nil(t, redactAuth(nil))
+}
+
+func TestDryRunnerRedacted(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.StandardLogger()
+	output, level := logger.Out, logger.Level
+	defer func() {
+		logger.Out, logger.Level = output, level
+	}()
+	logger.Out, logger.Level = &out, log.DebugLevel
+
+	newContainer := func(password string) *Container {
+		return &Container{
+			State:  &ContainerState{Running: true},
+			Name:   config.NewContainerName("test", "db"),
+			Config: &config.Container{Env: config.StringMap{"DB_PASSWORD": password}},
+		}
+	}
+
+	// the plan and the diff leading to it are printed without the env values
+	actions, err := NewDiff("test").Diff([]*Container{newContainer("qwerty")}, []*Container{newContainer("hunter2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDryRunner().Run(actions); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, out.String(), "found difference in 'Env'")
+	assert.Contains(t, out.String(), "[DRY] Running")
+	for _, secret := range []string{"qwerty", "hunter2"} {
+		assert.NotContains(t, out.String(), secret)
+	}
+}
+
+func TestClientFetchImagesDedup(t *testing.T) {
+	newContainer := func(name, image string) *Container {
+		return &Container{Name: config.NewContainerName("test", name), Image: imagename.NewFromString(image)}
+	}
+	containers := []*Container{
+		newContainer("web1", "nginx:1.9"),
+		newContainer("web2", "nginx:1.9"),
+		newContainer("db", "postgres:9.4"),
+		newContainer("private", "nginx:1.9"),
+	}
+	// the container pulling with its own credentials does not share the pull
+	containers[3].PullAuth = &docker.AuthConfiguration{Username: "deploy"}
+
+	var (
+		mutex   sync.Mutex
+		fetched = []string{}
+	)
+	images, err := fetchImages(containers, 2, func(sharing []*Container) (*docker.Image, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		fetched = append(fetched, containerNames(sharing))
+		return &docker.Image{ID: sharing[0].Name.Name}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(fetched)
+	assert.Equal(t, []string{"test.db", "test.private", "test.web1, test.web2"}, fetched)
+	assert.Equal(t, "web1", images[newPullKey(containers[1])].ID)
+	assert.Equal(t, "private", images[newPullKey(containers[3])].ID)
+	assert.Equal(t, "db", images[newPullKey(containers[2])].ID)
+}
+
+func TestClientFetchImagesConcurrency(t *testing.T) {
+	containers := []*Container{}
+	for i := 0; i < 10; i++ {
+		containers = append(containers, &Container{
+			Name:  config.NewContainerName("test", fmt.Sprintf("app%d", i)),
+			Image: imagename.NewFromString(fmt.Sprintf("app%d:1.0", i)),
+		})
+	}
+
+	var running, maxRunning int32
+	_, err := fetchImages(containers, 3, func(sharing []*Container) (*docker.Image, error) {
+		container := sharing[0]
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if container.Name.Name == "app7" || container.Name.Name == "app4" {
+			return nil, fmt.Errorf("%s failed", container.Name.Name)
+		}
+		return &docker.Image{ID: container.Name.Name}, nil
+	})
+
+	assert.EqualError(t, err, "app4 failed", "should report the first failed image")
+	assert.True(t, maxRunning > 1, "should pull in parallel")
+	assert.True(t, maxRunning <= 3, "should not pull more than 3 images at once, got %d", maxRunning)
+}
+
+func TestClientNeedsPull(t *testing.T) {
+	newContainer := func(image, policy string) *Container {
+		return &Container{
+			Name:   config.NewContainerName("test", "main"),
+			Image:  imagename.NewFromString(image),
+			Config: &config.Container{Image: &image, PullPolicy: policy},
+		}
+	}
+	digest := "nginx@sha256:ead434cd278824865d6e3b67e5d4579ded02eb2e8367fc165efa21138b225f11"
+
+	cases := []struct {
+		container   *Container
+		forceUpdate bool
+		missing     bool
+		pull        bool
+	}{
+		{newContainer("nginx:latest", ""), false, false, true},
+		{newContainer("nginx:1.9", ""), false, false, true},
+		{newContainer("nginx:1.9", "missing"), false, false, false},
+		{newContainer("nginx:1.9", "missing"), false, true, true},
+		{newContainer("nginx:1.9", "missing"), true, false, true},
+		{newContainer(digest, ""), false, false, false},
+		{newContainer(digest, ""), true, false, false},
+		{newContainer(digest, ""), false, true, true},
+		{newContainer("nginx:1.9", "always"), false, false, true},
+		{newContainer("nginx:latest", "missing"), false, false, false},
+		{newContainer("nginx:latest", "never"), true, false, false},
+	}
+
+	for i, c := range cases {
+		pull, err := needsPull(c.container, c.forceUpdate, c.missing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.pull, pull, "case #%d: %s", i, c.container.Image)
+	}
+
+	_, err := needsPull(newContainer("nginx:1.9", "never"), false, true)
+	assert.EqualError(t, err, "Container test.main: image nginx:1.9 is not found and pull_policy is never")
+}
+
+func TestClientPullTimeout(t *testing.T) {
+	timeout := config.Duration(50 * time.Millisecond)
+	container := &Container{
+		Name:   config.NewContainerName("test", "main"),
+		Config: &config.Container{PullTimeout: &timeout},
+	}
+
+	canceled := make(chan struct{})
+	slowPull := func(cancel <-chan struct{}) (*docker.Image, error) {
+		select {
+		case <-cancel:
+			close(canceled)
+			return nil, errStreamCanceled
+		case <-time.After(time.Second):
+			return &docker.Image{ID: "slow"}, nil
+		}
+	}
+	start := time.Now()
+	_, err := pullWithTimeout([]*Container{container}, slowPull)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "pull_timeout 50ms exceeded, gave up after 5")
+	}
+	assert.True(t, time.Since(start) < time.Second, "should not wait for the pull")
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("pull should be canceled after the timeout")
+	}
+
+	// the pull within the timeout
+	img, err := pullWithTimeout([]*Container{container}, func(cancel <-chan struct{}) (*docker.Image, error) {
+		return &docker.Image{ID: "fast"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "fast", img.ID)
+
+	// the longest timeout of the containers sharing the pull is used
+	longer := config.Duration(100 * time.Millisecond)
+	other := &Container{
+		Name:   config.NewContainerName("test", "other"),
+		Image:  container.Image,
+		Config: &config.Container{PullTimeout: &longer},
+	}
+	_, err = pullWithTimeout([]*Container{container, other}, func(cancel <-chan struct{}) (*docker.Image, error) {
+		<-cancel
+		return nil, errStreamCanceled
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "pull_timeout 100ms exceeded")
+	}
+
+	// no limit if one of them does not set it
+	other.Config.PullTimeout = nil
+	img, err = pullWithTimeout([]*Container{container, other}, func(cancel <-chan struct{}) (*docker.Image, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &docker.Image{ID: "shared"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "shared", img.ID)
+
+	// no timeout given
+	container.Config.PullTimeout = nil
+	img, err = pullWithTimeout([]*Container{container}, func(cancel <-chan struct{}) (*docker.Image, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &docker.Image{ID: "slow"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "slow", img.ID)
+}
+
+func TestClientFetchImagesRecordsChangedPulls(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	dockerCli, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dockerCli.PullImage(docker.PullImageOptions{Repository: "app:1.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+
+	image := "app:1.0"
+	newContainers := func() []*Container {
+		return []*Container{NewContainerFromConfig(config.NewContainerName("test", "main"), &config.Container{Image: &image})}
+	}
+
+	// the test server gives the image a new id on every pull
+	client, err := NewClient(&DockerClient{Docker: dockerCli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.FetchImages(newContainers(), template.Vars{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, client.GetPulledImages(), 1, "the pull changing the image should be recorded")
+
+	// the tag still points to the same image after the pull
+	server.CustomHandler("/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	client, err = NewClient(&DockerClient{Docker: dockerCli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.FetchImages(newContainers(), template.Vars{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, client.GetPulledImages(), "the pull of the unchanged image should not be recorded")
+}
+
+func TestClientGetContainersAdopted(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	dockerCli, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dockerCli.PullImage(docker.PullImageOptions{Repository: "app:1.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// containers started by `docker run`, only the ones named within a namespace are adopted
+	for _, name := range []string{"test.main", "test.db", "test.cache", "other"} {
+		if _, err := dockerCli.CreateContainer(docker.CreateContainerOptions{
+			Name:   name,
+			Config: &docker.Config{Image: "app:1.0", Cmd: []string{"serve"}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := NewClient(&DockerClient{Docker: dockerCli})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := client.GetContainers(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adopted := []string{}
+	for _, container := range containers {
+		assert.True(t, container.Adopted, container.Name.String())
+		adopted = append(adopted, container.Name.String())
+	}
+	sort.Strings(adopted)
+	assert.Equal(t, []string{"test.cache", "test.db", "test.main"}, adopted)
+
+	// all containers are fetched for the manifests referring to other namespaces
+	containers, err = client.GetContainers(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, containers, 4)
+}
+
+func TestClientGetContainersNaming(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	dockerCli, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dockerCli.PullImage(docker.PullImageOptions{Repository: "app:1.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dockerCli.CreateContainer(docker.CreateContainerOptions{
+		Name:   "test_web_api",
+		Config: &docker.Config{Image: "app:1.0"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := config.ReadConfig("test", strings.NewReader(`namespace: test
+naming: underscore
+containers:
+  web_api:
+    image: app:1.0`), map[string]interface{}{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client parses the names with the naming strategy of the manifest
+	compose, err := New(&Config{Manifest: manifest, Docker: dockerCli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers, err := compose.client.GetContainers(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, containers, 1) {
+		assert.Equal(t, config.NewContainerName("test", "web_api"), containers[0].Name)
+		assert.Equal(t, "test_web_api", containers[0].DockerName())
+	}
+
+	// the new containers are named with it as well
+	container := GetContainersFromConfig(manifest)[0]
+	assert.Equal(t, "test.web_api", container.Name.String())
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "test_web_api", opts.Name)
+}
+
+func TestIsAdoptionCandidateLabelPrefix(t *testing.T) {
+	managed := docker.APIContainers{Names: []string{"/main"}, Labels: map[string]string{"myorg-compose-id": "1"}}
+	assert.True(t, isAdoptionCandidate(managed, config.DotNaming, "myorg-compose-"))
+	assert.False(t, isAdoptionCandidate(managed, config.DotNaming, config.DefaultLabelPrefix),
+		"containers managed with another prefix should not be fetched")
+}
+
+func TestNewLabelPrefix(t *testing.T) {
+	manifest, err := config.ReadConfig("test", strings.NewReader(`namespace: test
+containers:
+  main:
+    image: app:1.0
+    labels:
+      app: main
+      myorg-compose-id: "1"`), map[string]interface{}{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compose, err := New(&Config{Manifest: manifest, LabelPrefix: "myorg-compose-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, config.LabelPrefix("myorg-compose-"), compose.client.(*DockerClient).labelPrefix())
+	assert.Equal(t, config.StringMap{"app": "main"}, manifest.Containers["main"].Labels,
+		"the labels managed with the prefix should be stripped from the manifest")
+}
+
+func TestNewRestartOverride(t *testing.T) {
+	manifest, err := config.ReadConfig("test", strings.NewReader(`namespace: test
+containers:
+  main:
+    image: app:1.0
+    restart: always`), map[string]interface{}{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(&Config{Manifest: manifest, RestartOverride: &config.RestartPolicy{Name: "no"}}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &config.RestartPolicy{Name: "no"}, manifest.Containers["main"].Restart)
+}
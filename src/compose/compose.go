@@ -36,17 +36,28 @@ import (
 // Config is a configuration object which is passed to compose.New()
 // for creating the new Compose instance.
 type Config struct {
-	Manifest   *config.Config
-	Docker     *docker.Client
-	Force      bool
-	DryRun     bool
-	Attach     bool
-	Pull       bool
-	Remove     bool
-	Recover    bool
-	Wait       time.Duration
-	Auth       *docker.AuthConfigurations
-	KeepImages int
+	Manifest         *config.Config
+	Docker           *docker.Client
+	Force            bool
+	DryRun           bool
+	Attach           bool
+	Pull             bool
+	Remove           bool
+	Recover          bool
+	Wait             time.Duration
+	Auth             *docker.AuthConfigurations
+	KeepImages       int
+	Confirm          ConfirmFunc
+	Metadata         map[string]string
+	Environment      string                // see Compose.Environment
+	PullConcurrency  int                   // see DockerClient.PullConcurrency
+	Rollback         bool                  // see Compose.Rollback
+	Only             []string              // see Compose.Only
+	RecreateOn       []string              // see Compose.RecreateOn
+	ImageConcurrency int                   // see Compose.ImageConcurrency
+	OnEvent          EventFunc             // see Compose.OnEvent
+	LabelPrefix      config.LabelPrefix    // see DockerClient.LabelPrefix
+	RestartOverride  *config.RestartPolicy // see config.OverrideRestart
 }
 
 // Compose is the main object that executes actions and holds runtime information.
@@ -57,35 +68,87 @@ type Compose struct {
 	Pull     bool
 	Remove   bool
 	Wait     time.Duration
+	Confirm  ConfirmFunc
+	Metadata map[string]string
+
+	// Environment, e.g. prod or staging, created containers are labeled with;
+	// containers of other environments on the same host are left intact
+	Environment string
+
+	// Rollback reverts the changes made to containers if the run fails partway:
+	// containers created during the run are removed and the previous ones are recreated
+	Rollback bool
+
+	// Only is the list of containers a partial run is narrowed down to, the rest
+	// of the containers of the manifest are left as they are, see selectContainers
+	Only []string
+
+	// RecreateOn limits the properties which changes recreate the containers, changes
+	// of the other ones are ignored; all properties are compared if it is empty
+	RecreateOn []string
+
+	// ImageConcurrency limits the number of containers of the same image started
+	// at the same time, no limit if it is not set, see imageLimitClient
+	ImageConcurrency int
+
+	// OnEvent is called with the lifecycle transitions of the containers, e.g. pulling or creating,
+	// the containers of the manifest that are left as they are are reported as skipped
+	OnEvent EventFunc
+
+	// Force recreates the containers that were not created by rocker-compose and differ
+	// from the manifest, they are left as they are otherwise, see Container.Adopted
+	Force bool
 
 	client             Client
 	chErrors           chan error
 	attachedContainers map[string]struct{}
 	executionPlan      []Action
+	metrics            *Metrics
 }
 
 // New makes a new Compose object
 func New(config *Config) (*Compose, error) {
 	compose := &Compose{
-		Manifest: config.Manifest,
-		DryRun:   config.DryRun,
-		Attach:   config.Attach,
-		Pull:     config.Pull,
-		Wait:     config.Wait,
-		Remove:   config.Remove,
+		Manifest:         config.Manifest,
+		DryRun:           config.DryRun,
+		Attach:           config.Attach,
+		Pull:             config.Pull,
+		Wait:             config.Wait,
+		Remove:           config.Remove,
+		Confirm:          config.Confirm,
+		Metadata:         config.Metadata,
+		Environment:      config.Environment,
+		Rollback:         config.Rollback,
+		Only:             config.Only,
+		RecreateOn:       config.RecreateOn,
+		OnEvent:          config.OnEvent,
+		ImageConcurrency: config.ImageConcurrency,
+		Force:            config.Force,
 	}
 
 	cliConf := &DockerClient{
-		Docker:     config.Docker,
-		Attach:     config.Attach,
-		Wait:       config.Wait,
-		Auth:       config.Auth,
-		KeepImages: config.KeepImages,
-		Recover:    config.Recover,
+		Docker:          config.Docker,
+		Attach:          config.Attach,
+		Wait:            config.Wait,
+		Auth:            config.Auth,
+		KeepImages:      config.KeepImages,
+		Recover:         config.Recover,
+		Force:           config.Force,
+		PullConcurrency: config.PullConcurrency,
+		OnEvent:         config.OnEvent,
+		LabelPrefix:     config.LabelPrefix,
+	}
+
+	// the docker containers are named with the naming strategy of the manifest
+	if config.Manifest != nil {
+		cliConf.Naming = config.Manifest.GetNaming()
+		prepareManifest(config.Manifest, cliConf.labelPrefix(), config.RestartOverride)
 	}
 
 	cli, err := NewClient(cliConf)
 	if err != nil {
+		// the client is not used anymore, so its credentials are replaced before printing
+		cliConf.Auth = redactAuth(cliConf.Auth)
 		return nil, fmt.Errorf("Compose client initialization failed with error '%s' and config:\n%s", err,
 			pretty.Sprintf("%# v", cliConf))
 	}
@@ -95,12 +158,81 @@ func New(config *Config) (*Compose, error) {
 	return compose, nil
 }
 
+// prepareManifest applies the options of the run to the manifest, the same way for New and Apply:
+// the manifest cannot override the managed labels of the prefix, see config.StripManagedLabels,
+// and the restart policy of its containers is replaced by the override if it is given
+func prepareManifest(manifest *config.Config, prefix config.LabelPrefix, restartOverride *config.RestartPolicy) {
+	manifest.StripManagedLabels(prefix)
+	if restartOverride != nil {
+		manifest.OverrideRestart(restartOverride)
+	}
+}
+
 // RunAction implements 'rocker-compose run'
 func (compose *Compose) RunAction() error {
+	expected, err := compose.reconcile(nil)
+	if err != nil {
+		return err
+	}
+
+	strContainers := []string{}
+	for _, container := range expected {
+		// TODO: map ids for already existing containers
+		// strContainers = append(strContainers, fmt.Sprintf("%s (id: %s)", container.Name, util.TruncateID(container.Id)))
+		strContainers = append(strContainers, container.Name.String())
+	}
+
+	if len(strContainers) > 0 {
+		log.Infof("OK, containers are running: %s", strings.Join(strContainers, ", "))
+	} else {
+		log.Infof("Nothing is running")
+	}
+
+	// if --attach was specified
+	if compose.Attach {
+		log.Debugf("Attaching to containers...")
+		if err := compose.client.AttachToContainers(expected); err != nil {
+			return fmt.Errorf("Cannot attach to containers, error: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// reconcile fetches the actual containers list, compares it with the manifest
+// and runs the resulting execution plan. It returns the list of expected containers,
+// narrowed down to the ones given to --only if it was specified.
+// Statistics of the run are collected to compose.metrics.
+// The run is stopped with ErrCanceled between the steps once cancel is closed.
+func (compose *Compose) reconcile(cancel <-chan struct{}) (_ []*Container, err error) {
+	metrics := NewMetrics(compose.Manifest.Namespace)
+	compose.metrics = metrics
+
+	start := time.Now()
+	defer func() {
+		metrics.Duration = time.Since(start)
+		metrics.Success = err == nil
+	}()
+
+	if err := config.ValidateRecreateOn(compose.RecreateOn); err != nil {
+		return nil, err
+	}
+
+	// memory and cpus given as percentages depend on the docker host
+	if compose.Manifest.HasHostPercents() {
+		memTotal, ncpu, err := compose.client.GetHostResources()
+		if err != nil {
+			return nil, err
+		}
+		if err := compose.Manifest.ResolveHostPercents(memTotal, ncpu); err != nil {
+			return nil, err
+		}
+	}
+
 	// get the actual list of existing containers from docker client
 	actual, err := compose.client.GetContainers(compose.Manifest.HasExternalRefs())
 	if err != nil {
-		return fmt.Errorf("GetContainers failed with error, error: %s", err)
+		return nil, fmt.Errorf("GetContainers failed with error, error: %s", err)
 	}
 
 	expected := []*Container{}
@@ -109,64 +241,105 @@ func (compose *Compose) RunAction() error {
 	if !compose.Remove {
 		expected = GetContainersFromConfig(compose.Manifest)
 	}
+	for _, container := range expected {
+		container.Metadata = compose.Metadata
+		container.Environment = compose.Environment
+		container.RecreateOn = compose.RecreateOn
+	}
+
+	if actual, err = scopeEnvironment(compose.Environment, expected, actual); err != nil {
+		return nil, err
+	}
+
+	// if --only was specified, the other containers are substituted with the existing ones
+	all, selected := expected, expected
+	if len(compose.Only) > 0 {
+		if compose.Remove {
+			return nil, fmt.Errorf("--only cannot be used with --remove")
+		}
+		if expected, selected, err = selectContainers(compose.Manifest.Namespace, compose.Only, expected, actual); err != nil {
+			return nil, err
+		}
+	}
+	warning, err := labelFileHash(compose.Manifest, len(compose.Only) > 0, all, selected, actual)
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" {
+		log.Warnf("%s", warning)
+	}
+
+	if err := checkCanceled(cancel); err != nil {
+		return nil, err
+	}
 
 	// if --pull is specified PullAll, otherwise Fetch required
 	if compose.Pull {
-		if err := compose.client.PullAll(expected, compose.Manifest.Vars); err != nil {
-			return err
+		if err := compose.client.PullAll(selected, compose.Manifest.Vars); err != nil {
+			return nil, err
 		}
-	} else if err := compose.client.FetchImages(expected, compose.Manifest.Vars); err != nil {
-		return fmt.Errorf("Failed to fetch images of given containers, error: %s", err)
+	} else if err := compose.client.FetchImages(selected, compose.Manifest.Vars); err != nil {
+		return nil, fmt.Errorf("Failed to fetch images of given containers, error: %s", err)
 	}
 
-	// Assign IDs of existing containers
+	// Assign IDs of existing containers, report the ones that stopped unexpectedly
 	for _, actualC := range actual {
 		for _, expectedC := range expected {
 			if expectedC.IsSameKind(actualC) {
 				expectedC.ID = actualC.ID
+				if expectedC.State.Running && !actualC.State.Running {
+					log.Warnf("Container %s is not running, it %s", actualC.Name, actualC.State.FailureReport())
+				}
 			}
 		}
 	}
 
-	executionPlan, err := NewDiff(compose.Manifest.Namespace).Diff(expected, actual)
+	executionPlan, err := newDiff(compose.Manifest.Namespace, compose.Force).Diff(expected, actual)
 	if err != nil {
-		return fmt.Errorf("Diff of configuration failed, error: %s", err)
+		return nil, fmt.Errorf("Diff of configuration failed, error: %s", err)
 	}
 	compose.executionPlan = executionPlan
+	metrics.countPlan(executionPlan, expected)
 
-	var runner Runner
+	if err := checkCanceled(cancel); err != nil {
+		return nil, err
+	}
+
+	var (
+		runner  Runner
+		journal *rollbackClient
+	)
 	if compose.DryRun {
 		runner = NewDryRunner()
 	} else {
-		runner = NewDockerClientRunner(compose.client)
+		if err := confirmPlan(executionPlan, compose.Confirm); err != nil {
+			return nil, err
+		}
+		// nothing is changed in dry run mode, so no events are reported either
+		compose.OnEvent.emitSkipped(executionPlan, selected)
+		client := compose.client
+		if compose.Rollback {
+			journal = newRollbackClient(client)
+			client = journal
+		}
+		if compose.ImageConcurrency > 0 {
+			client = newImageLimitClient(client, compose.ImageConcurrency)
+		}
+		runner = NewDockerClientRunner(client)
+		executionPlan = metrics.instrument(executionPlan)
 	}
 
 	if err := runner.Run(executionPlan); err != nil {
-		return fmt.Errorf("Execution failed with, error: %s", err)
-	}
-
-	strContainers := []string{}
-	for _, container := range expected {
-		// TODO: map ids for already existing containers
-		// strContainers = append(strContainers, fmt.Sprintf("%s (id: %s)", container.Name, util.TruncateID(container.Id)))
-		strContainers = append(strContainers, container.Name.String())
-	}
-
-	if len(strContainers) > 0 {
-		log.Infof("OK, containers are running: %s", strings.Join(strContainers, ", "))
-	} else {
-		log.Infof("Nothing is running")
-	}
-
-	// if --attach was specified
-	if compose.Attach {
-		log.Debugf("Attaching to containers...")
-		if err := compose.client.AttachToContainers(expected); err != nil {
-			return fmt.Errorf("Cannot attach to containers, error: %s", err)
+		if journal != nil {
+			log.Errorf("Execution failed, rolling back the changes, error: %s", err)
+			if rollbackErr := journal.rollback(); rollbackErr != nil {
+				return nil, fmt.Errorf("Execution failed with, error: %s; %s", err, rollbackErr)
+			}
 		}
+		return nil, fmt.Errorf("Execution failed with, error: %s", err)
 	}
 
-	return nil
+	return selected, nil
 }
 
 // RecoverAction implements 'rocker-compose recover'
@@ -258,6 +431,21 @@ func (compose *Compose) PinAction(local, hub bool) (template.Vars, error) {
 	return vars, nil
 }
 
+// GraphAction implements 'rocker-compose graph', it returns the dependency graph
+// of the manifest in DOT format. Docker is only queried if the manifest refers
+// to containers of other namespaces.
+func (compose *Compose) GraphAction() (string, error) {
+	actual := []*Container{}
+	if compose.Manifest.HasExternalRefs() {
+		var err error
+		if actual, err = compose.client.GetContainers(true); err != nil {
+			return "", fmt.Errorf("GetContainers failed with error, error: %s", err)
+		}
+	}
+
+	return DependencyGraphDOT(compose.Manifest.Namespace, GetContainersFromConfig(compose.Manifest), actual)
+}
+
 // WritePlan saves various rocker-compose change information to the ansible.Response object
 // TODO: should compose know about ansible.Response at all?
 //       maybe it should give some data struct back to main?
@@ -267,30 +455,27 @@ func (compose *Compose) WritePlan(resp *ansible.Response) *ansible.Response {
 	resp.Pulled = []string{}
 	resp.Cleaned = []string{}
 
-	WalkActions(compose.executionPlan, func(action Action) {
-		if a, ok := action.(*removeContainer); ok {
-			resp.Removed = append(resp.Removed, ansible.ResponseContainer{
-				ID:   a.container.ID,
-				Name: a.container.Name.String(),
-			})
-		}
-		if a, ok := action.(*runContainer); ok {
-			resp.Created = append(resp.Created, ansible.ResponseContainer{
-				ID:   a.container.ID,
-				Name: a.container.Name.String(),
-			})
-		}
-	})
+	result := compose.Result()
 
-	// TODO: images are pulled but may not be changed
-	for _, imageName := range compose.client.GetPulledImages() {
+	for _, container := range result.Removed {
+		resp.Removed = append(resp.Removed, ansible.ResponseContainer{
+			ID:   container.ID,
+			Name: container.Name.String(),
+		})
+	}
+	for _, container := range result.Created {
+		resp.Created = append(resp.Created, ansible.ResponseContainer{
+			ID:   container.ID,
+			Name: container.Name.String(),
+		})
+	}
+	for _, imageName := range result.Pulled {
 		resp.Pulled = append(resp.Pulled, imageName.String())
 	}
-
-	for _, imageName := range compose.client.GetRemovedImages() {
+	for _, imageName := range result.Cleaned {
 		resp.Cleaned = append(resp.Cleaned, imageName.String())
 	}
 
-	resp.Changed = len(resp.Removed)+len(resp.Created)+len(resp.Pulled) > 0
+	resp.Changed = result.Changed
 	return resp
 }
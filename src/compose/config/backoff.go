@@ -0,0 +1,110 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Names of the labels under which the restart backoff parameters are stored on the container, see LabelPrefix.Label
+const (
+	LabelRestartBackoffInitial    = "restart-backoff-initial"
+	LabelRestartBackoffMax        = "restart-backoff-max"
+	LabelRestartBackoffMultiplier = "restart-backoff-multiplier"
+)
+
+// Backoff describes "restart_backoff" property of the container spec. Docker does not
+// support configurable restart backoff, so rocker-compose only stores the parameters
+// as labels of the container for external monitors to read and honor them.
+type Backoff struct {
+	Initial    *Duration `yaml:"initial,omitempty"`    // first delay before restart
+	Max        *Duration `yaml:"max,omitempty"`        // upper bound of the delay
+	Multiplier *float64  `yaml:"multiplier,omitempty"` // factor the delay grows by after every restart
+}
+
+// Labels returns the labels representation of the restart backoff parameters
+func (b *Backoff) Labels(prefix LabelPrefix) map[string]string {
+	labels := map[string]string{}
+	if b == nil {
+		return labels
+	}
+	if b.Initial != nil {
+		labels[prefix.Label(LabelRestartBackoffInitial)] = time.Duration(*b.Initial).String()
+	}
+	if b.Max != nil {
+		labels[prefix.Label(LabelRestartBackoffMax)] = time.Duration(*b.Max).String()
+	}
+	if b.Multiplier != nil {
+		labels[prefix.Label(LabelRestartBackoffMultiplier)] = strconv.FormatFloat(*b.Multiplier, 'g', -1, 64)
+	}
+	return labels
+}
+
+// NewBackoffFromLabels reads restart backoff parameters from the container labels,
+// it returns nil if there are no such labels
+func NewBackoffFromLabels(labels map[string]string, prefix LabelPrefix) (*Backoff, error) {
+	var b *Backoff
+
+	for _, name := range []string{LabelRestartBackoffInitial, LabelRestartBackoffMax} {
+		key := prefix.Label(name)
+		value, ok := labels[key]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse label %s, error: %s", key, err)
+		}
+		if b == nil {
+			b = &Backoff{}
+		}
+		duration := Duration(d)
+		if name == LabelRestartBackoffInitial {
+			b.Initial = &duration
+		} else {
+			b.Max = &duration
+		}
+	}
+
+	if value, ok := labels[prefix.Label(LabelRestartBackoffMultiplier)]; ok {
+		multiplier, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse label %s, error: %s", prefix.Label(LabelRestartBackoffMultiplier), err)
+		}
+		if b == nil {
+			b = &Backoff{}
+		}
+		b.Multiplier = &multiplier
+	}
+
+	return b, nil
+}
+
+func (b *Backoff) validate() error {
+	if b.Initial != nil && *b.Initial <= 0 {
+		return fmt.Errorf("restart_backoff initial should be positive")
+	}
+	if b.Initial != nil && b.Max != nil && *b.Max < *b.Initial {
+		return fmt.Errorf("restart_backoff max should not be less than initial")
+	}
+	if b.Multiplier != nil && *b.Multiplier < 1 {
+		return fmt.Errorf("restart_backoff multiplier should not be less than 1")
+	}
+	return nil
+}
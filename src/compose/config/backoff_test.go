@@ -0,0 +1,82 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffLabels(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    restart_backoff:
+      initial: 1s
+      max: 5m
+      multiplier: 1.5`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backoff := config.Containers["main"].RestartBackoff
+	labels := backoff.Labels(DefaultLabelPrefix)
+
+	assert.Equal(t, map[string]string{
+		"rocker-compose-restart-backoff-initial":    "1s",
+		"rocker-compose-restart-backoff-max":        "5m0s",
+		"rocker-compose-restart-backoff-multiplier": "1.5",
+	}, labels)
+
+	restored, err := NewBackoffFromLabels(labels, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, backoff, restored)
+	assert.Equal(t, 5*time.Minute, restored.Max.Get(0))
+
+	none, err := NewBackoffFromLabels(map[string]string{"foo": "bar"}, DefaultLabelPrefix)
+	assert.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestBackoffIsNotCompared(t *testing.T) {
+	multiplier := 2.0
+	c1 := &Container{}
+	c2 := &Container{RestartBackoff: &Backoff{Multiplier: &multiplier}}
+
+	assert.True(t, c1.IsEqualTo(c2), "restart_backoff change should not cause recreation")
+}
+
+func TestBackoffValidate(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    restart_backoff:
+      initial: 10s
+      max: 1s`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container main: restart_backoff max should not be less than initial")
+}
@@ -0,0 +1,91 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// CmdTemplateData is the context of templates in cmd and entrypoint parts,
+// it is evaluated for every container after the manifest is rendered and processed
+type CmdTemplateData struct {
+	Image  string
+	Env    map[string]string
+	Labels map[string]string
+}
+
+// renderCmdTemplates evaluates templates in cmd and entrypoint parts of the container if it
+// sets cmd_template, referring undefined env vars, labels or fields is an error. Without it
+// the parts are kept as they are, e.g. escaped by the manifest template to be passed literally.
+func (container *Container) renderCmdTemplates() (err error) {
+	if container.CmdTemplate == nil || !*container.CmdTemplate {
+		return nil
+	}
+
+	data := CmdTemplateData{
+		Env:    map[string]string(container.Env),
+		Labels: map[string]string(container.Labels),
+	}
+	if container.Image != nil {
+		data.Image = *container.Image
+	}
+	if data.Env == nil {
+		data.Env = map[string]string{}
+	}
+	if data.Labels == nil {
+		data.Labels = map[string]string{}
+	}
+
+	// the slices may be shared with the containers they were extended from, so make new ones
+	if container.Cmd != nil {
+		if container.Cmd, err = renderParts("cmd", container.Cmd, data); err != nil {
+			return err
+		}
+	}
+	if container.Entrypoint != nil {
+		parts, err := renderParts("entrypoint", *container.Entrypoint, data)
+		if err != nil {
+			return err
+		}
+		entrypoint := Strings(parts)
+		container.Entrypoint = &entrypoint
+	}
+	return nil
+}
+
+func renderParts(property string, parts []string, data CmdTemplateData) ([]string, error) {
+	result := make([]string, len(parts))
+	for i, part := range parts {
+		if !strings.Contains(part, "{{") {
+			result[i] = part
+			continue
+		}
+		tpl, err := template.New(property).Option("missingkey=error").Parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s template %q, error: %s", property, part, err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("Failed to render %s template %q, error: %s", property, part, err)
+		}
+		result[i] = buf.String()
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grammarly/rocker/src/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigCmdTemplate(t *testing.T) {
+	// the manifest is a template itself, so cmd templates are escaped to be rendered per container
+	configStr := `namespace: test
+containers:
+  main:
+    image: example/api:1.0
+    env:
+      PORT: 8080
+    labels:
+      role: api
+    cmd_template: true
+    entrypoint:
+      - '{{ "{{ .Env.PORT | printf \"/entrypoint-%s.sh\" }}" }}'
+    cmd:
+      - --port
+      - '{{ "{{ .Env.PORT }}" }}'
+      - '--role={{ "{{ .Labels.role }}" }}'
+      - '--image={{ "{{ .Image }}" }}'
+  replica:
+    extends: main
+    env:
+      PORT: 9090`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &Strings{"/entrypoint-8080.sh"}, config.Containers["main"].Entrypoint)
+	assert.Equal(t, Cmd{"--port", "8080", "--role=api", "--image=example/api:1.0"}, config.Containers["main"].Cmd)
+	assert.Equal(t, Cmd{"--port", "9090", "--role=api", "--image=example/api:1.0"}, config.Containers["replica"].Cmd)
+}
+
+func TestConfigCmdTemplateSpecTemplate(t *testing.T) {
+	image := "example/api:1.0"
+	enabled := true
+	config, err := New("test", map[string]*Container{
+		"_base": &Container{Image: &image, Cmd: Cmd{"--port", "{{ .Env.PORT }}"}, CmdTemplate: &enabled},
+		"main":  &Container{Extends: &Extends{Service: "_base"}, Env: StringMap{"PORT": "80"}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Cmd{"--port", "{{ .Env.PORT }}"}, config.Containers["_base"].Cmd)
+	assert.Equal(t, Cmd{"--port", "80"}, config.Containers["main"].Cmd)
+}
+
+func TestConfigCmdTemplateErrors(t *testing.T) {
+	tests := map[string]string{
+		"{{ .Env.PORT }}":    `map has no entry for key "PORT"`,
+		"{{ .Labels.role }}": `map has no entry for key "role"`,
+		"{{ .Name }}":        `can't evaluate field Name`,
+		"{{ .Env.PORT ":      `Failed to parse cmd template`,
+	}
+
+	image := "example/api:1.0"
+	enabled := true
+	for part, expected := range tests {
+		config := &Config{Containers: map[string]*Container{
+			"main": &Container{Image: &image, Cmd: Cmd{part}, CmdTemplate: &enabled},
+		}}
+		err := config.process("/")
+		if assert.Error(t, err, part) {
+			assert.Contains(t, err.Error(), "Container main: ", part)
+			assert.Contains(t, err.Error(), expected, part)
+		}
+	}
+}
+
+func TestConfigCmdTemplateEscaped(t *testing.T) {
+	// the parts escaped by the manifest template are passed literally unless cmd_template is set
+	configStr := `namespace: test
+containers:
+  main:
+    image: example/api:1.0
+    cmd:
+      - --format
+      - '{{ "{{.ID}}" }}'`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Cmd{"--format", "{{.ID}}"}, config.Containers["main"].Cmd)
+}
@@ -31,7 +31,16 @@ func (a *Container) LastCompareField() string {
 // IsEqualTo compares the container spec against another one.
 // It returns false if at least one property is unequal.
 func (a *Container) IsEqualTo(b *Container) bool {
+	return a.IsEqualOn(b, nil)
+}
+
+// IsEqualOn compares the container spec against another one on the given properties only,
+// named as in the manifest, see ValidateRecreateOn. All properties are compared if none are given.
+func (a *Container) IsEqualOn(b *Container, properties []string) bool {
 	for _, field := range getComparableFields() {
+		if len(properties) > 0 && !stringsContain(properties, getYamlFieldName(field)) {
+			continue
+		}
 		a.lastCompareField = field
 		if equal, _ := compareYaml(field, a, b); !equal {
 			// TODO: return err
@@ -64,6 +73,11 @@ func compareYaml(name string, a, b *Container) (bool, error) {
 	isSlice := av.Type().Kind() == reflect.Slice
 	isMap := av.Type().Kind() == reflect.Map
 
+	// nil and empty values differ for some fields, see compareNilFields
+	if stringsContain(compareNilFields, name) && av.IsNil() != bv.IsNil() {
+		return false, nil
+	}
+
 	// empty values and nil pointer should be considered equal
 	if av.IsNil() && !isSlice && !isMap {
 		av = reflect.New(av.Type().Elem())
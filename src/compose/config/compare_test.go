@@ -32,6 +32,26 @@ func TestConfigIsEqualTo_Empty(t *testing.T) {
 	assert.True(t, c1.IsEqualTo(c2), "empty configs should be equal")
 }
 
+func TestConfigIsEqualOn(t *testing.T) {
+	memory1, memory2 := Memory(128*1024*1024), Memory(256*1024*1024)
+	c1 := &Container{Memory: &memory1, Env: StringMap{"A": "1"}}
+	c2 := &Container{Memory: &memory2, Env: StringMap{"A": "1"}}
+
+	assert.False(t, c1.IsEqualOn(c2, nil), "all properties are compared by default")
+	assert.True(t, c1.IsEqualOn(c2, []string{"image", "env"}), "memory is not in the list")
+	assert.False(t, c1.IsEqualOn(c2, []string{"env", "memory"}))
+}
+
+func TestConfigValidateRecreateOn(t *testing.T) {
+	assert.NoError(t, ValidateRecreateOn([]string{"image", "env", "memory", "hash_paths"}))
+
+	err := ValidateRecreateOn([]string{"env", "memroy"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Unknown property \"memroy\" to recreate containers on, known ones are: ")
+	}
+	assert.Error(t, ValidateRecreateOn([]string{"extends"}), "properties which are not compared are not known")
+}
+
 func TestConfigCompareReflect(t *testing.T) {
 	var aInt64 int64
 	c1 := &Container{CPUShares: &aInt64}
@@ -45,8 +65,8 @@ func TestConfigCompareReflect(t *testing.T) {
 }
 
 func TestConfigCompareReflectSlice(t *testing.T) {
-	c1 := &Container{Entrypoint: []string{"foo", "bar"}}
-	c2 := &Container{Entrypoint: []string{"bar", "foo"}}
+	c1 := &Container{Entrypoint: &Strings{"foo", "bar"}}
+	c2 := &Container{Entrypoint: &Strings{"bar", "foo"}}
 
 	equal, err := compareYaml("Entrypoint", c1, c2)
 	if err != nil {
@@ -79,7 +99,7 @@ func TestConfigIsEqualTo(t *testing.T) {
 	cases := tests{
 		// type: string
 		fieldSpec{
-			[]string{"Pid", "Uts", "CpusetCpus", "Hostname", "Domainname", "User", "Workdir", "LogDriver"},
+			[]string{"Pid", "Uts", "CpusetCpus", "Hostname", "Domainname", "User", "Workdir", "LogDriver", "CgroupParent", "CpusetMems"},
 			[]check{
 				check{shouldEqual, "KEY: foo", "KEY: foo"},
 				check{shouldEqual, "", ""},
@@ -92,7 +112,7 @@ func TestConfigIsEqualTo(t *testing.T) {
 		},
 		// type: numbers
 		fieldSpec{
-			[]string{"CPUShares"},
+			[]string{"CPUShares", "CPUQuota", "CPUPeriod"},
 			[]check{
 				check{shouldEqual, "KEY: 20", "KEY: 20"},
 				check{shouldEqual, "", ""},
@@ -105,7 +125,7 @@ func TestConfigIsEqualTo(t *testing.T) {
 		},
 		// type: booleans
 		fieldSpec{
-			[]string{"OomKillDisable", "Privileged", "PublishAllPorts"},
+			[]string{"OomKillDisable", "Privileged", "PublishAllPorts", "ReadonlyRootfs"},
 			[]check{
 				check{shouldEqual, "KEY: true", "KEY: true"},
 				check{shouldEqual, "", ""},
@@ -128,6 +148,18 @@ func TestConfigIsEqualTo(t *testing.T) {
 				check{shouldNotEqual, "", "KEY: bridge"},
 			},
 		},
+		// type: Cpus
+		fieldSpec{
+			[]string{"Cpus"},
+			[]check{
+				check{shouldEqual, "KEY: 1.5", "KEY: 1.5"},
+				check{shouldEqual, "KEY: 2", "KEY: 2.0"},
+				check{shouldEqual, "", ""},
+				check{shouldNotEqual, "", "KEY: 1.5"},
+				check{shouldNotEqual, "KEY: 1.5", ""},
+				check{shouldNotEqual, "KEY: 1.5", "KEY: 2"},
+			},
+		},
 		// type: ConfigMemory
 		fieldSpec{
 			[]string{"Memory", "MemorySwap"},
@@ -140,9 +172,18 @@ func TestConfigIsEqualTo(t *testing.T) {
 				check{shouldNotEqual, "KEY: 64m", "KEY: 2g"},
 			},
 		},
+		// type: ConfigMemory, not supported by the docker client and skipped
+		fieldSpec{
+			[]string{"ShmSize", "KernelMemory", "MemReservation"},
+			[]check{
+				check{shouldEqual, "KEY: 64m", "KEY: 64m"},
+				check{shouldEqual, "", "KEY: 64m"},
+				check{shouldEqual, "KEY: 64m", "KEY: 2g"},
+			},
+		},
 		// type: []string
 		fieldSpec{
-			[]string{"DNS", "AddHost", "Expose", "Volumes", "VolumesFrom", "Links", "WaitFor", "Ports"},
+			[]string{"DNS", "AddHost", "CapAdd", "CapDrop", "SecurityOpt", "Devices", "Expose", "Volumes", "VolumesFrom", "Links", "WaitFor", "Ports", "HashPaths"},
 			[]check{
 				check{shouldEqual, "", ""},
 				check{shouldEqual, "KEY:\n  - foo", "KEY:\n  - foo"},
@@ -158,6 +199,7 @@ func TestConfigIsEqualTo(t *testing.T) {
 		fieldSpec{
 			[]string{"Cmd", "Entrypoint"},
 			[]check{
+				check{shouldEqual, "KEY: []", "KEY: []"},
 				check{shouldEqual, "", ""},
 				check{shouldEqual, "KEY:\n  - foo", "KEY:\n  - foo"},
 				check{shouldEqual, "KEY:\n  - foo\n  - bar", "KEY:\n  - foo\n  - bar"},
@@ -168,6 +210,14 @@ func TestConfigIsEqualTo(t *testing.T) {
 				check{shouldNotEqual, "KEY:\n  - foo\n  - bar", ""},
 			},
 		},
+		// type: *[]string -- empty list resets the image entrypoint
+		fieldSpec{
+			[]string{"Entrypoint"},
+			[]check{
+				check{shouldNotEqual, "KEY: []", ""},
+				check{shouldNotEqual, "", "KEY: []"},
+			},
+		},
 		// type: RestartPolicy
 		fieldSpec{
 			[]string{"Restart"},
@@ -194,6 +244,18 @@ func TestConfigIsEqualTo(t *testing.T) {
 				check{shouldNotEqual, "KEY:\n  - name: nofile\n    soft: 1024\n    hard: 2048\n  - name: /app\n    soft: 1024\n    hard: 2048", ""},
 			},
 		},
+		// type: []Mount
+		fieldSpec{
+			[]string{"Mounts"},
+			[]check{
+				check{shouldEqual, "", ""},
+				check{shouldEqual, "KEY:\n  - source: /a\n    target: /b", "KEY:\n  - source: /a\n    target: /b"},
+				check{shouldEqual, "KEY:\n  - target: /a\n  - target: /b", "KEY:\n  - target: /b\n  - target: /a"},
+				check{shouldNotEqual, "KEY:\n  - source: /a\n    target: /b", ""},
+				check{shouldNotEqual, "KEY:\n  - source: /a\n    target: /b", "KEY:\n  - source: /a\n    target: /b\n    read_only: true"},
+				check{shouldNotEqual, "KEY:\n  - source: /a\n    target: /b", "KEY:\n  - source: /a\n    target: /b\n    propagation: rslave"},
+			},
+		},
 		// type: map[string]string
 		fieldSpec{
 			[]string{"Labels", "Env", "Extra", "LogOpt"},
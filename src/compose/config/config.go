@@ -27,11 +27,16 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/grammarly/rocker/src/imagename"
 	"github.com/grammarly/rocker/src/template"
@@ -46,46 +51,110 @@ type Config struct {
 	Namespace  string // All containers names under current compose.yml will be prefixed with this namespace
 	Containers map[string]*Container
 	Vars       template.Vars
+	Warnings   []Warning // Non-fatal issues found while loading the manifest
+
+	// Named registry credentials which containers can refer to by pull_secret
+	Credentials map[string]*Credential
+
+	// Named sets of ulimits which containers can refer to by ulimit_profile
+	UlimitProfiles map[string][]Ulimit
+
+	// Opt-in json-file log options applied to containers that do not set them
+	LogRotation *LogRotation
+
+	// Name of the naming strategy of the docker containers, see NamingStrategies
+	Naming string
+}
+
+// Credential is a registry auth that is used for pulling images of containers
+// referring to it by the pull_secret property
+type Credential struct {
+	Username      string `yaml:"username,omitempty"`
+	Password      string `yaml:"password,omitempty"`
+	Email         string `yaml:"email,omitempty"`
+	ServerAddress string `yaml:"server_address,omitempty"`
+}
+
+// Warning describes a non-fatal issue with a container spec found while loading the manifest
+type Warning struct {
+	Container string
+	Message   string
 }
 
 // Container represents a single container spec from compose.yml
 type Container struct {
-	Extends         string         `yaml:"extends,omitempty"`           // can extend from other container spec referring by name
-	Image           *string        `yaml:"image,omitempty"`             //
-	Net             *Net           `yaml:"net,omitempty"`               //
-	Pid             *string        `yaml:"pid,omitempty"`               //
-	Uts             *string        `yaml:"uts,omitempty"`               //
-	State           *State         `yaml:"state,omitempty"`             // "running" or "created" or "ran"
-	DNS             Strings        `yaml:"dns,omitempty"`               //
-	AddHost         Strings        `yaml:"add_host,omitempty"`          //
-	Restart         *RestartPolicy `yaml:"restart,omitempty"`           //
-	Memory          *Memory        `yaml:"memory,omitempty"`            //
-	MemorySwap      *Memory        `yaml:"memory_swap,omitempty"`       //
-	CPUShares       *int64         `yaml:"cpu_shares,omitempty"`        //
-	CpusetCpus      *string        `yaml:"cpuset_cpus,omitempty"`       //
-	OomKillDisable  *bool          `yaml:"oom_kill_disable,omitempty"`  // e.g. docker run --oom-kill-disable TODO: pull request to go-dockerclient
-	Ulimits         []Ulimit       `yaml:"ulimits,omitempty"`           // search by "Ulimits" here https://goo.gl/IxbZck
-	Privileged      *bool          `yaml:"privileged,omitempty"`        //
-	Cmd             Cmd            `yaml:"cmd,omitempty"`               //
-	Entrypoint      Strings        `yaml:"entrypoint,omitempty"`        //
-	Expose          Strings        `yaml:"expose,omitempty"`            //
-	Ports           Ports          `yaml:"ports,omitempty"`             //
-	LogDriver       *string        `yaml:"log_driver,omitempty"`        //
-	LogOpt          StringMap      `yaml:"log_opt,omitempty"`           //
-	PublishAllPorts *bool          `yaml:"publish_all_ports,omitempty"` //
-	Labels          StringMap      `yaml:"labels,omitempty"`            //
-	Env             StringMap      `yaml:"env,omitempty"`               //
-	VolumesFrom     ContainerNames `yaml:"volumes_from,omitempty"`      //
-	Volumes         Strings        `yaml:"volumes,omitempty"`           //
-	Links           Links          `yaml:"links,omitempty"`             //
-	WaitFor         ContainerNames `yaml:"wait_for,omitempty"`          //
-	KillTimeout     *uint          `yaml:"kill_timeout,omitempty"`      //
-	Hostname        *string        `yaml:"hostname,omitempty"`          //
-	Domainname      *string        `yaml:"domainname,omitempty"`        //
-	User            *string        `yaml:"user,omitempty"`              //
-	Workdir         *string        `yaml:"workdir,omitempty"`           //
-	NetworkDisabled *bool          `yaml:"network_disabled,omitempty"`  // TODO: do we need this?
-	KeepVolumes     *bool          `yaml:"keep_volumes,omitempty"`      //
+	Extends          *Extends       `yaml:"extends,omitempty"`           // can extend from other container spec referring by name or file and name
+	Image            *string        `yaml:"image,omitempty"`             //
+	Net              *Net           `yaml:"net,omitempty"`               //
+	Pid              *string        `yaml:"pid,omitempty"`               //
+	Uts              *string        `yaml:"uts,omitempty"`               //
+	State            *State         `yaml:"state,omitempty"`             // "running" or "created" or "ran"
+	DesiredState     string         `yaml:"desired_state,omitempty"`     // "running" or "stopped", the existing container is started or stopped without recreation
+	DNS              Strings        `yaml:"dns,omitempty"`               //
+	AddHost          Strings        `yaml:"add_host,omitempty"`          //
+	Restart          *RestartPolicy `yaml:"restart,omitempty"`           //
+	RestartBackoff   *Backoff       `yaml:"restart_backoff,omitempty"`   // backoff hints for external monitors, stored as labels
+	Memory           *Memory        `yaml:"memory,omitempty"`            //
+	MemorySwap       *Memory        `yaml:"memory_swap,omitempty"`       //
+	ShmSize          *Memory        `yaml:"shm_size,omitempty"`          // TODO: not supported by go-dockerclient yet
+	KernelMemory     *Memory        `yaml:"kernel_memory,omitempty"`     // TODO: not supported by go-dockerclient yet
+	MemReservation   *Memory        `yaml:"mem_reservation,omitempty"`   // TODO: not supported by go-dockerclient yet
+	CPUShares        *int64         `yaml:"cpu_shares,omitempty"`        //
+	CpusetCpus       *string        `yaml:"cpuset_cpus,omitempty"`       //
+	CpusetMems       *string        `yaml:"cpuset_mems,omitempty"`       // memory nodes, same format as cpuset_cpus
+	Cpus             *Cpus          `yaml:"cpus,omitempty"`              // number of CPUs, converted to CPU quota
+	CPUQuota         *int64         `yaml:"cpu_quota,omitempty"`         // CFS quota in microseconds, conflicts with cpus
+	CPUPeriod        *int64         `yaml:"cpu_period,omitempty"`        // CFS period in microseconds, conflicts with cpus
+	OomKillDisable   *bool          `yaml:"oom_kill_disable,omitempty"`  // e.g. docker run --oom-kill-disable TODO: pull request to go-dockerclient
+	Ulimits          []Ulimit       `yaml:"ulimits,omitempty"`           // search by "Ulimits" here https://goo.gl/IxbZck
+	UlimitProfile    string         `yaml:"ulimit_profile,omitempty"`    // name of the profile from the ulimit_profiles section, "ulimits" are merged on top of it
+	Privileged       *bool          `yaml:"privileged,omitempty"`        //
+	CapAdd           Strings        `yaml:"cap_add,omitempty"`           // capabilities to add, e.g. NET_ADMIN
+	CapDrop          Strings        `yaml:"cap_drop,omitempty"`          // capabilities to drop, e.g. MKNOD
+	SecurityOpt      Strings        `yaml:"security_opt,omitempty"`      // e.g. apparmor:my-profile or label:disable
+	ReadonlyRootfs   *bool          `yaml:"read_only,omitempty"`         // mount the root filesystem as read only
+	CgroupParent     *string        `yaml:"cgroup_parent,omitempty"`     // parent cgroup of the container
+	Devices          Strings        `yaml:"devices,omitempty"`           // host:container[:permissions], e.g. /dev/fuse:/dev/fuse:rwm
+	Cmd              Cmd            `yaml:"cmd,omitempty"`               //
+	Entrypoint       *Strings       `yaml:"entrypoint,omitempty"`        // nil keeps the image entrypoint, empty list resets it
+	CmdTemplate      *bool          `yaml:"cmd_template,omitempty"`      // render templates in cmd and entrypoint parts, see renderCmdTemplates
+	Expose           Strings        `yaml:"expose,omitempty"`            //
+	Ports            Ports          `yaml:"ports,omitempty"`             //
+	LogDriver        *string        `yaml:"log_driver,omitempty"`        //
+	LogOpt           StringMap      `yaml:"log_opt,omitempty"`           //
+	PublishAllPorts  *bool          `yaml:"publish_all_ports,omitempty"` //
+	Labels           StringMap      `yaml:"labels,omitempty"`            //
+	Env              StringMap      `yaml:"env,omitempty"`               //
+	EnvFromExec      []EnvFromExec  `yaml:"env_from_exec,omitempty"`     // env vars set to the output of commands run inside dependencies
+	VolumesFrom      ContainerNames `yaml:"volumes_from,omitempty"`      //
+	Volumes          Strings        `yaml:"volumes,omitempty"`           //
+	Mounts           []Mount        `yaml:"mounts,omitempty"`            // long form of volumes
+	Links            Links          `yaml:"links,omitempty"`             //
+	WaitFor          ContainerNames `yaml:"wait_for,omitempty"`          //
+	WaitForExternal  []External     `yaml:"wait_for_external,omitempty"` // services outside of the manifest probed before the container is started
+	KillTimeout      *uint          `yaml:"kill_timeout,omitempty"`      //
+	StopPriority     *int           `yaml:"stop_priority,omitempty"`     // containers of higher priority are removed later, see listContainersToRemove
+	Hostname         *string        `yaml:"hostname,omitempty"`          //
+	Domainname       *string        `yaml:"domainname,omitempty"`        //
+	User             *string        `yaml:"user,omitempty"`              //
+	Workdir          *string        `yaml:"workdir,omitempty"`           //
+	NetworkDisabled  *bool          `yaml:"network_disabled,omitempty"`  // TODO: do we need this?
+	KeepVolumes      *bool          `yaml:"keep_volumes,omitempty"`      //
+	HashPaths        Strings        `yaml:"hash_paths,omitempty"`        // files and directories which content changes should trigger recreation
+	PullSecret       string         `yaml:"pull_secret,omitempty"`       // name of the credential from the credentials section to pull image with
+	RecreateStrategy string         `yaml:"recreate_strategy,omitempty"` // "stop-first" (default) or "start-first"
+	PullPolicy       string         `yaml:"pull_policy,omitempty"`       // "always", "missing" or "never", see GetPullPolicy
+	PullTimeout      *Duration      `yaml:"pull_timeout,omitempty"`      // limit of pulling the image, e.g. 10m, no limit if not given
+	Group            string         `yaml:"group,omitempty"`             // containers of the same group are recreated together
+	RequiredEnv      Strings        `yaml:"required_env,omitempty"`      // env vars that should be set to non-empty values
+	SecretEnv        Strings        `yaml:"secret_env,omitempty"`        // patterns of env vars which values are redacted in the output, e.g. "*_KEY"
+	Readiness        *Readiness     `yaml:"readiness,omitempty"`         // command run inside the container to check it is ready
+	PreStop          *PreStop       `yaml:"pre_stop,omitempty"`          // command run inside the container before it is stopped
+	Quiesce          *Hook          `yaml:"quiesce,omitempty"`           // command run inside the existing container before it is recreated
+	Unquiesce        *Hook          `yaml:"unquiesce,omitempty"`         // command run inside the new container once it is ready, or the existing one if recreation fails before it is removed
+	StartupDelay     *Duration      `yaml:"startup_delay,omitempty"`     // pause after the container is running before dependents are started
+	Platform         string         `yaml:"platform,omitempty"`          // expected platform of the image, e.g. "linux/amd64"
+	When             Strings        `yaml:"when,omitempty"`              // conditions on host facts, the container is skipped unless all are true
 
 	// Aliases, for compatibility with docker-compose and `docker run`
 
@@ -101,6 +170,10 @@ type Container struct {
 	Extra map[string]interface{} `yaml:"extra,omitempty"`
 
 	lastCompareField string
+	contentHash      string
+	configLabel      string
+	hostPercents     map[string]float64 // memory and cpus given as percentages of the host resources, see ResolveHostPercents
+	naming           NamingStrategy     // naming of the docker containers the spec refers to, see GetNaming
 }
 
 // ContainerName represents the pair of namespace and container name.
@@ -111,6 +184,13 @@ type ContainerName struct {
 	Name      string
 }
 
+// Extends refers to the container spec to extend from, either by name within the same
+// manifest ("extends: base") or by name in the other file ("extends: {file: common.yml, service: base}")
+type Extends struct {
+	File    string `yaml:"file,omitempty"`
+	Service string `yaml:"service"`
+}
+
 // Link is same as ContainerName with addition of Alias property, which
 // specifies associated container alias
 type Link struct {
@@ -125,11 +205,76 @@ type Ulimit struct {
 	Hard int64
 }
 
-// Memory is memory in bytes that is used for Memory and MemorySwap
-// properties of the container spec. It is parsed from string (e.g. "64M")
-// to int64 bytes as a uniform representation.
+// Mount describes a single volume in the long form, it is an alternative to
+// "src:dest:mode" strings in "volumes" property. Source is a host path, Volume is
+// a name of the docker named volume, a Subpath of which can be mounted. If neither
+// Source nor Volume is given, the data volume is created. The named volume that does
+// not exist yet may be created and populated from the Seed image.
+type Mount struct {
+	Source      string `yaml:"source,omitempty"`
+	Volume      string `yaml:"volume,omitempty"`
+	Subpath     string `yaml:"subpath,omitempty"` // relative path inside the named volume
+	Target      string `yaml:"target"`
+	ReadOnly    bool   `yaml:"read_only,omitempty"`
+	Propagation string `yaml:"propagation,omitempty"` // shared|rshared|slave|rslave|private|rprivate
+	Seed        string `yaml:"seed,omitempty"`        // image which contents are copied to the named volume when it is created
+	SeedPath    string `yaml:"seed_path,omitempty"`   // directory of the seed image to copy, target by default
+}
+
+// Memory is memory in bytes that is used for memory, memory_swap, shm_size, kernel_memory
+// and mem_reservation properties of the container spec. It is parsed from string (e.g. "64M")
+// to int64 bytes as a uniform representation, see NewConfigMemoryFromString.
 type Memory int64
 
+// Duration is a time interval given as a string parsable by time.ParseDuration (e.g. "500ms", "10s")
+type Duration time.Duration
+
+// Readiness describes the command which is run inside the container after start to check
+// that it is ready. Dependent containers are not started until the command exits with zero code.
+type Readiness struct {
+	Exec     Strings   `yaml:"exec"`
+	Interval *Duration `yaml:"interval,omitempty"` // pause between attempts, default 1s
+	Timeout  *Duration `yaml:"timeout,omitempty"`  // time given to a single attempt, default 10s
+	Retries  *int      `yaml:"retries,omitempty"`  // number of attempts, default 30
+	Stable   *Duration `yaml:"stable,omitempty"`   // time it should keep passing if the container is restarted on exit, default 3 intervals
+}
+
+// PreStop describes the command which is run inside the running container before it
+// is stopped, e.g. to fail the load balancer health check, and the time to wait after it
+// so connections are drained. If the command fails, the container is stopped anyway.
+type PreStop struct {
+	Exec    Strings   `yaml:"exec"`
+	Wait    *Duration `yaml:"wait,omitempty"`    // pause after the command before stopping, default 0
+	Timeout *Duration `yaml:"timeout,omitempty"` // time given to the command, default 10s
+}
+
+// Hook describes the command which is run inside the running container around its recreation,
+// e.g. to stop taking jobs from the queue by "quiesce" and to resume by "unquiesce".
+type Hook struct {
+	Exec    Strings   `yaml:"exec"`
+	Timeout *Duration `yaml:"timeout,omitempty"` // time given to the command, default 10s
+}
+
+// EnvFromExec describes an env variable which value is the output of the command run inside
+// the running Container right before the container is created, e.g. a token generated by it.
+// The value is given to docker only, so it is neither stored in the config label nor compared.
+type EnvFromExec struct {
+	Container ContainerName `yaml:"container"`
+	Command   Strings       `yaml:"command"`
+	Var       string        `yaml:"var"`
+}
+
+// External describes a service outside of the manifest, e.g. a managed database on another
+// host, which should be reachable before the container is started. Either host and port
+// are given to probe a TCP connection, or url to probe with HTTP GET.
+type External struct {
+	Host     string    `yaml:"host,omitempty"`
+	Port     int       `yaml:"port,omitempty"`
+	URL      string    `yaml:"url,omitempty"`
+	Timeout  *Duration `yaml:"timeout,omitempty"`  // total time to wait for the service, default 60s
+	Interval *Duration `yaml:"interval,omitempty"` // pause between attempts, default 1s
+}
+
 // RestartPolicy represents "restart" property of the container spec. Possible
 // values are: no | always | on-failure,N (where N is number of times it is allowed to fail)
 // Default value is "always". Despite Docker's default value is "no", we found that more often
@@ -147,6 +292,25 @@ type PortBinding struct {
 	HostPort string
 }
 
+// Possible values of "recreate_strategy" property
+const (
+	RecreateStopFirst  = "stop-first"
+	RecreateStartFirst = "start-first"
+)
+
+// Possible values of "pull_policy" property
+const (
+	PullAlways  = "always"
+	PullMissing = "missing"
+	PullNever   = "never"
+)
+
+// Possible values of "desired_state" property
+const (
+	DesiredStateRunning = "running"
+	DesiredStateStopped = "stopped"
+)
+
 // State represents "state" property from the manifest.
 // Possible values are: running | created | ran
 type State string
@@ -208,11 +372,63 @@ func NewFromFile(filename string, vars template.Vars, funcs map[string]interface
 	return config, nil
 }
 
+// NewFromDir reads all *.yml files from a directory and merges them into a single config.
+// Files are read in lexical order and every next file overrides properties of containers
+// defined in previous ones, similar to systemd drop-ins. Relative volume paths are resolved
+// against the given directory. See ReadConfig/4 for reading and parsing details.
+func NewFromDir(dirname string, vars template.Vars, funcs map[string]interface{}, print bool) (*Config, error) {
+	if !path.IsAbs(dirname) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("Cannot get absolute path to %s due to error %s", dirname, err)
+		}
+		dirname = path.Join(wd, dirname)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dirname, "*.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list config files in %s, error: %s", dirname, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No *.yml files found in directory %s", dirname)
+	}
+	sort.Strings(files)
+
+	config := &Config{}
+
+	for _, filename := range files {
+		fd, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open config file %s, error: %s", filename, err)
+		}
+		fileConfig, err := parseConfig(filename, fd, vars, funcs, print)
+		fd.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read config file %s, error: %s", filename, err)
+		}
+		if err := fileConfig.resolveFileExtends(filename, vars, funcs); err != nil {
+			return nil, fmt.Errorf("Failed to read config file %s, error: %s", filename, err)
+		}
+		config.merge(fileConfig)
+	}
+
+	if print {
+		os.Exit(0)
+	}
+
+	// empty namespace is guessed from the directory name
+	if err := config.process(dirname); err != nil {
+		return nil, err
+	}
+
+	config.Vars = vars
+
+	return config, nil
+}
+
 // ReadConfig reads and parses the config from io.Reader stream.
 // Before parsing it processes config through a template engine implemented in template.go.
 func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs map[string]interface{}, print bool) (*Config, error) {
-	config := &Config{}
-
 	basedir, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get working dir, error: %s", err)
@@ -225,30 +441,73 @@ func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs m
 		basedir = filepath.Dir(configName)
 	}
 
-	data, err := template.Process(configName, reader, vars, funcs)
+	config, err := parseConfig(configName, reader, vars, funcs, print)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to process config template, error: %s", err)
+		return nil, err
 	}
 
-	if print {
-		fmt.Print(data.String())
-		os.Exit(0)
+	if err := config.resolveFileExtends(configName, vars, funcs); err != nil {
+		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data.Bytes(), config); err != nil {
-		return nil, fmt.Errorf("Failed to parse YAML config, error: %s", err)
+	if print {
+		os.Exit(0)
 	}
 
-	// empty namespace is a backward compatible docker-compose format
-	// we will try to guess the namespace my parent directory name
-	if config.Namespace == "" {
-		parentDir := filepath.Base(basedir)
-		config.Namespace = regexp.MustCompile("[^a-z0-9\\-\\_]").ReplaceAllString(parentDir, "")
+	if err := config.process(basedir); err != nil {
+		return nil, err
 	}
 
 	// Save vars to config
 	config.Vars = vars
 
+	return config, nil
+}
+
+// New makes a Config from container specs built in code rather than read from
+// a manifest file. The specs get the same processing as ones read by ReadConfig,
+// relative paths are resolved against basedir and empty namespace is guessed from it.
+func New(namespace string, containers map[string]*Container, basedir string) (*Config, error) {
+	config := &Config{
+		Namespace:  namespace,
+		Containers: containers,
+		Vars:       template.Vars{},
+	}
+
+	if config.Containers == nil {
+		config.Containers = map[string]*Container{}
+	}
+
+	if err := config.process(basedir); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// parseConfig processes the config template, unmarshals the YAML and handles aliases
+// and extra properties of containers. It does not resolve extends and does not validate
+// the result, so partial configs can be merged together before processing.
+func parseConfig(configName string, reader io.Reader, vars template.Vars, funcs map[string]interface{}, print bool) (*Config, error) {
+	config := &Config{}
+
+	data, err := template.Process(configName, reader, vars, funcs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to process config template, error: %s", err)
+	}
+
+	if print {
+		// the secret values are redacted so the output can be shared, invalid YAML
+		// is not printed and fails to parse below
+		if redacted, err := RedactManifest(data.Bytes()); err == nil {
+			fmt.Print(string(redacted))
+		}
+	}
+
+	if err := yaml.Unmarshal(data.Bytes(), config); err != nil {
+		return nil, fmt.Errorf("Failed to parse YAML config, error: %s", err)
+	}
+
 	// Read extra data
 	type ConfigExtra struct {
 		Containers map[string]map[string]interface{}
@@ -265,17 +524,6 @@ func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs m
 		yamlFields[v] = true
 	}
 
-	// Function that gets HOME (initialize only once)
-	homeMemo := ""
-	getHome := func() (h string, err error) {
-		if homeMemo == "" {
-			if homeMemo, err = homedir.Dir(); err != nil {
-				return "", err
-			}
-		}
-		return homeMemo, nil
-	}
-
 	// Process aliases on the first run, have to do it before extends
 	// because Golang randomizes maps, sometimes inherited containers
 	// process earlier then dependencies; also do initial validation
@@ -338,35 +586,285 @@ func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs m
 			container.Extra = extraFields
 		}
 
+		// Memory and cpus given as percentages of the host resources
+		container.readHostPercents(extra.Containers[name])
+
 		// pretty.Println(name, container.Extra)
 	}
 
+	return config, nil
+}
+
+// merge applies the given config on top of the current one. Containers that are specified
+// in both configs are merged property by property, the given config wins.
+func (config *Config) merge(other *Config) {
+	if other.Namespace != "" {
+		config.Namespace = other.Namespace
+	}
+	if len(other.Credentials) > 0 && config.Credentials == nil {
+		config.Credentials = map[string]*Credential{}
+	}
+	for name, credential := range other.Credentials {
+		config.Credentials[name] = credential
+	}
+	if len(other.UlimitProfiles) > 0 && config.UlimitProfiles == nil {
+		config.UlimitProfiles = map[string][]Ulimit{}
+	}
+	for name, profile := range other.UlimitProfiles {
+		config.UlimitProfiles[name] = profile
+	}
+	if other.LogRotation != nil {
+		config.LogRotation = other.LogRotation
+	}
+	if other.Naming != "" {
+		config.Naming = other.Naming
+	}
+	if config.Containers == nil {
+		config.Containers = map[string]*Container{}
+	}
+	for name, container := range other.Containers {
+		if existing, ok := config.Containers[name]; ok {
+			if container.Extends == nil {
+				container.Extends = existing.Extends
+			}
+			container.ExtendFrom(existing)
+		}
+		config.Containers[name] = container
+	}
+}
+
+// process resolves extends, namespaces and relative paths of the parsed config
+// and validates the result.
+func (config *Config) process(basedir string) error {
+	// empty namespace is a backward compatible docker-compose format
+	// we will try to guess the namespace my parent directory name
+	if config.Namespace == "" {
+		parentDir := filepath.Base(basedir)
+		config.Namespace = regexp.MustCompile("[^a-z0-9\\-\\_]").ReplaceAllString(parentDir, "")
+	}
+
+	if config.LogRotation != nil {
+		if err := config.LogRotation.validate(); err != nil {
+			return err
+		}
+	}
+
+	naming, err := GetNamingStrategy(config.Naming)
+	if err != nil {
+		return err
+	}
+
+	// Function that gets HOME (initialize only once)
+	homeMemo := ""
+	getHome := func() (h string, err error) {
+		if homeMemo == "" {
+			if homeMemo, err = homedir.Dir(); err != nil {
+				return "", err
+			}
+		}
+		return homeMemo, nil
+	}
+
 	// Process extending containers configuration
 	for name, container := range config.Containers {
-		if container.Extends != "" {
-			if container.Extends == name {
-				return nil, fmt.Errorf("Container %s: cannot extend from itself", name)
+		// Containers extending specs from other files are resolved while reading, see resolveFileExtends
+		if container.Extends != nil && container.Extends.File == "" {
+			parent := container.Extends.Service
+			if parent == name {
+				return fmt.Errorf("Container %s: cannot extend from itself", name)
 			}
-			if _, ok := config.Containers[container.Extends]; !ok {
-				return nil, fmt.Errorf("Container %s: cannot find container %s to extend from", name, container.Extends)
+			if _, ok := config.Containers[parent]; !ok {
+				return fmt.Errorf("Container %s: cannot find container %s to extend from", name, parent)
 			}
 			// TODO: build dependency graph by extends hierarchy to allow multiple inheritance
-			if config.Containers[container.Extends].Extends != "" {
-				return nil, fmt.Errorf("Container %s: cannot extend from %s: multiple inheritance is not allowed yet",
-					name, container.Extends)
+			if grandparent := config.Containers[parent].Extends; grandparent != nil && grandparent.File == "" {
+				return fmt.Errorf("Container %s: cannot extend from %s: multiple inheritance is not allowed yet",
+					name, parent)
 			}
-			container.ExtendFrom(config.Containers[container.Extends])
+			container.ExtendFrom(config.Containers[parent])
 		}
 
 		// Validate image
 		if container.Image == nil {
-			return nil, fmt.Errorf("Image should be specified for container: %s", name)
+			return fmt.Errorf("Image should be specified for container: %s", name)
+		}
+
+		// Validate recreate strategy
+		switch container.RecreateStrategy {
+		case "", RecreateStopFirst:
+		case RecreateStartFirst:
+			// the replacement cannot bind the same host ports while the old one is running
+			for _, port := range container.Ports {
+				if port.HostPort != "" {
+					return fmt.Errorf("Container %s: recreate_strategy %s cannot be used with fixed host port %s",
+						name, RecreateStartFirst, port.HostPort)
+				}
+			}
+		default:
+			return fmt.Errorf("Container %s: unknown recreate_strategy %s, possible values are %s and %s",
+				name, container.RecreateStrategy, RecreateStopFirst, RecreateStartFirst)
+		}
+
+		// Validate pull policy
+		switch container.PullPolicy {
+		case "", PullAlways, PullMissing, PullNever:
+		default:
+			return fmt.Errorf("Container %s: unknown pull_policy %s, possible values are %s, %s and %s",
+				name, container.PullPolicy, PullAlways, PullMissing, PullNever)
+		}
+
+		// Validate desired state, it is the alternative to "state" for long running containers
+		switch container.DesiredState {
+		case "":
+		case DesiredStateRunning, DesiredStateStopped:
+			if !container.State.Bool() {
+				return fmt.Errorf("Container %s: desired_state cannot be used with state %s", name, *container.State)
+			}
+		default:
+			return fmt.Errorf("Container %s: unknown desired_state %s, possible values are %s and %s",
+				name, container.DesiredState, DesiredStateRunning, DesiredStateStopped)
+		}
+
+		// Expand ulimit profile, container's own ulimits override the ones of the profile
+		if container.UlimitProfile != "" {
+			profile, ok := config.UlimitProfiles[container.UlimitProfile]
+			if !ok {
+				return fmt.Errorf("Container %s: cannot find ulimit profile %s", name, container.UlimitProfile)
+			}
+			container.Ulimits = mergeUlimits(profile, container.Ulimits)
+		}
+
+		// Validate readiness probe
+		if container.Readiness != nil {
+			if len(container.Readiness.Exec) == 0 {
+				return fmt.Errorf("Container %s: readiness exec command should be specified", name)
+			}
+			if container.Readiness.GetRetries() < 1 {
+				return fmt.Errorf("Container %s: readiness retries should be positive", name)
+			}
+			if container.Readiness.GetStable() < 0 {
+				return fmt.Errorf("Container %s: readiness stable should not be negative", name)
+			}
+		}
+
+		// Validate pre-stop hook
+		if container.PreStop != nil && len(container.PreStop.Exec) == 0 {
+			return fmt.Errorf("Container %s: pre_stop exec command should be specified", name)
+		}
+
+		// Validate quiesce hooks
+		if container.Quiesce != nil && len(container.Quiesce.Exec) == 0 {
+			return fmt.Errorf("Container %s: quiesce exec command should be specified", name)
+		}
+		if container.Unquiesce != nil && len(container.Unquiesce.Exec) == 0 {
+			return fmt.Errorf("Container %s: unquiesce exec command should be specified", name)
+		}
+
+		// Validate env from exec
+		envFromVars := map[string]struct{}{}
+		for _, envFrom := range container.EnvFromExec {
+			if envFrom.Container.Name == "" || len(envFrom.Command) == 0 || envFrom.Var == "" {
+				return fmt.Errorf("Container %s: env_from_exec should specify container, command and var", name)
+			}
+			if strings.ContainsAny(envFrom.Var, "= ") {
+				return fmt.Errorf("Container %s: env_from_exec has bad var name %q", name, envFrom.Var)
+			}
+			if _, ok := envFromVars[envFrom.Var]; ok {
+				return fmt.Errorf("Container %s: env_from_exec var %s is given more than once", name, envFrom.Var)
+			}
+			envFromVars[envFrom.Var] = struct{}{}
+		}
+
+		// Validate external services
+		for _, external := range container.WaitForExternal {
+			if err := external.validate(); err != nil {
+				return fmt.Errorf("Container %s: wait_for_external %s", name, err)
+			}
+		}
+
+		// Validate secret env patterns
+		for _, pattern := range container.SecretEnv {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Container %s: bad secret_env pattern %q", name, pattern)
+			}
+		}
+
+		// Validate cpusets, cpuset_cpus is also checked against the host CPUs, see CheckCpusets
+		if container.CpusetCpus != nil && *container.CpusetCpus != "" {
+			if _, err := ParseCpuset(*container.CpusetCpus); err != nil {
+				return fmt.Errorf("Container %s: cpuset_cpus %s", name, err)
+			}
+		}
+		if container.CpusetMems != nil && *container.CpusetMems != "" {
+			if _, err := ParseCpuset(*container.CpusetMems); err != nil {
+				return fmt.Errorf("Container %s: cpuset_mems %s", name, err)
+			}
+		}
+
+		// Validate devices
+		for _, device := range container.Devices {
+			if _, err := ParseDevice(device); err != nil {
+				return fmt.Errorf("Container %s: %s", name, err)
+			}
+		}
+
+		// Validate pull timeout
+		if container.PullTimeout.Get(0) < 0 {
+			return fmt.Errorf("Container %s: pull_timeout should not be negative", name)
+		}
+
+		// Validate startup delay
+		if container.StartupDelay.Get(0) < 0 {
+			return fmt.Errorf("Container %s: startup_delay should not be negative", name)
+		}
+
+		// Validate when conditions
+		for _, expr := range container.When {
+			if _, err := ParseCondition(expr); err != nil {
+				return fmt.Errorf("Container %s: %s", name, err)
+			}
+		}
+
+		// Validate platform
+		if container.Platform != "" {
+			if parts := strings.Split(container.Platform, "/"); len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("Container %s: invalid platform %s, expected format is os/arch[/variant]", name, container.Platform)
+			}
+		}
+
+		// Validate restart backoff
+		if container.RestartBackoff != nil {
+			if err := container.RestartBackoff.validate(); err != nil {
+				return fmt.Errorf("Container %s: %s", name, err)
+			}
+		}
+
+		// Validate the pull secret reference
+		if container.PullSecret != "" {
+			if _, ok := config.Credentials[container.PullSecret]; !ok {
+				return fmt.Errorf("Container %s: cannot find credential %s referred by pull_secret",
+					name, container.PullSecret)
+			}
+		}
+
+		// Validate required env vars, spec templates are checked through the containers extending them
+		if !strings.HasPrefix(name, "_") {
+			missing := []string{}
+			for _, key := range container.RequiredEnv {
+				if container.Env[key] == "" {
+					missing = append(missing, key)
+				}
+			}
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				return fmt.Errorf("Container %s: required env vars are not set: %s", name, strings.Join(missing, ", "))
+			}
 		}
 
 		img := imagename.NewFromString(*container.Image)
 
 		if !img.IsStrict() && !img.HasVersionRange() && !img.All() {
-			return nil, fmt.Errorf("Image `%s` for container `%s`: image without tag is not allowed",
+			return fmt.Errorf("Image `%s` for container `%s`: image without tag is not allowed",
 				*container.Image, name)
 		}
 
@@ -380,6 +878,9 @@ func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs m
 		for k := range container.WaitFor {
 			container.WaitFor[k].DefaultNamespace(config.Namespace)
 		}
+		for k := range container.EnvFromExec {
+			container.EnvFromExec[k].Container.DefaultNamespace(config.Namespace)
+		}
 		if container.Net != nil && container.Net.Type == "container" {
 			container.Net.Container.DefaultNamespace(config.Namespace)
 		}
@@ -397,10 +898,13 @@ func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs m
 			if len(split) == 1 {
 				continue
 			}
+			if warning := legacyVolumeWarning(name, volume); warning != nil {
+				config.Warnings = append(config.Warnings, *warning)
+			}
 			if strings.HasPrefix(split[0], "~") {
 				home, err := getHome()
 				if err != nil {
-					return nil, fmt.Errorf("Failed to get HOME path, error: %s", err)
+					return fmt.Errorf("Failed to get HOME path, error: %s", err)
 				}
 				split[0] = strings.Replace(split[0], "~", home, 1)
 			}
@@ -409,9 +913,114 @@ func ReadConfig(configName string, reader io.Reader, vars template.Vars, funcs m
 			}
 			container.Volumes[i] = strings.Join(split, ":")
 		}
+
+		// Process relative paths in mounts
+		for i, mount := range container.Mounts {
+			if mount.Target == "" {
+				return fmt.Errorf("Container %s: target should be specified for every mount", name)
+			}
+			if mount.Source != "" && mount.Volume != "" {
+				return fmt.Errorf("Container %s: mount %s cannot have both source and volume", name, mount.Target)
+			}
+			if mount.Subpath != "" {
+				if mount.Volume == "" {
+					return fmt.Errorf("Container %s: mount %s: subpath can be used only with volume", name, mount.Target)
+				}
+				subpath := path.Clean(mount.Subpath)
+				if path.IsAbs(subpath) || subpath == ".." || strings.HasPrefix(subpath, "../") {
+					return fmt.Errorf("Container %s: mount %s: subpath %s should be relative to the volume",
+						name, mount.Target, mount.Subpath)
+				}
+				mount.Subpath = subpath
+				container.Mounts[i] = mount
+			}
+			if mount.Seed != "" && mount.Volume == "" {
+				return fmt.Errorf("Container %s: mount %s: seed can be used only with volume", name, mount.Target)
+			}
+			if mount.SeedPath != "" && (mount.Seed == "" || !path.IsAbs(mount.SeedPath)) {
+				return fmt.Errorf("Container %s: mount %s: seed_path should be an absolute path in the seed image",
+					name, mount.Target)
+			}
+			if mount.Source == "" {
+				continue
+			}
+			if strings.HasPrefix(mount.Source, "~") {
+				home, err := getHome()
+				if err != nil {
+					return fmt.Errorf("Failed to get HOME path, error: %s", err)
+				}
+				mount.Source = strings.Replace(mount.Source, "~", home, 1)
+			}
+			if !path.IsAbs(mount.Source) {
+				mount.Source = path.Join(basedir, mount.Source)
+			}
+			container.Mounts[i] = mount
+		}
+
+		// Process relative paths in hash_paths and calculate the content hash
+		if len(container.HashPaths) > 0 {
+			for i, hashPath := range container.HashPaths {
+				if strings.HasPrefix(hashPath, "~") {
+					home, err := getHome()
+					if err != nil {
+						return fmt.Errorf("Failed to get HOME path, error: %s", err)
+					}
+					hashPath = strings.Replace(hashPath, "~", home, 1)
+				}
+				if !path.IsAbs(hashPath) {
+					hashPath = path.Join(basedir, hashPath)
+				}
+				container.HashPaths[i] = hashPath
+			}
+			hash, err := hashPaths(basedir, container.HashPaths)
+			if err != nil {
+				return fmt.Errorf("Container %s: %s", name, err)
+			}
+			container.contentHash = hash
+		}
 	}
 
-	return config, nil
+	// Render cmd and entrypoint templates, apply log rotation and check ports once all
+	// containers are extended, spec templates are handled through the containers extending them
+	for name, container := range config.Containers {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		if err := container.renderCmdTemplates(); err != nil {
+			return fmt.Errorf("Container %s: %s", name, err)
+		}
+		config.LogRotation.apply(container)
+
+		if err := container.validateMemory(); err != nil {
+			return fmt.Errorf("Container %s: %s", name, err)
+		}
+		if err := container.validateCPU(); err != nil {
+			return fmt.Errorf("Container %s: %s", name, err)
+		}
+		if err := validateNaming(ContainerName{config.Namespace, name}, naming); err != nil {
+			return fmt.Errorf("Container %s: %s", name, err)
+		}
+		container.naming = naming
+		for _, memory := range container.memoryFields() {
+			if _, percent := container.hostPercents[memory.name]; memory.unsupported && (*memory.field != nil || percent) {
+				config.Warnings = append(config.Warnings, Warning{
+					Container: name,
+					Message:   fmt.Sprintf("%s is not supported by the docker client yet and is ignored", memory.name),
+				})
+			}
+		}
+
+		// Ports are not published with the host network, see GetAPIHostConfig
+		publishAll := container.PublishAllPorts != nil && *container.PublishAllPorts
+		if container.Net.IsHost() && (len(container.Ports) > 0 || publishAll) {
+			config.Warnings = append(config.Warnings, Warning{
+				Container: name,
+				Message:   "ports and publish_all_ports are ignored with net: host, the container uses the ports of the host directly",
+			})
+		}
+	}
+
+	return nil
 }
 
 // HasExternalRefs returns true if there is at least one reference to the external namespace
@@ -432,6 +1041,11 @@ func (c *Config) HasExternalRefs() bool {
 				return true
 			}
 		}
+		for k := range container.EnvFromExec {
+			if container.EnvFromExec[k].Container.GetNamespace() != c.Namespace {
+				return true
+			}
+		}
 		if container.Net != nil && container.Net.Type == "container" {
 			if container.Net.Container.GetNamespace() != c.Namespace {
 				return true
@@ -493,35 +1107,44 @@ func NewLinkFromString(str string) *Link {
 // Examples of string that can be given:
 //    "124124" (124124 bytes)
 //    "124124b" (same)
-//    "1024k"
+//    "1024k" or "1024kb"
 //    "512m"
-//    "2g"
+//    "1.5g"
+//    "1t"
+//    "-1" (unlimited, makes sense for memory_swap only)
+// Units are case insensitive and binary, e.g. 1k is 1024 bytes.
 func NewConfigMemoryFromString(str string) (*Memory, error) {
-	var (
-		value int64
-		t     string
-	)
-
 	if str == "" {
 		return nil, nil
 	}
 
-	if _, err := fmt.Sscanf(str, "%d%s", &value, &t); err != nil {
-		if _, err := fmt.Sscanf(str, "%d", &value); err != nil {
-			return nil, err
-		}
+	matches := memoryRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(str)))
+	if matches == nil {
+		return nil, errMemoryFormat(str)
 	}
-	for idx, ct := range []string{"b", "k", "m", "g"} {
-		if ct == strings.ToLower(t) {
-			value = value * (int64)(math.Pow(1024, (float64)(idx)))
-			break
-		}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return nil, errMemoryFormat(str)
+	}
+	if matches[2] != "" {
+		value *= math.Pow(1024, float64(strings.Index("bkmgt", matches[2])))
+	}
+	if value < 0 && (value != -1 || matches[2] != "") || value > math.MaxInt64 {
+		return nil, errMemoryFormat(str)
 	}
 
-	memory := (Memory)(value)
+	memory := (Memory)(round(value))
 	return &memory, nil
 }
 
+var memoryRegexp = regexp.MustCompile(`^(-?[0-9]+(?:\.[0-9]+)?)\s*(?:([bkmgt])b?)?$`)
+
+// errMemoryFormat is the error of all memory properties that cannot be parsed
+func errMemoryFormat(str string) error {
+	return fmt.Errorf("Failed to parse memory %q, expected bytes with optional unit b, k, m, g or t (e.g. 512m), or percentage of the host memory", str)
+}
+
 // NewConfigMemoryFromInt64 makes a ConfigMemory from int64 value
 func NewConfigMemoryFromInt64(value int64) *Memory {
 	if value == 0 {
@@ -548,9 +1171,130 @@ func NewNetFromString(str string) (*Net, error) {
 	return n, nil
 }
 
+// mergeUlimits returns the list of base ulimits where the ones having the same name
+// are replaced by the overrides, other overrides are appended to the end
+func mergeUlimits(base, overrides []Ulimit) []Ulimit {
+	result := []Ulimit{}
+	overridden := map[string]struct{}{}
+
+	for _, ulimit := range base {
+		for _, override := range overrides {
+			if override.Name == ulimit.Name {
+				ulimit = override
+				overridden[override.Name] = struct{}{}
+				break
+			}
+		}
+		result = append(result, ulimit)
+	}
+	for _, override := range overrides {
+		if _, ok := overridden[override.Name]; !ok {
+			result = append(result, override)
+		}
+	}
+
+	return result
+}
+
+// legacyVolumeWarning returns a warning if the given "volumes" entry specifies
+// mode options that are clearer when written as a long form "mounts" entry.
+func legacyVolumeWarning(container, volume string) *Warning {
+	split := strings.SplitN(volume, ":", 3)
+	if len(split) < 3 {
+		return nil
+	}
+
+	mount := Mount{
+		Source: split[0],
+		Target: split[1],
+	}
+	for _, opt := range strings.Split(split[2], ",") {
+		switch opt {
+		case "ro":
+			mount.ReadOnly = true
+		case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+			mount.Propagation = opt
+		}
+	}
+	if !mount.ReadOnly && mount.Propagation == "" {
+		return nil
+	}
+
+	return &Warning{
+		Container: container,
+		Message: fmt.Sprintf("volume %q uses legacy syntax, consider using mounts instead: %s",
+			volume, mount.flowString()),
+	}
+}
+
 // Methods
 
-// String gives a string representation of the container name
+// String returns the string representation of the warning
+func (w Warning) String() string {
+	return fmt.Sprintf("Container %s: %s", w.Container, w.Message)
+}
+
+// Bind returns the bind spec for the mount in "src:dest:mode" form which is eatable
+// by docker api, or an empty string if mount is a data volume or a volume subpath.
+// Subpath mounts need the mountpoint of the volume, see SubpathBind.
+func (m Mount) Bind() string {
+	switch {
+	case m.Source != "":
+		return m.bind(m.Source)
+	case m.Volume != "" && m.Subpath == "":
+		return m.bind(m.Volume)
+	}
+	return ""
+}
+
+// SubpathBind returns the bind spec for the subpath mount of the named volume
+// having the given mountpoint on the host
+func (m Mount) SubpathBind(mountpoint string) string {
+	return m.bind(path.Join(mountpoint, m.Subpath))
+}
+
+// GetSeedPath returns the directory of the seed image which is copied to the named volume
+func (m Mount) GetSeedPath() string {
+	if m.SeedPath != "" {
+		return m.SeedPath
+	}
+	return m.Target
+}
+
+// IsDataVolume returns true if the mount is neither a host path nor a named volume
+func (m Mount) IsDataVolume() bool {
+	return m.Source == "" && m.Volume == ""
+}
+
+func (m Mount) bind(source string) string {
+	opts := []string{}
+	if m.ReadOnly {
+		opts = append(opts, "ro")
+	}
+	if m.Propagation != "" {
+		opts = append(opts, m.Propagation)
+	}
+	bind := source + ":" + m.Target
+	if len(opts) > 0 {
+		bind += ":" + strings.Join(opts, ",")
+	}
+	return bind
+}
+
+// flowString returns a YAML flow representation of the mount, used in hints
+func (m Mount) flowString() string {
+	parts := []string{"source: " + m.Source, "target: " + m.Target}
+	if m.ReadOnly {
+		parts = append(parts, "read_only: true")
+	}
+	if m.Propagation != "" {
+		parts = append(parts, "propagation: "+m.Propagation)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// String gives a string representation of the container name as it is referred to
+// in the manifest, e.g. "namespace.name", the docker name is given by NamingStrategy
 func (n ContainerName) String() string {
 	name := n.Name
 	if n.Namespace != "" && !n.IsGlobalNs() {
@@ -561,7 +1305,11 @@ func (n ContainerName) String() string {
 
 // String is same as ContainerName.String() but adds alias
 func (link Link) String() string {
-	name := link.ContainerName.String()
+	return link.format(link.ContainerName.String())
+}
+
+// format adds alias to the given name of the linked container
+func (link Link) format(name string) string {
 	if name == "" && link.Alias == "" {
 		return ""
 	}
@@ -609,6 +1357,103 @@ func (link *Link) IsGlobalNs() bool {
 	return link.ContainerName.IsGlobalNs()
 }
 
+// Get returns time.Duration value of the Duration object or the given default if it is not set
+func (d *Duration) Get(def time.Duration) time.Duration {
+	if d == nil {
+		return def
+	}
+	return time.Duration(*d)
+}
+
+// GetInterval returns the pause between readiness attempts
+func (r *Readiness) GetInterval() time.Duration {
+	return r.Interval.Get(time.Second)
+}
+
+// GetTimeout returns the time given to a single readiness attempt
+func (r *Readiness) GetTimeout() time.Duration {
+	return r.Timeout.Get(10 * time.Second)
+}
+
+// GetStable returns the time the readiness command should keep passing after it passed
+// for the first time, it is checked for the containers which are restarted on exit
+func (r *Readiness) GetStable() time.Duration {
+	return r.Stable.Get(3 * r.GetInterval())
+}
+
+// GetRetries returns the number of readiness attempts
+func (r *Readiness) GetRetries() int {
+	if r.Retries == nil {
+		return 30
+	}
+	return *r.Retries
+}
+
+// GetWait returns the pause between the pre-stop command and stopping the container
+func (p *PreStop) GetWait() time.Duration {
+	return p.Wait.Get(0)
+}
+
+// GetTimeout returns the time given to the pre-stop command
+func (p *PreStop) GetTimeout() time.Duration {
+	return p.Timeout.Get(10 * time.Second)
+}
+
+// GetTimeout returns the time given to the hook command
+func (h *Hook) GetTimeout() time.Duration {
+	return h.Timeout.Get(10 * time.Second)
+}
+
+// GetPullPolicy returns the "pull_policy" of the container or the default one: images by tag
+// are always pulled since any tag is mutable, so the container is recreated once the tag points
+// to another image, while content-addressed images, pinned by digest or tagged by rocker with
+// the "sha256-" prefix, are pulled only if missing
+func (c *Container) GetPullPolicy() string {
+	if c.PullPolicy != "" {
+		return c.PullPolicy
+	}
+	if c.Image != nil && !imagename.NewFromString(*c.Image).TagIsSha() {
+		return PullAlways
+	}
+	return PullMissing
+}
+
+// GetTimeout returns the total time to wait for the external service
+func (e *External) GetTimeout() time.Duration {
+	return e.Timeout.Get(60 * time.Second)
+}
+
+// GetInterval returns the pause between the attempts to reach the external service
+func (e *External) GetInterval() time.Duration {
+	return e.Interval.Get(time.Second)
+}
+
+// String returns the url or the host:port address of the external service
+func (e External) String() string {
+	if e.URL != "" {
+		return e.URL
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// validate checks that either host and port or http url of the external service is given
+func (e *External) validate() error {
+	if e.URL != "" {
+		if e.Host != "" || e.Port != 0 {
+			return fmt.Errorf("%s: either url or host and port should be given", e.URL)
+		}
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s: expecting http or https url", e.URL)
+		}
+		return nil
+	}
+	if e.Host == "" || e.Port < 1 || e.Port > 65535 {
+		return fmt.Errorf("%s: host and port or url should be given", e)
+	}
+	return nil
+}
+
 // Int64 returns int64 value of the ConfigMemory object
 func (m *Memory) Int64() int64 {
 	if m == nil {
@@ -652,3 +1497,16 @@ func (net *Net) String() string {
 	}
 	return net.Type
 }
+
+// format returns the network mode given to docker, the container is referred to by its docker name
+func (net *Net) format(naming NamingStrategy) string {
+	if net != nil && net.Type == "container" {
+		return net.Type + ":" + naming.Format(net.Container)
+	}
+	return net.String()
+}
+
+// IsHost returns true if the container uses the network stack of the host
+func (net *Net) IsHost() bool {
+	return net != nil && net.Type == "host"
+}
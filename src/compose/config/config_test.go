@@ -17,9 +17,15 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-yaml/yaml"
 	"github.com/grammarly/rocker/src/template"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,21 +53,30 @@ func TestNewFromFile(t *testing.T) {
 
 func TestConfigMemoryInt64(t *testing.T) {
 	assertions := map[string]int64{
-		"-1":   -1,
-		"0":    0,
-		"100":  100,
-		"100x": 100,
-		"100b": 100,
-		"100k": 102400,
-		"100m": 104857600,
-		"100g": 107374182400,
+		"-1":     -1,
+		"0":      0,
+		"100":    100,
+		"100b":   100,
+		"100k":   102400,
+		"100K":   102400,
+		"100kb":  102400,
+		"100m":   104857600,
+		"100 MB": 104857600,
+		"100g":   107374182400,
+		"1.5g":   1610612736,
+		"2t":     2199023255552,
 	}
 	for input, expected := range assertions {
 		actual, err := NewConfigMemoryFromString(input)
 		if err != nil {
 			t.Fatal(err)
 		}
-		assert.EqualValues(t, expected, *actual)
+		assert.EqualValues(t, expected, *actual, input)
+	}
+
+	for _, input := range []string{"100x", "100mm", "m", "1.5.5g", "-2", "-1m", "1e3", "ten"} {
+		_, err := NewConfigMemoryFromString(input)
+		assert.EqualError(t, err, fmt.Sprintf("Failed to parse memory %q, expected bytes with optional unit b, k, m, g or t (e.g. 512m), or percentage of the host memory", input))
 	}
 }
 
@@ -81,6 +96,48 @@ containers:
 	assert.Equal(t, Cmd{"/bin/sh", "-c", "whoami"}, config.Containers["whoami"].Cmd)
 }
 
+func TestConfigEntrypointReset(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  default:
+    image: ubuntu:14.04
+  reset:
+    image: ubuntu:14.04
+    entrypoint: []
+  custom:
+    image: ubuntu:14.04
+    entrypoint: [/bin/sh, -c]
+  child:
+    extends: custom
+    entrypoint: []`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, config.Containers["default"].Entrypoint)
+	assert.Nil(t, config.Containers["default"].GetAPIConfig().Entrypoint, "unset keeps the image entrypoint")
+
+	for _, name := range []string{"reset", "child"} {
+		assert.Equal(t, &Strings{}, config.Containers[name].Entrypoint, name)
+		assert.Equal(t, []string{}, config.Containers[name].GetAPIConfig().Entrypoint, "%s resets the image entrypoint", name)
+	}
+
+	// the reset survives serialization to the container label
+	data, err := yaml.Marshal(config.Containers["reset"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &Container{}
+	if err := yaml.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Strings{}, restored.Entrypoint)
+	assert.True(t, config.Containers["reset"].IsEqualTo(restored))
+	assert.False(t, config.Containers["default"].IsEqualTo(restored))
+}
+
 func TestConfigNoImageSpecified(t *testing.T) {
 	configStr := `namespace: test
 containers:
@@ -222,3 +279,561 @@ containers:
 		assert.Equal(t, out, cfg.HasExternalRefs())
 	}
 }
+
+func TestNewFromDir(t *testing.T) {
+	config, err := NewFromDir("testdata/dropins", configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "dropins", config.Namespace)
+	assert.Equal(t, 3, len(config.Containers))
+
+	main := config.Containers["main"]
+
+	// later files win
+	assert.Equal(t, "quay.io/myapp:1.9.3", *main.Image)
+	assert.Equal(t, "debug", main.Env["LOG_LEVEL"])
+	assert.EqualValues(t, 314572800, *main.Memory)
+
+	// properties of previous files are kept
+	assert.EqualValues(t, 512, *main.CPUShares)
+	assert.Equal(t, "myapp", main.Labels["service"])
+	assert.Equal(t, "1", main.Labels["num"])
+
+	// extends works across files
+	assert.Equal(t, "quay.io/myapp:1.9.3", *config.Containers["worker"].Image)
+	assert.Equal(t, Cmd{"worker"}, config.Containers["worker"].Cmd)
+	assert.Equal(t, "mysql:5.6", *config.Containers["db"].Image)
+}
+
+func TestNewFromDirMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocker-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"00-base.yml":   "namespace: test\ncontainers:\n  main:\n    image: ubuntu:14.04",
+		"10-broken.yml": "containers:\n  main:\n    image: [ubuntu",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = NewFromDir(dir, configTestVars, map[string]interface{}{}, false)
+	if err == nil {
+		t.Fatal("Expected error for malformed file")
+	}
+	assert.Contains(t, err.Error(), filepath.Join(dir, "10-broken.yml"))
+}
+
+func TestNewFromDirEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocker-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewFromDir(dir, configTestVars, map[string]interface{}{}, false)
+	assert.Error(t, err)
+}
+
+func TestConfigLegacyVolumeWarnings(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    volumes:
+      - /data
+      - /tmp:/tmp
+      - /tmp:/tmp2:rw
+      - /etc/hosts:/etc/hosts:ro
+      - /mnt:/mnt:rslave`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []Warning{
+		{
+			Container: "main",
+			Message:   `volume "/etc/hosts:/etc/hosts:ro" uses legacy syntax, consider using mounts instead: {source: /etc/hosts, target: /etc/hosts, read_only: true}`,
+		},
+		{
+			Container: "main",
+			Message:   `volume "/mnt:/mnt:rslave" uses legacy syntax, consider using mounts instead: {source: /mnt, target: /mnt, propagation: rslave}`,
+		},
+	}, config.Warnings)
+}
+
+func TestConfigMounts(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    mounts:
+      - target: /data
+      - source: ./etc
+        target: /etc/app
+        read_only: true
+        propagation: rslave`
+
+	config, err := ReadConfig("/opt/compose.yml", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, config.Warnings)
+
+	mounts := config.Containers["main"].Mounts
+	assert.Equal(t, "", mounts[0].Bind())
+	assert.Equal(t, "/opt/etc:/etc/app:ro,rslave", mounts[1].Bind())
+}
+
+func TestConfigMountsNoTarget(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    mounts:
+      - source: /data`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.Equal(t, "Container main: target should be specified for every mount", err.Error())
+}
+
+func TestConfigMountsVolumeSubpath(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    mounts:
+      - volume: myvol
+        target: /cache
+      - volume: myvol
+        subpath: ./sub/dir/
+        target: /data
+        read_only: true`
+
+	config, err := ReadConfig("/opt/compose.yml", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := config.Containers["main"].Mounts
+	assert.Equal(t, "myvol:/cache", mounts[0].Bind())
+	assert.Equal(t, "sub/dir", mounts[1].Subpath)
+	assert.Equal(t, "", mounts[1].Bind())
+	assert.Equal(t, "/var/lib/docker/volumes/myvol/_data/sub/dir:/data:ro",
+		mounts[1].SubpathBind("/var/lib/docker/volumes/myvol/_data"))
+	assert.Empty(t, config.Containers["main"].GetAPIConfig().Volumes)
+}
+
+func TestConfigMountsInvalidSubpath(t *testing.T) {
+	tests := map[string]string{
+		"subpath: sub":                            "Container main: mount /data: subpath can be used only with volume",
+		"volume: myvol\n        subpath: /sub":    "Container main: mount /data: subpath /sub should be relative to the volume",
+		"volume: myvol\n        subpath: a/../..": "Container main: mount /data: subpath a/../.. should be relative to the volume",
+		"volume: myvol\n        source: /sub":     "Container main: mount /data cannot have both source and volume",
+	}
+
+	for mount, expected := range tests {
+		configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    mounts:
+      - target: /data
+        ` + strings.Replace(mount, "\\n", "\n", -1)
+
+		_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		if assert.Error(t, err, mount) {
+			assert.Equal(t, expected, err.Error())
+		}
+	}
+}
+
+func TestConfigPullSecretNotFound(t *testing.T) {
+	configStr := `namespace: test
+credentials:
+  private:
+    username: robot
+containers:
+  main:
+    image: ubuntu:14.04
+    pull_secret: other`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.Equal(t, "Container main: cannot find credential other referred by pull_secret", err.Error())
+}
+
+func TestConfigRecreateStrategyHostPort(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    recreate_strategy: start-first
+    ports:
+      - "8080:80"`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.Equal(t, "Container main: recreate_strategy start-first cannot be used with fixed host port 8080", err.Error())
+}
+
+func TestConfigRequiredEnv(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: ubuntu:14.04
+    required_env: [API_KEY, DB_HOST]
+  main:
+    extends: _base
+    env:
+      API_KEY: {{ .api_key }}
+      DB_HOST: db.local`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{"api_key": "secret"}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "secret", config.Containers["main"].Env["API_KEY"])
+}
+
+func TestConfigRequiredEnvMissing(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    required_env: [DB_HOST, API_KEY, LOG_LEVEL]
+    env:
+      API_KEY: "{{ .api_key }}"
+      LOG_LEVEL: debug`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{"api_key": ""}, map[string]interface{}{}, false)
+	assert.Equal(t, "Container main: required env vars are not set: API_KEY, DB_HOST", err.Error())
+}
+
+func TestConfigReadiness(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  db:
+    image: postgres:9.4
+    readiness:
+      exec: [pg_isready, -h, localhost]
+      interval: 500ms
+      retries: 5`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readiness := config.Containers["db"].Readiness
+	assert.Equal(t, Strings{"pg_isready", "-h", "localhost"}, readiness.Exec)
+	assert.Equal(t, 500*time.Millisecond, readiness.GetInterval())
+	assert.Equal(t, 10*time.Second, readiness.GetTimeout())
+	assert.Equal(t, 5, readiness.GetRetries())
+	assert.Equal(t, 1500*time.Millisecond, readiness.GetStable(), "stable should default to 3 intervals")
+}
+
+func TestConfigUlimitProfile(t *testing.T) {
+	configStr := `namespace: test
+ulimit_profiles:
+  server:
+    - name: nofile
+      soft: 1024
+      hard: 2048
+    - name: nproc
+      soft: 512
+      hard: 512
+containers:
+  main:
+    image: ubuntu:14.04
+    ulimit_profile: server
+  db:
+    image: ubuntu:14.04
+    ulimit_profile: server
+    ulimits:
+      - name: nofile
+        soft: 65536
+        hard: 65536
+      - name: memlock
+        soft: -1
+        hard: -1`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []Ulimit{
+		{Name: "nofile", Soft: 1024, Hard: 2048},
+		{Name: "nproc", Soft: 512, Hard: 512},
+	}, config.Containers["main"].Ulimits)
+
+	assert.Equal(t, []Ulimit{
+		{Name: "nofile", Soft: 65536, Hard: 65536},
+		{Name: "nproc", Soft: 512, Hard: 512},
+		{Name: "memlock", Soft: -1, Hard: -1},
+	}, config.Containers["db"].Ulimits)
+}
+
+func TestConfigUlimitProfileNotFound(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    ulimit_profile: server`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.Equal(t, "Container main: cannot find ulimit profile server", err.Error())
+}
+
+func TestConfigInvalidPlatform(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    platform: amd64`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.Equal(t, "Container main: invalid platform amd64, expected format is os/arch[/variant]", err.Error())
+}
+
+func TestConfigPreStop(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: nginx:1.9
+    pre_stop:
+      exec: ["touch", "/tmp/draining"]
+      wait: 15s
+  broken:
+    image: nginx:1.9
+    pre_stop:
+      wait: 15s`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container broken: pre_stop exec command should be specified")
+
+	configStr = strings.Split(configStr, "\n  broken:")[0]
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preStop := config.Containers["main"].PreStop
+	assert.Equal(t, Strings{"touch", "/tmp/draining"}, preStop.Exec)
+	assert.Equal(t, 15*time.Second, preStop.GetWait())
+	assert.Equal(t, 10*time.Second, preStop.GetTimeout())
+}
+
+func TestConfigQuiesce(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: worker:1.0
+    quiesce:
+      exec: ["worker", "pause"]
+      timeout: 30s
+  main:
+    extends: _base
+    unquiesce:
+      exec: ["worker", "resume"]
+  broken:
+    image: worker:1.0
+    unquiesce:
+      timeout: 30s`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container broken: unquiesce exec command should be specified")
+
+	configStr = strings.Split(configStr, "\n  broken:")[0]
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := config.Containers["main"]
+	assert.Equal(t, Strings{"worker", "pause"}, main.Quiesce.Exec, "quiesce should be inherited")
+	assert.Equal(t, 30*time.Second, main.Quiesce.GetTimeout())
+	assert.Equal(t, Strings{"worker", "resume"}, main.Unquiesce.Exec)
+	assert.Equal(t, 10*time.Second, main.Unquiesce.GetTimeout())
+}
+
+func TestConfigStartupDelay(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: nginx:1.9
+    startup_delay: 5s
+  broken:
+    image: nginx:1.9
+    startup_delay: -1s`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container broken: startup_delay should not be negative")
+
+	configStr = strings.Split(configStr, "\n  broken:")[0]
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 5*time.Second, config.Containers["main"].StartupDelay.Get(0))
+}
+
+func TestConfigWaitForExternal(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: nginx:1.9
+    wait_for_external:
+      - host: db.example.com
+        port: 5432
+        timeout: 2m
+      - url: http://auth.example.com/health
+  broken:
+    image: nginx:1.9
+    wait_for_external:
+      - host: db.example.com`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container broken: wait_for_external db.example.com:0: host and port or url should be given")
+
+	configStr = strings.Split(configStr, "\n  broken:")[0]
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	externals := config.Containers["main"].WaitForExternal
+	assert.Len(t, externals, 2)
+	assert.Equal(t, "db.example.com:5432", externals[0].String())
+	assert.Equal(t, 2*time.Minute, externals[0].GetTimeout())
+	assert.Equal(t, "http://auth.example.com/health", externals[1].String())
+	assert.Equal(t, 60*time.Second, externals[1].GetTimeout())
+	assert.Equal(t, time.Second, externals[1].GetInterval())
+}
+
+func TestExternalValidate(t *testing.T) {
+	assert.NoError(t, (&External{URL: "https://example.com"}).validate())
+	assert.EqualError(t, (&External{URL: "tcp://example.com:80"}).validate(),
+		"tcp://example.com:80: expecting http or https url")
+	assert.EqualError(t, (&External{URL: "http://example.com", Port: 80}).validate(),
+		"http://example.com: either url or host and port should be given")
+	assert.EqualError(t, (&External{Host: "example.com", Port: 70000}).validate(),
+		"example.com:70000: host and port or url should be given")
+}
+
+func TestContainerGetPullPolicy(t *testing.T) {
+	newContainer := func(image, policy string) *Container {
+		return &Container{Image: &image, PullPolicy: policy}
+	}
+
+	digest := "sha256:ead434cd278824865d6e3b67e5d4579ded02eb2e8367fc165efa21138b225f11"
+	tests := []struct {
+		image, policy, expected string
+	}{
+		{"nginx:latest", "", PullAlways},
+		{"nginx", "", PullAlways},
+		{"nginx:1.9", "", PullAlways},
+		{"quay.io/app:stable", "", PullAlways},
+		{"localhost:5000/app:1.0", "", PullAlways},
+		{"nginx@" + digest, "", PullMissing},
+		{"quay.io/app@" + digest, "", PullMissing},
+		{"quay.io/app:sha256-ead434cd2788", "", PullMissing},
+		{"s3:bucket/app:sha256-ead434cd2788", "", PullMissing},
+		{"nginx:latest", "never", PullNever},
+		{"nginx:1.9", "missing", PullMissing},
+		{"nginx@" + digest, "always", PullAlways},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, newContainer(test.image, test.policy).GetPullPolicy(), test.image)
+	}
+	assert.Equal(t, PullMissing, (&Container{}).GetPullPolicy())
+
+	configStr := `namespace: test
+containers:
+  main:
+    image: nginx:1.9
+    pull_policy: sometimes`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container main: unknown pull_policy sometimes, possible values are always, missing and never")
+}
+
+func TestConfigMountSeed(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: postgres:9.4
+    mounts:
+      - volume: db_data
+        target: /var/lib/postgresql/data
+        seed: db-fixtures:1.0`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mount := config.Containers["main"].Mounts[0]
+	assert.Equal(t, "db-fixtures:1.0", mount.Seed)
+	assert.Equal(t, "/var/lib/postgresql/data", mount.GetSeedPath())
+
+	tests := []struct {
+		mount, err string
+	}{
+		{"{source: /data, target: /data, seed: 'db-fixtures:1.0'}", "Container main: mount /data: seed can be used only with volume"},
+		{"{volume: db_data, target: /data, seed_path: /fixtures}", "Container main: mount /data: seed_path should be an absolute path in the seed image"},
+		{"{volume: db_data, target: /data, seed: 'db:1.0', seed_path: fixtures}", "Container main: mount /data: seed_path should be an absolute path in the seed image"},
+	}
+	for _, test := range tests {
+		configStr := "namespace: test\ncontainers:\n  main:\n    image: postgres:9.4\n    mounts: [" + test.mount + "]"
+		_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+func TestConfigEnvFromExec(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  vault:
+    image: vault:0.6
+  main:
+    image: app:1.0
+    env_from_exec:
+      - container: vault
+        command: [vault, read, -field=password, secret/db]
+        var: DB_PASSWORD`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFrom := config.Containers["main"].EnvFromExec
+	assert.Equal(t, []EnvFromExec{{
+		Container: *NewContainerName("test", "vault"),
+		Command:   Strings{"vault", "read", "-field=password", "secret/db"},
+		Var:       "DB_PASSWORD",
+	}}, envFrom)
+
+	tests := []struct {
+		envFrom, err string
+	}{
+		{"[{container: vault, var: TOKEN}]", "Container main: env_from_exec should specify container, command and var"},
+		{"[{container: vault, command: [cat, token], var: 'A B'}]", "Container main: env_from_exec has bad var name \"A B\""},
+		{"[{container: vault, command: [cat, a], var: A}, {container: vault, command: [cat, b], var: A}]",
+			"Container main: env_from_exec var A is given more than once"},
+	}
+	for _, test := range tests {
+		configStr := "namespace: test\ncontainers:\n  main:\n    image: app:1.0\n    env_from_exec: " + test.envFrom
+		_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		assert.EqualError(t, err, test.err)
+	}
+}
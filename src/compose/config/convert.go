@@ -18,6 +18,8 @@ package config
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -28,35 +30,341 @@ import (
 // to beinitialized by rocker-compose
 type ErrNotRockerCompose struct {
 	ContainerID string
+	Label       string
 }
 
 // Error returns string error
 func (err ErrNotRockerCompose) Error() string {
-	return fmt.Sprintf("Expecting container %.12s to have label 'rocker-compose-config' to parse it", err.ContainerID)
+	return fmt.Sprintf("Expecting container %.12s to have label '%s' to parse it", err.ContainerID, err.Label)
 }
 
-// NewFromDocker produces an container spec object from a docker.Container given by go-dockerclient.
-func NewFromDocker(apiContainer *docker.Container) (*Container, error) {
-	yamlData, ok := apiContainer.Config.Labels["rocker-compose-config"]
+// NewFromDocker produces an container spec object from a docker.Container given by go-dockerclient,
+// the spec is read from the config label of the given prefix.
+func NewFromDocker(apiContainer *docker.Container, prefix LabelPrefix) (*Container, error) {
+	yamlData, ok := apiContainer.Config.Labels[prefix.Label(LabelConfig)]
 	if !ok {
-		return nil, ErrNotRockerCompose{apiContainer.ID}
+		return nil, ErrNotRockerCompose{apiContainer.ID, prefix.Label(LabelConfig)}
 	}
 
-	container := &Container{}
+	container := &Container{configLabel: yamlData}
 
 	if err := yaml.Unmarshal([]byte(yamlData), container); err != nil {
 		return nil, fmt.Errorf("Failed to parse YAML config for container %s, error: %s", apiContainer.Name, err)
 	}
 
-	if container.Labels != nil {
-		for k := range container.Labels {
-			if strings.HasPrefix(k, "rocker-compose-") {
-				delete(container.Labels, k)
+	// only the reserved labels are stripped, the user ones are kept even if they have the same prefix
+	container.Labels = prefix.userLabels(container.Labels)
+
+	if apiContainer.HostConfig != nil {
+		container.readHostConfig(apiContainer.HostConfig)
+		container.CpusetCpus = readCpuset(container.CpusetCpus, actualCpusetCpus(apiContainer))
+	}
+
+	return container, nil
+}
+
+// ConfigLabel returns the value of the config label the spec was restored from by NewFromDocker,
+// it is the original spec before the properties were overridden with the actual values of the container
+func (config *Container) ConfigLabel() string {
+	return config.configLabel
+}
+
+// readHostConfig overrides properties of the container spec restored from the label
+// with the values of the actual host config, so changes made to the container out of
+// band are detected by comparison.
+func (config *Container) readHostConfig(hostConfig *docker.HostConfig) {
+	// Privileged
+	if hostConfig.Privileged || config.Privileged != nil {
+		privileged := hostConfig.Privileged
+		config.Privileged = &privileged
+	}
+
+	// PublishAllPorts, it is not given to docker with the host network
+	if (hostConfig.PublishAllPorts || config.PublishAllPorts != nil) && hostConfig.NetworkMode != "host" {
+		publishAllPorts := hostConfig.PublishAllPorts
+		config.PublishAllPorts = &publishAllPorts
+	}
+
+	// ReadonlyRootfs
+	if hostConfig.ReadonlyRootfs || config.ReadonlyRootfs != nil {
+		readonlyRootfs := hostConfig.ReadonlyRootfs
+		config.ReadonlyRootfs = &readonlyRootfs
+	}
+
+	// CgroupParent
+	if hostConfig.CgroupParent != "" {
+		cgroupParent := hostConfig.CgroupParent
+		config.CgroupParent = &cgroupParent
+	} else {
+		config.CgroupParent = nil
+	}
+
+	// CpusetMems, the spec is left as is if it denotes the same set; CpusetCpus may be
+	// given by the container config as well, so it is read by the callers, see actualCpusetCpus
+	config.CpusetMems = readCpuset(config.CpusetMems, hostConfig.CPUSetMEMs)
+
+	// CPUQuota and CPUPeriod, unless they are given by cpus
+	if config.Cpus == nil {
+		config.CPUQuota = readInt64(config.CPUQuota, hostConfig.CPUQuota)
+		config.CPUPeriod = readInt64(config.CPUPeriod, hostConfig.CPUPeriod)
+	}
+
+	// Pid
+	if hostConfig.PidMode != "" {
+		pid := hostConfig.PidMode
+		config.Pid = &pid
+	} else {
+		config.Pid = nil
+	}
+
+	// Net, docker reports "default" if network mode was not given;
+	// for the "container" mode only the type is compared, because docker
+	// may store the reference to the container either by name or by id
+	netType := "bridge"
+	if config.Net != nil {
+		netType = config.Net.Type
+	}
+	mode := hostConfig.NetworkMode
+	if mode == "" || mode == "default" {
+		mode = "bridge"
+	}
+	if strings.SplitN(mode, ":", 2)[0] != netType {
+		if net, err := NewNetFromString(mode); err == nil {
+			config.Net = net
+		} else {
+			config.Net = &Net{Type: mode}
+		}
+	}
+
+	// LogDriver and LogOpt, the spec is left as is if it produces the same log config;
+	// without them the daemon default applies, so whatever docker reports is not a change
+	hasLogConfig := config.LogDriver != nil || config.LogOpt != nil
+	if expected := config.GetAPIHostConfig().LogConfig; hasLogConfig && !isEqualLogConfig(expected, hostConfig.LogConfig) {
+		config.LogDriver = nil
+		if hostConfig.LogConfig.Type != "" {
+			logDriver := hostConfig.LogConfig.Type
+			config.LogDriver = &logDriver
+		}
+		config.LogOpt = nil
+		if len(hostConfig.LogConfig.Config) > 0 {
+			config.LogOpt = map[string]string{}
+			for k, v := range hostConfig.LogConfig.Config {
+				config.LogOpt[k] = v
 			}
 		}
 	}
 
-	return container, nil
+	// Capabilities, nil and empty lists are equal and the order is not compared
+	config.CapAdd = nil
+	if len(hostConfig.CapAdd) > 0 {
+		config.CapAdd = append(Strings{}, hostConfig.CapAdd...)
+	}
+	config.CapDrop = nil
+	if len(hostConfig.CapDrop) > 0 {
+		config.CapDrop = append(Strings{}, hostConfig.CapDrop...)
+	}
+
+	// SecurityOpt, same as capabilities
+	config.SecurityOpt = nil
+	if len(hostConfig.SecurityOpt) > 0 {
+		config.SecurityOpt = append(Strings{}, hostConfig.SecurityOpt...)
+	}
+
+	// Devices
+	config.Devices = readDevices(config.Devices, hostConfig.Devices)
+
+	// Ulimits, their order is not compared
+	config.Ulimits = nil
+	for _, ulimit := range hostConfig.Ulimits {
+		config.Ulimits = append(config.Ulimits, Ulimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+}
+
+// readInt64 returns the actual value of the host config, zero means it was not given
+// or was given as zero, which is the daemon default
+func readInt64(spec *int64, actual int64) *int64 {
+	if spec != nil && *spec == actual {
+		return spec
+	}
+	if actual == 0 {
+		return nil
+	}
+	return &actual
+}
+
+// readString returns the actual value of the container config, empty one or the default
+// docker falls back to means it was not given
+func readString(spec *string, actual, fallback string) *string {
+	if spec != nil && *spec == actual {
+		return spec
+	}
+	if actual == "" || actual == fallback {
+		return nil
+	}
+	return &actual
+}
+
+// apiCpusetCpus returns the normalized "cpuset_cpus" given to docker
+func (config *Container) apiCpusetCpus() string {
+	if config.CpusetCpus == nil {
+		return ""
+	}
+	return normalizeCpuset(*config.CpusetCpus)
+}
+
+// actualCpusetCpus returns the CPUs of the host config, falling back to the legacy
+// fields for the containers created by earlier versions of docker
+func actualCpusetCpus(apiContainer *docker.Container) string {
+	if hostConfig := apiContainer.HostConfig; hostConfig != nil {
+		if hostConfig.CPUSetCPUs != "" {
+			return hostConfig.CPUSetCPUs
+		}
+		if hostConfig.CPUSet != "" {
+			return hostConfig.CPUSet
+		}
+	}
+	if apiContainer.Config != nil {
+		return apiContainer.Config.CPUSet
+	}
+	return ""
+}
+
+// readCpuset returns the cpuset of the spec if it is the same set as the actual one,
+// e.g. "0-2" and "0,1,2", or the actual one otherwise
+func readCpuset(spec *string, actual string) *string {
+	if spec != nil && isEqualCpuset(*spec, actual) {
+		return spec
+	}
+	if actual == "" {
+		return nil
+	}
+	return &actual
+}
+
+// ReadExposedPorts overrides "expose" property of the container spec restored from the label
+// with the ports actually exposed by the container, so the changes made out of band are detected.
+// Docker adds the ports of EXPOSE instruction of the image (imageExposed) and the published ports,
+// so the spec is left as is if it explains all the exposed ports with them.
+func (config *Container) ReadExposedPorts(exposed, imageExposed map[docker.Port]struct{}) {
+	expected := map[docker.Port]struct{}{}
+	for port := range imageExposed {
+		expected[port] = struct{}{}
+	}
+	for _, port := range config.Expose {
+		expected[docker.Port(port)] = struct{}{}
+	}
+	for _, port := range config.Ports {
+		expected[docker.Port(port.Port)] = struct{}{}
+	}
+
+	equal := len(expected) == len(exposed)
+	for port := range exposed {
+		if _, ok := expected[port]; !ok {
+			equal = false
+		}
+	}
+	if equal {
+		return
+	}
+
+	config.Expose = nil
+	for port := range exposed {
+		if _, ok := imageExposed[port]; !ok {
+			config.Expose = append(config.Expose, string(port))
+		}
+	}
+	sort.Strings(config.Expose)
+}
+
+// ReadImageDefaults overrides hostname, domainname, user and workdir of the container spec restored
+// from the label with the actual values of the container config, so the changes made out of band are
+// detected. Docker falls back to the image config (imageConfig) for the ones that are not given, and to
+// the short container id for the hostname, such values are read as not given.
+func (config *Container) ReadImageDefaults(apiConfig *docker.Config, containerID string, imageConfig *docker.Config) {
+	if imageConfig == nil {
+		imageConfig = &docker.Config{}
+	}
+
+	// the hostname is the one of the host or the other container if the namespace is shared
+	sharedUTS := (config.Net != nil && (config.Net.Type == "host" || config.Net.Type == "container")) ||
+		(config.Uts != nil && *config.Uts == "host")
+	if !sharedUTS {
+		shortID := containerID
+		if len(shortID) > 12 {
+			shortID = shortID[:12]
+		}
+		config.Hostname = readString(config.Hostname, apiConfig.Hostname, shortID)
+	}
+
+	config.Domainname = readString(config.Domainname, apiConfig.Domainname, imageConfig.Domainname)
+	config.User = readString(config.User, apiConfig.User, imageConfig.User)
+	config.Workdir = readString(config.Workdir, apiConfig.WorkingDir, imageConfig.WorkingDir)
+}
+
+// StripImageDefaults leaves out the properties of the container spec inferred by NewFromDockerRuntime
+// that docker merges in from the image config (imageConfig): cmd and entrypoint equal to the ones
+// of the image, and env variables, exposed ports and data volumes declared by the image.
+func (config *Container) StripImageDefaults(imageConfig *docker.Config) {
+	if imageConfig == nil {
+		return
+	}
+
+	if len(config.Cmd) > 0 && reflect.DeepEqual([]string(config.Cmd), imageConfig.Cmd) {
+		config.Cmd = nil
+	}
+	if config.Entrypoint != nil && reflect.DeepEqual([]string(*config.Entrypoint), imageConfig.Entrypoint) {
+		config.Entrypoint = nil
+	}
+
+	for _, env := range imageConfig.Env {
+		split := strings.SplitN(env, "=", 2)
+		if value, ok := config.Env[split[0]]; ok && len(split) > 1 && value == split[1] {
+			delete(config.Env, split[0])
+		}
+	}
+	if len(config.Env) == 0 {
+		config.Env = nil
+	}
+
+	expose := Strings{}
+	for _, port := range config.Expose {
+		if _, ok := imageConfig.ExposedPorts[docker.Port(port)]; !ok {
+			expose = append(expose, port)
+		}
+	}
+	config.Expose = nil
+	if len(expose) > 0 {
+		config.Expose = expose
+	}
+
+	volumes := Strings{}
+	for _, volume := range config.Volumes {
+		if _, ok := imageConfig.Volumes[volume]; !ok {
+			volumes = append(volumes, volume)
+		}
+	}
+	config.Volumes = nil
+	if len(volumes) > 0 {
+		config.Volumes = volumes
+	}
+}
+
+// isEqualLogConfig returns true if log configs have the same driver and options,
+// nil and empty options are considered equal
+func isEqualLogConfig(a, b docker.LogConfig) bool {
+	if a.Type != b.Type || len(a.Config) != len(b.Config) {
+		return false
+	}
+	for k, v := range a.Config {
+		if bv, ok := b.Config[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
 }
 
 // GetAPIConfig as an opposite from NewFromDocker - it returns docker.Config that can be used
@@ -64,8 +372,11 @@ func NewFromDocker(apiContainer *docker.Container) (*Container, error) {
 func (config *Container) GetAPIConfig() *docker.Config {
 	// Copy simple values
 	apiConfig := &docker.Config{
-		Entrypoint: config.Entrypoint,
-		Labels:     config.Labels,
+		Labels: config.Labels,
+	}
+	// docker resets the entrypoint of the image if an empty list is given
+	if config.Entrypoint != nil {
+		apiConfig.Entrypoint = append([]string{}, *config.Entrypoint...)
 	}
 	if config.Cmd != nil {
 		apiConfig.Cmd = config.Cmd
@@ -85,15 +396,9 @@ func (config *Container) GetAPIConfig() *docker.Config {
 	if config.User != nil {
 		apiConfig.User = *config.User
 	}
-	if config.Memory != nil {
-		apiConfig.Memory = config.Memory.Int64()
-	}
-	if config.MemorySwap != nil {
-		apiConfig.MemorySwap = config.MemorySwap.Int64()
-	}
-	if config.CpusetCpus != nil {
-		apiConfig.CPUSet = *config.CpusetCpus
-	}
+	// docker before 1.6 reads the CPUs from the container config, later from the host config,
+	// so both get the same value
+	apiConfig.CPUSet = config.apiCpusetCpus()
 	if config.CPUShares != nil {
 		apiConfig.CPUShares = *config.CPUShares
 	}
@@ -115,11 +420,16 @@ func (config *Container) GetAPIConfig() *docker.Config {
 		}
 	}
 
-	// env
+	// env, sorted by name so the api config is stable between runs
 	if config.Env != nil {
+		keys := []string{}
+		for key := range config.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
 		apiConfig.Env = []string{}
-		for key, val := range config.Env {
-			apiConfig.Env = append(apiConfig.Env, fmt.Sprintf("%s=%s", key, val))
+		for _, key := range keys {
+			apiConfig.Env = append(apiConfig.Env, fmt.Sprintf("%s=%s", key, config.Env[key]))
 		}
 	}
 
@@ -136,6 +446,17 @@ func (config *Container) GetAPIConfig() *docker.Config {
 		}
 	}
 
+	// data volumes given in the long form
+	for _, mount := range config.Mounts {
+		if !mount.IsDataVolume() {
+			continue
+		}
+		if apiConfig.Volumes == nil {
+			apiConfig.Volumes = map[string]struct{}{}
+		}
+		apiConfig.Volumes[mount.Target] = struct{}{}
+	}
+
 	// TODO: SecurityOpts, OnBuild ?
 
 	return apiConfig
@@ -144,16 +465,22 @@ func (config *Container) GetAPIConfig() *docker.Config {
 // GetAPIHostConfig as an opposite from NewFromDocker - it returns docker.HostConfig that can be used
 // to run containers through the docker api.
 func (config *Container) GetAPIHostConfig() *docker.HostConfig {
-	// TODO: CapAdd, CapDrop, LxcConf, Devices, LogConfig, ReadonlyRootfs,
-	//       SecurityOpt, CgroupParent, CPUQuota, CPUPeriod
-	// TODO: where Memory and MemorySwap should go?
+	// TODO: LxcConf
 	hostConfig := &docker.HostConfig{
 		DNS:           config.DNS,
 		ExtraHosts:    config.AddHost,
 		RestartPolicy: config.Restart.ToDockerAPI(),
-		Memory:        config.Memory.Int64(),
-		MemorySwap:    config.MemorySwap.Int64(),
-		NetworkMode:   config.Net.String(),
+		NetworkMode:   config.Net.format(config.GetNaming()),
+	}
+
+	// Memory limits belong to the host config only, docker reads them from there
+	// since API 1.18 and the Config fields are deprecated, so the limits are never
+	// diffed against two sources
+	if config.Memory != nil {
+		hostConfig.Memory = config.Memory.Int64()
+	}
+	if config.MemorySwap != nil {
+		hostConfig.MemorySwap = config.MemorySwap.Int64()
 	}
 
 	// if state is "running", then restart policy sould be "always" by default
@@ -167,8 +494,19 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 	if config.Uts != nil {
 		hostConfig.UTSMode = *config.Uts
 	}
-	if config.CpusetCpus != nil {
-		hostConfig.CPUSet = *config.CpusetCpus
+	hostConfig.CPUSetCPUs = config.apiCpusetCpus()
+	if config.CpusetMems != nil {
+		hostConfig.CPUSetMEMs = normalizeCpuset(*config.CpusetMems)
+	}
+	if quota := config.Cpus.CPUQuota(); quota > 0 {
+		hostConfig.CPUQuota = quota
+		hostConfig.CPUPeriod = CPUPeriod
+	}
+	if config.CPUQuota != nil {
+		hostConfig.CPUQuota = *config.CPUQuota
+	}
+	if config.CPUPeriod != nil {
+		hostConfig.CPUPeriod = *config.CPUPeriod
 	}
 
 	// Binds
@@ -178,6 +516,11 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 			binds = append(binds, volume)
 		}
 	}
+	for _, mount := range config.Mounts {
+		if bind := mount.Bind(); bind != "" {
+			binds = append(binds, bind)
+		}
+	}
 	if len(binds) > 0 {
 		hostConfig.Binds = binds
 	}
@@ -187,13 +530,39 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 		hostConfig.Privileged = *config.Privileged
 	}
 
-	// PublishAllPorts
-	if config.PublishAllPorts != nil {
+	// Capabilities
+	if len(config.CapAdd) > 0 {
+		hostConfig.CapAdd = config.CapAdd
+	}
+	if len(config.CapDrop) > 0 {
+		hostConfig.CapDrop = config.CapDrop
+	}
+
+	// Security
+	if len(config.SecurityOpt) > 0 {
+		hostConfig.SecurityOpt = config.SecurityOpt
+	}
+	if config.ReadonlyRootfs != nil {
+		hostConfig.ReadonlyRootfs = *config.ReadonlyRootfs
+	}
+	if config.CgroupParent != nil {
+		hostConfig.CgroupParent = *config.CgroupParent
+	}
+
+	// Devices, they are validated when the manifest is read
+	for _, spec := range config.Devices {
+		if device, err := ParseDevice(spec); err == nil {
+			hostConfig.Devices = append(hostConfig.Devices, device)
+		}
+	}
+
+	// PublishAllPorts and PortBindings conflict with the host network, the ports
+	// are still exposed, so they can be discovered by the image metadata
+	if config.PublishAllPorts != nil && !config.Net.IsHost() {
 		hostConfig.PublishAllPorts = *config.PublishAllPorts
 	}
 
-	// PortBindings
-	if len(config.Ports) > 0 {
+	if len(config.Ports) > 0 && !config.Net.IsHost() {
 		hostConfig.PortBindings = map[docker.Port][]docker.PortBinding{}
 		for _, configPort := range config.Ports {
 			key := (docker.Port)(configPort.Port)
@@ -208,16 +577,8 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 		}
 	}
 
-	// By default, use "json-file" logger (Docker's default)
-	// and also setup log rotation
-	if config.LogOpt == nil && config.LogDriver == nil {
-		hostConfig.LogConfig.Type = "json-file"
-		hostConfig.LogConfig.Config = map[string]string{
-			"max-file": "5",
-			"max-size": "100m",
-		}
-	}
-
+	// Logging, without log_driver and log_opt the log config is left empty,
+	// so the default driver of the docker daemon applies
 	if config.LogDriver != nil {
 		hostConfig.LogConfig.Type = *config.LogDriver
 	}
@@ -232,7 +593,7 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 	if len(config.Links) > 0 {
 		hostConfig.Links = []string{}
 		for _, link := range config.Links {
-			hostConfig.Links = append(hostConfig.Links, link.String())
+			hostConfig.Links = append(hostConfig.Links, link.format(config.GetNaming().Format(link.ContainerName)))
 		}
 	}
 
@@ -240,7 +601,7 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 	if len(config.VolumesFrom) > 0 {
 		hostConfig.VolumesFrom = []string{}
 		for _, volume := range config.VolumesFrom {
-			hostConfig.VolumesFrom = append(hostConfig.VolumesFrom, volume.String())
+			hostConfig.VolumesFrom = append(hostConfig.VolumesFrom, config.GetNaming().Format(volume))
 		}
 	}
 
@@ -258,3 +619,13 @@ func (config *Container) GetAPIHostConfig() *docker.HostConfig {
 
 	return hostConfig
 }
+
+// AuthConfiguration returns the docker api auth configuration of the credential
+func (c *Credential) AuthConfiguration() docker.AuthConfiguration {
+	return docker.AuthConfiguration{
+		Username:      c.Username,
+		Password:      c.Password,
+		Email:         c.Email,
+		ServerAddress: c.ServerAddress,
+	}
+}
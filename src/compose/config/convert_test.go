@@ -22,6 +22,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/fsouza/go-dockerclient"
+	"github.com/go-yaml/yaml"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,6 +35,29 @@ var (
 	}
 )
 
+// configLabels returns the labels the container created from the spec stores it in
+func configLabels(t *testing.T, spec *Container) map[string]string {
+	yamlData, err := yaml.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{DefaultLabelPrefix.Label(LabelConfig): string(yamlData)}
+}
+
+// roundTrip returns the spec read back from the container created from it, along with
+// the docker container, so it can be changed out of band and read again
+func roundTrip(t *testing.T, spec *Container) (*Container, *docker.Container) {
+	apiContainer := &docker.Container{
+		Config:     &docker.Config{Labels: configLabels(t, spec)},
+		HostConfig: spec.GetAPIHostConfig(),
+	}
+	actual, err := NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return actual, apiContainer
+}
+
 func TestConfigGetApiConfig(t *testing.T) {
 	config, err := NewFromFile("testdata/compose.yml", configTestVars, map[string]interface{}{}, false)
 	if err != nil {
@@ -70,3 +95,649 @@ func TestConfigGetApiHostConfig(t *testing.T) {
 
 	assert.Equal(t, strings.TrimSpace(string(expected)), string(actual))
 }
+
+func TestConfigGetApiConfigEnvOrder(t *testing.T) {
+	image := "app:1.0"
+	container := &Container{Image: &image, Env: StringMap{}}
+	for _, key := range []string{"PORT", "AWS_KEY", "DB_HOST", "ZONE", "B", "HOME", "A"} {
+		container.Env[key] = strings.ToLower(key)
+	}
+
+	expected := []string{"A=a", "AWS_KEY=aws_key", "B=b", "DB_HOST=db_host", "HOME=home", "PORT=port", "ZONE=zone"}
+	first, err := json.Marshal(container.GetAPIConfig().Env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		actual, err := json.Marshal(container.GetAPIConfig().Env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(first), string(actual), "env should be serialized in the same order every time")
+	}
+	assert.Equal(t, expected, container.GetAPIConfig().Env)
+
+	assert.Nil(t, (&Container{Image: &image}).GetAPIConfig().Env)
+}
+
+func TestConfigGetApiHostConfigNoLimits(t *testing.T) {
+	image := "app:1.0"
+	container := &Container{Image: &image}
+
+	assert.EqualValues(t, 0, container.GetAPIConfig().Memory, "memory should be set in host config only")
+
+	hostConfig := container.GetAPIHostConfig()
+	assert.EqualValues(t, 0, hostConfig.Memory)
+	assert.EqualValues(t, 0, hostConfig.MemorySwap)
+	assert.EqualValues(t, 0, hostConfig.CPUQuota)
+
+	memory, swap := Memory(64*1024*1024), Memory(-1)
+	container.Memory, container.MemorySwap = &memory, &swap
+
+	assert.EqualValues(t, 0, container.GetAPIConfig().Memory, "memory should be set in host config only")
+	assert.EqualValues(t, 0, container.GetAPIConfig().MemorySwap, "memory_swap should be set in host config only")
+	hostConfig = container.GetAPIHostConfig()
+	assert.EqualValues(t, 64*1024*1024, hostConfig.Memory)
+	assert.EqualValues(t, -1, hostConfig.MemorySwap)
+}
+
+func TestConfigNewFromDockerHostConfig(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    net: host
+  bridged:
+    image: ubuntu:14.04`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config.Containers["main"]
+
+	apiContainer := &docker.Container{
+		Config:     &docker.Config{Labels: configLabels(t, expected)},
+		HostConfig: &docker.HostConfig{NetworkMode: "host"},
+	}
+
+	actual, err := NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, expected.IsEqualTo(actual), "container as created should be equal to the spec")
+
+	// out of band changes
+	checks := []func(hostConfig *docker.HostConfig){
+		func(hostConfig *docker.HostConfig) { hostConfig.Privileged = true },
+		func(hostConfig *docker.HostConfig) { hostConfig.PidMode = "host" },
+		func(hostConfig *docker.HostConfig) { hostConfig.NetworkMode = "default" },
+		func(hostConfig *docker.HostConfig) { hostConfig.NetworkMode = "container:test.db" },
+		func(hostConfig *docker.HostConfig) {
+			hostConfig.Ulimits = []docker.ULimit{{Name: "nofile", Soft: 1024, Hard: 2048}}
+		},
+	}
+
+	for i, change := range checks {
+		apiContainer.HostConfig = &docker.HostConfig{NetworkMode: "host"}
+		change(apiContainer.HostConfig)
+
+		actual, err := NewFromDocker(apiContainer, DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, expected.IsEqualTo(actual), "change #%d of host config should be detected", i)
+	}
+
+	// ports are not published with the host network, so publish_all_ports is checked on the bridged one
+	bridged := config.Containers["bridged"]
+	apiContainer = &docker.Container{
+		Config:     &docker.Config{Labels: configLabels(t, bridged)},
+		HostConfig: &docker.HostConfig{},
+	}
+
+	if actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bridged.IsEqualTo(actual), "container as created should be equal to the spec")
+
+	apiContainer.HostConfig.PublishAllPorts = true
+	if actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, bridged.IsEqualTo(actual), "change of publish_all_ports should be detected")
+}
+
+func TestConfigHostNetPorts(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    net: host
+    ports: ["8080:80"]
+    publish_all_ports: true
+  bridged:
+    image: ubuntu:14.04
+    ports: ["8080:80"]`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []Warning{{
+		Container: "main",
+		Message:   "ports and publish_all_ports are ignored with net: host, the container uses the ports of the host directly",
+	}}, config.Warnings)
+
+	expected := config.Containers["main"]
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Empty(t, hostConfig.PortBindings)
+	assert.False(t, hostConfig.PublishAllPorts)
+	_, exposed := expected.GetAPIConfig().ExposedPorts["80/tcp"]
+	assert.True(t, exposed, "ports should still be exposed")
+
+	assert.Len(t, config.Containers["bridged"].GetAPIHostConfig().PortBindings, 1)
+
+	// the ignored ports should not cause recreation of the container
+	actual, _ := roundTrip(t, expected)
+	assert.True(t, expected.IsEqualTo(actual), "container as created should be equal to the spec")
+}
+
+func TestConfigNewFromDockerLogConfig(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  syslog:
+    image: ubuntu:14.04
+    log_driver: syslog
+    log_opt:
+      syslog-address: tcp://192.168.0.42:123
+  opts_only:
+    image: ubuntu:14.04
+    log_opt:
+      max-size: 10m`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range config.Containers {
+		actual, apiContainer := roundTrip(t, expected)
+		assert.True(t, expected.IsEqualTo(actual), "container %s as created should be equal to the spec", name)
+
+		// out of band changes
+		checks := []func(logConfig *docker.LogConfig){
+			func(logConfig *docker.LogConfig) { logConfig.Type = "journald" },
+			func(logConfig *docker.LogConfig) { logConfig.Config = map[string]string{"max-size": "1g"} },
+			func(logConfig *docker.LogConfig) { logConfig.Config = nil },
+		}
+		for i, change := range checks {
+			apiContainer.HostConfig = expected.GetAPIHostConfig()
+			change(&apiContainer.HostConfig.LogConfig)
+
+			actual, err := NewFromDocker(apiContainer, DefaultLabelPrefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.False(t, expected.IsEqualTo(actual), "change #%d of log config of %s should be detected", i, name)
+		}
+	}
+}
+
+func TestConfigNewFromDockerDefaultLogConfig(t *testing.T) {
+	image := "ubuntu:14.04"
+	expected := &Container{Image: &image}
+
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Equal(t, docker.LogConfig{}, hostConfig.LogConfig, "the daemon default log driver should apply")
+
+	// whatever the daemon default is, it is not a change
+	for _, logConfig := range []docker.LogConfig{
+		{},
+		{Type: "json-file"},
+		{Type: "journald", Config: map[string]string{"tag": "app"}},
+		{Type: "json-file", Config: map[string]string{"max-file": "5", "max-size": "100m"}},
+	} {
+		apiContainer := &docker.Container{
+			Config:     &docker.Config{Labels: configLabels(t, expected)},
+			HostConfig: &docker.HostConfig{LogConfig: logConfig},
+		}
+		actual, err := NewFromDocker(apiContainer, DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, expected.IsEqualTo(actual), "log config %v should be equal to the default one", logConfig)
+	}
+}
+
+func TestConfigNewFromDockerLogOptOrder(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    log_driver: fluentd
+    log_opt:
+      tag: app.main
+      fluentd-address: localhost:24224
+      fluentd-async-connect: "true"
+      env: APP_ENV,APP_VERSION`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config.Containers["main"]
+
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Equal(t, "fluentd", hostConfig.LogConfig.Type)
+	assert.Equal(t, "app.main", hostConfig.LogConfig.Config["tag"])
+	assert.Len(t, hostConfig.LogConfig.Config, 4)
+
+	// the config label is written and read many times, a map is never ordered
+	for i := 0; i < 10; i++ {
+		logConfig := docker.LogConfig{Type: "fluentd", Config: map[string]string{}}
+		for k, v := range hostConfig.LogConfig.Config {
+			logConfig.Config[k] = v
+		}
+		actual, err := NewFromDocker(&docker.Container{
+			Config:     &docker.Config{Labels: configLabels(t, expected)},
+			HostConfig: &docker.HostConfig{LogConfig: logConfig},
+		}, DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected.LogOpt, actual.LogOpt)
+		assert.True(t, expected.IsEqualTo(actual), "log_opt should survive the label round-trip, failed on field: %s",
+			expected.LastCompareField())
+	}
+}
+
+func TestIsEqualLogConfig(t *testing.T) {
+	assert.True(t, isEqualLogConfig(docker.LogConfig{Type: "syslog"}, docker.LogConfig{Type: "syslog", Config: map[string]string{}}))
+	assert.False(t, isEqualLogConfig(docker.LogConfig{Type: "syslog"}, docker.LogConfig{Type: "journald"}))
+	assert.False(t, isEqualLogConfig(
+		docker.LogConfig{Type: "json-file", Config: map[string]string{"max-size": "10m"}},
+		docker.LogConfig{Type: "json-file", Config: map[string]string{"max-file": "10m"}}))
+}
+
+func TestConfigNewFromDockerUlimits(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    ulimits:
+      - name: nofile
+        soft: 1024
+        hard: 2048
+      - name: nproc
+        soft: 512
+        hard: 512`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config.Containers["main"]
+
+	actual, apiContainer := roundTrip(t, expected)
+	hostConfig := apiContainer.HostConfig
+	assert.Equal(t, expected.Ulimits, actual.Ulimits)
+	assert.True(t, expected.IsEqualTo(actual), "container as created should be equal to the spec")
+
+	// docker may report ulimits in a different order
+	hostConfig.Ulimits[0], hostConfig.Ulimits[1] = hostConfig.Ulimits[1], hostConfig.Ulimits[0]
+	actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, expected.IsEqualTo(actual), "order of ulimits should not be compared")
+
+	// changed out of band
+	hostConfig.Ulimits[0].Soft = 256
+	actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, expected.IsEqualTo(actual), "changed ulimit should be detected")
+
+	hostConfig.Ulimits = nil
+	actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, expected.IsEqualTo(actual), "removed ulimits should be detected")
+}
+
+func TestConfigNewFromDockerCapabilities(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    cap_drop: MKNOD
+  main:
+    extends: _base
+    cap_add:
+      - NET_ADMIN
+      - SYS_PTRACE
+  empty:
+    image: app:1.0
+    cap_add: []`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := config.Containers["main"]
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Equal(t, []string{"NET_ADMIN", "SYS_PTRACE"}, hostConfig.CapAdd)
+	assert.Equal(t, []string{"MKNOD"}, hostConfig.CapDrop, "cap_drop should be inherited")
+
+	actual, apiContainer := roundTrip(t, expected)
+	assert.True(t, expected.IsEqualTo(actual), "container as created should be equal to the spec, failed on field: %s",
+		expected.LastCompareField())
+
+	// docker may report capabilities in a different order
+	apiContainer.HostConfig.CapAdd = []string{"SYS_PTRACE", "NET_ADMIN"}
+	actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, expected.IsEqualTo(actual), "order of capabilities should not be compared")
+
+	// changed out of band
+	apiContainer.HostConfig.CapDrop = nil
+	actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, expected.IsEqualTo(actual), "removed cap_drop should be detected")
+
+	// an empty list is the same as no capabilities at all
+	empty := config.Containers["empty"]
+	assert.Nil(t, empty.GetAPIHostConfig().CapAdd)
+	actual, _ = roundTrip(t, empty)
+	assert.True(t, empty.IsEqualTo(actual), "empty cap_add should be equal to none, failed on field: %s",
+		empty.LastCompareField())
+}
+
+func TestConfigNewFromDockerSecurity(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    read_only: true
+    cgroup_parent: /apps
+  main:
+    extends: _base
+    security_opt:
+      - apparmor:my-profile
+      - label:type:svirt_apache_t
+  default:
+    image: app:1.0`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := config.Containers["main"]
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Equal(t, []string{"apparmor:my-profile", "label:type:svirt_apache_t"}, hostConfig.SecurityOpt)
+	assert.True(t, hostConfig.ReadonlyRootfs, "read_only should be inherited")
+	assert.Equal(t, "/apps", hostConfig.CgroupParent, "cgroup_parent should be inherited")
+
+	actual, apiContainer := roundTrip(t, expected)
+	assert.Equal(t, Strings{"apparmor:my-profile", "label:type:svirt_apache_t"}, actual.SecurityOpt)
+	assert.True(t, expected.IsEqualTo(actual), "container as created should be equal to the spec, failed on field: %s",
+		expected.LastCompareField())
+
+	// changed out of band
+	for _, change := range []func(*docker.HostConfig){
+		func(c *docker.HostConfig) { c.SecurityOpt = []string{"apparmor:other"} },
+		func(c *docker.HostConfig) { c.ReadonlyRootfs = false },
+		func(c *docker.HostConfig) { c.CgroupParent = "" },
+	} {
+		hostConfig := *expected.GetAPIHostConfig()
+		change(&hostConfig)
+		apiContainer.HostConfig = &hostConfig
+		actual, err := NewFromDocker(apiContainer, DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, expected.IsEqualTo(actual), "change of %v should be detected", hostConfig)
+	}
+
+	// unset properties leave the daemon defaults
+	defaults := config.Containers["default"]
+	hostConfig = defaults.GetAPIHostConfig()
+	assert.Nil(t, hostConfig.SecurityOpt)
+	assert.False(t, hostConfig.ReadonlyRootfs)
+	assert.Empty(t, hostConfig.CgroupParent)
+	actual, _ = roundTrip(t, defaults)
+	assert.True(t, defaults.IsEqualTo(actual), "unset properties should not differ, failed on field: %s",
+		defaults.LastCompareField())
+}
+
+func TestConfigNewFromDockerCpuset(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    cpuset_mems: "0"
+  main:
+    extends: _base
+    cpuset_cpus: 2,0-1`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config.Containers["main"]
+
+	// both the container and the host config get the normalized cpuset
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Equal(t, "0-2", hostConfig.CPUSetCPUs)
+	assert.Equal(t, "0-2", expected.GetAPIConfig().CPUSet)
+	assert.Equal(t, "0", hostConfig.CPUSetMEMs, "cpuset_mems should be inherited")
+	assert.Equal(t, "", config.Containers["_base"].GetAPIConfig().CPUSet)
+
+	tests := []struct {
+		cpus, mems, legacyCpus, configCpus string
+		equal                              bool
+	}{
+		{"0-2", "0", "", "", true},
+		{"0,1,2", "0", "", "", true},
+		{"2,0-1", "0-0", "", "", true},
+		{"", "0", "0-2", "", true},
+		{"", "0", "", "0,1,2", true},
+		{"0-3", "0", "", "0-2", false},
+		{"", "0", "", "", false},
+		{"0-2", "0-1", "", "", false},
+		{"0-2", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		actual, err := NewFromDocker(&docker.Container{
+			Config: &docker.Config{
+				Labels: configLabels(t, expected),
+				CPUSet: test.configCpus,
+			},
+			HostConfig: &docker.HostConfig{
+				CPUSetCPUs: test.cpus,
+				CPUSetMEMs: test.mems,
+				CPUSet:     test.legacyCpus,
+			},
+		}, DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.equal, expected.IsEqualTo(actual), "cpus %q mems %q legacy %q config %q",
+			test.cpus, test.mems, test.legacyCpus, test.configCpus)
+	}
+}
+
+func TestConfigNewFromDockerCPUQuota(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    cpu_shares: 512
+    cpu_quota: 50000
+    cpu_period: 200000
+  cpus:
+    image: app:1.0
+    cpus: 1.5`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := config.Containers["main"]
+	hostConfig := expected.GetAPIHostConfig()
+	assert.EqualValues(t, 50000, hostConfig.CPUQuota)
+	assert.EqualValues(t, 200000, hostConfig.CPUPeriod)
+	assert.EqualValues(t, 512, expected.GetAPIConfig().CPUShares)
+
+	actual, apiContainer := roundTrip(t, expected)
+	assert.True(t, expected.IsEqualTo(actual), "container as created should be equal to the spec, failed on field: %s",
+		expected.LastCompareField())
+
+	// changed out of band
+	apiContainer.HostConfig.CPUQuota = 100000
+	actual, err = NewFromDocker(apiContainer, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, expected.IsEqualTo(actual), "changed cpu_quota should be detected")
+
+	// cpus are converted to the same fields, but they are not read back as cpu_quota
+	cpus := config.Containers["cpus"]
+	hostConfig = cpus.GetAPIHostConfig()
+	assert.EqualValues(t, 150000, hostConfig.CPUQuota)
+	assert.EqualValues(t, CPUPeriod, hostConfig.CPUPeriod)
+	actual, _ = roundTrip(t, cpus)
+	assert.Nil(t, actual.CPUQuota)
+	assert.True(t, cpus.IsEqualTo(actual), "container with cpus should be equal to the spec, failed on field: %s",
+		cpus.LastCompareField())
+}
+
+func TestConfigReadExposedPorts(t *testing.T) {
+	imageExposed := map[docker.Port]struct{}{"80/tcp": {}}
+	ports := func(list ...string) map[docker.Port]struct{} {
+		result := map[docker.Port]struct{}{}
+		for _, port := range list {
+			result[docker.Port(port)] = struct{}{}
+		}
+		return result
+	}
+
+	// the ports of the image are not a drift
+	container := &Container{}
+	container.ReadExposedPorts(ports("80/tcp"), imageExposed)
+	assert.Nil(t, container.Expose)
+
+	container = &Container{
+		Expose: Strings{"8080/tcp"},
+		Ports:  Ports{{Port: "9000/tcp", HostPort: "9000"}},
+	}
+	container.ReadExposedPorts(ports("80/tcp", "8080/tcp", "9000/tcp"), imageExposed)
+	assert.Equal(t, Strings{"8080/tcp"}, container.Expose)
+
+	// the spec may expose the same port as the image
+	container = &Container{Expose: Strings{"80/tcp"}}
+	container.ReadExposedPorts(ports("80/tcp"), imageExposed)
+	assert.Equal(t, Strings{"80/tcp"}, container.Expose)
+
+	// out of band changes
+	expected := &Container{Expose: Strings{"8080/tcp"}}
+	actual := &Container{Expose: Strings{"8080/tcp"}}
+	actual.ReadExposedPorts(ports("80/tcp", "8080/tcp", "8081/tcp"), imageExposed)
+	assert.Equal(t, Strings{"8080/tcp", "8081/tcp"}, actual.Expose)
+	assert.False(t, expected.IsEqualTo(actual))
+
+	actual = &Container{Expose: Strings{"8080/tcp"}}
+	actual.ReadExposedPorts(ports("80/tcp"), imageExposed)
+	assert.Nil(t, actual.Expose)
+	assert.False(t, expected.IsEqualTo(actual))
+}
+
+func TestConfigReadImageDefaults(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    hostname: app1
+    domainname: grammarly.com
+    user: app
+    workdir: /app
+  defaults:
+    image: app:1.0
+  host:
+    image: app:1.0
+    net: host`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const containerID = "0123456789abcdef0123"
+	imageConfig := &docker.Config{User: "nobody", WorkingDir: "/srv", Domainname: "image.local"}
+
+	read := func(spec *Container, change func(apiConfig *docker.Config)) *Container {
+		apiConfig := spec.GetAPIConfig()
+		apiConfig.Labels = configLabels(t, spec)
+		// docker fills the properties that are not given, the host network gives the hostname of the host
+		switch {
+		case spec.Net != nil:
+			apiConfig.Hostname = "docker-host"
+		case apiConfig.Hostname == "":
+			apiConfig.Hostname = containerID[:12]
+		}
+		if apiConfig.Domainname == "" {
+			apiConfig.Domainname = imageConfig.Domainname
+		}
+		if apiConfig.User == "" {
+			apiConfig.User = imageConfig.User
+		}
+		if apiConfig.WorkingDir == "" {
+			apiConfig.WorkingDir = imageConfig.WorkingDir
+		}
+		if change != nil {
+			change(apiConfig)
+		}
+
+		actual, err := NewFromDocker(&docker.Container{ID: containerID, Config: apiConfig}, DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual.ReadImageDefaults(apiConfig, containerID, imageConfig)
+		return actual
+	}
+
+	for _, name := range []string{"main", "defaults", "host"} {
+		expected := config.Containers[name]
+		actual := read(expected, nil)
+		assert.True(t, expected.IsEqualTo(actual), "container %s should be equal after round trip, failed on field: %s",
+			name, expected.LastCompareField())
+	}
+
+	// out of band changes of every field are detected
+	changes := map[string]func(apiConfig *docker.Config){
+		"Hostname":   func(apiConfig *docker.Config) { apiConfig.Hostname = "other" },
+		"Domainname": func(apiConfig *docker.Config) { apiConfig.Domainname = "other.com" },
+		"User":       func(apiConfig *docker.Config) { apiConfig.User = "root" },
+		"Workdir":    func(apiConfig *docker.Config) { apiConfig.WorkingDir = "/" },
+	}
+	for _, name := range []string{"main", "defaults"} {
+		for field, change := range changes {
+			expected := config.Containers[name]
+			actual := read(expected, change)
+			assert.False(t, expected.IsEqualTo(actual), "container %s: change of %s should be detected", name, field)
+			assert.Equal(t, field, expected.LastCompareField())
+		}
+	}
+}
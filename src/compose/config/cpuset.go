@@ -0,0 +1,221 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxCpusetCPUs is the largest number of CPUs the linux kernel can be built with
+// (NR_CPUS), it bounds the ranges ParseCpuset is willing to expand
+const maxCpusetCPUs = 8192
+
+// cpuRange is an inclusive range of CPU numbers of the cpuset spec
+type cpuRange struct {
+	from, to int
+}
+
+// ParseCpuset parses the cpuset spec such as "0-3,7" which is used by
+// "cpuset_cpus" property and returns the sorted list of CPU numbers
+func ParseCpuset(spec string) ([]int, error) {
+	ranges, err := parseCpusetRanges(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cpus := []int{}
+	seen := map[int]struct{}{}
+
+	for _, r := range ranges {
+		if r.to >= maxCpusetCPUs {
+			return nil, fmt.Errorf("Invalid cpuset %q: CPU number %d exceeds the limit of %d CPUs", spec, r.to, maxCpusetCPUs)
+		}
+		for cpu := r.from; cpu <= r.to; cpu++ {
+			if _, ok := seen[cpu]; !ok {
+				seen[cpu] = struct{}{}
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// parseCpusetRanges parses the cpuset spec into the list of ranges as they are
+// written in the spec, without expanding them
+func parseCpusetRanges(spec string) ([]cpuRange, error) {
+	ranges := []cpuRange{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("Invalid cpuset %q: empty element", spec)
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("Invalid cpuset %q: bad CPU number %q", spec, bounds[0])
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil || to < 0 {
+				return nil, fmt.Errorf("Invalid cpuset %q: bad CPU number %q", spec, bounds[1])
+			}
+			if to < from {
+				return nil, fmt.Errorf("Invalid cpuset %q: bad range %q", spec, part)
+			}
+		}
+
+		ranges = append(ranges, cpuRange{from, to})
+	}
+
+	return ranges, nil
+}
+
+// formatCpuRanges returns the canonical spec of the ranges, overlapping and
+// adjacent ranges are merged, e.g. [4-5 9 5-6] gives "4-6,9"
+func formatCpuRanges(ranges []cpuRange) string {
+	sorted := append([]cpuRange{}, ranges...)
+	sort.Sort(cpuRangesByFrom(sorted))
+
+	parts := []string{}
+	for i := 0; i < len(sorted); {
+		from, to := sorted[i].from, sorted[i].to
+		for i++; i < len(sorted) && sorted[i].from <= to+1; i++ {
+			if sorted[i].to > to {
+				to = sorted[i].to
+			}
+		}
+		if from == to {
+			parts = append(parts, strconv.Itoa(from))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", from, to))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+type cpuRangesByFrom []cpuRange
+
+func (r cpuRangesByFrom) Len() int           { return len(r) }
+func (r cpuRangesByFrom) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r cpuRangesByFrom) Less(i, j int) bool { return r[i].from < r[j].from }
+
+// FormatCpuset returns the canonical spec of the CPU numbers, consecutive numbers
+// are merged into ranges, e.g. [0 1 2 7] gives "0-2,7"
+func FormatCpuset(cpus []int) string {
+	sorted := append([]int{}, cpus...)
+	sort.Ints(sorted)
+
+	parts := []string{}
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[i] == sorted[j] {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// normalizeCpuset returns the canonical form of the cpuset spec, e.g. "0-2" for "2,0,1",
+// specs that cannot be parsed are returned as is
+func normalizeCpuset(spec string) string {
+	if spec == "" {
+		return spec
+	}
+	cpus, err := ParseCpuset(spec)
+	if err != nil {
+		return spec
+	}
+	return FormatCpuset(cpus)
+}
+
+// isEqualCpuset returns true if both cpuset specs denote the same set, e.g. "0-2" and "0,1,2",
+// specs that cannot be parsed are compared as strings
+func isEqualCpuset(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	cpusA, errA := ParseCpuset(a)
+	cpusB, errB := ParseCpuset(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	if len(cpusA) != len(cpusB) {
+		return false
+	}
+	for i := range cpusA {
+		if cpusA[i] != cpusB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckCpusets validates "cpuset_cpus" of all containers against the number
+// of CPUs available on the host. It returns an error describing all containers
+// referring to CPUs that do not exist.
+func (config *Config) CheckCpusets(ncpu int) error {
+	problems := []string{}
+
+	for name, container := range config.Containers {
+		if container.CpusetCpus == nil || *container.CpusetCpus == "" {
+			continue
+		}
+
+		// the bounds are checked against ncpu without expanding the ranges,
+		// so that huge ranges such as "0-4000000000" cost nothing
+		ranges, err := parseCpusetRanges(*container.CpusetCpus)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("container %s: %s", name, err))
+			continue
+		}
+
+		outOfRange := []cpuRange{}
+		for _, r := range ranges {
+			if r.to >= ncpu {
+				from := r.from
+				if from < ncpu {
+					from = ncpu
+				}
+				outOfRange = append(outOfRange, cpuRange{from, r.to})
+			}
+		}
+		if len(outOfRange) > 0 {
+			problems = append(problems, fmt.Sprintf("container %s: cpuset_cpus %s refers to CPUs %s, but the host has only %d CPUs (0-%d)",
+				name, *container.CpusetCpus, formatCpuRanges(outOfRange), ncpu, ncpu-1))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	return fmt.Errorf("Cpuset validation failed: %s", strings.Join(problems, "; "))
+}
@@ -0,0 +1,113 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCpuset(t *testing.T) {
+	cpus, err := ParseCpuset("0-3,7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 7}, cpus)
+
+	cpus, err = ParseCpuset("5,1-2,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{1, 2, 5}, cpus)
+
+	for _, spec := range []string{"", "a", "1,", "3-1", "1-x", "-1", "0-4000000000", "8192"} {
+		_, err := ParseCpuset(spec)
+		assert.Error(t, err, "spec %q should not be valid", spec)
+	}
+}
+
+func TestConfigCheckCpusets(t *testing.T) {
+	valid := "0-3"
+	outOfRange := "2-5,9"
+
+	config := &Config{
+		Containers: map[string]*Container{
+			"main":   &Container{CpusetCpus: &valid},
+			"nocpus": &Container{},
+		},
+	}
+	assert.NoError(t, config.CheckCpusets(4))
+
+	config.Containers["worker"] = &Container{CpusetCpus: &outOfRange}
+	err := config.CheckCpusets(4)
+	assert.EqualError(t, err, "Cpuset validation failed: container worker: cpuset_cpus 2-5,9 refers to CPUs 4-5,9, but the host has only 4 CPUs (0-3)")
+
+	huge := "0-4000000000"
+	config.Containers["worker"] = &Container{CpusetCpus: &huge}
+	err = config.CheckCpusets(4)
+	assert.EqualError(t, err, "Cpuset validation failed: container worker: cpuset_cpus 0-4000000000 refers to CPUs 4-4000000000, but the host has only 4 CPUs (0-3)")
+}
+
+func TestFormatCpuRanges(t *testing.T) {
+	assert.Equal(t, "4-6,9", formatCpuRanges([]cpuRange{{4, 5}, {9, 9}, {5, 6}}))
+	assert.Equal(t, "4-10", formatCpuRanges([]cpuRange{{4, 4}, {5, 10}, {6, 7}}))
+}
+
+func TestIsEqualCpuset(t *testing.T) {
+	assert.True(t, isEqualCpuset("0-2", "0,1,2"))
+	assert.True(t, isEqualCpuset("3,0-1", "0-1,3"))
+	assert.True(t, isEqualCpuset("", ""))
+	assert.True(t, isEqualCpuset("bad", "bad"))
+	assert.False(t, isEqualCpuset("0-2", "0-3"))
+	assert.False(t, isEqualCpuset("0", ""))
+	assert.False(t, isEqualCpuset("bad", "0"))
+}
+
+func TestFormatCpuset(t *testing.T) {
+	assert.Equal(t, "0-2,7", FormatCpuset([]int{7, 0, 1, 2}))
+	assert.Equal(t, "1,3,5-6", FormatCpuset([]int{1, 3, 5, 6}))
+	assert.Equal(t, "4", FormatCpuset([]int{4}))
+	assert.Equal(t, "", FormatCpuset([]int{}))
+
+	assert.Equal(t, "0-3", normalizeCpuset("3,0-1,2"))
+	assert.Equal(t, "0-x", normalizeCpuset("0-x"))
+	assert.Equal(t, "", normalizeCpuset(""))
+}
+
+func TestConfigCpusetCpusValidation(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    cpuset_cpus: 3-1`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, `Container main: cpuset_cpus Invalid cpuset "3-1": bad range "3-1"`)
+}
+
+func TestConfigCpusetMemsValidation(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    cpuset_mems: 0-x`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, `Container main: cpuset_mems Invalid cpuset "0-x": bad CPU number "x"`)
+}
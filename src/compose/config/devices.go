@@ -0,0 +1,82 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// defaultDevicePermissions are the cgroup permissions of the device if they are not given,
+// same as docker run --device does
+const defaultDevicePermissions = "rwm"
+
+// ParseDevice parses the device binding of the "devices" property given in
+// the form host:container[:permissions], e.g. /dev/fuse:/dev/fuse:rwm
+func ParseDevice(spec string) (device docker.Device, err error) {
+	split := strings.Split(spec, ":")
+	if len(split) < 2 || len(split) > 3 {
+		return device, fmt.Errorf("Bad device %q, should be host:container[:permissions]", spec)
+	}
+	device.PathOnHost = split[0]
+	device.PathInContainer = split[1]
+	device.CgroupPermissions = defaultDevicePermissions
+	if len(split) == 3 {
+		device.CgroupPermissions = split[2]
+	}
+	if device.PathOnHost == "" || device.PathInContainer == "" || device.CgroupPermissions == "" {
+		return device, fmt.Errorf("Bad device %q, should be host:container[:permissions]", spec)
+	}
+	return device, nil
+}
+
+// formatDevice returns the device binding in the manifest form, the default permissions are omitted
+func formatDevice(device docker.Device) string {
+	spec := device.PathOnHost + ":" + device.PathInContainer
+	if device.CgroupPermissions != "" && device.CgroupPermissions != defaultDevicePermissions {
+		spec += ":" + device.CgroupPermissions
+	}
+	return spec
+}
+
+// readDevices returns the devices of the spec if they bind the same devices as the actual
+// ones, e.g. "/dev/fuse:/dev/fuse" and "/dev/fuse:/dev/fuse:rwm", or the actual ones otherwise
+func readDevices(spec Strings, actual []docker.Device) Strings {
+	devices := Strings{}
+	for _, device := range actual {
+		devices = append(devices, formatDevice(device))
+	}
+	if len(spec) == len(devices) {
+		same := true
+		for i, s := range spec {
+			device, err := ParseDevice(s)
+			if err != nil || formatDevice(device) != devices[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return spec
+		}
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	return devices
+}
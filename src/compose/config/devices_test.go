@@ -0,0 +1,93 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDevice(t *testing.T) {
+	device, err := ParseDevice("/dev/fuse:/dev/fuse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, docker.Device{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"}, device)
+
+	device, err = ParseDevice("/dev/nvidia0:/dev/gpu:rw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, docker.Device{PathOnHost: "/dev/nvidia0", PathInContainer: "/dev/gpu", CgroupPermissions: "rw"}, device)
+
+	for _, spec := range []string{"/dev/fuse", "/dev/fuse:/dev/fuse:rwm:x", ":/dev/fuse", "/dev/fuse:/dev/fuse:"} {
+		_, err := ParseDevice(spec)
+		assert.Error(t, err, "%s should not be parsed", spec)
+	}
+}
+
+func TestConfigDevices(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    devices:
+      - /dev/fuse:/dev/fuse
+      - /dev/nvidia0:/dev/gpu:rw`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := config.Containers["main"]
+	hostConfig := expected.GetAPIHostConfig()
+	assert.Equal(t, []docker.Device{
+		{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"},
+		{PathOnHost: "/dev/nvidia0", PathInContainer: "/dev/gpu", CgroupPermissions: "rw"},
+	}, hostConfig.Devices)
+
+	// the default permissions reported by docker are the same as omitted ones
+	actual := &Container{Devices: expected.Devices}
+	actual.readHostConfig(hostConfig)
+	assert.Equal(t, expected.Devices, actual.Devices)
+
+	// changed out of band
+	hostConfig.Devices = hostConfig.Devices[:1]
+	actual = &Container{Devices: expected.Devices}
+	actual.readHostConfig(hostConfig)
+	assert.Equal(t, Strings{"/dev/fuse:/dev/fuse"}, actual.Devices)
+
+	hostConfig.Devices = nil
+	actual = &Container{Devices: expected.Devices}
+	actual.readHostConfig(hostConfig)
+	assert.Nil(t, actual.Devices)
+}
+
+func TestConfigDevicesInvalid(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    devices: /dev/fuse:/dev/fuse:rwm:x`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, `Container main: Bad device "/dev/fuse:/dev/fuse:rwm:x", should be host:container[:permissions]`)
+}
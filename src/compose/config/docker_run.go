@@ -0,0 +1,206 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_./:=@%+,-]+$`)
+
+// DockerRunCommand renders the docker api config produced by GetAPIConfig and
+// GetAPIHostConfig as an equivalent shell-quoted "docker run" command. It is meant
+// as a debugging aid, so labels managed by rocker-compose with the given prefix are omitted.
+func DockerRunCommand(name string, apiConfig *docker.Config, hostConfig *docker.HostConfig, prefix LabelPrefix) string {
+	args := []string{"docker", "run", "-d"}
+	add := func(flag string, values ...string) {
+		for _, value := range values {
+			args = append(args, flag, value)
+		}
+	}
+
+	if name != "" {
+		add("--name", name)
+	}
+
+	if apiConfig.Hostname != "" {
+		add("--hostname", apiConfig.Hostname)
+	}
+	if apiConfig.Domainname != "" {
+		add("--domainname", apiConfig.Domainname)
+	}
+	if apiConfig.User != "" {
+		add("--user", apiConfig.User)
+	}
+	if apiConfig.WorkingDir != "" {
+		add("--workdir", apiConfig.WorkingDir)
+	}
+
+	env := append([]string{}, apiConfig.Env...)
+	sort.Strings(env)
+	add("--env", env...)
+
+	labels := []string{}
+	for k, v := range apiConfig.Labels {
+		if !prefix.IsManaged(k) {
+			labels = append(labels, k+"="+v)
+		}
+	}
+	sort.Strings(labels)
+	add("--label", labels...)
+
+	// published ports
+	published := map[docker.Port]struct{}{}
+	ports := []string{}
+	for port, bindings := range hostConfig.PortBindings {
+		published[port] = struct{}{}
+		for _, binding := range bindings {
+			spec := string(port)
+			if binding.HostIP != "" {
+				spec = binding.HostIP + ":" + binding.HostPort + ":" + spec
+			} else if binding.HostPort != "" {
+				spec = binding.HostPort + ":" + spec
+			}
+			ports = append(ports, spec)
+		}
+	}
+	sort.Strings(ports)
+	add("--publish", ports...)
+	if hostConfig.PublishAllPorts {
+		args = append(args, "--publish-all")
+	}
+
+	exposed := []string{}
+	for port := range apiConfig.ExposedPorts {
+		if _, ok := published[port]; !ok {
+			exposed = append(exposed, string(port))
+		}
+	}
+	sort.Strings(exposed)
+	add("--expose", exposed...)
+
+	// volumes
+	add("--volume", hostConfig.Binds...)
+	volumes := []string{}
+	for volume := range apiConfig.Volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+	add("--volume", volumes...)
+	add("--volumes-from", hostConfig.VolumesFrom...)
+
+	add("--link", hostConfig.Links...)
+	if hostConfig.NetworkMode != "" {
+		add("--net", hostConfig.NetworkMode)
+	}
+	if hostConfig.PidMode != "" {
+		add("--pid", hostConfig.PidMode)
+	}
+	if hostConfig.UTSMode != "" {
+		add("--uts", hostConfig.UTSMode)
+	}
+	add("--dns", hostConfig.DNS...)
+	add("--add-host", hostConfig.ExtraHosts...)
+
+	if restart := hostConfig.RestartPolicy; restart.Name != "" {
+		if restart.MaximumRetryCount > 0 {
+			add("--restart", fmt.Sprintf("%s:%d", restart.Name, restart.MaximumRetryCount))
+		} else {
+			add("--restart", restart.Name)
+		}
+	}
+
+	if hostConfig.Privileged {
+		args = append(args, "--privileged")
+	}
+	add("--cap-add", hostConfig.CapAdd...)
+	add("--cap-drop", hostConfig.CapDrop...)
+	add("--security-opt", hostConfig.SecurityOpt...)
+	if hostConfig.ReadonlyRootfs {
+		args = append(args, "--read-only")
+	}
+	if hostConfig.CgroupParent != "" {
+		add("--cgroup-parent", hostConfig.CgroupParent)
+	}
+	for _, device := range hostConfig.Devices {
+		spec := device.PathOnHost + ":" + device.PathInContainer
+		if device.CgroupPermissions != "" {
+			spec += ":" + device.CgroupPermissions
+		}
+		add("--device", spec)
+	}
+
+	if hostConfig.Memory > 0 {
+		add("--memory", fmt.Sprintf("%d", hostConfig.Memory))
+	}
+	if hostConfig.MemorySwap != 0 {
+		add("--memory-swap", fmt.Sprintf("%d", hostConfig.MemorySwap))
+	}
+	if apiConfig.CPUShares > 0 {
+		add("--cpu-shares", fmt.Sprintf("%d", apiConfig.CPUShares))
+	}
+	if hostConfig.CPUSetCPUs != "" {
+		add("--cpuset-cpus", hostConfig.CPUSetCPUs)
+	}
+	if hostConfig.CPUSetMEMs != "" {
+		add("--cpuset-mems", hostConfig.CPUSetMEMs)
+	}
+	for _, ulimit := range hostConfig.Ulimits {
+		add("--ulimit", fmt.Sprintf("%s=%d:%d", ulimit.Name, ulimit.Soft, ulimit.Hard))
+	}
+
+	if hostConfig.LogConfig.Type != "" {
+		add("--log-driver", hostConfig.LogConfig.Type)
+	}
+	logOpts := []string{}
+	for k, v := range hostConfig.LogConfig.Config {
+		logOpts = append(logOpts, k+"="+v)
+	}
+	sort.Strings(logOpts)
+	add("--log-opt", logOpts...)
+
+	// docker run accepts only a single entrypoint element, the rest goes before cmd
+	cmd := apiConfig.Cmd
+	if len(apiConfig.Entrypoint) > 0 {
+		add("--entrypoint", apiConfig.Entrypoint[0])
+		cmd = append(append([]string{}, apiConfig.Entrypoint[1:]...), cmd...)
+	} else if apiConfig.Entrypoint != nil {
+		add("--entrypoint", "")
+	}
+
+	args = append(args, apiConfig.Image)
+	args = append(args, cmd...)
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes the argument for POSIX shell if needed
+func shellQuote(arg string) string {
+	if shellSafe.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
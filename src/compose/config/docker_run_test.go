@@ -0,0 +1,83 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerRunCommand(t *testing.T) {
+	config, err := NewFromFile("testdata/compose.yml", configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := config.Containers["main"]
+	container.Env["GREETING"] = "it's me"
+
+	hostConfig := container.GetAPIHostConfig()
+	hostConfig.CapAdd = []string{"NET_ADMIN"}
+	hostConfig.CapDrop = []string{"MKNOD"}
+	hostConfig.SecurityOpt = []string{"apparmor:my-profile"}
+	hostConfig.ReadonlyRootfs = true
+	hostConfig.CgroupParent = "/apps"
+	hostConfig.CPUSetMEMs = "0"
+
+	expected := "docker run -d --name myapp.main" +
+		" --hostname myapp1 --domainname grammarly.com --user root --workdir /app" +
+		" --env AWS_KEY=asdqwe --env 'GREETING=it'\\''s me'" +
+		" --label num=1 --label service=myapp" +
+		" --expose 23456/tcp --expose 5000/tcp --expose 5005/tcp --expose 5006/tcp" +
+		" --volume /tmp/myapp/tmpfs:/tmp/tmpfs --volume /tmp/myapp/log:/opt/myapp/log:ro --volume /var/log" +
+		" --volumes-from myapp.config --volumes-from myapp.extdata --volumes-from monitoring.sensu" +
+		" --link monitoring.sensu:sensu --net host --pid host --uts host" +
+		" --dns 8.8.8.8 --add-host www.grammarly.com:127.0.0.1 --restart always" +
+		" --privileged --cap-add NET_ADMIN --cap-drop MKNOD" +
+		" --security-opt apparmor:my-profile --read-only --cgroup-parent /apps" +
+		" --memory 314572800 --memory-swap 1073741824 --cpu-shares 512 --cpuset-cpus 0-2 --cpuset-mems 0" +
+		" --ulimit nofile=1024:2048" +
+		" --log-driver syslog --log-opt syslog-address=tcp://192.168.0.42:123" +
+		" --entrypoint /bin/app quay.io/myapp:1.9.2 param1 param2"
+
+	assert.Equal(t, expected, DockerRunCommand("myapp.main", container.GetAPIConfig(), hostConfig, DefaultLabelPrefix))
+}
+
+func TestDockerRunCommandEntrypoint(t *testing.T) {
+	apiConfig := &docker.Config{
+		Image:      "ubuntu:14.04",
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{"echo $HOME"},
+		Labels:     map[string]string{"rocker-compose-id": "123"},
+	}
+
+	assert.Equal(t, "docker run -d --entrypoint /bin/sh ubuntu:14.04 -c 'echo $HOME'",
+		DockerRunCommand("", apiConfig, &docker.HostConfig{}, DefaultLabelPrefix))
+}
+
+func TestDockerRunCommandEntrypointReset(t *testing.T) {
+	apiConfig := &docker.Config{
+		Image:      "ubuntu:14.04",
+		Entrypoint: []string{},
+		Cmd:        []string{"ls"},
+	}
+
+	assert.Equal(t, "docker run -d --entrypoint '' ubuntu:14.04 ls",
+		DockerRunCommand("", apiConfig, &docker.HostConfig{}, DefaultLabelPrefix))
+}
@@ -0,0 +1,249 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// NewFromDockerConfig produces a container spec from the actual docker config and host config
+// of the container, unlike NewFromDocker it does not need the managed config label,
+// so it can be used to import containers that were started by other tools. Note that docker
+// merges the image defaults (e.g. cmd, env) into the container config, so they are exported as well.
+// The second returned value lists the settings that cannot be represented in the manifest.
+// The names of the linked containers are parsed with the given naming strategy, the labels
+// managed with the given prefix are not exported.
+func NewFromDockerConfig(apiContainer *docker.Container, naming NamingStrategy, prefix LabelPrefix) (*Container, []string) {
+	var (
+		container = &Container{}
+		warnings  = []string{}
+	)
+
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if apiConfig := apiContainer.Config; apiConfig != nil {
+		container.readAPIConfig(apiConfig, apiContainer.ID, prefix)
+		if apiConfig.Tty || apiConfig.OpenStdin {
+			warn("tty and stdin options are not supported")
+		}
+		if len(apiConfig.OnBuild) > 0 {
+			warn("onbuild triggers are not supported")
+		}
+		if apiConfig.VolumeDriver != "" {
+			warn("volume_driver is not supported: %s", apiConfig.VolumeDriver)
+		}
+	}
+
+	hostConfig := apiContainer.HostConfig
+	if hostConfig == nil {
+		return container, warnings
+	}
+
+	container.readHostConfig(hostConfig)
+
+	// readHostConfig sets the net type even when it is the default one
+	if container.Net != nil && container.Net.Type == "bridge" {
+		container.Net = nil
+	}
+	if hostConfig.UTSMode != "" {
+		uts := hostConfig.UTSMode
+		container.Uts = &uts
+	}
+	if len(hostConfig.DNS) > 0 {
+		container.DNS = hostConfig.DNS
+	}
+	if len(hostConfig.ExtraHosts) > 0 {
+		container.AddHost = hostConfig.ExtraHosts
+	}
+	if policy := hostConfig.RestartPolicy; policy.Name != "" {
+		container.Restart = &RestartPolicy{policy.Name, policy.MaximumRetryCount}
+	}
+	if memory := NewConfigMemoryFromInt64(hostConfig.Memory); memory != nil {
+		container.Memory = memory
+	}
+	if memorySwap := NewConfigMemoryFromInt64(hostConfig.MemorySwap); memorySwap != nil {
+		container.MemorySwap = memorySwap
+	}
+	if cpuset := actualCpusetCpus(apiContainer); cpuset != "" {
+		container.CpusetCpus = &cpuset
+	}
+	if hostConfig.CPUSetMEMs != "" {
+		cpusetMems := hostConfig.CPUSetMEMs
+		container.CpusetMems = &cpusetMems
+	}
+	// CPU quota of the default period is exported as cpus, other ones are set by readHostConfig
+	if period := hostConfig.CPUPeriod; hostConfig.CPUQuota > 0 && (period == 0 || period == CPUPeriod) {
+		cpus := Cpus(float64(hostConfig.CPUQuota) / float64(CPUPeriod))
+		container.Cpus = &cpus
+		container.CPUQuota, container.CPUPeriod = nil, nil
+	}
+	if hostConfig.OOMKillDisable {
+		oomKillDisable := true
+		container.OomKillDisable = &oomKillDisable
+	}
+
+	// Ports, ports that are exposed but not published go to "expose"
+	for port, bindings := range hostConfig.PortBindings {
+		for _, binding := range bindings {
+			container.Ports = append(container.Ports, PortBinding{
+				Port:     string(port),
+				HostIP:   binding.HostIP,
+				HostPort: binding.HostPort,
+			})
+		}
+	}
+	if apiContainer.Config != nil {
+		for port := range apiContainer.Config.ExposedPorts {
+			if _, ok := hostConfig.PortBindings[port]; !ok {
+				container.Expose = append(container.Expose, string(port))
+			}
+		}
+	}
+	sort.Sort(portsByPort(container.Ports))
+	sort.Strings(container.Expose)
+
+	// Volumes, data volumes are those that are not bound from the host
+	bound := map[string]struct{}{}
+	for _, bind := range hostConfig.Binds {
+		container.Volumes = append(container.Volumes, bind)
+		if split := strings.Split(bind, ":"); len(split) > 1 {
+			bound[split[1]] = struct{}{}
+		}
+	}
+	if apiContainer.Config != nil {
+		for volume := range apiContainer.Config.Volumes {
+			if _, ok := bound[volume]; !ok {
+				container.Volumes = append(container.Volumes, volume)
+			}
+		}
+	}
+	sort.Strings(container.Volumes)
+
+	for _, volume := range hostConfig.VolumesFrom {
+		split := strings.SplitN(volume, ":", 2)
+		if len(split) > 1 {
+			warn("volumes_from %s: access mode %s is not supported", split[0], split[1])
+		}
+		container.VolumesFrom = append(container.VolumesFrom, *naming.Parse(split[0]))
+	}
+
+	// Links, docker reports them in the form of "/db:/web/alias"
+	for _, str := range hostConfig.Links {
+		split := strings.SplitN(str, ":", 2)
+		link := Link{ContainerName: *naming.Parse(split[0])}
+		link.Alias = strings.Replace(link.ContainerName.Name, "_", "-", -1)
+		if len(split) > 1 {
+			link.Alias = split[1][strings.LastIndex(split[1], "/")+1:]
+		}
+		container.Links = append(container.Links, link)
+	}
+
+	// Logging, the default json-file driver is omitted
+	if container.LogDriver != nil && *container.LogDriver == "json-file" {
+		container.LogDriver = nil
+	}
+
+	// The settings that have no property in the manifest
+	if len(hostConfig.DNSSearch) > 0 {
+		warn("dns_search is not supported: %s", strings.Join(hostConfig.DNSSearch, ", "))
+	}
+	if hostConfig.IpcMode != "" {
+		warn("ipc is not supported: %s", hostConfig.IpcMode)
+	}
+
+	return container, warnings
+}
+
+// NewFromDockerRuntime produces a best-effort container spec of the container that was not
+// created by rocker-compose, so it can be compared with the manifest without being recreated.
+// It is the same as NewFromDockerConfig, but the labels are left out since docker merges
+// the labels of the image into them and they would always differ from the manifest, and
+// the "no" restart policy, which is the docker default, is read as not given.
+// The properties docker takes from the image are left out by StripImageDefaults.
+func NewFromDockerRuntime(apiContainer *docker.Container, naming NamingStrategy, prefix LabelPrefix) *Container {
+	container, _ := NewFromDockerConfig(apiContainer, naming, prefix)
+	container.Labels = nil
+	if container.Restart != nil && container.Restart.Name == "no" {
+		container.Restart = nil
+	}
+	return container
+}
+
+// readAPIConfig fills the properties of the container spec from the docker config
+func (config *Container) readAPIConfig(apiConfig *docker.Config, containerID string, prefix LabelPrefix) {
+	if apiConfig.Image != "" {
+		image := apiConfig.Image
+		config.Image = &image
+	}
+	if len(apiConfig.Cmd) > 0 {
+		config.Cmd = apiConfig.Cmd
+	}
+	if len(apiConfig.Entrypoint) > 0 {
+		entrypoint := Strings(apiConfig.Entrypoint)
+		config.Entrypoint = &entrypoint
+	}
+
+	// docker uses the short container id as a hostname if it was not given
+	if apiConfig.Hostname != "" && !strings.HasPrefix(containerID, apiConfig.Hostname) {
+		hostname := apiConfig.Hostname
+		config.Hostname = &hostname
+	}
+	if apiConfig.Domainname != "" {
+		domainname := apiConfig.Domainname
+		config.Domainname = &domainname
+	}
+	if apiConfig.User != "" {
+		user := apiConfig.User
+		config.User = &user
+	}
+	if apiConfig.WorkingDir != "" {
+		workdir := apiConfig.WorkingDir
+		config.Workdir = &workdir
+	}
+
+	if len(apiConfig.Env) > 0 {
+		config.Env = StringMap{}
+		for _, env := range apiConfig.Env {
+			split := strings.SplitN(env, "=", 2)
+			if len(split) > 1 {
+				config.Env[split[0]] = split[1]
+			} else {
+				config.Env[split[0]] = ""
+			}
+		}
+	}
+
+	config.Labels = prefix.userLabels(apiConfig.Labels)
+}
+
+// portsByPort sorts port bindings by the container port and then by the host port
+type portsByPort Ports
+
+func (p portsByPort) Len() int      { return len(p) }
+func (p portsByPort) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p portsByPort) Less(i, j int) bool {
+	if p[i].Port != p[j].Port {
+		return p[i].Port < p[j].Port
+	}
+	return p[i].HostPort < p[j].HostPort
+}
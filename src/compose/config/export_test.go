@@ -0,0 +1,137 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/go-yaml/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFromDockerConfig(t *testing.T) {
+	apiContainer := &docker.Container{
+		ID:   "4a2b6c8d0e1f23456789",
+		Name: "/web",
+		Config: &docker.Config{
+			Image:    "nginx:1.9",
+			Hostname: "4a2b6c8d0e1f",
+			Env:      []string{"PORT=80", "DEBUG="},
+			Cmd:      []string{"nginx", "-g", "daemon off;"},
+			ExposedPorts: map[docker.Port]struct{}{
+				"80/tcp":  {},
+				"443/tcp": {},
+			},
+			Volumes: map[string]struct{}{
+				"/var/cache/nginx": {},
+				"/etc/nginx":       {},
+			},
+			Labels: map[string]string{
+				"app":               "web",
+				"rocker-compose-id": "abc123",
+			},
+		},
+		HostConfig: &docker.HostConfig{
+			NetworkMode: "default",
+			Binds:       []string{"/opt/nginx:/etc/nginx:ro"},
+			PortBindings: map[docker.Port][]docker.PortBinding{
+				"80/tcp": {{HostIP: "0.0.0.0", HostPort: "8080"}},
+			},
+			Links:         []string{"/db:/web/database"},
+			RestartPolicy: docker.AlwaysRestart(),
+			LogConfig:     docker.LogConfig{Type: "json-file"},
+		},
+	}
+
+	container, warnings := NewFromDockerConfig(apiContainer, DotNaming, DefaultLabelPrefix)
+
+	assert.Empty(t, warnings)
+	assert.Equal(t, "nginx:1.9", *container.Image)
+	assert.Nil(t, container.Hostname)
+	assert.Nil(t, container.Net)
+	assert.Nil(t, container.LogDriver)
+	assert.Equal(t, StringMap{"PORT": "80", "DEBUG": ""}, container.Env)
+	assert.Equal(t, StringMap{"app": "web"}, container.Labels)
+	assert.Equal(t, Cmd{"nginx", "-g", "daemon off;"}, container.Cmd)
+	assert.Equal(t, Ports{{Port: "80/tcp", HostIP: "0.0.0.0", HostPort: "8080"}}, container.Ports)
+	assert.Equal(t, Strings{"443/tcp"}, container.Expose)
+	assert.Equal(t, Strings{"/opt/nginx:/etc/nginx:ro", "/var/cache/nginx"}, container.Volumes)
+	assert.Equal(t, Links{{ContainerName{"", "db"}, "database"}}, container.Links)
+	assert.Equal(t, &RestartPolicy{"always", 0}, container.Restart)
+
+	// the exported spec should be readable back as a manifest
+	data, err := yaml.Marshal(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &Container{}
+	if err := yaml.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, container.Ports, restored.Ports)
+	assert.Equal(t, container.Volumes, restored.Volumes)
+	assert.Equal(t, container.Env, restored.Env)
+}
+
+func TestNewFromDockerConfigWarnings(t *testing.T) {
+	apiContainer := &docker.Container{
+		ID:     "4a2b6c8d0e1f23456789",
+		Config: &docker.Config{Image: "nginx:1.9"},
+		HostConfig: &docker.HostConfig{
+			CapAdd:         []string{"NET_ADMIN"},
+			SecurityOpt:    []string{"apparmor:my-profile"},
+			ReadonlyRootfs: true,
+			DNSSearch:      []string{"example.com"},
+			VolumesFrom:    []string{"data:ro"},
+			NetworkMode:    "host",
+			RestartPolicy:  docker.NeverRestart(),
+		},
+	}
+
+	container, warnings := NewFromDockerConfig(apiContainer, DotNaming, DefaultLabelPrefix)
+
+	assert.Equal(t, []string{
+		"volumes_from data: access mode ro is not supported",
+		"dns_search is not supported: example.com",
+	}, warnings)
+	assert.Equal(t, Strings{"NET_ADMIN"}, container.CapAdd)
+	assert.Equal(t, Strings{"apparmor:my-profile"}, container.SecurityOpt)
+	assert.True(t, *container.ReadonlyRootfs)
+	assert.Nil(t, container.CgroupParent)
+	assert.Equal(t, ContainerNames{{"", "data"}}, container.VolumesFrom)
+	assert.Equal(t, "host", container.Net.Type)
+}
+
+func TestNewFromDockerConfigCPUQuota(t *testing.T) {
+	newAPIContainer := func(quota, period int64) *docker.Container {
+		return &docker.Container{
+			Config:     &docker.Config{Image: "nginx:1.9"},
+			HostConfig: &docker.HostConfig{CPUQuota: quota, CPUPeriod: period},
+		}
+	}
+
+	container, _ := NewFromDockerConfig(newAPIContainer(150000, CPUPeriod), DotNaming, DefaultLabelPrefix)
+	assert.EqualValues(t, 1.5, *container.Cpus, "quota of the default period should be exported as cpus")
+	assert.Nil(t, container.CPUQuota)
+	assert.Nil(t, container.CPUPeriod)
+
+	container, _ = NewFromDockerConfig(newAPIContainer(50000, 200000), DotNaming, DefaultLabelPrefix)
+	assert.Nil(t, container.Cpus)
+	assert.EqualValues(t, 50000, *container.CPUQuota)
+	assert.EqualValues(t, 200000, *container.CPUPeriod)
+}
@@ -16,6 +16,15 @@
 
 package config
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/grammarly/rocker/src/template"
+)
+
 // ExtendFrom extends the container spec from a given one
 func (container *Container) ExtendFrom(parent *Container) {
 	if container.Image == nil {
@@ -42,33 +51,86 @@ func (container *Container) ExtendFrom(parent *Container) {
 	if container.Restart == nil {
 		container.Restart = parent.Restart
 	}
+	if container.RestartBackoff == nil {
+		container.RestartBackoff = parent.RestartBackoff
+	}
+	container.extendHostPercents(parent)
 	if container.Memory == nil {
 		container.Memory = parent.Memory
 	}
 	if container.MemorySwap == nil {
 		container.MemorySwap = parent.MemorySwap
 	}
+	if container.ShmSize == nil {
+		container.ShmSize = parent.ShmSize
+	}
+	if container.KernelMemory == nil {
+		container.KernelMemory = parent.KernelMemory
+	}
+	if container.MemReservation == nil {
+		container.MemReservation = parent.MemReservation
+	}
 	if container.CPUShares == nil {
 		container.CPUShares = parent.CPUShares
 	}
+	if container.Cpus == nil {
+		container.Cpus = parent.Cpus
+	}
+	for name := range container.hostPercents {
+		// the percentage given by the container wins over the concrete value of the parent
+		container.setHostPercent(name, container.hostPercents[name])
+	}
+	if container.CPUQuota == nil {
+		container.CPUQuota = parent.CPUQuota
+	}
+	if container.CPUPeriod == nil {
+		container.CPUPeriod = parent.CPUPeriod
+	}
 	if container.CpusetCpus == nil {
 		container.CpusetCpus = parent.CpusetCpus
 	}
+	if container.CpusetMems == nil {
+		container.CpusetMems = parent.CpusetMems
+	}
 	if container.OomKillDisable == nil {
 		container.OomKillDisable = parent.OomKillDisable
 	}
 	if container.Ulimits == nil {
 		container.Ulimits = parent.Ulimits
 	}
+	if container.UlimitProfile == "" {
+		container.UlimitProfile = parent.UlimitProfile
+	}
 	if container.Privileged == nil {
 		container.Privileged = parent.Privileged
 	}
+	if container.CapAdd == nil {
+		container.CapAdd = parent.CapAdd
+	}
+	if container.CapDrop == nil {
+		container.CapDrop = parent.CapDrop
+	}
+	if container.SecurityOpt == nil {
+		container.SecurityOpt = parent.SecurityOpt
+	}
+	if container.Devices == nil {
+		container.Devices = parent.Devices
+	}
+	if container.ReadonlyRootfs == nil {
+		container.ReadonlyRootfs = parent.ReadonlyRootfs
+	}
+	if container.CgroupParent == nil {
+		container.CgroupParent = parent.CgroupParent
+	}
 	if container.Cmd == nil {
 		container.Cmd = parent.Cmd
 	}
 	if container.Entrypoint == nil {
 		container.Entrypoint = parent.Entrypoint
 	}
+	if container.CmdTemplate == nil {
+		container.CmdTemplate = parent.CmdTemplate
+	}
 	if container.Expose == nil {
 		container.Expose = parent.Expose
 	}
@@ -116,15 +178,72 @@ func (container *Container) ExtendFrom(parent *Container) {
 	if container.WaitFor == nil {
 		container.WaitFor = parent.WaitFor
 	}
+	if container.EnvFromExec == nil {
+		container.EnvFromExec = parent.EnvFromExec
+	}
 	if container.VolumesFrom == nil {
 		container.VolumesFrom = parent.VolumesFrom
 	}
 	if container.Volumes == nil {
 		container.Volumes = parent.Volumes
 	}
+	if container.Mounts == nil {
+		container.Mounts = parent.Mounts
+	}
+	if container.PullSecret == "" {
+		container.PullSecret = parent.PullSecret
+	}
+	if container.RecreateStrategy == "" {
+		container.RecreateStrategy = parent.RecreateStrategy
+	}
+	if container.Group == "" {
+		container.Group = parent.Group
+	}
+	if container.PullPolicy == "" {
+		container.PullPolicy = parent.PullPolicy
+	}
+	if container.PullTimeout == nil {
+		container.PullTimeout = parent.PullTimeout
+	}
+	if container.DesiredState == "" {
+		container.DesiredState = parent.DesiredState
+	}
+	if container.RequiredEnv == nil {
+		container.RequiredEnv = parent.RequiredEnv
+	}
+	if container.SecretEnv == nil {
+		container.SecretEnv = parent.SecretEnv
+	}
+	if container.Readiness == nil {
+		container.Readiness = parent.Readiness
+	}
+	if container.PreStop == nil {
+		container.PreStop = parent.PreStop
+	}
+	if container.Quiesce == nil {
+		container.Quiesce = parent.Quiesce
+	}
+	if container.Unquiesce == nil {
+		container.Unquiesce = parent.Unquiesce
+	}
+	if container.WaitForExternal == nil {
+		container.WaitForExternal = parent.WaitForExternal
+	}
+	if container.StartupDelay == nil {
+		container.StartupDelay = parent.StartupDelay
+	}
+	if container.Platform == "" {
+		container.Platform = parent.Platform
+	}
+	if container.When == nil {
+		container.When = parent.When
+	}
 	if container.KillTimeout == nil {
 		container.KillTimeout = parent.KillTimeout
 	}
+	if container.StopPriority == nil {
+		container.StopPriority = parent.StopPriority
+	}
 	if container.Hostname == nil {
 		container.Hostname = parent.Hostname
 	}
@@ -137,9 +256,88 @@ func (container *Container) ExtendFrom(parent *Container) {
 	if container.Workdir == nil {
 		container.Workdir = parent.Workdir
 	}
+	if container.HashPaths == nil {
+		container.HashPaths = parent.HashPaths
+	}
 	if container.Extra == nil {
 		container.Extra = parent.Extra
 	}
 
 	return
 }
+
+// resolveFileExtends extends containers of the config read from configName that refer
+// to specs in other files. Relative file paths are resolved against the directory of
+// the referencing file. Extended specs are fully resolved, so they may extend further
+// from other files or from containers of their own file.
+func (config *Config) resolveFileExtends(configName string, vars template.Vars, funcs map[string]interface{}) error {
+	for name, container := range config.Containers {
+		if container.Extends == nil || container.Extends.File == "" {
+			continue
+		}
+		chain := []string{extendsRef(configName, name)}
+		parent, err := loadExtends(configName, container.Extends, vars, funcs, chain)
+		if err != nil {
+			return fmt.Errorf("Container %s: %s", name, err)
+		}
+		container.ExtendFrom(parent)
+	}
+	return nil
+}
+
+// loadExtends reads the container spec referred by extends from the file,
+// chain holds specs being resolved to detect cycles
+func loadExtends(configName string, extends *Extends, vars template.Vars, funcs map[string]interface{}, chain []string) (*Container, error) {
+	filename := extends.File
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(configName), filename)
+	}
+
+	ref := extendsRef(filename, extends.Service)
+	for _, r := range chain {
+		if r == ref {
+			return nil, fmt.Errorf("extends cycle detected: %s", strings.Join(append(chain, ref), " -> "))
+		}
+	}
+	chain = append(chain, ref)
+
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file %s to extend from, error: %s", filename, err)
+	}
+	defer fd.Close()
+
+	fileConfig, err := parseConfig(filename, fd, vars, funcs, false)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read file %s to extend from, error: %s", filename, err)
+	}
+
+	parent, ok := fileConfig.Containers[extends.Service]
+	if !ok {
+		return nil, fmt.Errorf("cannot find container %s in %s to extend from", extends.Service, filename)
+	}
+
+	if parent.Extends != nil {
+		// extending within the same file refers to the file itself
+		next := *parent.Extends
+		if next.File == "" {
+			next.File = filepath.Base(filename)
+		}
+		grandparent, err := loadExtends(filename, &next, vars, funcs, chain)
+		if err != nil {
+			return nil, err
+		}
+		parent.ExtendFrom(grandparent)
+		parent.Extends = nil
+	}
+
+	return parent, nil
+}
+
+// extendsRef returns "file:service" reference used to detect extends cycles
+func extendsRef(filename, service string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	return filename + ":" + service
+}
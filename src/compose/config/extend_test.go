@@ -17,6 +17,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -54,3 +55,49 @@ func TestConfigExtend(t *testing.T) {
 	// should be overriden
 	assert.EqualValues(t, 200, *config.Containers["main2"].KillTimeout)
 }
+
+func TestConfigExtendFromFile(t *testing.T) {
+	config, err := NewFromFile("testdata/extends/compose.yml", configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := config.Containers["main"]
+
+	// inherited through common/base.yml -> common/web.yml -> common/base.yml
+	assert.Equal(t, "quay.io/myapp:1.9.2", *main.Image)
+	assert.Equal(t, Strings{"8.8.8.8"}, main.DNS)
+	assert.EqualValues(t, 512, *main.CPUShares)
+	assert.Equal(t, StringMap{"service": "myapp", "tier": "web"}, main.Labels)
+
+	// should be overriden
+	assert.Equal(t, StringMap{"LOG_LEVEL": "debug", "PORT": "8080"}, main.Env)
+
+	// extending within the same file should see the resolved spec
+	assert.Equal(t, "quay.io/myapp:1.9.2", *config.Containers["worker"].Image)
+	assert.EqualValues(t, 512, *config.Containers["worker"].CPUShares)
+
+	// containers of extended files should not be added
+	assert.Len(t, config.Containers, 2)
+}
+
+func TestConfigExtendFromFileCycle(t *testing.T) {
+	_, err := NewFromFile("testdata/extends/cycle/a.yml", configTestVars, map[string]interface{}{}, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Container main: extends cycle detected: ")
+		assert.Contains(t, err.Error(), "a.yml:main -> ")
+		assert.Contains(t, err.Error(), "b.yml:_base -> ")
+	}
+}
+
+func TestConfigExtendFromFileNotFound(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    extends:
+      file: testdata/extends/common/web.yml
+      service: db`
+
+	_, err := ReadConfig("compose.yml", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container main: cannot find container db in testdata/extends/common/web.yml to extend from")
+}
@@ -0,0 +1,96 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/go-yaml/yaml"
+	"github.com/grammarly/rocker/src/imagename"
+)
+
+// ContainerFlags are the properties of a single container given by command line
+// flags of 'rocker-compose run' instead of a manifest file
+type ContainerFlags struct {
+	Name    string   // container name, the image name by default
+	Image   string   //
+	Env     []string // KEY=VALUE pairs
+	Ports   []string //
+	Volumes []string //
+	Cmd     []string //
+}
+
+// FlagsNamespace is the namespace of the single container given by flags unless another one
+// is given, so the containers of the manifests run from the same directory are never touched
+const FlagsNamespace = "run"
+
+// NewFromFlags makes a manifest of the single container described by the flags.
+// If namespace is empty, FlagsNamespace is used, relative volume paths are resolved
+// against basedir.
+func NewFromFlags(namespace string, flags ContainerFlags, basedir string) (*Config, error) {
+	container, err := NewContainerFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace == "" {
+		namespace = FlagsNamespace
+	}
+
+	name := flags.Name
+	if name == "" {
+		name = regexp.MustCompile("[^a-z0-9\\-\\_]").ReplaceAllString(path.Base(imagename.NewFromString(flags.Image).Name), "")
+	}
+
+	return New(namespace, map[string]*Container{name: container}, basedir)
+}
+
+// NewContainerFromFlags converts the flags to the container spec. The values are
+// parsed the same way as the corresponding properties of the manifest.
+func NewContainerFromFlags(flags ContainerFlags) (*Container, error) {
+	if flags.Image == "" {
+		return nil, fmt.Errorf("Image should be specified for the container")
+	}
+
+	props := map[string]interface{}{"image": flags.Image}
+	if len(flags.Env) > 0 {
+		props["env"] = flags.Env
+	}
+	if len(flags.Ports) > 0 {
+		props["ports"] = flags.Ports
+	}
+	if len(flags.Volumes) > 0 {
+		props["volumes"] = flags.Volumes
+	}
+	if len(flags.Cmd) > 0 {
+		props["cmd"] = flags.Cmd
+	}
+
+	data, err := yaml.Marshal(props)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to serialize container flags, error: %s", err)
+	}
+
+	container := &Container{}
+	if err := yaml.Unmarshal(data, container); err != nil {
+		return nil, fmt.Errorf("Failed to parse container flags, error: %s", err)
+	}
+
+	return container, nil
+}
@@ -0,0 +1,73 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewContainerFromFlags(t *testing.T) {
+	container, err := NewContainerFromFlags(ContainerFlags{
+		Image:   "nginx:1.9",
+		Env:     []string{"FOO=bar", "DEBUG"},
+		Ports:   []string{"8080:80", "127.0.0.1:8443:443", "53/udp"},
+		Volumes: []string{"/data:/var/lib/data", "/cache"},
+		Cmd:     []string{"nginx", "-g", "daemon off;"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "nginx:1.9", *container.Image)
+	assert.Equal(t, StringMap{"FOO": "bar", "DEBUG": "true"}, container.Env)
+	assert.Equal(t, Ports{
+		PortBinding{Port: "80/tcp", HostPort: "8080"},
+		PortBinding{Port: "443/tcp", HostIP: "127.0.0.1", HostPort: "8443"},
+		PortBinding{Port: "53/udp"},
+	}, container.Ports)
+	assert.Equal(t, Strings{"/data:/var/lib/data", "/cache"}, container.Volumes)
+	assert.Equal(t, Cmd{"nginx", "-g", "daemon off;"}, container.Cmd)
+}
+
+func TestNewContainerFromFlagsNoImage(t *testing.T) {
+	_, err := NewContainerFromFlags(ContainerFlags{Env: []string{"FOO=bar"}})
+	assert.EqualError(t, err, "Image should be specified for the container")
+}
+
+func TestNewFromFlags(t *testing.T) {
+	config, err := NewFromFlags("", ContainerFlags{
+		Image:   "quay.io/example/web-app:1.0",
+		Volumes: []string{"./data:/data"},
+	}, "/home/user/tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, FlagsNamespace, config.Namespace, "the namespace should not be guessed from the directory")
+	if container := config.Containers["web-app"]; assert.NotNil(t, container) {
+		assert.Equal(t, Strings{"/home/user/tests/data:/data"}, container.Volumes)
+	}
+}
+
+func TestNewFromFlagsValidation(t *testing.T) {
+	_, err := NewFromFlags("test", ContainerFlags{Name: "main.web", Image: "nginx:1.9"}, "/")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Container main.web: docker name test.main.web of the container is ambiguous")
+	}
+}
@@ -0,0 +1,103 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// ContentHash returns the hash of the content of files listed in "hash_paths"
+// property of the container spec. It is calculated once the config is loaded,
+// empty string means that there is nothing to hash.
+func (config *Container) ContentHash() string {
+	return config.contentHash
+}
+
+// FileHash returns the hash of the whole resolved manifest: the namespace and the specs
+// of all containers, templates prefixed with "_" affect it through the containers
+// extending them. Containers are labeled with it, so a partial run can tell that
+// the manifest has changed since the last full one.
+func (config *Config) FileHash() (string, error) {
+	names := []string{}
+	for name := range config.Containers {
+		if !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", config.Namespace)
+
+	for _, name := range names {
+		data, err := yaml.Marshal(config.Containers[name])
+		if err != nil {
+			return "", fmt.Errorf("Failed to hash container %s, error: %s", name, err)
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", name, data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashPaths calculates sha256 hash of all given files and directories (recursively).
+// Both file names and their contents affect the result, so renaming a file
+// is also considered as a change. The names are taken relative to the manifest
+// directory, so the same checkout gives the same hash wherever it is placed.
+func hashPaths(basedir string, paths []string) (string, error) {
+	h := sha256.New()
+
+	for _, root := range paths {
+		err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			name, err := filepath.Rel(basedir, file)
+			if err != nil {
+				name = file
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00", name, info.Size())
+
+			fd, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer fd.Close()
+
+			_, err = io.Copy(h, fd)
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("Failed to hash %s, error: %s", root, err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,177 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigContentHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rocker-compose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readHash := func() string {
+		configStr := `namespace: test
+containers:
+  nginx:
+    image: nginx:1.9
+    volumes: ./conf.d:/etc/nginx/conf.d
+    hash_paths:
+      - ./conf.d
+      - ./nginx.conf
+  other:
+    image: nginx:1.9`
+
+		config, err := ReadConfig(filepath.Join(dir, "compose.yml"), strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "", config.Containers["other"].ContentHash())
+		assert.Equal(t, Strings{filepath.Join(dir, "conf.d"), filepath.Join(dir, "nginx.conf")}, config.Containers["nginx"].HashPaths)
+		return config.Containers["nginx"].ContentHash()
+	}
+
+	writeFile("nginx.conf", "worker_processes 1;")
+	writeFile("conf.d/default.conf", "server {}")
+
+	hash1 := readHash()
+	assert.NotEmpty(t, hash1)
+	assert.Equal(t, hash1, readHash(), "hash should be stable if nothing changed")
+
+	writeFile("conf.d/default.conf", "server { listen 80; }")
+	hash2 := readHash()
+	assert.NotEqual(t, hash1, hash2, "hash should change when file in a directory changes")
+
+	writeFile("conf.d/other.conf", "")
+	hash3 := readHash()
+	assert.NotEqual(t, hash2, hash3, "hash should change when a new file is added")
+
+	writeFile("nginx.conf", "worker_processes 2;")
+	assert.NotEqual(t, hash3, readHash(), "hash should change when file changes")
+}
+
+func TestConfigContentHashRelative(t *testing.T) {
+	readHash := func() string {
+		dir, err := ioutil.TempDir("", "rocker-compose-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("worker_processes 1;"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		configStr := `namespace: test
+containers:
+  nginx:
+    image: nginx:1.9
+    hash_paths: ./nginx.conf`
+
+		config, err := ReadConfig(filepath.Join(dir, "compose.yml"), strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.Containers["nginx"].ContentHash()
+	}
+
+	assert.Equal(t, readHash(), readHash(), "hash should not depend on the directory of the manifest")
+}
+
+func TestConfigContentHashMissingPath(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  nginx:
+    image: nginx:1.9
+    hash_paths: /nonexisting/path/nginx.conf`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.Error(t, err)
+}
+
+func TestConfigFileHash(t *testing.T) {
+	readHash := func(configStr string) string {
+		config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := config.FileHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	configStr := `namespace: test
+containers:
+  _base:
+    image: ubuntu:14.04
+    env:
+      A: 1
+      B: 2
+  main:
+    extends: _base
+    cmd: ["app"]
+  db:
+    image: postgres:9.4`
+
+	hash := readHash(configStr)
+	assert.NotEmpty(t, hash)
+	assert.Equal(t, hash, readHash(configStr), "hash should be stable if nothing changed")
+
+	reordered := `namespace: test
+containers:
+  db:
+    image: postgres:9.4
+  main:
+    cmd: ["app"]
+    extends: _base
+  _base:
+    env:
+      B: 2
+      A: 1
+    image: ubuntu:14.04`
+	assert.Equal(t, hash, readHash(reordered), "hash should not depend on the order of properties")
+
+	changed := strings.Replace(configStr, "postgres:9.4", "postgres:9.5", 1)
+	assert.NotEqual(t, hash, readHash(changed), "hash should change when any container changes")
+
+	changed = strings.Replace(configStr, "B: 2", "B: 3", 1)
+	assert.NotEqual(t, hash, readHash(changed), "hash should change when a template changes")
+
+	changed = strings.Replace(configStr, "namespace: test", "namespace: other", 1)
+	assert.NotEqual(t, hash, readHash(changed), "hash should change with the namespace")
+}
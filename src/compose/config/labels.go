@@ -0,0 +1,135 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import "strings"
+
+// LabelPrefix is the prefix of the labels rocker-compose manages containers with, e.g. the spec
+// of the container is stored in "rocker-compose-config" label. Another prefix can be given
+// if the default one collides with conventions of other tooling, the containers created with
+// another prefix are not recognized as managed by rocker-compose then.
+type LabelPrefix string
+
+// DefaultLabelPrefix is the default prefix of the labels rocker-compose manages containers with
+const DefaultLabelPrefix LabelPrefix = "rocker-compose-"
+
+// Names of the managed labels, see LabelPrefix.Label
+const (
+	LabelConfig    = "config"
+	LabelID        = "id"
+	LabelNamespace = "namespace"
+)
+
+// LabelEnvironment is the label of the environment, e.g. prod or staging,
+// a container was deployed to. It is not the part of the spec, so it is not compared.
+const LabelEnvironment = "environment"
+
+// LabelContentHash is the name of the label keeping the hash of "hash_paths", see ContentHash
+const LabelContentHash = "content-hash"
+
+// LabelFileHash is the name of the label keeping the hash of the manifest of the last full run, see FileHash
+const LabelFileHash = "file-hash"
+
+// LabelEndpointPrefix is the prefix of the labels describing the host endpoints the ports of the container
+// are published on, e.g. "rocker-compose-endpoint.8080/tcp", see EndpointLabels
+const LabelEndpointPrefix = "endpoint."
+
+// Label returns the key of the managed label with the given name, e.g. prefix.Label(LabelConfig)
+func (prefix LabelPrefix) Label(name string) string {
+	return string(prefix) + name
+}
+
+// reservedLabels are the names of all labels rocker-compose sets itself
+var reservedLabels = []string{
+	LabelConfig,
+	LabelID,
+	LabelNamespace,
+	LabelEnvironment,
+	LabelContentHash,
+	LabelFileHash,
+	LabelRestartBackoffInitial,
+	LabelRestartBackoffMax,
+	LabelRestartBackoffMultiplier,
+}
+
+// IsManaged returns true if the label key is one of the labels rocker-compose sets itself,
+// other labels that happen to have the same prefix, e.g. "rocker-compose-custom", are the user ones
+func (prefix LabelPrefix) IsManaged(key string) bool {
+	if !strings.HasPrefix(key, string(prefix)) {
+		return false
+	}
+	if strings.HasPrefix(key, prefix.Label(LabelEndpointPrefix)) {
+		return true
+	}
+	for _, name := range reservedLabels {
+		if key == prefix.Label(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// StripManagedLabels removes the labels managed with the given prefix from "labels" of all
+// containers, rocker-compose sets them itself and strips them when the containers are read back,
+// so a manifest declaring one of them would always differ from the running container.
+func (config *Config) StripManagedLabels(prefix LabelPrefix) {
+	for _, container := range config.Containers {
+		container.Labels = prefix.userLabels(container.Labels)
+	}
+}
+
+// EndpointLabels returns the labels describing the published ports of the container for service
+// discovery agents, e.g. "rocker-compose-endpoint.8080/tcp" = "0.0.0.0:80", a port published
+// several times has comma separated endpoints. Random host ports are assigned by docker when
+// the container starts, so such bindings are not described; nothing is published with the host network.
+func (config *Container) EndpointLabels(prefix LabelPrefix) map[string]string {
+	labels := map[string]string{}
+	if config.Net.IsHost() {
+		return labels
+	}
+	for _, port := range config.Ports {
+		if port.HostPort == "" {
+			continue
+		}
+		hostIP := port.HostIP
+		if hostIP == "" {
+			hostIP = "0.0.0.0"
+		}
+		key := prefix.Label(LabelEndpointPrefix + port.Port)
+		if labels[key] != "" {
+			labels[key] += ","
+		}
+		labels[key] += hostIP + ":" + port.HostPort
+	}
+	return labels
+}
+
+// userLabels returns the labels without the managed ones, so the labels set by rocker-compose
+// are neither restored nor compared; keys are matched case-sensitively, as docker does
+func (prefix LabelPrefix) userLabels(labels StringMap) StringMap {
+	var result StringMap
+	for k, v := range labels {
+		if prefix.IsManaged(k) {
+			continue
+		}
+		if result == nil {
+			result = StringMap{}
+		}
+		result[k] = v
+	}
+	return result
+}
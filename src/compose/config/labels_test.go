@@ -0,0 +1,70 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelPrefixIsManaged(t *testing.T) {
+	for _, key := range []string{"rocker-compose-config", "rocker-compose-id", "rocker-compose-environment", "rocker-compose-restart-backoff-max",
+		"rocker-compose-endpoint.8080/tcp"} {
+		assert.True(t, DefaultLabelPrefix.IsManaged(key), "%s should be managed", key)
+	}
+	for _, key := range []string{"rocker-compose-custom", "config", "app"} {
+		assert.False(t, DefaultLabelPrefix.IsManaged(key), "%s should not be managed", key)
+	}
+
+	prefix := LabelPrefix("myorg-compose-")
+	assert.Equal(t, "myorg-compose-config", prefix.Label(LabelConfig))
+	assert.True(t, prefix.IsManaged("myorg-compose-config"))
+	assert.False(t, prefix.IsManaged("rocker-compose-config"), "labels of other prefixes should not be managed")
+}
+
+func TestConfigStripManagedLabels(t *testing.T) {
+	config := &Config{Containers: map[string]*Container{
+		"main": &Container{Labels: StringMap{"rocker-compose-custom": "foo", "rocker-compose-config": "image: ubuntu"}},
+		"db":   &Container{Labels: StringMap{"myorg-compose-id": "1"}},
+		"web":  &Container{},
+	}}
+
+	config.StripManagedLabels("myorg-compose-")
+	assert.Equal(t, StringMap{"rocker-compose-custom": "foo", "rocker-compose-config": "image: ubuntu"}, config.Containers["main"].Labels)
+	assert.Nil(t, config.Containers["db"].Labels)
+
+	config.StripManagedLabels(DefaultLabelPrefix)
+	assert.Equal(t, StringMap{"rocker-compose-custom": "foo"}, config.Containers["main"].Labels)
+	assert.Nil(t, config.Containers["web"].Labels)
+}
+
+func TestEndpointLabels(t *testing.T) {
+	container := &Container{Ports: Ports{
+		{Port: "8080/tcp", HostPort: "80"},
+		{Port: "8080/tcp", HostIP: "127.0.0.1", HostPort: "8080"},
+		{Port: "8125/udp", HostIP: "10.0.0.1", HostPort: "8125"},
+		{Port: "9090/tcp"},
+	}}
+	assert.Equal(t, map[string]string{
+		"rocker-compose-endpoint.8080/tcp": "0.0.0.0:80,127.0.0.1:8080",
+		"rocker-compose-endpoint.8125/udp": "10.0.0.1:8125",
+	}, container.EndpointLabels(DefaultLabelPrefix))
+
+	container.Net = &Net{Type: "host"}
+	assert.Empty(t, container.EndpointLabels(DefaultLabelPrefix), "ports are not published with the host network")
+}
@@ -0,0 +1,64 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// LogRotation describes "log_rotation" root property of the manifest: options of
+// the json-file log driver which are applied to the containers that do not set them
+type LogRotation struct {
+	MaxSize string `yaml:"max_size,omitempty"` // max size of the log file before it is rotated, e.g. 100m
+	MaxFile string `yaml:"max_file,omitempty"` // max number of log files kept
+}
+
+// validate checks that at least one option is given and max_file is a positive number
+func (r *LogRotation) validate() error {
+	if r.MaxSize == "" && r.MaxFile == "" {
+		return fmt.Errorf("log_rotation should specify max_size or max_file")
+	}
+	if r.MaxFile != "" {
+		if n, err := strconv.Atoi(r.MaxFile); err != nil || n < 1 {
+			return fmt.Errorf("log_rotation max_file should be a positive number, got %s", r.MaxFile)
+		}
+	}
+	return nil
+}
+
+// apply merges the rotation options into log options of the container if it sets
+// the json-file driver explicitly, options set by the container itself are not overridden.
+// Containers without log_driver are left with the default driver of the docker daemon.
+func (r *LogRotation) apply(container *Container) {
+	if r == nil || container.LogDriver == nil || *container.LogDriver != "json-file" {
+		return
+	}
+
+	// log_opt may be shared with the container it was extended from, so make a new one
+	opts := StringMap{}
+	for k, v := range container.LogOpt {
+		opts[k] = v
+	}
+	if _, ok := opts["max-size"]; !ok && r.MaxSize != "" {
+		opts["max-size"] = r.MaxSize
+	}
+	if _, ok := opts["max-file"]; !ok && r.MaxFile != "" {
+		opts["max-file"] = r.MaxFile
+	}
+	container.LogOpt = opts
+}
@@ -0,0 +1,116 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/grammarly/rocker/src/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigLogRotation(t *testing.T) {
+	configStr := `namespace: test
+log_rotation:
+  max_size: 50m
+  max_file: 3
+containers:
+  default:
+    image: ubuntu:14.04
+  json:
+    image: ubuntu:14.04
+    log_driver: json-file
+    log_opt:
+      labels: app
+  override:
+    image: ubuntu:14.04
+    log_driver: json-file
+    log_opt:
+      max-size: 1g
+  opts_only:
+    image: ubuntu:14.04
+    log_opt:
+      max-size: 1g
+  syslog:
+    image: ubuntu:14.04
+    log_driver: syslog
+  syslog_child:
+    extends: default
+    log_driver: syslog`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the default driver of the docker daemon is not known to be json-file
+	assert.Equal(t, docker.LogConfig{}, config.Containers["default"].GetAPIHostConfig().LogConfig)
+	assert.Nil(t, config.Containers["default"].LogOpt)
+
+	assert.Equal(t, docker.LogConfig{
+		Type:   "json-file",
+		Config: map[string]string{"labels": "app", "max-size": "50m", "max-file": "3"},
+	}, config.Containers["json"].GetAPIHostConfig().LogConfig)
+
+	assert.Equal(t, docker.LogConfig{
+		Type:   "json-file",
+		Config: map[string]string{"max-size": "1g", "max-file": "3"},
+	}, config.Containers["override"].GetAPIHostConfig().LogConfig)
+
+	assert.Equal(t, StringMap{"max-size": "1g"}, config.Containers["opts_only"].LogOpt)
+
+	for _, name := range []string{"syslog", "syslog_child"} {
+		assert.Equal(t, docker.LogConfig{Type: "syslog"}, config.Containers[name].GetAPIHostConfig().LogConfig, name)
+	}
+}
+
+func TestConfigLogRotationNotConfigured(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: ubuntu:14.04
+    log_driver: json-file`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{}, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, config.LogRotation)
+	assert.Nil(t, config.Containers["main"].LogOpt)
+}
+
+func TestConfigLogRotationInvalid(t *testing.T) {
+	tests := map[string]string{
+		"log_rotation: {}":                              "log_rotation should specify max_size or max_file",
+		"log_rotation:\n  max_file: 0":                  "log_rotation max_file should be a positive number, got 0",
+		"log_rotation:\n  max_file: seven":              "log_rotation max_file should be a positive number, got seven",
+		"log_rotation:\n  max_size: 10m":                "",
+		"log_rotation:\n  max_size: 10m\n  max_file: 2": "",
+	}
+
+	for rotation, expected := range tests {
+		configStr := "namespace: test\n" + rotation + "\ncontainers:\n  main:\n    image: ubuntu:14.04"
+		_, err := ReadConfig("test", strings.NewReader(configStr), template.Vars{}, map[string]interface{}{}, false)
+		if expected == "" {
+			assert.NoError(t, err, rotation)
+		} else {
+			assert.EqualError(t, err, expected, rotation)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NamingStrategy formats names of the containers given to docker and parses them back, it is
+// selected by the "naming" property of the manifest. References in the manifest are always
+// written as "namespace.name" regardless of it, see ContainerName.String
+type NamingStrategy interface {
+	// Format returns the docker name of the container, e.g. "myapp.web"
+	Format(name ContainerName) string
+	// Parse returns the container name from the docker one, the leading slash is trimmed
+	Parse(name string) *ContainerName
+}
+
+// separatorNaming joins the namespace and the name with the separator
+type separatorNaming string
+
+// Built-in naming strategies
+const (
+	DotNaming        = separatorNaming(".") // myapp.web, the default one
+	UnderscoreNaming = separatorNaming("_") // myapp_web
+	DashNaming       = separatorNaming("-") // myapp-web
+)
+
+// NamingStrategies are the built-in naming strategies by their names
+var NamingStrategies = map[string]NamingStrategy{
+	"dot":        DotNaming,
+	"underscore": UnderscoreNaming,
+	"dash":       DashNaming,
+}
+
+// DefaultNaming is the name of the default naming strategy
+const DefaultNaming = "dot"
+
+// GetNamingStrategy returns one of the built-in naming strategies by its name,
+// the default one if the name is empty
+func GetNamingStrategy(name string) (NamingStrategy, error) {
+	if name == "" {
+		name = DefaultNaming
+	}
+	naming, ok := NamingStrategies[name]
+	if !ok {
+		names := []string{}
+		for name := range NamingStrategies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown naming strategy %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+	return naming, nil
+}
+
+// GetNaming returns the naming strategy selected by the "naming" property of the manifest,
+// it is validated when the manifest is read, so the default one is returned for unknown names
+func (config *Config) GetNaming() NamingStrategy {
+	naming, err := GetNamingStrategy(config.Naming)
+	if err != nil {
+		return DotNaming
+	}
+	return naming
+}
+
+// GetNaming returns the naming strategy of the manifest the spec was read from,
+// the default one if the spec is not read from a manifest
+func (config *Container) GetNaming() NamingStrategy {
+	if config.naming == nil {
+		return DotNaming
+	}
+	return config.naming
+}
+
+// Format returns the namespace and the name joined with the separator
+func (sep separatorNaming) Format(name ContainerName) string {
+	if name.Namespace == "" || name.IsGlobalNs() {
+		return name.Name
+	}
+	return name.Namespace + string(sep) + name.Name
+}
+
+// Parse splits the docker name by the separator, the dot one takes the last element
+// as the name, as the manifest references do, the others take the first as the namespace,
+// so that names may contain dashes or underscores
+func (sep separatorNaming) Parse(str string) *ContainerName {
+	str = strings.TrimPrefix(str, "/") // TODO: investigate why Docker adds prefix slash to container names
+	if sep == DotNaming {
+		return NewContainerNameFromString(str)
+	}
+	split := strings.SplitN(str, string(sep), 2)
+	if len(split) == 1 {
+		return &ContainerName{Name: str}
+	}
+	return &ContainerName{Namespace: split[0], Name: split[1]}
+}
+
+// validateNaming checks that the docker name of the container is parsed back to the same name
+func validateNaming(name ContainerName, naming NamingStrategy) error {
+	dockerName := naming.Format(name)
+	if parsed := naming.Parse(dockerName); parsed.Namespace != name.GetNamespace() || parsed.Name != name.Name {
+		return fmt.Errorf("docker name %s of the container is ambiguous with the naming strategy, it is read back as %s",
+			dockerName, parsed)
+	}
+	return nil
+}
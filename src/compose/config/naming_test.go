@@ -0,0 +1,130 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-yaml/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamingStrategies(t *testing.T) {
+	tests := []struct {
+		naming NamingStrategy
+		name   ContainerName
+		docker string
+	}{
+		{DotNaming, ContainerName{"myapp", "web"}, "myapp.web"},
+		{DotNaming, ContainerName{"", "web"}, "web"},
+		{UnderscoreNaming, ContainerName{"myapp", "web"}, "myapp_web"},
+		{UnderscoreNaming, ContainerName{"myapp", "web_api"}, "myapp_web_api"},
+		{UnderscoreNaming, ContainerName{"", "web"}, "web"},
+		{DashNaming, ContainerName{"myapp", "web"}, "myapp-web"},
+		{DashNaming, ContainerName{"myapp", "web-api"}, "myapp-web-api"},
+		{DashNaming, ContainerName{"", "web"}, "web"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.docker, test.naming.Format(test.name), "%s", test.name)
+		assert.Equal(t, &test.name, test.naming.Parse(test.docker), "%s", test.docker)
+		assert.Equal(t, &test.name, test.naming.Parse("/"+test.docker), "docker reports names with a leading slash")
+	}
+
+	// global namespace is not prefixed
+	assert.Equal(t, "web", DashNaming.Format(ContainerName{".", "web"}))
+}
+
+func TestGetNamingStrategy(t *testing.T) {
+	naming, err := GetNamingStrategy("underscore")
+	assert.NoError(t, err)
+	assert.Equal(t, UnderscoreNaming, naming)
+
+	naming, err = GetNamingStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, DotNaming, naming)
+
+	_, err = GetNamingStrategy("hash")
+	assert.EqualError(t, err, `Unknown naming strategy "hash", expected one of: dash, dot, underscore`)
+}
+
+func TestNamingDockerConfig(t *testing.T) {
+	configStr := `namespace: myapp
+naming: dash
+containers:
+  db:
+    image: postgres:9.4
+  web-api:
+    image: app:1.0
+    links: db
+    volumes_from: monitoring.sensu
+    net: container:db`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := config.Containers["web-api"]
+	assert.Equal(t, DashNaming, config.GetNaming())
+	assert.Equal(t, DashNaming, container.GetNaming())
+
+	// docker is given the names of the strategy
+	hostConfig := container.GetAPIHostConfig()
+	assert.Equal(t, []string{"myapp-db:db"}, hostConfig.Links)
+	assert.Equal(t, []string{"monitoring-sensu"}, hostConfig.VolumesFrom)
+	assert.Equal(t, "container:myapp-db", hostConfig.NetworkMode)
+
+	// the label keeps the manifest references
+	yamlData, err := yaml.Marshal(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(yamlData), "myapp.db:db")
+	assert.Contains(t, string(yamlData), "monitoring.sensu")
+	assert.Contains(t, string(yamlData), "container:myapp.db")
+
+	restored := &Container{}
+	if err := yaml.Unmarshal(yamlData, restored); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, container.IsEqualTo(restored), "failed on field: %s", container.LastCompareField())
+}
+
+func TestNamingValidation(t *testing.T) {
+	configStr := `namespace: my_app
+naming: %s
+containers:
+  web:
+    image: app:1.0`
+
+	_, err := ReadConfig("test", strings.NewReader(fmt.Sprintf(configStr, "underscore")), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, "Container web: docker name my_app_web of the container is ambiguous with the naming strategy, it is read back as my.app_web")
+
+	_, err = ReadConfig("test", strings.NewReader(fmt.Sprintf(configStr, "dash")), configTestVars, map[string]interface{}{}, false)
+	assert.NoError(t, err)
+
+	_, err = ReadConfig("test", strings.NewReader(fmt.Sprintf(configStr, "hash")), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, `Unknown naming strategy "hash", expected one of: dash, dot, underscore`)
+}
+
+func TestNamingDefault(t *testing.T) {
+	assert.Equal(t, DotNaming, (&Container{}).GetNaming(), "specs built in code use the default naming")
+	assert.Equal(t, DotNaming, (&Config{}).GetNaming())
+	assert.Equal(t, "myapp.web", ContainerName{"myapp", "web"}.String(), "the manifest name is not affected by the naming")
+}
@@ -17,7 +17,9 @@
 package config
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"unicode"
 )
@@ -27,9 +29,35 @@ var compareSkipFields = []string{
 	"Image",
 	"Extends",
 	"KillTimeout",
+	"StopPriority",
 	"NetworkDisabled",
 	"State",
+	"DesiredState",
 	"KeepVolumes",
+	"PullSecret",
+	"RecreateStrategy",
+	"PullPolicy",
+	"PullTimeout",
+	"Group",
+	"RequiredEnv",
+	"SecretEnv",
+	"EnvFromExec",
+	"Readiness",
+	"PreStop",
+	"Quiesce",
+	"Unquiesce",
+	"StartupDelay",
+	"WaitForExternal",
+	"UlimitProfile",
+	"Platform",
+	"RestartBackoff",
+	"When",
+	"CmdTemplate",
+
+	// not supported by the docker client yet, so never differ from the containers
+	"ShmSize",
+	"KernelMemory",
+	"MemReservation",
 
 	// aliases
 	"Command",
@@ -41,6 +69,12 @@ var compareSkipFields = []string{
 	"Environment",
 }
 
+// compareNilFields defines which fields differ when nil on one side and empty on the other,
+// e.g. an empty entrypoint resets the one of the image while nil keeps it
+var compareNilFields = []string{
+	"Entrypoint",
+}
+
 // getContainerFields returns the list of fields of the container spec struct
 func getContainerFields() []string {
 	fields := []string{}
@@ -79,6 +113,30 @@ func getComparableFields() []string {
 	return fields
 }
 
+// RecreateOnProperties returns the names of the properties which changes can recreate
+// the container: the compared ones and "image", which is checked by the image version and id
+func RecreateOnProperties() []string {
+	properties := []string{"image"}
+	for _, fieldName := range getComparableFields() {
+		properties = append(properties, getYamlFieldName(fieldName))
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+// ValidateRecreateOn checks that the properties the recreation is limited to are known,
+// see RecreateOnProperties
+func ValidateRecreateOn(properties []string) error {
+	known := RecreateOnProperties()
+	for _, property := range properties {
+		if !stringsContain(known, property) {
+			return fmt.Errorf("Unknown property %q to recreate containers on, known ones are: %s",
+				property, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
 // getYamlFields returns the list of yaml field names of the container spec
 func getYamlFields() []string {
 	fields := []string{}
@@ -100,3 +158,13 @@ func getYamlFieldName(fieldName string) string {
 	split := strings.SplitN(yamlTag, ",", 2)
 	return split[0]
 }
+
+// stringsContain returns true if the list contains the given string
+func stringsContain(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Cpus is the number of CPUs the container can use, e.g. 1.5, which is used by
+// "cpus" property of the container spec. It is converted to CPU quota of 100ms period.
+type Cpus float64
+
+// CPUPeriod is the CFS period in microseconds which is used for "cpus" property
+const CPUPeriod = 100000
+
+// Memory and Cpus can also be given as a percentage of the host resources, e.g. "25%".
+// Such properties are kept apart from the concrete values in hostPercents of the container
+// until they are resolved against the docker host by Config.ResolveHostPercents.
+
+// Float64 returns the number of CPUs, or zero if it is not set
+func (c *Cpus) Float64() float64 {
+	if c == nil {
+		return 0
+	}
+	return float64(*c)
+}
+
+// CPUQuota returns the CFS quota in microseconds per CPUPeriod
+func (c *Cpus) CPUQuota() int64 {
+	return int64(round(c.Float64() * CPUPeriod))
+}
+
+// round rounds the value to the nearest integer, halves away from zero are rounded up
+func round(value float64) float64 {
+	return math.Floor(value + 0.5)
+}
+
+// parsePercent parses "25%" string, ok is false if the string is not a percentage
+func parsePercent(str string) (percent float64, ok bool, err error) {
+	str = strings.TrimSpace(str)
+	if !strings.HasSuffix(str, "%") {
+		return 0, false, nil
+	}
+	percent, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(str, "%")), 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("Invalid percentage %q", str)
+	}
+	if percent <= 0 || percent > 100 {
+		return 0, true, fmt.Errorf("Invalid percentage %q, should be greater than 0%% and not greater than 100%%", str)
+	}
+	return percent, true, nil
+}
+
+// namedMemory is the memory property of the container along with its name in the spec,
+// unsupported properties cannot be passed to docker through go-dockerclient yet
+type namedMemory struct {
+	name        string
+	field       **Memory
+	unsupported bool
+}
+
+// memoryFields returns all memory properties of the container, they share the parsing,
+// inheritance and resolving of percentages
+func (container *Container) memoryFields() []namedMemory {
+	return []namedMemory{
+		{"memory", &container.Memory, false},
+		{"memory_swap", &container.MemorySwap, false},
+		{"shm_size", &container.ShmSize, true},
+		{"kernel_memory", &container.KernelMemory, true},
+		{"mem_reservation", &container.MemReservation, true},
+	}
+}
+
+// hasResource returns true if the memory or cpus property has a concrete value,
+// the second result is false if there is no such property
+func (container *Container) hasResource(name string) (set bool, ok bool) {
+	if name == "cpus" {
+		return container.Cpus != nil, true
+	}
+	for _, memory := range container.memoryFields() {
+		if memory.name == name {
+			return *memory.field != nil, true
+		}
+	}
+	return false, false
+}
+
+// setHostPercent makes the memory or cpus property a percentage of the host resources,
+// the concrete value is dropped, it is resolved by Config.ResolveHostPercents
+func (container *Container) setHostPercent(name string, percent float64) {
+	if container.hostPercents == nil {
+		container.hostPercents = map[string]float64{}
+	}
+	container.hostPercents[name] = percent
+	if name == "cpus" {
+		container.Cpus = nil
+	}
+	for _, memory := range container.memoryFields() {
+		if memory.name == name {
+			*memory.field = nil
+		}
+	}
+}
+
+// readHostPercents picks the memory and cpus properties given as percentages from
+// the raw YAML of the container, UnmarshalYAML has validated them already
+func (container *Container) readHostPercents(raw map[string]interface{}) {
+	for key, val := range raw {
+		str, isString := val.(string)
+		if _, ok := container.hasResource(key); !ok || !isString {
+			continue
+		}
+		if percent, isPercent, err := parsePercent(str); err == nil && isPercent {
+			container.setHostPercent(key, percent)
+		}
+	}
+}
+
+// extendHostPercents inherits percentages of the host resources from the parent,
+// the property given by the container wins either it is a percentage or a concrete value
+func (container *Container) extendHostPercents(parent *Container) {
+	for name, percent := range parent.hostPercents {
+		_, given := container.hostPercents[name]
+		if set, _ := container.hasResource(name); !given && !set {
+			container.setHostPercent(name, percent)
+		}
+	}
+}
+
+// HasHostPercents returns true if any container has memory or cpus given
+// as a percentage of the host resources
+func (config *Config) HasHostPercents() bool {
+	for _, container := range config.Containers {
+		if len(container.hostPercents) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveHostPercents converts memory and cpus given as percentages to concrete values
+// using the total memory in bytes and the number of CPUs of the docker host
+func (config *Config) ResolveHostPercents(memTotal int64, ncpu int) error {
+	for name, container := range config.Containers {
+		for _, memory := range container.memoryFields() {
+			if percent, ok := container.hostPercents[memory.name]; ok {
+				if memTotal <= 0 {
+					return fmt.Errorf("Container %s: cannot resolve %s %g%%, the host memory is unknown", name, memory.name, percent)
+				}
+				value := Memory(float64(memTotal) * percent / 100)
+				*memory.field = &value
+			}
+		}
+		if percent, ok := container.hostPercents["cpus"]; ok {
+			if ncpu <= 0 {
+				return fmt.Errorf("Container %s: cannot resolve cpus %g%%, the number of host CPUs is unknown", name, percent)
+			}
+			// round to the precision of the CPU quota
+			cpus := Cpus(round(float64(ncpu)*percent/100*CPUPeriod) / CPUPeriod)
+			container.Cpus = &cpus
+		}
+		container.hostPercents = nil
+	}
+	return nil
+}
+
+// validateMemory checks the memory properties once the container is extended,
+// only memory_swap can be -1 which means unlimited swap
+func (container *Container) validateMemory() error {
+	for _, memory := range container.memoryFields() {
+		if memory.name != "memory_swap" && (*memory.field).Int64() < 0 {
+			return fmt.Errorf("%s should not be negative", memory.name)
+		}
+	}
+	if reservation, limit := container.MemReservation.Int64(), container.Memory.Int64(); reservation > 0 && limit > 0 && reservation > limit {
+		return fmt.Errorf("mem_reservation %d should not be greater than memory %d", reservation, limit)
+	}
+	return nil
+}
+
+// validateCPU checks the CFS quota and period, zero means the daemon default. It is done
+// once the container is extended because "cpus" is converted to the same host config fields.
+func (container *Container) validateCPU() error {
+	quota, period := int64(0), int64(0)
+	if container.CPUQuota != nil {
+		quota = *container.CPUQuota
+	}
+	if container.CPUPeriod != nil {
+		period = *container.CPUPeriod
+	}
+	_, cpusPercent := container.hostPercents["cpus"]
+	if (container.Cpus != nil || cpusPercent) && (quota != 0 || period != 0) {
+		return fmt.Errorf("cpus cannot be used together with cpu_quota or cpu_period")
+	}
+	if quota != 0 && quota != -1 && quota < 1000 {
+		return fmt.Errorf("cpu_quota %d should be at least 1000 microseconds, or -1 for no limit", *container.CPUQuota)
+	}
+	if period != 0 && (period < 1000 || period > 1000000) {
+		return fmt.Errorf("cpu_period %d should be between 1000 and 1000000 microseconds", *container.CPUPeriod)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-yaml/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigResolveHostPercents(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    memory: 25%
+  main:
+    extends: _base
+    memory_swap: 50%
+    cpus: 50%
+  worker:
+    image: app:1.0
+    memory: 512m
+    memory_swap: -1
+    cpus: 1.5`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := config.Containers["main"]
+	assert.Equal(t, map[string]float64{"memory": 25, "memory_swap": 50, "cpus": 50}, main.hostPercents)
+	assert.Nil(t, main.Memory, "unresolved memory should not have a concrete value")
+	assert.True(t, config.HasHostPercents())
+
+	// 8g of memory and 4 CPUs
+	if err := config.ResolveHostPercents(8*1024*1024*1024, 4); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, config.HasHostPercents())
+
+	assert.EqualValues(t, 2*1024*1024*1024, main.Memory.Int64())
+	assert.EqualValues(t, 4*1024*1024*1024, main.MemorySwap.Int64())
+	assert.Equal(t, 2.0, main.Cpus.Float64())
+
+	hostConfig := main.GetAPIHostConfig()
+	assert.EqualValues(t, 2*1024*1024*1024, hostConfig.Memory)
+	assert.EqualValues(t, 200000, hostConfig.CPUQuota)
+	assert.EqualValues(t, 100000, hostConfig.CPUPeriod)
+
+	// the concrete value is stored in the label
+	data, err := yaml.Marshal(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(data), "memory: 2147483648\n")
+	assert.Contains(t, string(data), "cpus: 2\n")
+
+	worker := config.Containers["worker"]
+	assert.EqualValues(t, 512*1024*1024, worker.Memory.Int64())
+	assert.EqualValues(t, -1, worker.MemorySwap.Int64())
+	assert.Equal(t, 1.5, worker.Cpus.Float64())
+}
+
+func TestConfigResolveHostPercentsUnknownHost(t *testing.T) {
+	config := &Config{Containers: map[string]*Container{
+		"main": &Container{hostPercents: map[string]float64{"memory": 10}},
+	}}
+	assert.EqualError(t, config.ResolveHostPercents(0, 4), "Container main: cannot resolve memory 10%, the host memory is unknown")
+}
+
+func TestConfigExtendHostPercents(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    memory: 1g
+    cpus: 50%
+  main:
+    extends: _base
+    memory: 12.5%
+  worker:
+    extends: _base
+    cpus: 2`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := config.Containers["main"]
+	assert.Equal(t, map[string]float64{"memory": 12.5, "cpus": 50}, main.hostPercents)
+	assert.Nil(t, main.Memory)
+
+	worker := config.Containers["worker"]
+	assert.Empty(t, worker.hostPercents)
+	assert.EqualValues(t, 1024*1024*1024, worker.Memory.Int64())
+	assert.Equal(t, 2.0, worker.Cpus.Float64())
+}
+
+func TestYamlHostPercents(t *testing.T) {
+	test := &yamlTestCases{
+		map[string]string{
+			"cpus: 0.5": "cpus: 0.5",
+		},
+	}
+	if err := test.run(t); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, invalid := range []string{"memory: 0%", "memory: 150%", "memory: abc%", "cpus: 101%", "cpus: -1", "cpus: two"} {
+		container := &Container{}
+		assert.Error(t, yaml.Unmarshal([]byte(invalid), container), invalid)
+	}
+}
+
+func TestConfigMemoryFields(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    memory: 1G
+    shm_size: 64mb
+  main:
+    extends: _base
+    memory_swap: 2g
+    kernel_memory: 128m
+    mem_reservation: 512 MB`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := config.Containers["main"]
+	assert.EqualValues(t, 1024*1024*1024, main.Memory.Int64())
+	assert.EqualValues(t, 2*1024*1024*1024, main.MemorySwap.Int64())
+	assert.EqualValues(t, 64*1024*1024, main.ShmSize.Int64(), "shm_size should be inherited")
+	assert.EqualValues(t, 128*1024*1024, main.KernelMemory.Int64())
+	assert.EqualValues(t, 512*1024*1024, main.MemReservation.Int64())
+
+	assert.Equal(t, []Warning{
+		{"main", "shm_size is not supported by the docker client yet and is ignored"},
+		{"main", "kernel_memory is not supported by the docker client yet and is ignored"},
+		{"main", "mem_reservation is not supported by the docker client yet and is ignored"},
+	}, config.Warnings)
+
+	// the ignored fields are never set on the containers, so they do not cause recreation
+	changed := *main
+	shmSize, kernelMemory, memReservation := Memory(1024), Memory(1024), Memory(1024)
+	changed.ShmSize, changed.KernelMemory, changed.MemReservation = &shmSize, &kernelMemory, &memReservation
+	assert.True(t, main.IsEqualTo(&changed))
+	assert.NotContains(t, RecreateOnProperties(), "shm_size")
+}
+
+func TestConfigMemoryFieldsInvalid(t *testing.T) {
+	for _, field := range []string{"memory", "memory_swap", "shm_size", "kernel_memory", "mem_reservation"} {
+		for _, value := range []string{"10x", "1.2.3m", "-5", "150%", "lots"} {
+			configStr := fmt.Sprintf("containers:\n  main:\n    image: app:1.0\n    %s: %s", field, value)
+			_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+			if assert.Error(t, err, "%s: %s", field, value) {
+				assert.Contains(t, err.Error(), fmt.Sprintf("Failed to parse memory %q, expected bytes with optional unit b, k, m, g or t", value))
+			}
+		}
+	}
+
+	tests := map[string]string{
+		"shm_size: -1":                          "Container main: shm_size should not be negative",
+		"memory: 256m\n    mem_reservation: 1g": "Container main: mem_reservation 1073741824 should not be greater than memory 268435456",
+	}
+	for spec, expected := range tests {
+		configStr := "containers:\n  main:\n    image: app:1.0\n    " + spec
+		_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		assert.EqualError(t, err, expected, spec)
+	}
+}
+
+func TestConfigCPUQuotaInvalid(t *testing.T) {
+	tests := map[string]string{
+		"cpus: 1.5\n    cpu_quota: 50000":  "Container main: cpus cannot be used together with cpu_quota or cpu_period",
+		"cpus: 1.5\n    cpu_period: 50000": "Container main: cpus cannot be used together with cpu_quota or cpu_period",
+		"cpu_quota: 500":                   "Container main: cpu_quota 500 should be at least 1000 microseconds, or -1 for no limit",
+		"cpu_period: 2000000":              "Container main: cpu_period 2000000 should be between 1000 and 1000000 microseconds",
+	}
+	for spec, expected := range tests {
+		configStr := "containers:\n  main:\n    image: app:1.0\n    " + spec
+		_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		assert.EqualError(t, err, expected, spec)
+	}
+
+	configStr := "containers:\n  main:\n    image: app:1.0\n    cpu_quota: -1\n    cpu_period: 50000\n    cpu_shares: 512"
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.NoError(t, err, "cpu_quota and cpu_period should be independent of cpu_shares")
+}
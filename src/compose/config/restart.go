@@ -0,0 +1,48 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseRestartPolicy parses the restart policy: no | always | on-failure,N the same way
+// as "restart" property, but unlike the yaml parser it does not accept unknown policies
+func ParseRestartPolicy(value string) (*RestartPolicy, error) {
+	policy := &RestartPolicy{}
+	if err := policy.parse(value); err != nil {
+		return nil, fmt.Errorf("Bad restart policy %q, %s", value, err)
+	}
+	if value == "" || policy.Name == "" {
+		return nil, fmt.Errorf("Bad restart policy %q, expected one of: no, always, on-failure[,N]", value)
+	}
+	return policy, nil
+}
+
+// OverrideRestart replaces the restart policy of every container of the manifest,
+// e.g. to keep docker from restarting the containers during an incident. The containers
+// whose policy changes are recreated, and again once the override is removed.
+func (config *Config) OverrideRestart(policy *RestartPolicy) {
+	for name, container := range config.Containers {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		restart := *policy
+		container.Restart = &restart
+	}
+}
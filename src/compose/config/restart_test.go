@@ -0,0 +1,81 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	for value, expected := range map[string]*RestartPolicy{
+		"no":           {"no", 0},
+		"always":       {"always", 0},
+		"on-failure":   {"on-failure", 0},
+		"on-failure,5": {"on-failure", 5},
+	} {
+		policy, err := ParseRestartPolicy(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, policy, "bad policy parsed from %s", value)
+	}
+
+	for _, value := range []string{"", "never", "on-failure,x", "on-failure,-1"} {
+		_, err := ParseRestartPolicy(value)
+		assert.Error(t, err, "%s should not be parsed", value)
+	}
+}
+
+func TestConfigOverrideRestart(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  _base:
+    image: app:1.0
+    restart: on-failure,3
+  main:
+    extends: _base
+  worker:
+    image: app:1.0
+    restart: always
+  default:
+    image: app:1.0`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.OverrideRestart(&RestartPolicy{"no", 0})
+	for _, name := range []string{"main", "worker", "default"} {
+		container := config.Containers[name]
+		assert.Equal(t, &RestartPolicy{"no", 0}, container.Restart, "override should win for %s", name)
+		assert.Equal(t, docker.RestartPolicy{Name: "no"}, container.GetAPIHostConfig().RestartPolicy)
+	}
+	assert.Equal(t, &RestartPolicy{"on-failure", 3}, config.Containers["_base"].Restart, "templates should be left as is")
+
+	// the container running with the policy of the manifest is recreated
+	assert.False(t, config.Containers["worker"].IsEqualTo(original.Containers["worker"]), "restart override should be compared")
+	assert.Equal(t, &RestartPolicy{"always", 0}, original.Containers["worker"].Restart)
+}
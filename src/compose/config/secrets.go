@@ -0,0 +1,230 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// DefaultSecretEnv are the patterns of env keys which values are always redacted
+// in the output, additional patterns are given in "secret_env" property
+var DefaultSecretEnv = []string{"*_PASSWORD", "*_TOKEN", "*_SECRET"}
+
+// RedactedValue replaces the values of secret env variables in the output
+const RedactedValue = "<redacted>"
+
+// IsSecretEnv returns true if the value of the env variable should not be printed.
+// The key is matched case-insensitively against DefaultSecretEnv and "secret_env" patterns.
+func (container *Container) IsSecretEnv(key string) bool {
+	key = strings.ToUpper(key)
+	for _, patterns := range [][]string{DefaultSecretEnv, container.SecretEnv} {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToUpper(pattern), key); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RedactedEnv returns a copy of the "env" property with the values of secret variables replaced
+func (container *Container) RedactedEnv() StringMap {
+	return container.redactMap(container.Env)
+}
+
+// Redacted returns a copy of the container that is safe to print, the values of env variables,
+// labels, log options and extra properties which keys match the secret patterns are replaced
+func (container *Container) Redacted() *Container {
+	redacted := *container
+	redacted.Env = container.redactMap(container.Env)
+	redacted.Environment = container.redactMap(container.Environment)
+	redacted.Labels = container.redactMap(container.Labels)
+	redacted.Label = container.redactMap(container.Label)
+	redacted.LogOpt = container.redactMap(container.LogOpt)
+
+	if container.Extra != nil {
+		redacted.Extra = map[string]interface{}{}
+		for key, value := range container.Extra {
+			if container.IsSecretEnv(key) {
+				value = RedactedValue
+			}
+			redacted.Extra[key] = value
+		}
+	}
+
+	return &redacted
+}
+
+// redactMap returns a copy of the map with the values of secret keys replaced
+func (container *Container) redactMap(values StringMap) StringMap {
+	if values == nil {
+		return nil
+	}
+	redacted := StringMap{}
+	for key, value := range values {
+		if container.IsSecretEnv(key) {
+			value = RedactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// RedactEnv returns a copy of the list of "KEY=VALUE" pairs, as given in the docker api config,
+// with the values of secret variables replaced
+func (container *Container) RedactEnv(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	redacted := make([]string, len(env))
+	for i, pair := range env {
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) > 1 && container.IsSecretEnv(split[0]) {
+			pair = split[0] + "=" + RedactedValue
+		}
+		redacted[i] = pair
+	}
+	return redacted
+}
+
+// RedactedYAML returns the resolved manifest, e.g. to share it for debugging, with the secret
+// values, see Container.Redacted, and the passwords of the credentials replaced by RedactedValue. Containers
+// are given as they are after extends, so the templates prefixed with "_" are left out.
+// The output is a valid manifest itself.
+func (config *Config) RedactedYAML() ([]byte, error) {
+	manifest := struct {
+		Namespace      string                 `yaml:"namespace"`
+		Containers     map[string]*Container  `yaml:"containers"`
+		Credentials    map[string]*Credential `yaml:"credentials,omitempty"`
+		UlimitProfiles map[string][]Ulimit    `yaml:"ulimit_profiles,omitempty"`
+		LogRotation    *LogRotation           `yaml:"log_rotation,omitempty"`
+		Naming         string                 `yaml:"naming,omitempty"`
+	}{
+		Namespace:      config.Namespace,
+		Containers:     map[string]*Container{},
+		UlimitProfiles: config.UlimitProfiles,
+		LogRotation:    config.LogRotation,
+		Naming:         config.Naming,
+	}
+
+	for name, container := range config.Containers {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		redacted := container.Redacted()
+		redacted.Extends = nil
+		manifest.Containers[name] = redacted
+	}
+
+	for name, credential := range config.Credentials {
+		if manifest.Credentials == nil {
+			manifest.Credentials = map[string]*Credential{}
+		}
+		redacted := *credential
+		if redacted.Password != "" {
+			redacted.Password = RedactedValue
+		}
+		manifest.Credentials[name] = &redacted
+	}
+
+	return yaml.Marshal(manifest)
+}
+
+// redactedProperties are the container properties which values are redacted by RedactManifest
+var redactedProperties = []string{"env", "environment", "labels", "label", "log_opt"}
+
+// RedactManifest returns the rendered manifest, as printed by the --print flag, with the secret
+// values of the containers and the passwords of the credentials replaced by RedactedValue.
+// The secret patterns of a container include the ones of the containers it extends in the same file.
+func RedactManifest(data []byte) ([]byte, error) {
+	manifest := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	containers, _ := manifest["containers"].(map[interface{}]interface{})
+	for _, spec := range containers {
+		spec, ok := spec.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		container := &Container{}
+		if err := readSecretEnv(containers, spec, container, len(containers)); err != nil {
+			return nil, err
+		}
+
+		for _, key := range redactedProperties {
+			value, ok := spec[key]
+			if !ok {
+				continue
+			}
+			values := StringMap{}
+			if err := remarshal(value, &values); err != nil {
+				return nil, err
+			}
+			spec[key] = container.redactMap(values)
+		}
+	}
+
+	credentials, _ := manifest["credentials"].(map[interface{}]interface{})
+	for _, credential := range credentials {
+		if credential, ok := credential.(map[interface{}]interface{}); ok && credential["password"] != nil {
+			credential["password"] = RedactedValue
+		}
+	}
+
+	return yaml.Marshal(manifest)
+}
+
+// readSecretEnv appends the "secret_env" patterns of the raw container spec and of the ones
+// it extends to the container, depth guards against extends loops
+func readSecretEnv(containers map[interface{}]interface{}, spec map[interface{}]interface{}, container *Container, depth int) error {
+	if patterns, ok := spec["secret_env"]; ok {
+		secretEnv := Strings{}
+		if err := remarshal(patterns, &secretEnv); err != nil {
+			return err
+		}
+		container.SecretEnv = append(container.SecretEnv, secretEnv...)
+	}
+
+	value, ok := spec["extends"]
+	if !ok || depth == 0 {
+		return nil
+	}
+	extends := Extends{}
+	if err := remarshal(value, &extends); err != nil {
+		return err
+	}
+	// parents from other files are not available here, only the default patterns apply to them
+	if parent, ok := containers[extends.Service].(map[interface{}]interface{}); ok && extends.File == "" {
+		return readSecretEnv(containers, parent, container, depth-1)
+	}
+	return nil
+}
+
+// remarshal converts the raw YAML value to the given type by its UnmarshalYAML
+func remarshal(value interface{}, out interface{}) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
@@ -0,0 +1,197 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerIsSecretEnv(t *testing.T) {
+	container := &Container{SecretEnv: Strings{"*_KEY", "API_*"}}
+
+	assert.True(t, container.IsSecretEnv("DB_PASSWORD"))
+	assert.True(t, container.IsSecretEnv("github_token"))
+	assert.True(t, container.IsSecretEnv("AWS_KEY"))
+	assert.True(t, container.IsSecretEnv("API_URL"))
+	assert.False(t, container.IsSecretEnv("PORT"))
+	assert.False(t, (&Container{}).IsSecretEnv("AWS_KEY"))
+}
+
+func TestContainerRedactEnv(t *testing.T) {
+	container := &Container{
+		Env: StringMap{"PORT": "80", "DB_PASSWORD": "qwerty"},
+	}
+
+	assert.Equal(t, StringMap{"PORT": "80", "DB_PASSWORD": RedactedValue}, container.RedactedEnv())
+	assert.Equal(t, "qwerty", container.Env["DB_PASSWORD"], "should not modify the actual env")
+	assert.Equal(t, []string{"PORT=80", "DB_PASSWORD=" + RedactedValue},
+		container.RedactEnv([]string{"PORT=80", "DB_PASSWORD=qwerty"}))
+}
+
+func TestDockerRunCommandRedacted(t *testing.T) {
+	container := &Container{
+		Env: StringMap{"DB_PASSWORD": "qwerty"},
+	}
+	apiConfig := container.GetAPIConfig()
+	apiConfig.Env = container.RedactEnv(apiConfig.Env)
+
+	cmd := DockerRunCommand("", apiConfig, container.GetAPIHostConfig(), DefaultLabelPrefix)
+	assert.Contains(t, cmd, "--env 'DB_PASSWORD=<redacted>'")
+	assert.NotContains(t, cmd, "qwerty")
+}
+
+func TestConfigSecretEnvBadPattern(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: nginx:1.9
+    secret_env: ["[_KEY"]`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, `Container main: bad secret_env pattern "[_KEY"`)
+}
+
+func TestConfigRedactedYAML(t *testing.T) {
+	configStr := `namespace: test
+credentials:
+  registry:
+    username: deploy
+    password: hunter2
+containers:
+  _base:
+    image: app:1.0
+    env:
+      DB_PASSWORD: qwerty
+  main:
+    extends: _base
+    secret_env: ["*_KEY", "*-KEY"]
+    pull_secret: registry
+    env:
+      AWS_KEY: abc123
+      PORT: 8080
+    labels:
+      app.api_token: t0k3n
+    log_opt:
+      splunk-key: s3cr3t`
+
+	config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := config.RedactedYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "qwerty", "abc123", "t0k3n", "s3cr3t"} {
+		assert.NotContains(t, string(data), secret)
+	}
+
+	// the output parses as a manifest of the same structure
+	redacted, err := ReadConfig("test", strings.NewReader(string(data)), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatalf("Failed to read the redacted manifest, error: %s\n%s", err, data)
+	}
+	assert.Equal(t, "test", redacted.Namespace)
+	assert.Equal(t, []string{"main"}, func() (names []string) {
+		for name := range redacted.Containers {
+			names = append(names, name)
+		}
+		return
+	}())
+
+	main := redacted.Containers["main"]
+	assert.Equal(t, StringMap{"DB_PASSWORD": RedactedValue, "AWS_KEY": RedactedValue, "PORT": "8080"}, main.Env)
+	assert.Equal(t, "app:1.0", *main.Image)
+	assert.Equal(t, StringMap{"app.api_token": RedactedValue}, main.Labels)
+	assert.Equal(t, StringMap{"splunk-key": RedactedValue}, main.LogOpt)
+	assert.Equal(t, &Credential{Username: "deploy", Password: RedactedValue}, redacted.Credentials["registry"])
+
+	// the actual config is not modified
+	assert.Equal(t, "qwerty", config.Containers["main"].Env["DB_PASSWORD"])
+	assert.Equal(t, "hunter2", config.Credentials["registry"].Password)
+}
+
+func TestContainerRedacted(t *testing.T) {
+	container := &Container{
+		SecretEnv: Strings{"*-TOKEN"},
+		Env:       StringMap{"PORT": "80"},
+		Labels:    StringMap{"app.db_password": "qwerty", "app.version": "1.0"},
+		LogOpt:    StringMap{"splunk-token": "s3cr3t"},
+		Extra:     map[string]interface{}{"API_SECRET": "abc123", "owner": "infra"},
+	}
+
+	redacted := container.Redacted()
+	assert.Equal(t, StringMap{"PORT": "80"}, redacted.Env)
+	assert.Equal(t, StringMap{"app.db_password": RedactedValue, "app.version": "1.0"}, redacted.Labels)
+	assert.Equal(t, StringMap{"splunk-token": RedactedValue}, redacted.LogOpt)
+	assert.Equal(t, map[string]interface{}{"API_SECRET": RedactedValue, "owner": "infra"}, redacted.Extra)
+
+	// the actual container is not modified
+	assert.Equal(t, "qwerty", container.Labels["app.db_password"])
+	assert.Equal(t, "s3cr3t", container.LogOpt["splunk-token"])
+	assert.Equal(t, "abc123", container.Extra["API_SECRET"])
+}
+
+func TestRedactManifest(t *testing.T) {
+	manifest := `namespace: test
+credentials:
+  registry:
+    username: deploy
+    password: hunter2
+containers:
+  _base:
+    image: app:1.0
+    secret_env: "*_KEY"
+    env:
+      DB_PASSWORD: qwerty
+  main:
+    extends: _base
+    environment:
+      - AWS_KEY=abc123
+      - PORT=8080
+    labels: app.api_token=t0k3n
+    log_opt:
+      splunk-token: s3cr3t`
+
+	data, err := RedactManifest([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "qwerty", "abc123", "t0k3n"} {
+		assert.NotContains(t, string(data), secret)
+	}
+	// not a secret by the default patterns and not given in secret_env
+	assert.Contains(t, string(data), "s3cr3t")
+
+	// the output is still a manifest of the same structure
+	config, err := ReadConfig("test", strings.NewReader(string(data)), configTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatalf("Failed to read the redacted manifest, error: %s\n%s", err, data)
+	}
+	main := config.Containers["main"]
+	assert.Equal(t, StringMap{"DB_PASSWORD": RedactedValue, "AWS_KEY": RedactedValue, "PORT": "8080"}, main.Env)
+	assert.Equal(t, RedactedValue, main.Labels["app.api_token"])
+	assert.Equal(t, "app:1.0", *main.Image)
+	assert.Equal(t, &Credential{Username: "deploy", Password: RedactedValue}, config.Credentials["registry"])
+
+	_, err = RedactManifest([]byte("containers: ["))
+	assert.Error(t, err)
+}
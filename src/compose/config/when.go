@@ -0,0 +1,194 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+var conditionRe = regexp.MustCompile(`^\s*(!)?\s*([a-zA-Z0-9_.\-]+)\s*(?:(==|!=)\s*(.*?))?\s*$`)
+
+// Condition is a single check of a host fact used by "when" property of the container.
+// It is either a presence check "fact", an absence check "!fact" or an equality
+// check "fact == value" or "fact != value".
+type Condition struct {
+	Fact   string
+	Op     string // "", "!", "==" or "!="
+	Value  string
+	source string
+}
+
+// ParseCondition parses the condition expression of "when" property
+func ParseCondition(expr string) (*Condition, error) {
+	match := conditionRe.FindStringSubmatch(expr)
+	if match == nil || (match[1] != "" && match[3] != "") {
+		return nil, fmt.Errorf("Invalid when condition %q, expected \"fact\", \"!fact\", \"fact == value\" or \"fact != value\"", expr)
+	}
+	c := &Condition{
+		Fact:   match[2],
+		Op:     match[1] + match[3],
+		Value:  strings.Trim(match[4], `"'`),
+		source: strings.TrimSpace(expr),
+	}
+	return c, nil
+}
+
+// Eval returns true if the condition holds for the given host facts
+func (c *Condition) Eval(facts map[string]string) bool {
+	value, ok := facts[c.Fact]
+	switch c.Op {
+	case "!":
+		return !ok
+	case "==":
+		return ok && value == c.Value
+	case "!=":
+		return !ok || value != c.Value
+	}
+	return ok
+}
+
+// String returns the condition as it was written in the manifest
+func (c *Condition) String() string {
+	return c.source
+}
+
+// HostFacts collects facts about the docker host which "when" conditions are evaluated
+// against: "os", "arch", "kernel", "hostname" and "ncpu" from the daemon info,
+// "label.<name>" for every daemon label and "env.<NAME>" for every environment variable
+func HostFacts(info *docker.Env, environ []string) map[string]string {
+	facts := map[string]string{}
+
+	if info != nil {
+		for fact, key := range map[string]string{
+			"os":       "OSType",
+			"arch":     "Architecture",
+			"kernel":   "KernelVersion",
+			"hostname": "Name",
+			"ncpu":     "NCPU",
+		} {
+			if info.Exists(key) {
+				facts[fact] = info.Get(key)
+			}
+		}
+		for _, label := range info.GetList("Labels") {
+			parts := strings.SplitN(label, "=", 2)
+			if len(parts) == 1 {
+				parts = append(parts, "")
+			}
+			facts["label."+parts[0]] = parts[1]
+		}
+	}
+
+	for _, env := range environ {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) == 2 {
+			facts["env."+parts[0]] = parts[1]
+		}
+	}
+
+	return facts
+}
+
+// HasConditions returns true if any container of the manifest has "when" property
+func (config *Config) HasConditions() bool {
+	for _, container := range config.Containers {
+		if len(container.When) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterByFacts removes containers whose "when" conditions do not hold for the given
+// host facts and returns the sorted names of removed containers. It fails if any of
+// the remaining containers links to, takes volumes or env from, waits for or shares
+// the network of a removed one.
+func (config *Config) FilterByFacts(facts map[string]string) ([]string, error) {
+	skipped := []string{}
+
+	for name, container := range config.Containers {
+		for _, expr := range container.When {
+			cond, err := ParseCondition(expr)
+			if err != nil {
+				return nil, fmt.Errorf("Container %s: %s", name, err)
+			}
+			if !cond.Eval(facts) {
+				skipped = append(skipped, name)
+				break
+			}
+		}
+	}
+
+	sort.Strings(skipped)
+
+	isSkipped := func(ref ContainerName) bool {
+		if ref.Namespace != config.Namespace {
+			return false
+		}
+		for _, name := range skipped {
+			if ref.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for name, container := range config.Containers {
+		if strings.HasPrefix(name, "_") || isSkipped(ContainerName{config.Namespace, name}) {
+			continue
+		}
+		for _, link := range container.Links {
+			if isSkipped(link.ContainerName) {
+				return nil, fmt.Errorf("Container %s: links to container %s which is skipped by its when condition",
+					name, link.ContainerName.Name)
+			}
+		}
+		for _, volumesFrom := range container.VolumesFrom {
+			if isSkipped(volumesFrom) {
+				return nil, fmt.Errorf("Container %s: takes volumes from container %s which is skipped by its when condition",
+					name, volumesFrom.Name)
+			}
+		}
+		for _, waitFor := range container.WaitFor {
+			if isSkipped(waitFor) {
+				return nil, fmt.Errorf("Container %s: waits for container %s which is skipped by its when condition",
+					name, waitFor.Name)
+			}
+		}
+		if container.Net != nil && container.Net.Type == "container" && isSkipped(container.Net.Container) {
+			return nil, fmt.Errorf("Container %s: uses the network of container %s which is skipped by its when condition",
+				name, container.Net.Container.Name)
+		}
+		for _, envFrom := range container.EnvFromExec {
+			if isSkipped(envFrom.Container) {
+				return nil, fmt.Errorf("Container %s: takes env from container %s which is skipped by its when condition",
+					name, envFrom.Container.Name)
+			}
+		}
+	}
+
+	for _, name := range skipped {
+		delete(config.Containers, name)
+	}
+
+	return skipped, nil
+}
@@ -0,0 +1,161 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition(t *testing.T) {
+	facts := map[string]string{"label.gpu": "nvidia", "os": "linux"}
+
+	tests := map[string]bool{
+		"label.gpu":              true,
+		"label.ssd":              false,
+		"!label.ssd":             true,
+		"! label.gpu":            false,
+		"label.gpu == nvidia":    true,
+		"label.gpu == 'nvidia'":  true,
+		"label.gpu==amd":         false,
+		"label.gpu != amd":       true,
+		"label.ssd != true":      true,
+		"os == linux":            true,
+		"env.GPU_ENABLED == yes": false,
+	}
+
+	for expr, expected := range tests {
+		cond, err := ParseCondition(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, cond.Eval(facts), expr)
+	}
+
+	for _, expr := range []string{"", "a b", "!a == b", "a = b"} {
+		_, err := ParseCondition(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestHostFacts(t *testing.T) {
+	info := &docker.Env{}
+	info.Set("OSType", "linux")
+	info.Set("Architecture", "x86_64")
+	info.SetInt("NCPU", 4)
+	info.SetList("Labels", []string{"gpu=nvidia", "ssd"})
+
+	facts := HostFacts(info, []string{"DC=us-east-1", "EMPTY="})
+
+	assert.Equal(t, map[string]string{
+		"os":        "linux",
+		"arch":      "x86_64",
+		"ncpu":      "4",
+		"label.gpu": "nvidia",
+		"label.ssd": "",
+		"env.DC":    "us-east-1",
+		"env.EMPTY": "",
+	}, facts)
+}
+
+func TestConfigFilterByFacts(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+  trainer:
+    image: trainer:1.0
+    when:
+      - label.gpu
+      - os == linux
+  fallback:
+    image: trainer:1.0-cpu
+    when: "!label.gpu"`
+
+	read := func() *Config {
+		config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	config := read()
+	assert.True(t, config.HasConditions())
+
+	skipped, err := config.FilterByFacts(map[string]string{"label.gpu": "nvidia", "os": "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"fallback"}, skipped)
+	assert.Len(t, config.Containers, 2)
+	assert.NotNil(t, config.Containers["trainer"])
+
+	config = read()
+	skipped, err = config.FilterByFacts(map[string]string{"os": "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"trainer"}, skipped)
+	assert.NotNil(t, config.Containers["fallback"])
+}
+
+func TestConfigFilterByFactsSkippedReference(t *testing.T) {
+	for reference, expected := range map[string]string{
+		"links: trainer":          "Container main: links to container trainer which is skipped by its when condition",
+		"volumes_from: trainer":   "Container main: takes volumes from container trainer which is skipped by its when condition",
+		"wait_for: trainer":       "Container main: waits for container trainer which is skipped by its when condition",
+		"net: container:trainer":  "Container main: uses the network of container trainer which is skipped by its when condition",
+		"wait_for: test.trainer":  "Container main: waits for container trainer which is skipped by its when condition",
+		"wait_for: other.trainer": "",
+	} {
+		configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    ` + reference + `
+  trainer:
+    image: trainer:1.0
+    when: label.gpu`
+
+		config, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = config.FilterByFacts(map[string]string{})
+		if expected == "" {
+			assert.NoError(t, err, "%s should not refer to the skipped container", reference)
+			continue
+		}
+		assert.EqualError(t, err, expected, "bad error for %s", reference)
+	}
+}
+
+func TestConfigInvalidWhen(t *testing.T) {
+	configStr := `namespace: test
+containers:
+  main:
+    image: app:1.0
+    when: a = b`
+
+	_, err := ReadConfig("test", strings.NewReader(configStr), configTestVars, map[string]interface{}{}, false)
+	assert.EqualError(t, err, `Container main: Invalid when condition "a = b", expected "fact", "!fact", "fact == value" or "fact != value"`)
+}
@@ -20,28 +20,37 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // UnmarshalYAML unserialize Config object form YAML
 // It supports compatibility with docker-compose YAML spec where containers map is specified
 // on the first level. rocker-compose provides extra level for global properties such as 'namespace'
-// This function fallbacks to the docker-compose format if 'namespace' key was not found on the
-// first level.
+// This function fallbacks to the docker-compose format if none of 'namespace', 'containers',
+// 'credentials', 'ulimit_profiles', 'log_rotation' or 'naming' keys were found on the first level.
 func (config *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// compatibiliy with docker-compose format, if namespace is not specified,
 	// we think it is docker-compose format
 	c := &struct {
-		Namespace  *string
-		Containers *map[string]*Container
+		Namespace      *string
+		Containers     *map[string]*Container
+		Credentials    *map[string]*Credential
+		UlimitProfiles *map[string][]Ulimit `yaml:"ulimit_profiles"`
+		LogRotation    **LogRotation        `yaml:"log_rotation"`
+		Naming         *string
 	}{
 		&config.Namespace,
 		&config.Containers,
+		&config.Credentials,
+		&config.UlimitProfiles,
+		&config.LogRotation,
+		&config.Naming,
 	}
 	if err := unmarshal(c); err != nil {
 		return err
 	}
-	// parse containers only, if namespace is empty, we will deal with it later
-	if *c.Namespace == "" {
+	// parse containers only, if no rocker-compose keys are found, we will deal with it later
+	if *c.Namespace == "" && *c.Containers == nil && *c.Credentials == nil && *c.UlimitProfiles == nil && *c.LogRotation == nil && *c.Naming == "" {
 		if err := unmarshal(&c.Containers); err != nil {
 			return err
 		}
@@ -64,6 +73,33 @@ func (n ContainerName) MarshalYAML() (interface{}, error) {
 	return n.String(), nil
 }
 
+// UnmarshalYAML unserialize Extends object from YAML
+// Either the name of container or {file, service} hash can be given
+func (e *Extends) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*e = Extends{Service: name}
+		return nil
+	}
+	type extends Extends
+	if err := unmarshal((*extends)(e)); err != nil {
+		return err
+	}
+	if e.Service == "" {
+		return fmt.Errorf("Service should be specified to extend from file %s", e.File)
+	}
+	return nil
+}
+
+// MarshalYAML serialize Extends object to YAML
+func (e Extends) MarshalYAML() (interface{}, error) {
+	if e.File == "" {
+		return e.Service, nil
+	}
+	type extends Extends
+	return extends(e), nil
+}
+
 // UnmarshalYAML unserialize Link object from YAML
 func (link *Link) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var name string
@@ -85,6 +121,15 @@ func (m *Memory) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal(&str); err != nil {
 		return err
 	}
+	_, isPercent, err := parsePercent(str)
+	if err != nil {
+		return errMemoryFormat(str)
+	}
+	if isPercent {
+		// the percentage is kept by the container, see readHostPercents
+		*m = 0
+		return nil
+	}
 	value, err := NewConfigMemoryFromString(str)
 	if err != nil {
 		return err
@@ -94,12 +139,73 @@ func (m *Memory) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// MarshalYAML serialize Memory object to YAML
+func (m Memory) MarshalYAML() (interface{}, error) {
+	return int64(m), nil
+}
+
+// UnmarshalYAML unserialize Cpus object from YAML
+// Either the number of CPUs or the percentage of the host CPUs can be given
+func (c *Cpus) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	_, isPercent, err := parsePercent(str)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cpus %q, error: %s", str, err)
+	}
+	if isPercent {
+		// the percentage is kept by the container, see readHostPercents
+		*c = 0
+		return nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value <= 0 {
+		return fmt.Errorf("Failed to parse cpus %q, expected positive number or percentage", str)
+	}
+	*c = Cpus(value)
+
+	return nil
+}
+
+// MarshalYAML serialize Cpus object to YAML
+func (c Cpus) MarshalYAML() (interface{}, error) {
+	return float64(c), nil
+}
+
+// UnmarshalYAML unserialize Duration object from YAML
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("Failed to parse duration %q, error: %s", str, err)
+	}
+	*d = Duration(value)
+
+	return nil
+}
+
+// MarshalYAML serialize Duration object to YAML
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
 // UnmarshalYAML unserialize RestartPolicy object from YAML
 func (r *RestartPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var name string
 	if err := unmarshal(&name); err != nil {
 		return err
 	}
+	return r.parse(name)
+}
+
+// parse reads the restart policy: no | always | on-failure,N, the name is left empty
+// if the policy is unknown, see ParseRestartPolicy
+func (r *RestartPolicy) parse(name string) error {
 	if name == "" || name == "no" {
 		r.Name = "no"
 	} else if name == "always" {
@@ -109,8 +215,8 @@ func (r *RestartPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		parts := strings.SplitN(name, ",", 2)
 		if len(parts) == 2 {
 			n, err := strconv.ParseInt(parts[1], 10, 16)
-			if err != nil {
-				return err
+			if err != nil || n < 0 {
+				return fmt.Errorf("retry count should be a non-negative number")
 			}
 			r.MaximumRetryCount = (int)(n)
 		}
@@ -234,6 +234,7 @@ func TestYamlEntrypoint(t *testing.T) {
 	test := &yamlTestCases{
 		map[string]string{
 			"entrypoint:":                          "{}",
+			"entrypoint: []":                       "entrypoint: []",
 			"entrypoint:\n- 8.8.8.8":               "entrypoint:\n- 8.8.8.8",
 			"entrypoint: 192.168.1.1":              "entrypoint:\n- 192.168.1.1",
 			`entrypoint: ["8.8.8.8", "127.0.0.1"]`: "entrypoint:\n- 8.8.8.8\n- 127.0.0.1",
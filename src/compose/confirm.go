@@ -0,0 +1,133 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotConfirmed is returned when destructive actions of the plan were declined
+var ErrNotConfirmed = errors.New("Destructive actions were not confirmed, nothing is changed")
+
+// Removal describes a container which is going to be removed by the execution plan,
+// either because it is not in the manifest anymore or to be recreated if it is stateful
+type Removal struct {
+	Container *Container
+	Recreate  bool
+}
+
+// ConfirmFunc is called with the list of removals before the plan is executed,
+// the plan is executed only if it returns true
+type ConfirmFunc func(removals []Removal) (bool, error)
+
+// String returns the printable string representation of the removal
+func (r Removal) String() string {
+	if r.Recreate {
+		return fmt.Sprintf("%s (recreate)", r.Container.Name)
+	}
+	return fmt.Sprintf("%s (remove)", r.Container.Name)
+}
+
+// StatefulLabel marks the container as keeping the state, so its recreation is confirmed
+// even if it has no volumes, e.g. "stateful: true" for a cache warmed up in memory
+const StatefulLabel = "stateful"
+
+// isStateful returns true if the data of the container may be lost when it is recreated:
+// it has volumes, data or named volume mounts, volumes shared from other containers,
+// or it is labeled with StatefulLabel
+func isStateful(container *Container) bool {
+	if container.Config == nil {
+		return false
+	}
+	for _, mount := range container.Config.Mounts {
+		if mount.IsDataVolume() || mount.Volume != "" {
+			return true
+		}
+	}
+	return len(container.Config.Volumes) > 0 || len(container.Config.VolumesFrom) > 0 ||
+		container.Config.Labels[StatefulLabel] == "true"
+}
+
+// planRemovals returns containers removed by the execution plan, the stateless
+// containers that are recreated lose nothing, so they are left out
+func planRemovals(plan []Action) []Removal {
+	run := map[string]struct{}{}
+	WalkActions(plan, func(action Action) {
+		if a, ok := action.(*runContainer); ok {
+			run[a.container.Name.String()] = struct{}{}
+		}
+	})
+
+	removals := []Removal{}
+	WalkActions(plan, func(action Action) {
+		switch a := action.(type) {
+		case *removeContainer:
+			_, recreate := run[a.container.Name.String()]
+			if !recreate || isStateful(a.container) {
+				removals = append(removals, Removal{Container: a.container, Recreate: recreate})
+			}
+		case *replaceContainer:
+			if isStateful(a.existing) {
+				removals = append(removals, Removal{Container: a.existing, Recreate: true})
+			}
+		}
+	})
+	return removals
+}
+
+// confirmPlan asks the confirm function if the plan has destructive actions
+func confirmPlan(plan []Action, confirm ConfirmFunc) error {
+	if confirm == nil {
+		return nil
+	}
+	removals := planRemovals(plan)
+	if len(removals) == 0 {
+		return nil
+	}
+	ok, err := confirm(removals)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+// PromptConfirm makes ConfirmFunc that prints the list of removals to out
+// and reads the answer from in, anything but "y" or "yes" declines
+func PromptConfirm(in io.Reader, out io.Writer) ConfirmFunc {
+	return func(removals []Removal) (bool, error) {
+		fmt.Fprintln(out, "The following containers are going to be removed:")
+		for _, removal := range removals {
+			fmt.Fprintf(out, "  - %s\n", removal)
+		}
+		fmt.Fprint(out, "Continue? [y/N]: ")
+
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("Failed to read confirmation, error: %s", err)
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	}
+}
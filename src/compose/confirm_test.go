@@ -0,0 +1,203 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newConfirmTestManifest(t *testing.T) *config.Config {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestApplyConfirmDeclined(t *testing.T) {
+	manifest := newConfirmTestManifest(t)
+	orphan := newContainer("test", "orphan")
+
+	client := &clientMock{actual: []*Container{orphan}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+
+	var asked []Removal
+	confirm := func(removals []Removal) (bool, error) {
+		asked = removals
+		return false, nil
+	}
+
+	_, err := Apply(client, manifest, ApplyOptions{Confirm: confirm})
+	assert.Equal(t, ErrNotConfirmed, err)
+	assert.Equal(t, []Removal{{Container: orphan}}, asked)
+	client.AssertNotCalled(t, "RemoveContainer", mock.Anything)
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+}
+
+func TestApplyConfirmAccepted(t *testing.T) {
+	manifest := newConfirmTestManifest(t)
+	orphan := newContainer("test", "orphan")
+
+	client := &clientMock{actual: []*Container{orphan}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RemoveContainer", orphan).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	confirmed := false
+	confirm := func(removals []Removal) (bool, error) {
+		confirmed = true
+		return true, nil
+	}
+
+	if _, err := Apply(client, manifest, ApplyOptions{Confirm: confirm}); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, confirmed)
+	client.AssertExpectations(t)
+}
+
+func TestApplyConfirmNotAskedWithoutRemovals(t *testing.T) {
+	manifest := newConfirmTestManifest(t)
+
+	client := &clientMock{}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	confirm := func(removals []Removal) (bool, error) {
+		t.Fatalf("Confirmation should not be asked, removals: %v", removals)
+		return false, nil
+	}
+
+	if _, err := Apply(client, manifest, ApplyOptions{Confirm: confirm}); err != nil {
+		t.Fatal(err)
+	}
+	client.AssertExpectations(t)
+}
+
+func TestPlanRemovalsRecreate(t *testing.T) {
+	cpusetCpus1 := "0-2"
+	cpusetCpus2 := "0-4"
+	c1x := &Container{
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus1},
+	}
+	c1y := &Container{
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus2},
+	}
+	actions, err := NewDiff("test").Diff([]*Container{c1x}, []*Container{c1y})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, planRemovals(actions), "recreation of the stateless container loses nothing")
+
+	c1y.Config.Volumes = config.Strings{"/data"}
+	assert.Equal(t, []Removal{{Container: c1y, Recreate: true}}, planRemovals(actions))
+
+	c1y.Config.Volumes = nil
+	c1y.Config.Labels = config.StringMap{StatefulLabel: "true"}
+	assert.Equal(t, []Removal{{Container: c1y, Recreate: true}}, planRemovals(actions))
+}
+
+func TestIsStatefulMounts(t *testing.T) {
+	tests := []struct {
+		config   *config.Container
+		stateful bool
+		message  string
+	}{
+		{&config.Container{}, false, "no volumes"},
+		{&config.Container{Mounts: []config.Mount{{Source: "/etc/app", Target: "/etc/app"}}}, false, "host path mount"},
+		{&config.Container{Mounts: []config.Mount{{Target: "/data"}}}, true, "data volume mount"},
+		{&config.Container{Mounts: []config.Mount{{Volume: "data", Target: "/data"}}}, true, "named volume mount"},
+		{&config.Container{VolumesFrom: config.ContainerNames{{Namespace: "test", Name: "data"}}}, true, "volumes_from"},
+	}
+	for _, test := range tests {
+		container := &Container{Name: config.NewContainerName("test", "main"), Config: test.config}
+		assert.Equal(t, test.stateful, isStateful(container), test.message)
+	}
+}
+
+func TestApplyConfirmNotAskedForStatelessRecreate(t *testing.T) {
+	manifest := newConfirmTestManifest(t)
+
+	image := "ubuntu:12.04"
+	existing := NewContainerFromConfig(config.NewContainerName("test", "main"), &config.Container{Image: &image})
+	existing.State.Running = true
+
+	client := &clientMock{actual: []*Container{existing}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RemoveContainer", existing).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	confirm := func(removals []Removal) (bool, error) {
+		t.Fatalf("Confirmation should not be asked, removals: %v", removals)
+		return false, nil
+	}
+
+	if _, err := Apply(client, manifest, ApplyOptions{Confirm: confirm}); err != nil {
+		t.Fatal(err)
+	}
+	client.AssertExpectations(t)
+}
+
+func TestPromptConfirm(t *testing.T) {
+	removals := []Removal{
+		{Container: newContainer("test", "db"), Recreate: true},
+		{Container: newContainer("test", "orphan")},
+	}
+
+	var out bytes.Buffer
+	ok, err := PromptConfirm(strings.NewReader("yes\n"), &out)(removals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, ok)
+	assert.Equal(t, `The following containers are going to be removed:
+  - test.db (recreate)
+  - test.orphan (remove)
+Continue? [y/N]: `, out.String())
+
+	for _, answer := range []string{"n\n", "\n", ""} {
+		ok, err := PromptConfirm(strings.NewReader(answer), &out)(removals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, ok, answer)
+	}
+}
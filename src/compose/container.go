@@ -17,6 +17,7 @@
 package compose
 
 import (
+	"fmt"
 	"github.com/grammarly/rocker-compose/src/compose/config"
 	"github.com/grammarly/rocker-compose/src/util"
 	"strings"
@@ -40,21 +41,56 @@ type Container struct {
 	State         *ContainerState
 	Config        *config.Container
 	Io            *ContainerIo
+	ContentHash   string
+	PullAuth      *docker.AuthConfiguration // overrides the registry auth for pulling the image
+	Metadata      map[string]string         // extra labels that are not compared, e.g. git revision
+	Environment   string                    // environment the container is deployed to, see config.LabelEnvironment
+	FileHash      string                    // hash of the manifest of the last full run, see config.Config.FileHash
+	Adopted       bool                      // the container was not created by rocker-compose, its config is inferred
+	RecreateOn    []string                  // properties which changes recreate the container, all if empty, see config.ValidateRecreateOn
 
 	container *docker.Container
+	quiesced  bool                  // the quiesce hook succeeded and the container is not unquiesced yet
+	pinned    bool                  // created from ImageID instead of the tag, see createImage
+	naming    config.NamingStrategy // formats the docker name of the container, see DockerName
 }
 
 // ContainerState represents the state of a container.
 type ContainerState struct {
-	Running    bool
-	Paused     bool
-	Restarting bool
-	OOMKilled  bool
-	Pid        int
-	ExitCode   int
-	Error      string
-	StartedAt  time.Time
-	FinishedAt time.Time
+	Running      bool
+	Paused       bool
+	Restarting   bool
+	OOMKilled    bool
+	Pid          int
+	ExitCode     int
+	Error        string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	RestartCount int
+}
+
+// FailureReport describes why the container is not running: the exit code and
+// when it finished, the error given by docker and the restart count.
+// It returns an empty string for running containers.
+func (state *ContainerState) FailureReport() string {
+	if state == nil || state.Running {
+		return ""
+	}
+	exited := fmt.Sprintf("exited with code %d", state.ExitCode)
+	if !state.FinishedAt.IsZero() {
+		exited = fmt.Sprintf("%s at %s", exited, state.FinishedAt.Format(time.RFC3339))
+	}
+	report := []string{exited}
+	if state.OOMKilled {
+		report = append(report, "killed by OOM killer")
+	}
+	if state.Error != "" {
+		report = append(report, "error: "+state.Error)
+	}
+	if state.RestartCount > 0 {
+		report = append(report, fmt.Sprintf("restart count: %d", state.RestartCount))
+	}
+	return strings.Join(report, ", ")
 }
 
 // GetContainersFromConfig returns the list of Container objects from
@@ -66,7 +102,12 @@ func GetContainersFromConfig(cfg *config.Config) []*Container {
 			continue
 		}
 		containerName := config.NewContainerName(cfg.Namespace, name)
-		containers = append(containers, NewContainerFromConfig(containerName, containerConfig))
+		container := NewContainerFromConfig(containerName, containerConfig)
+		if credential, ok := cfg.Credentials[containerConfig.PullSecret]; ok {
+			auth := credential.AuthConfiguration()
+			container.PullAuth = &auth
+		}
+		containers = append(containers, container)
 	}
 	return containers
 }
@@ -76,9 +117,11 @@ func NewContainerFromConfig(name *config.ContainerName, containerConfig *config.
 	container := &Container{
 		Name: name,
 		State: &ContainerState{
-			Running: containerConfig.State.Bool(),
+			Running: containerConfig.State.Bool() && containerConfig.DesiredState != config.DesiredStateStopped,
 		},
-		Config: containerConfig,
+		Config:      containerConfig,
+		ContentHash: containerConfig.ContentHash(),
+		naming:      containerConfig.GetNaming(),
 	}
 	if containerConfig.Image != nil {
 		container.Image = imagename.NewFromString(*containerConfig.Image)
@@ -87,41 +130,79 @@ func NewContainerFromConfig(name *config.ContainerName, containerConfig *config.
 }
 
 // NewContainerFromDocker converts a container object given by
-// docker client to a local Container object
-func NewContainerFromDocker(dockerContainer *docker.Container) (*Container, error) {
-	cfg, err := config.NewFromDocker(dockerContainer)
+// docker client to a local Container object, its name is parsed with the naming strategy
+// and the managed labels are read with the given prefix
+func NewContainerFromDocker(dockerContainer *docker.Container, naming config.NamingStrategy, prefix config.LabelPrefix) (*Container, error) {
+	adopted := false
+	cfg, err := config.NewFromDocker(dockerContainer, prefix)
 	if err != nil {
 		if _, ok := err.(config.ErrNotRockerCompose); !ok {
 			return nil, err
 		}
+		// the container was started by other means, its spec is inferred from the docker config
+		cfg = config.NewFromDockerRuntime(dockerContainer, naming, prefix)
+		adopted = true
+	}
+	// the labels external monitors read take precedence over the stored spec, see config.Backoff
+	backoff, err := config.NewBackoffFromLabels(dockerContainer.Config.Labels, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read restart backoff of container %s, error: %s", dockerContainer.Name, err)
+	}
+	if backoff != nil {
+		cfg.RestartBackoff = backoff
 	}
 	return &Container{
 		ID:      dockerContainer.ID,
 		Image:   imagename.NewFromString(dockerContainer.Config.Image),
 		ImageID: dockerContainer.Image,
-		Name:    config.NewContainerNameFromString(dockerContainer.Name),
+		Name:    naming.Parse(dockerContainer.Name),
 		Created: dockerContainer.Created,
 		State: &ContainerState{
-			Running:    dockerContainer.State.Running,
-			Paused:     dockerContainer.State.Paused,
-			Restarting: dockerContainer.State.Restarting,
-			OOMKilled:  dockerContainer.State.OOMKilled,
-			Pid:        dockerContainer.State.Pid,
-			ExitCode:   dockerContainer.State.ExitCode,
-			Error:      dockerContainer.State.Error,
-			StartedAt:  dockerContainer.State.StartedAt,
-			FinishedAt: dockerContainer.State.FinishedAt,
+			Running:      dockerContainer.State.Running,
+			Paused:       dockerContainer.State.Paused,
+			Restarting:   dockerContainer.State.Restarting,
+			OOMKilled:    dockerContainer.State.OOMKilled,
+			Pid:          dockerContainer.State.Pid,
+			ExitCode:     dockerContainer.State.ExitCode,
+			Error:        dockerContainer.State.Error,
+			StartedAt:    dockerContainer.State.StartedAt,
+			FinishedAt:   dockerContainer.State.FinishedAt,
+			RestartCount: dockerContainer.RestartCount,
 		},
-		Config:    cfg,
-		container: dockerContainer,
+		Config:      cfg,
+		ContentHash: dockerContainer.Config.Labels[prefix.Label(config.LabelContentHash)],
+		Environment: dockerContainer.Config.Labels[prefix.Label(config.LabelEnvironment)],
+		FileHash:    dockerContainer.Config.Labels[prefix.Label(config.LabelFileHash)],
+		Adopted:     adopted,
+		container:   dockerContainer,
+		naming:      naming,
 	}, nil
 }
 
+// createImage returns the image the container is created from: the tag, or the image ID if the
+// container is pinned to the image it ran before, e.g. the previous one recreated by rollback
+// while the tag already points to the new image
+func (a *Container) createImage() string {
+	if a.pinned && a.ImageID != "" {
+		return a.ImageID
+	}
+	return a.Image.String()
+}
+
 // String returns container name
 func (a Container) String() string {
 	return a.Name.String()
 }
 
+// DockerName returns the name of the docker container, it differs from the name
+// in the manifest unless the default naming strategy is used
+func (a *Container) DockerName() string {
+	if a.naming == nil {
+		return config.DotNaming.Format(*a.Name)
+	}
+	return a.naming.Format(*a.Name)
+}
+
 // IsSameNamespace returns true if current and given containers are from same namespace
 func (a *Container) IsSameNamespace(b *Container) bool {
 	return a.Name.IsEqualNs(b.Name)
@@ -136,7 +217,8 @@ func (a *Container) IsSameKind(b *Container) bool {
 
 // IsEqualTo returns true if current and given containers are equal by
 // all dimensions. It compares configuration, image id (image can be updated),
-// state (running, craeted)
+// state (running, craeted). Configuration and image are compared only on a.RecreateOn
+// properties if they are given.
 func (a *Container) IsEqualTo(b *Container) bool {
 	// check name
 	if !a.IsSameKind(b) {
@@ -144,7 +226,7 @@ func (a *Container) IsEqualTo(b *Container) bool {
 	}
 
 	// check configuration
-	if !a.Config.IsEqualTo(b.Config) {
+	if !a.Config.IsEqualOn(b.Config, a.RecreateOn) {
 		log.Debugf("Comparing '%s' and '%s': found difference in '%s'",
 			a.Name.String(),
 			b.Name.String(),
@@ -153,7 +235,7 @@ func (a *Container) IsEqualTo(b *Container) bool {
 	}
 
 	// check image version
-	if a.Image != nil && !a.Image.Contains(b.Image) {
+	if a.recreatesOn("image") && a.Image != nil && !a.Image.Contains(b.Image) {
 		log.Debugf("Comparing '%s' and '%s': image version '%s' is not satisfied (was %s should satisfy %s)",
 			a.Name.String(),
 			b.Name.String(),
@@ -164,7 +246,7 @@ func (a *Container) IsEqualTo(b *Container) bool {
 	}
 
 	// check image id
-	if a.ImageID != "" && b.ImageID != "" && a.ImageID != b.ImageID {
+	if a.recreatesOn("image") && a.ImageID != "" && b.ImageID != "" && a.ImageID != b.ImageID {
 		log.Debugf("Comparing '%s' and '%s': image '%s' updated (was %.12s became %.12s)",
 			a.Name.String(),
 			b.Name.String(),
@@ -174,6 +256,16 @@ func (a *Container) IsEqualTo(b *Container) bool {
 		return false
 	}
 
+	// check content of files given in hash_paths
+	if a.recreatesOn("hash_paths") && a.ContentHash != b.ContentHash {
+		log.Debugf("Comparing '%s' and '%s': content hash of hash_paths changed (was %.12s became %.12s)",
+			a.Name.String(),
+			b.Name.String(),
+			b.ContentHash,
+			a.ContentHash)
+		return false
+	}
+
 	// One of exit codes is always '0' since once of containers (a or b) is always loaded from config
 	if a.Config.State.IsRan() && a.State.ExitCode+b.State.ExitCode > 0 {
 		log.Debugf("Comparing '%s' and '%s': container should run once, but previous exit code was %d",
@@ -183,8 +275,8 @@ func (a *Container) IsEqualTo(b *Container) bool {
 		return false
 	}
 
-	// check state
-	if !a.State.IsEqualState(b.State) {
+	// check state, the desired state is reached by starting or stopping the container, see Diff
+	if a.Config.DesiredState == "" && !a.State.IsEqualState(b.State) {
 		log.Debugf("Comparing '%s' and '%s': found difference in state: Running: %t != %t",
 			a.Name.String(),
 			b.Name.String(),
@@ -196,13 +288,27 @@ func (a *Container) IsEqualTo(b *Container) bool {
 	return true
 }
 
+// recreatesOn returns true if changes of the given property recreate the container, see RecreateOn
+func (a *Container) recreatesOn(property string) bool {
+	if len(a.RecreateOn) == 0 {
+		return true
+	}
+	for _, p := range a.RecreateOn {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
 // IsEqualState returns true if current and given containers have the same state
 func (a *ContainerState) IsEqualState(b *ContainerState) bool {
 	return a.Running == b.Running
 }
 
-// CreateContainerOptions returns create configuration eatable by go-dockerclient
-func (a *Container) CreateContainerOptions() (*docker.CreateContainerOptions, error) {
+// CreateContainerOptions returns create configuration eatable by go-dockerclient,
+// the container is labeled with the given prefix
+func (a *Container) CreateContainerOptions(prefix config.LabelPrefix) (*docker.CreateContainerOptions, error) {
 	apiConfig := a.Config.GetAPIConfig()
 
 	yamlData, err := yaml.Marshal(a.Config)
@@ -215,14 +321,33 @@ func (a *Container) CreateContainerOptions() (*docker.CreateContainerOptions, er
 	for k, v := range apiConfig.Labels {
 		labels[k] = v
 	}
-	labels["rocker-compose-id"] = util.GenerateRandomID()
-	labels["rocker-compose-config"] = string(yamlData)
+	for k, v := range a.Metadata {
+		labels[k] = v
+	}
+	labels[prefix.Label(config.LabelID)] = util.GenerateRandomID()
+	labels[prefix.Label(config.LabelConfig)] = string(yamlData)
+	labels[prefix.Label(config.LabelNamespace)] = a.Name.Namespace
+	for k, v := range a.Config.RestartBackoff.Labels(prefix) {
+		labels[k] = v
+	}
+	for k, v := range a.Config.EndpointLabels(prefix) {
+		labels[k] = v
+	}
+	if a.ContentHash != "" {
+		labels[prefix.Label(config.LabelContentHash)] = a.ContentHash
+	}
+	if a.Environment != "" {
+		labels[prefix.Label(config.LabelEnvironment)] = a.Environment
+	}
+	if a.FileHash != "" {
+		labels[prefix.Label(config.LabelFileHash)] = a.FileHash
+	}
 
 	apiConfig.Labels = labels
-	apiConfig.Image = a.Image.String()
+	apiConfig.Image = a.createImage()
 
 	return &docker.CreateContainerOptions{
-		Name:       a.Name.String(),
+		Name:       a.DockerName(),
 		Config:     apiConfig,
 		HostConfig: a.Config.GetAPIHostConfig(),
 	}, nil
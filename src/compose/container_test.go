@@ -41,7 +41,7 @@ func TestCreateContainerOptions(t *testing.T) {
 
 	container := NewContainerFromConfig(config.NewContainerName("myapp", "main"), cfg.Containers["main"])
 
-	opts, err := container.CreateContainerOptions()
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,7 +80,7 @@ func TestNewContainerFromDocker(t *testing.T) {
 		HostConfig: &docker.HostConfig{},
 	}
 
-	container, err := NewContainerFromDocker(apiContainer)
+	container, err := NewContainerFromDocker(apiContainer, config.DotNaming, config.DefaultLabelPrefix)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,6 +98,112 @@ func TestNewContainerFromDocker(t *testing.T) {
 	assert.Equal(t, assertionName, container.Name)
 }
 
+func TestNewContainerFromDockerAdopted(t *testing.T) {
+	apiContainer := &docker.Container{
+		ID: "2201c17d77c64d51a422c5732cb6368e010dfa47df8724378f4076f465de84c3",
+		Config: &docker.Config{
+			Image:  "quay.io/myapp:1.9.2",
+			Cmd:    []string{"serve"},
+			Env:    []string{"PORT=8080"},
+			Labels: map[string]string{"maintainer": "ops"},
+		},
+		State:      docker.State{Running: true},
+		Name:       "/myapp.main",
+		HostConfig: &docker.HostConfig{RestartPolicy: docker.AlwaysRestart()},
+	}
+
+	container, err := NewContainerFromDocker(apiContainer, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, container.Adopted)
+	assert.Equal(t, config.Cmd{"serve"}, container.Config.Cmd)
+	assert.Equal(t, config.StringMap{"PORT": "8080"}, container.Config.Env)
+	assert.Nil(t, container.Config.Labels, "labels merged from the image should be left out")
+
+	// the manifest describing the container as started should not recreate it
+	image := "quay.io/myapp:1.9.2"
+	cfg, err := config.New("myapp", map[string]*config.Container{
+		"main": &config.Container{
+			Image:   &image,
+			Cmd:     config.Cmd{"serve"},
+			Env:     config.StringMap{"PORT": "8080"},
+			Restart: &config.RestartPolicy{Name: "always"},
+		},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := GetContainersFromConfig(cfg)[0]
+	assert.True(t, expected.IsEqualTo(container), "adopted container should be equal to the spec, failed on field: %s",
+		expected.Config.LastCompareField())
+
+	// the managed containers are not adopted
+	apiContainer.Config.Labels = map[string]string{"rocker-compose-config": "image: quay.io/myapp:1.9.2"}
+	container, err = NewContainerFromDocker(apiContainer, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, container.Adopted)
+}
+
+func TestNewContainerFromDockerAdoptedImageDefaults(t *testing.T) {
+	// the container of `docker run --name test.main nginx:1.9`
+	imageConfig := &docker.Config{
+		Cmd:          []string{"nginx", "-g", "daemon off;"},
+		Env:          []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin", "NGINX_VERSION=1.9.15-1~jessie"},
+		ExposedPorts: map[docker.Port]struct{}{"80/tcp": {}, "443/tcp": {}},
+		Volumes:      map[string]struct{}{"/var/cache/nginx": {}},
+	}
+	apiContainer := &docker.Container{
+		ID:    "4f1e1b0ef0d5f3771438f0b4ac1d24a3d0ea1c5ebd2a17c9d6b3c7e26a34a2c1",
+		Image: "sha256:3b1a8b2a5a1c",
+		Name:  "/test.main",
+		Config: &docker.Config{
+			Hostname:     "4f1e1b0ef0d5",
+			Image:        "nginx:1.9",
+			Cmd:          imageConfig.Cmd,
+			Env:          append(imageConfig.Env, "WORKERS=4"),
+			ExposedPorts: imageConfig.ExposedPorts,
+			Volumes:      imageConfig.Volumes,
+		},
+		State: docker.State{Running: true},
+		HostConfig: &docker.HostConfig{
+			NetworkMode:   "default",
+			RestartPolicy: docker.NeverRestart(),
+			LogConfig:     docker.LogConfig{Type: "json-file"},
+		},
+	}
+
+	container, err := NewContainerFromDocker(apiContainer, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &DockerClient{images: newImageCache(func(id string) (*docker.Image, error) {
+		return &docker.Image{ID: id, Config: imageConfig}, nil
+	})}
+	client.readImageDefaults(container)
+
+	assert.True(t, container.Adopted)
+	assert.Nil(t, container.Config.Cmd, "cmd of the image should be left out")
+	assert.Equal(t, config.StringMap{"WORKERS": "4"}, container.Config.Env, "env of the image should be left out")
+	assert.Nil(t, container.Config.Expose, "ports exposed by the image should be left out")
+	assert.Nil(t, container.Config.Volumes, "volumes of the image should be left out")
+	assert.Nil(t, container.Config.Restart, "the docker default restart policy should be read as not given")
+
+	image := "nginx:1.9"
+	cfg, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image, Env: config.StringMap{"WORKERS": "4"}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := GetContainersFromConfig(cfg)[0]
+	assert.True(t, expected.IsEqualTo(container), "adopted container should be equal to the spec, failed on field: %s",
+		expected.Config.LastCompareField())
+}
+
 func TestNewFromDocker(t *testing.T) {
 	cfg, err := config.NewFromFile("config/testdata/compose.yml", containerTestVars, map[string]interface{}{}, false)
 	if err != nil {
@@ -106,7 +212,7 @@ func TestNewFromDocker(t *testing.T) {
 
 	container := NewContainerFromConfig(config.NewContainerName("myapp", "main"), cfg.Containers["main"])
 
-	opts, err := container.CreateContainerOptions()
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -121,7 +227,7 @@ func TestNewFromDocker(t *testing.T) {
 		Name: "/myapp.main",
 	}
 
-	configFromAPI, err := config.NewFromDocker(apiContainer)
+	configFromAPI, err := config.NewFromDocker(apiContainer, config.DefaultLabelPrefix)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -130,3 +236,313 @@ func TestNewFromDocker(t *testing.T) {
 	assert.True(t, compareResult,
 		"container spec converted from API should be equal to one fetched from config file, failed on field: %s", cfg.Containers["main"].LastCompareField())
 }
+
+func TestContainerContentHashChanged(t *testing.T) {
+	cfg, err := config.NewFromFile("config/testdata/compose.yml", containerTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NewContainerFromConfig(config.NewContainerName("myapp", "main"), cfg.Containers["main"])
+	expected.ContentHash = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	opts, err := expected.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expected.ContentHash, opts.Config.Labels["rocker-compose-content-hash"])
+
+	apiContainer := &docker.Container{
+		Config: &docker.Config{
+			Image:  opts.Config.Image,
+			Labels: opts.Config.Labels,
+		},
+		State: docker.State{
+			Running: true,
+		},
+		Name: "/myapp.main",
+	}
+
+	actual, err := NewContainerFromDocker(apiContainer, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, expected.IsEqualTo(actual), "containers with same content hash should be equal")
+
+	expected.ContentHash = "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"
+	assert.False(t, expected.IsEqualTo(actual), "containers with different content hash should not be equal")
+}
+
+func TestCreateContainerOptionsRestartBackoff(t *testing.T) {
+	image := "ubuntu:14.04"
+	initial := config.Duration(2 * time.Second)
+	container := NewContainerFromConfig(config.NewContainerName("test", "main"), &config.Container{
+		Image:          &image,
+		RestartBackoff: &config.Backoff{Initial: &initial},
+	})
+
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "2s", opts.Config.Labels["rocker-compose-restart-backoff-initial"])
+	_, hasMax := opts.Config.Labels["rocker-compose-restart-backoff-max"]
+	assert.False(t, hasMax)
+
+	// the backoff is read back from the labels, the container started by other means has them as well
+	for _, labels := range []map[string]string{opts.Config.Labels, {"rocker-compose-restart-backoff-initial": "2s"}} {
+		actual, err := NewContainerFromDocker(&docker.Container{
+			Name:   "/test.main",
+			Config: &docker.Config{Image: opts.Config.Image, Labels: labels},
+			State:  docker.State{Running: true},
+		}, config.DotNaming, config.DefaultLabelPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, &config.Backoff{Initial: &initial}, actual.Config.RestartBackoff)
+	}
+
+	_, err = NewContainerFromDocker(&docker.Container{
+		Name:   "/test.main",
+		Config: &docker.Config{Image: opts.Config.Image, Labels: map[string]string{"rocker-compose-restart-backoff-max": "forever"}},
+	}, config.DotNaming, config.DefaultLabelPrefix)
+	assert.Error(t, err)
+}
+
+func TestCreateContainerOptionsMetadata(t *testing.T) {
+	newContainer := func(metadata map[string]string) *Container {
+		image := "ubuntu:14.04"
+		cfg, err := config.New("test", map[string]*config.Container{
+			"main": &config.Container{Image: &image, Labels: config.StringMap{"app": "main"}},
+		}, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		container := GetContainersFromConfig(cfg)[0]
+		container.Metadata = metadata
+		return container
+	}
+
+	container := newContainer(map[string]string{"git.revision": "abc123", "build.time": "2016-01-01T00:00:00Z"})
+
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "abc123", opts.Config.Labels["git.revision"])
+	assert.Equal(t, "2016-01-01T00:00:00Z", opts.Config.Labels["build.time"])
+	assert.Equal(t, "main", opts.Config.Labels["app"])
+
+	// the container deployed with the previous revision should not be recreated
+	actual, err := NewContainerFromDocker(&docker.Container{
+		Name:   "/test.main",
+		Config: &docker.Config{Image: opts.Config.Image, Labels: opts.Config.Labels},
+		State:  docker.State{Running: true},
+	}, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := newContainer(map[string]string{"git.revision": "def456"})
+	assert.True(t, expected.IsEqualTo(actual), "containers with different metadata should be equal, failed on field: %s",
+		expected.Config.LastCompareField())
+}
+
+func TestCreateContainerOptionsLabelPrefix(t *testing.T) {
+	prefix := config.LabelPrefix("myorg-compose-")
+
+	image := "ubuntu:14.04"
+	cfg, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image, Labels: config.StringMap{"rocker-compose-custom": "foo"}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := GetContainersFromConfig(cfg)[0]
+
+	opts, err := container.CreateContainerOptions(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "test", opts.Config.Labels["myorg-compose-namespace"])
+	assert.NotEmpty(t, opts.Config.Labels["myorg-compose-config"])
+	_, hasDefault := opts.Config.Labels["rocker-compose-config"]
+	assert.False(t, hasDefault, "should not use the default prefix")
+
+	actual, err := NewContainerFromDocker(&docker.Container{
+		Name:   "/test.main",
+		Config: &docker.Config{Image: opts.Config.Image, Labels: opts.Config.Labels},
+		State:  docker.State{Running: true},
+	}, config.DotNaming, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "foo", actual.Config.Labels["rocker-compose-custom"], "labels of other prefixes should be kept")
+	assert.True(t, container.IsEqualTo(actual), "container as created should be equal to the spec, failed on field: %s",
+		container.Config.LastCompareField())
+}
+
+func TestCreateContainerOptionsUserLabels(t *testing.T) {
+	image := "ubuntu:14.04"
+	labels := config.StringMap{"rocker-compose-custom": "foo", "app": "main"}
+	cfg, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image, Labels: labels},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := GetContainersFromConfig(cfg)[0]
+
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := NewContainerFromDocker(&docker.Container{
+		Name:   "/test.main",
+		Config: &docker.Config{Image: opts.Config.Image, Labels: opts.Config.Labels},
+		State:  docker.State{Running: true},
+	}, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, labels, actual.Config.Labels, "only the labels declared by the user should be restored")
+	assert.Equal(t, opts.Config.Labels["rocker-compose-config"], actual.Config.ConfigLabel())
+	assert.True(t, container.IsEqualTo(actual), "container as created should be equal to the spec, failed on field: %s",
+		container.Config.LastCompareField())
+}
+
+func TestContainerLabelsManagedNotCompared(t *testing.T) {
+	image := "ubuntu:14.04"
+	newContainer := func(labels config.StringMap) *Container {
+		cfg, err := config.New("test", map[string]*config.Container{
+			"main": &config.Container{Image: &image, Labels: labels},
+		}, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.StripManagedLabels(config.DefaultLabelPrefix)
+		return GetContainersFromConfig(cfg)[0]
+	}
+
+	// the managed label declared in the manifest is stripped, so it does not churn
+	container := newContainer(config.StringMap{"app": "main", "rocker-compose-file-hash": "abc"})
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Config.Labels["rocker-compose-file-hash"] = "def"
+	opts.Config.Labels["rocker-compose-id"] = "other"
+
+	actual, err := NewContainerFromDocker(&docker.Container{
+		Name:   "/test.main",
+		Config: &docker.Config{Image: opts.Config.Image, Labels: opts.Config.Labels},
+		State:  docker.State{Running: true},
+	}, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, config.StringMap{"app": "main"}, actual.Config.Labels)
+	assert.True(t, container.IsEqualTo(actual), "change of managed labels should not recreate, failed on field: %s",
+		container.Config.LastCompareField())
+
+	// the user labels are compared case-sensitively
+	for _, labels := range []config.StringMap{
+		{"app": "other"},
+		{"app": "main", "Rocker-Compose-Id": "x"},
+		{"app": "main", "rocker-compose-custom": "foo"},
+	} {
+		expected := newContainer(labels)
+		assert.False(t, expected.IsEqualTo(actual), "change of user labels %v should recreate", labels)
+	}
+}
+
+func TestContainerStateFailureReport(t *testing.T) {
+	finishedAt := time.Date(2015, 11, 23, 14, 5, 0, 0, time.UTC)
+
+	apiContainer := &docker.Container{
+		ID: "2201c17d77c6",
+		Config: &docker.Config{
+			Image:  "quay.io/myapp:1.9.2",
+			Labels: map[string]string{"rocker-compose-config": "image: quay.io/myapp:1.9.2"},
+		},
+		State: docker.State{
+			ExitCode:   137,
+			OOMKilled:  true,
+			Error:      "cannot allocate memory",
+			FinishedAt: finishedAt,
+		},
+		RestartCount: 3,
+		Name:         "/myapp.main",
+		HostConfig:   &docker.HostConfig{},
+	}
+
+	container, err := NewContainerFromDocker(apiContainer, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "exited with code 137 at 2015-11-23T14:05:00Z, killed by OOM killer, error: cannot allocate memory, restart count: 3",
+		container.State.FailureReport())
+
+	assert.Equal(t, "exited with code 1", (&ContainerState{ExitCode: 1}).FailureReport())
+	assert.Equal(t, "", (&ContainerState{Running: true}).FailureReport())
+	assert.Equal(t, "", (*ContainerState)(nil).FailureReport())
+}
+
+func TestErrContainerBadState(t *testing.T) {
+	err := ErrContainerBadState{
+		Container:    newContainer("myapp", "main"),
+		Running:      true,
+		ExitCode:     2,
+		ErrorStr:     "oops",
+		RestartCount: 1,
+	}
+	assert.EqualError(t, err, "Container myapp.main exited with code 2, error: oops, restart count: 1")
+}
+
+func TestCreateContainerOptionsEndpoints(t *testing.T) {
+	image := "nginx:1.9"
+	container := NewContainerFromConfig(config.NewContainerName("test", "web"), &config.Container{
+		Image: &image,
+		Ports: config.Ports{
+			{Port: "80/tcp", HostPort: "8080"},
+			{Port: "443/tcp", HostIP: "10.0.0.1", HostPort: "8443"},
+		},
+	})
+
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0.0.0.0:8080", opts.Config.Labels["rocker-compose-endpoint.80/tcp"])
+	assert.Equal(t, "10.0.0.1:8443", opts.Config.Labels["rocker-compose-endpoint.443/tcp"])
+
+	actual, err := NewContainerFromDocker(&docker.Container{
+		Config:     opts.Config,
+		HostConfig: opts.HostConfig,
+		State:      docker.State{Running: true},
+		Name:       "/test.web",
+	}, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, container.IsEqualTo(actual), "endpoint labels should not be compared, failed on field: %s",
+		container.Config.LastCompareField())
+
+	// the container with changed ports is recreated, so it gets the new endpoint labels
+	container.Config.Ports[0].HostPort = "9080"
+	assert.False(t, container.IsEqualTo(actual))
+	opts, err = container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0.0.0.0:9080", opts.Config.Labels["rocker-compose-endpoint.80/tcp"])
+}
@@ -19,6 +19,9 @@ package compose
 import (
 	"fmt"
 	"github.com/grammarly/rocker-compose/src/compose/config"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
 )
 
 // Diff describes a comparison functionality of two container sets: expected and actual
@@ -35,6 +38,7 @@ type Diff interface {
 type graph struct {
 	ns           string
 	dependencies map[*Container][]*dependency
+	force        bool // recreate the containers started by other means, see Container.Adopted
 }
 
 // single dependency (external - means not in our namespace)
@@ -42,13 +46,21 @@ type dependency struct {
 	container *Container
 	external  bool
 	waitForIt bool
+	kinds     []string // relations the dependency comes from, e.g. links or volumes_from
 }
 
 // NewDiff returns an implementation of Diff object
 func NewDiff(ns string) Diff {
+	return newDiff(ns, false)
+}
+
+// newDiff returns an implementation of Diff object that recreates the existing containers
+// which were not created by rocker-compose only if force is given
+func newDiff(ns string, force bool) *graph {
 	return &graph{
 		ns:           ns,
 		dependencies: make(map[*Container][]*dependency),
+		force:        force,
 	}
 }
 
@@ -90,39 +102,41 @@ func resolveDependencies(ns string, expected []*Container, actual []*Container,
 	resolved = []*dependency{}
 	toResolve := map[config.ContainerName]*dependency{}
 
+	add := func(cn config.ContainerName, kind string) *dependency {
+		d, found := toResolve[cn]
+		if !found {
+			d = &dependency{external: cn.Namespace != ns}
+			toResolve[cn] = d
+		}
+		if len(d.kinds) == 0 || d.kinds[len(d.kinds)-1] != kind {
+			d.kinds = append(d.kinds, kind)
+		}
+		return d
+	}
+
 	//VolumesFrom
 	for _, cn := range target.Config.VolumesFrom {
-		if _, found := toResolve[cn]; !found {
-			toResolve[cn] = &dependency{external: cn.Namespace != ns}
-		}
+		add(cn, "volumes_from")
 	}
 
 	//WaitFor
 	for _, cn := range target.Config.WaitFor {
-		if d, found := toResolve[cn]; !found {
-			toResolve[cn] = &dependency{
-				waitForIt: true,
-				external:  cn.Namespace != ns,
-			}
-		} else {
-			d.waitForIt = true
-		}
+		add(cn, "wait_for").waitForIt = true
 	}
 
 	//Links
 	for _, link := range target.Config.Links {
-		cn := link.ContainerName
-		if _, found := toResolve[cn]; !found {
-			toResolve[cn] = &dependency{external: cn.Namespace != ns}
-		}
+		add(link.ContainerName, "links")
+	}
+
+	//EnvFromExec
+	for _, envFrom := range target.Config.EnvFromExec {
+		add(envFrom.Container, "env_from_exec")
 	}
 
 	//Net
 	if target.Config.Net != nil && target.Config.Net.Type == "container" {
-		cn := target.Config.Net.Container
-		if _, found := toResolve[cn]; !found {
-			toResolve[cn] = &dependency{external: cn.Namespace != ns}
-		}
+		add(target.Config.Net.Container, "net")
 	}
 
 	for name, dep := range toResolve {
@@ -147,25 +161,125 @@ func resolveDependencies(ns string, expected []*Container, actual []*Container,
 	return
 }
 
+// listContainersToRemove returns actions removing the containers that are not expected anymore.
+// Containers are removed one by one, the ones depending on others go first, and the ones of the
+// same dependency level are ordered by stop_priority, so containers of higher priority are stopped later.
 func listContainersToRemove(ns string, expected []*Container, actual []*Container) (res []Action) {
+	removed := []*Container{}
 	for _, a := range actual {
-		if a.Name.Namespace == ns {
+		// adopted containers are replaced by the ones of the same name but never removed
+		if a.Name.Namespace == ns && !a.Adopted {
 			var found bool
 			for _, e := range expected {
 				found = found || e.IsSameKind(a)
 			}
 			if !found {
-				res = append(res, NewRemoveContainerAction(a))
+				removed = append(removed, a)
 			}
 		}
 	}
+
+	sort.Stable(&removalOrder{containers: removed, levels: removalLevels(removed)})
+
+	for _, a := range removed {
+		res = append(res, NewRemoveContainerAction(a))
+	}
 	return
 }
 
+// removalOrder sorts containers by their removal level and then by stop_priority, see listContainersToRemove
+type removalOrder struct {
+	containers []*Container
+	levels     map[*Container]int
+}
+
+func (o *removalOrder) Len() int {
+	return len(o.containers)
+}
+
+func (o *removalOrder) Less(i, j int) bool {
+	a, b := o.containers[i], o.containers[j]
+	if o.levels[a] != o.levels[b] {
+		return o.levels[a] < o.levels[b]
+	}
+	return stopPriority(a) < stopPriority(b)
+}
+
+func (o *removalOrder) Swap(i, j int) {
+	o.containers[i], o.containers[j] = o.containers[j], o.containers[i]
+}
+
+// removalLevels returns the dependency level of every container among the given ones:
+// containers nothing depends on are of level 0, their dependencies are of level 1 and so on
+func removalLevels(containers []*Container) map[*Container]int {
+	dependents := map[*Container][]*Container{}
+	for _, c := range containers {
+		if c.Config == nil {
+			continue
+		}
+		names := append([]config.ContainerName{}, c.Config.VolumesFrom...)
+		names = append(names, c.Config.WaitFor...)
+		for _, link := range c.Config.Links {
+			names = append(names, link.ContainerName)
+		}
+		for _, envFrom := range c.Config.EnvFromExec {
+			names = append(names, envFrom.Container)
+		}
+		if c.Config.Net != nil && c.Config.Net.Type == "container" {
+			names = append(names, c.Config.Net.Container)
+		}
+		for _, name := range names {
+			if dep := find(containers, &name); dep != nil && dep != c {
+				dependents[dep] = append(dependents[dep], c)
+			}
+		}
+	}
+
+	levels := map[*Container]int{}
+	var level func(c *Container, path map[*Container]bool) int
+	level = func(c *Container, path map[*Container]bool) int {
+		if l, ok := levels[c]; ok {
+			return l
+		}
+		// dependencies have no cycles, but the existing containers are not validated
+		if path[c] {
+			return 0
+		}
+		path[c] = true
+		l := 0
+		for _, d := range dependents[c] {
+			if dl := level(d, path) + 1; dl > l {
+				l = dl
+			}
+		}
+		delete(path, c)
+		levels[c] = l
+		return l
+	}
+	for _, c := range containers {
+		level(c, map[*Container]bool{})
+	}
+	return levels
+}
+
+// stopPriority returns stop_priority of the existing container, 0 by default
+func stopPriority(c *Container) int {
+	if c.Config == nil || c.Config.StopPriority == nil {
+		return 0
+	}
+	return *c.Config.StopPriority
+}
+
 func (g *graph) buildExecutionPlan(actual []*Container) (res []Action) {
 	visited := map[*Container]bool{}
 	restarted := map[*Container]struct{}{}
 
+	expected := []*Container{}
+	for container := range g.dependencies {
+		expected = append(expected, container)
+	}
+	groups := changedGroups(expected, actual)
+
 	// while number of visited deps less than number of
 	// dependencies which should be visited - loop
 	for len(visited) < len(g.dependencies) {
@@ -200,6 +314,11 @@ func (g *graph) buildExecutionPlan(actual []*Container) (res []Action) {
 				}
 			}
 
+			// containers of a group are recreated together if any of them is changed
+			if _, changed := groups[container.Config.Group]; changed {
+				restart = true
+			}
+
 			// predefine flag / set false to prevent getting into the same operation
 			visited[container] = false
 
@@ -208,12 +327,36 @@ func (g *graph) buildExecutionPlan(actual []*Container) (res []Action) {
 				if container.IsSameKind(actualContainer) {
 					//in configuration was changed or restart forced by dependency - recreate container
 					if !container.IsEqualTo(actualContainer) || restart {
+						// the containers started by other means are never removed unless forced
+						if actualContainer.Adopted && !g.force {
+							log.Warnf("Container %s was not created by rocker-compose, it is left as is instead of being recreated, "+
+								"use -force to recreate it", actualContainer.Name)
+							step = append(step, NewStepAction(true, depActions...))
+							continue nextDependency
+						}
+
 						restartActions := []Action{
 							NewStepAction(true, depActions...),
 							NewRemoveContainerAction(actualContainer),
 							NewRunContainerAction(container),
 						}
 
+						if container.Config.RecreateStrategy == config.RecreateStartFirst {
+							restartActions = []Action{
+								NewStepAction(true, depActions...),
+								NewReplaceContainerAction(actualContainer, container),
+							}
+						}
+
+						// quiesce is the hook of the existing container, as pre_stop is, and unquiesce of the new one
+						if actualContainer.Config.Quiesce != nil || container.Config.Unquiesce != nil {
+							restartActions = append([]Action{
+								restartActions[0],
+								NewQuiesceContainerAction(actualContainer),
+							}, restartActions[1:]...)
+							restartActions = append(restartActions, NewUnquiesceContainerAction(container))
+						}
+
 						// in recovery mode we have to ensure containers are started
 						if container.Name.Namespace != g.ns {
 							restartActions = []Action{
@@ -229,6 +372,19 @@ func (g *graph) buildExecutionPlan(actual []*Container) (res []Action) {
 						continue nextDependency
 					}
 
+					// bring the container to the desired state without recreation
+					if container.Config.DesiredState != "" && container.State.Running != actualContainer.State.Running {
+						stateAction := NewStopContainerAction(actualContainer)
+						if container.State.Running {
+							stateAction = NewStartContainerAction(actualContainer, container)
+						}
+						step = append(step, NewStepAction(false,
+							NewStepAction(true, depActions...),
+							stateAction,
+						))
+						continue nextDependency
+					}
+
 					// adding ensure action if applicable
 					step = append(step, NewStepAction(true, depActions...))
 					continue nextDependency
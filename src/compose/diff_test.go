@@ -304,6 +304,109 @@ func TestDiffDifferentConfig(t *testing.T) {
 	mock.AssertExpectations(t)
 }
 
+func TestDiffRecreateOn(t *testing.T) {
+	memory1, memory2 := config.Memory(128*1024*1024), config.Memory(256*1024*1024)
+	newVersion := func(name, tag string, memory *config.Memory) *Container {
+		return &Container{
+			State:      &ContainerState{Running: true},
+			Name:       &config.ContainerName{Namespace: "test", Name: name},
+			Image:      imagename.NewFromString("app:" + tag),
+			Config:     &config.Container{Memory: memory, Env: config.StringMap{"A": "1"}},
+			RecreateOn: []string{"image", "env"},
+		}
+	}
+
+	// memory is changed for both containers, and the image only for the second one
+	c1x, c1y := newVersion("1", "1.0", &memory1), newVersion("1", "1.0", &memory2)
+	c2x, c2y := newVersion("2", "1.1", &memory1), newVersion("2", "1.0", &memory2)
+
+	actions, err := NewDiff("test").Diff([]*Container{c1x, c2x}, []*Container{c1y, c2y})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := clientMock{}
+	mock.On("RemoveContainer", c2y).Return(nil)
+	mock.On("RunContainer", c2x).Return(nil)
+	runner := NewDockerClientRunner(&mock)
+	if err := runner.Run(actions); err != nil {
+		t.Fatal(err)
+	}
+	mock.AssertExpectations(t)
+	mock.AssertNotCalled(t, "RemoveContainer", c1y)
+}
+
+func TestApplyRecreateOnUnknownProperty(t *testing.T) {
+	manifest, err := config.New("test", map[string]*config.Container{}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Apply(&clientMock{}, manifest, ApplyOptions{RecreateOn: []string{"image", "memroy"}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Unknown property \"memroy\" to recreate containers on")
+	}
+}
+
+func TestDiffDifferentConfigStartFirst(t *testing.T) {
+	cmp := NewDiff("test")
+	cpusetCpus1 := "0-2"
+	cpusetCpus2 := "0-4"
+	c1x := &Container{
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus1, RecreateStrategy: config.RecreateStartFirst},
+	}
+	c1y := &Container{
+		ID:     "old",
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus2},
+	}
+	actions, _ := cmp.Diff([]*Container{c1x}, []*Container{c1y})
+	mock := clientMock{}
+	mock.On("RenameContainer", c1y, "test.1_replaced").Return(nil)
+	mock.On("RunContainer", c1x).Return(nil)
+	mock.On("RemoveContainer", c1y).Return(nil)
+	runner := NewDockerClientRunner(&mock)
+	assert.NoError(t, runner.Run(actions))
+	mock.AssertExpectations(t)
+
+	// the old container is removed only after the new one is running
+	calls := []string{}
+	for _, call := range mock.Calls {
+		calls = append(calls, call.Method)
+	}
+	assert.Equal(t, []string{"RenameContainer", "RunContainer", "RemoveContainer"}, calls)
+}
+
+func TestDiffDifferentConfigStartFirstRollback(t *testing.T) {
+	cmp := NewDiff("test")
+	cpusetCpus1 := "0-2"
+	cpusetCpus2 := "0-4"
+	c1x := &Container{
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus1, RecreateStrategy: config.RecreateStartFirst},
+	}
+	c1y := &Container{
+		ID:     "old",
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus2},
+	}
+	actions, _ := cmp.Diff([]*Container{c1x}, []*Container{c1y})
+	client := clientMock{}
+	client.On("RenameContainer", c1y, "test.1_replaced").Return(nil)
+	client.On("RunContainer", c1x).Return(fmt.Errorf("exited abnormally")).Run(func(args mock.Arguments) {
+		args.Get(0).(*Container).ID = "new"
+	})
+	client.On("RemoveContainer", c1x).Return(nil)
+	client.On("RenameContainer", c1y, "test.1").Return(nil)
+	runner := NewDockerClientRunner(&client)
+	assert.Error(t, runner.Run(actions))
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "RemoveContainer", c1y)
+}
+
 func TestDiffForExternalDependencies(t *testing.T) {
 	cmp := NewDiff("test")
 	containers := []*Container{}
@@ -342,6 +445,47 @@ func TestDiffCreateRemoving(t *testing.T) {
 	mock.AssertExpectations(t)
 }
 
+func TestDiffRemoveOrder(t *testing.T) {
+	priority := func(c *Container, p int) *Container {
+		c.Config.StopPriority = &p
+		return c
+	}
+	db := priority(newContainer("test", "db"), 10)
+	cache := newContainer("test", "cache")
+	app := newContainer("test", "app", config.ContainerName{Namespace: "test", Name: "db"})
+	app.Config.Links = config.Links{config.Link{ContainerName: config.ContainerName{Namespace: "test", Name: "cache"}, Alias: "cache"}}
+	worker := priority(newContainerWaitFor("test", "worker", config.ContainerName{Namespace: "test", Name: "db"}), 5)
+	proxy := newContainer("test", "proxy", config.ContainerName{Namespace: "test", Name: "app"})
+	metrics := priority(newContainer("test", "metrics"), -1)
+	other := newContainer("other", "db")
+
+	actions, err := NewDiff("test").Diff([]*Container{}, []*Container{db, worker, proxy, cache, other, app, metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed := []string{}
+	WalkActions(actions, func(action Action) {
+		if a, ok := action.(*removeContainer); ok {
+			removed = append(removed, a.container.Name.Name)
+		}
+	})
+
+	// dependent containers go first, then by priority within the same level
+	assert.Equal(t, []string{"metrics", "proxy", "worker", "app", "cache", "db"}, removed)
+}
+
+func TestDiffRemoveOrderCycle(t *testing.T) {
+	a := newContainer("test", "a", config.ContainerName{Namespace: "test", Name: "b"})
+	b := newContainer("test", "b", config.ContainerName{Namespace: "test", Name: "a"})
+
+	actions, err := NewDiff("test").Diff([]*Container{}, []*Container{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, actions, 2, "existing containers with cycles should still be removed")
+}
+
 func TestDiffCreateSome(t *testing.T) {
 	cmp := NewDiff("test")
 	containers := []*Container{}
@@ -410,6 +554,96 @@ func TestDiffRecovery(t *testing.T) {
 	mock.AssertExpectations(t)
 }
 
+func TestDiffDesiredState(t *testing.T) {
+	newDesired := func(state string, running bool) *Container {
+		container := newContainer("test", "app")
+		container.Config.DesiredState = state
+		container.State.Running = running
+		return container
+	}
+
+	run := func(expected, actual *Container) *clientMock {
+		actions, err := NewDiff("test").Diff([]*Container{expected}, []*Container{actual})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &clientMock{}
+		client.On("StartContainer", mock.Anything).Return(nil)
+		client.On("StopContainer", mock.Anything).Return(nil)
+		if err := NewDockerClientRunner(client).Run(actions); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	// running -> stopped
+	actual := newDesired(config.DesiredStateRunning, true)
+	client := run(newDesired(config.DesiredStateStopped, false), actual)
+	client.AssertCalled(t, "StopContainer", actual)
+	client.AssertNotCalled(t, "StartContainer", mock.Anything)
+
+	// stopped -> running, the existing container is started
+	actual = newDesired(config.DesiredStateStopped, false)
+	actual.ID = "a1b2c3"
+	expected := newDesired(config.DesiredStateRunning, true)
+	client = run(expected, actual)
+	client.AssertCalled(t, "StartContainer", expected)
+	assert.Equal(t, "a1b2c3", expected.ID)
+	client.AssertNotCalled(t, "StopContainer", mock.Anything)
+
+	// already in the desired state
+	for _, running := range []bool{true, false} {
+		state := config.DesiredStateStopped
+		if running {
+			state = config.DesiredStateRunning
+		}
+		client = run(newDesired(state, running), newDesired(state, running))
+		client.AssertNotCalled(t, "StartContainer", mock.Anything)
+		client.AssertNotCalled(t, "StopContainer", mock.Anything)
+	}
+
+	// without desired_state a stopped container is recreated as before
+	client = &clientMock{}
+	client.On("RemoveContainer", mock.Anything).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	actions, err := NewDiff("test").Diff([]*Container{newContainer("test", "app")}, []*Container{newDesired("", false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDockerClientRunner(client).Run(actions); err != nil {
+		t.Fatal(err)
+	}
+	client.AssertNumberOfCalls(t, "RunContainer", 1)
+}
+
+func TestNewContainerFromConfigDesiredState(t *testing.T) {
+	image := "app:1.0"
+	cfg, err := config.New("test", map[string]*config.Container{
+		"stopped": &config.Container{Image: &image, DesiredState: config.DesiredStateStopped},
+		"running": &config.Container{Image: &image, DesiredState: config.DesiredStateRunning},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := map[string]bool{}
+	for _, container := range GetContainersFromConfig(cfg) {
+		states[container.Name.Name] = container.State.Running
+	}
+	assert.Equal(t, map[string]bool{"stopped": false, "running": true}, states)
+
+	state := config.State("ran")
+	_, err = config.New("test", map[string]*config.Container{
+		"job": &config.Container{Image: &image, State: &state, DesiredState: config.DesiredStateStopped},
+	}, "/")
+	assert.EqualError(t, err, "Container job: desired_state cannot be used with state ran")
+
+	_, err = config.New("test", map[string]*config.Container{
+		"app": &config.Container{Image: &image, DesiredState: "paused"},
+	}, "/")
+	assert.EqualError(t, err, "Container app: unknown desired_state paused, possible values are running and stopped")
+}
+
 func newContainer(namespace string, name string, dependencies ...config.ContainerName) *Container {
 	return &Container{
 		State: &ContainerState{
@@ -436,7 +670,7 @@ func newContainerWaitFor(namespace string, name string, dependencies ...config.C
 
 func (m *clientMock) GetContainers(global bool) ([]*Container, error) {
 	args := m.Called()
-	return nil, args.Error(0)
+	return m.actual, args.Error(0)
 }
 
 func (m *clientMock) RemoveContainer(container *Container) error {
@@ -444,11 +678,36 @@ func (m *clientMock) RemoveContainer(container *Container) error {
 	return args.Error(0)
 }
 
+func (m *clientMock) RenameContainer(container *Container, name string) error {
+	args := m.Called(container, name)
+	return args.Error(0)
+}
+
 func (m *clientMock) RunContainer(container *Container) error {
 	args := m.Called(container)
 	return args.Error(0)
 }
 
+func (m *clientMock) StartContainer(container *Container) error {
+	args := m.Called(container)
+	return args.Error(0)
+}
+
+func (m *clientMock) StopContainer(container *Container) error {
+	args := m.Called(container)
+	return args.Error(0)
+}
+
+func (m *clientMock) QuiesceContainer(container *Container) error {
+	args := m.Called(container)
+	return args.Error(0)
+}
+
+func (m *clientMock) UnquiesceContainer(container *Container) error {
+	args := m.Called(container)
+	return args.Error(0)
+}
+
 func (m *clientMock) EnsureContainerExist(container *Container) error {
 	args := m.Called(container)
 	return args.Error(0)
@@ -496,6 +755,9 @@ func (m *clientMock) WaitForContainer(container *Container) error {
 
 func (m *clientMock) GetPulledImages() []*imagename.ImageName {
 	m.Called()
+	if m.pulled != nil {
+		return m.pulled
+	}
 	return []*imagename.ImageName{}
 }
 
@@ -504,6 +766,11 @@ func (m *clientMock) GetRemovedImages() []*imagename.ImageName {
 	return []*imagename.ImageName{}
 }
 
+func (m *clientMock) GetHostResources() (int64, int, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Int(1), args.Error(2)
+}
+
 func (m *clientMock) Pin(local, hub bool, vars template.Vars, container []*Container) error {
 	args := m.Called(local, hub, vars, container)
 	return args.Error(0)
@@ -511,4 +778,6 @@ func (m *clientMock) Pin(local, hub bool, vars template.Vars, container []*Conta
 
 type clientMock struct {
 	mock.Mock
+	actual []*Container           // returned by GetContainers
+	pulled []*imagename.ImageName // returned by GetPulledImages
 }
@@ -93,6 +93,13 @@ func GetBridgeIP(client *docker.Client) (ip string, err error) {
 
 // PullDockerImage pulls an image and streams to a logger respecting terminal features
 func PullDockerImage(client *docker.Client, image *imagename.ImageName, auth *docker.AuthConfigurations) (*docker.Image, error) {
+	return pullDockerImage(client, image, auth, false, nil)
+}
+
+// pullDockerImage pulls the image as PullDockerImage does, once cancel is closed the pull
+// from the registry stops on its next progress message, see pullWithTimeout. Images pulled
+// concurrently are logged line by line, so their progress does not garble the terminal.
+func pullDockerImage(client *docker.Client, image *imagename.ImageName, auth *docker.AuthConfigurations, concurrent bool, cancel <-chan struct{}) (*docker.Image, error) {
 	if image.Storage == imagename.StorageS3 {
 		s3storage := s3.New(client, os.TempDir())
 		if err := s3storage.Pull(image.String()); err != nil {
@@ -105,7 +112,7 @@ func PullDockerImage(client *docker.Client, image *imagename.ImageName, auth *do
 			Repository:    image.NameWithRegistry(),
 			Registry:      image.Registry,
 			Tag:           image.Tag,
-			OutputStream:  pipeWriter,
+			OutputStream:  &cancelWriter{pipeWriter, cancel},
 			RawJSONStream: true,
 		}
 
@@ -130,7 +137,8 @@ func PullDockerImage(client *docker.Client, image *imagename.ImageName, auth *do
 		fd, isTerminal := term.GetFdInfo(def.Out)
 		out := def.Out
 
-		if !isTerminal {
+		if !isTerminal || concurrent {
+			isTerminal = false
 			out = def.Writer()
 		}
 
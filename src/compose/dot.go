@@ -0,0 +1,76 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyGraphDOT renders the dependency graph of the expected containers in Graphviz DOT
+// format, the same graph is used to order containers on run. Edges point from a container
+// to its dependency and are labeled with the relations, e.g. links or volumes_from.
+// Containers of other namespaces are resolved among the actual ones and drawn dashed.
+func DependencyGraphDOT(ns string, expected, actual []*Container) (string, error) {
+	g := NewDiff(ns).(*graph)
+	if err := g.buildDependencyGraph(expected, actual); err != nil {
+		return "", err
+	}
+	return g.dot(), nil
+}
+
+func (g *graph) dot() string {
+	nodes := map[string]bool{}
+	edges := []string{}
+
+	for container, deps := range g.dependencies {
+		nodes[container.Name.String()] = false
+		for _, dep := range deps {
+			attrs := fmt.Sprintf("label=%q", strings.Join(dep.kinds, ", "))
+			if dep.external {
+				nodes[dep.container.Name.String()] = true
+				attrs += ", style=dashed"
+			}
+			edges = append(edges, fmt.Sprintf("%q -> %q [%s];", container.Name.String(), dep.container.Name.String(), attrs))
+		}
+	}
+
+	names := []string{}
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(edges)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %q {\n", g.ns)
+	for _, name := range names {
+		if nodes[name] {
+			fmt.Fprintf(&buf, "  %q [style=dashed];\n", name)
+		} else {
+			fmt.Fprintf(&buf, "  %q;\n", name)
+		}
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&buf, "  %s\n", edge)
+	}
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
@@ -0,0 +1,61 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyGraphDOT(t *testing.T) {
+	db := config.ContainerName{Namespace: "test", Name: "db"}
+	data := config.ContainerName{Namespace: "test", Name: "data"}
+	logs := config.ContainerName{Namespace: "infra", Name: "logs"}
+
+	main := newContainer("test", "main", data)
+	main.Config.Links = config.Links{{ContainerName: db, Alias: "mysql"}}
+	main.Config.WaitFor = config.ContainerNames{db, logs}
+	sidecar := newContainer("test", "sidecar")
+	sidecar.Config.Net = &config.Net{Type: "container", Container: *main.Name}
+
+	expected := []*Container{main, sidecar, newContainer("test", "db", data), newContainer("test", "data")}
+	actual := []*Container{newContainer("infra", "logs")}
+
+	dot, err := DependencyGraphDOT("test", expected, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `digraph "test" {
+  "infra.logs" [style=dashed];
+  "test.data";
+  "test.db";
+  "test.main";
+  "test.sidecar";
+  "test.db" -> "test.data" [label="volumes_from"];
+  "test.main" -> "infra.logs" [label="wait_for", style=dashed];
+  "test.main" -> "test.data" [label="volumes_from"];
+  "test.main" -> "test.db" [label="wait_for, links"];
+  "test.sidecar" -> "test.main" [label="net"];
+}
+`, dot)
+
+	_, err = DependencyGraphDOT("test", expected, []*Container{})
+	assert.EqualError(t, err, "Cannot resolve dependency infra.logs for test.main")
+}
@@ -0,0 +1,74 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// envFromExecTimeout is the time given to every env_from_exec command
+const envFromExecTimeout = 10 * time.Second
+
+// sourceExecFunc returns the function running commands inside the running container of the
+// given name, the output it returns is stdout if the command succeeds, and stderr otherwise
+type sourceExecFunc func(name config.ContainerName) (execFunc, error)
+
+// envFromExec runs the env_from_exec commands of the container inside its dependencies and returns
+// the env given to docker with the vars set to the trimmed outputs, overriding the ones of "env".
+// The values are not logged, since they are usually secrets.
+func envFromExec(container *Container, env []string, source sourceExecFunc) ([]string, error) {
+	if len(container.Config.EnvFromExec) == 0 {
+		return env, nil
+	}
+
+	values := map[string]string{}
+	for _, envFrom := range container.Config.EnvFromExec {
+		log.Infof("Getting %s for %s from %s: %s", envFrom.Var, container.Name, envFrom.Container,
+			strings.Join(envFrom.Command, " "))
+
+		exec, err := source(envFrom.Container)
+		if err != nil {
+			return nil, err
+		}
+
+		exitCode, output, err := execWithTimeout(exec, envFrom.Command, envFromExecTimeout)
+		if err == nil && exitCode != 0 {
+			err = fmt.Errorf("exited with code %d, output: %s", exitCode, strings.TrimSpace(output))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Container %s: env_from_exec %s in %s failed, error: %s",
+				container.Name, envFrom.Var, envFrom.Container, err)
+		}
+		values[envFrom.Var] = strings.TrimSpace(output)
+	}
+
+	result := []string{}
+	for _, kv := range env {
+		if _, ok := values[strings.SplitN(kv, "=", 2)[0]]; !ok {
+			result = append(result, kv)
+		}
+	}
+	for _, envFrom := range container.Config.EnvFromExec {
+		result = append(result, envFrom.Var+"="+values[envFrom.Var])
+	}
+	return result, nil
+}
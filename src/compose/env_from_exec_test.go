@@ -0,0 +1,99 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEnvFromExecContainer(envFrom ...config.EnvFromExec) *Container {
+	return &Container{
+		Name:   config.NewContainerName("test", "app"),
+		Config: &config.Container{EnvFromExec: envFrom},
+	}
+}
+
+// fakeSource returns the source exec of containers that print the values of the given
+// map from "name cmd" keys, the other commands fail with exit code 1
+func fakeSource(outputs map[string]string, ran *[]string) sourceExecFunc {
+	return func(name config.ContainerName) (execFunc, error) {
+		if name.Name == "stopped" {
+			return nil, fmt.Errorf("Container %s is not running, cannot exec env_from_exec command in it", name)
+		}
+		return func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+			key := fmt.Sprintf("%s %v", name, cmd)
+			*ran = append(*ran, key)
+			if output, ok := outputs[key]; ok {
+				return 0, output, nil
+			}
+			return 1, "permission denied\n", nil
+		}, nil
+	}
+}
+
+func TestEnvFromExec(t *testing.T) {
+	ran := []string{}
+	source := fakeSource(map[string]string{
+		"test.vault [vault read db]": "s3cret\n",
+		"test.auth [auth token]":     "  abc  ",
+	}, &ran)
+	container := newEnvFromExecContainer(
+		config.EnvFromExec{Container: *config.NewContainerName("test", "vault"), Command: config.Strings{"vault", "read", "db"}, Var: "DB_PASSWORD"},
+		config.EnvFromExec{Container: *config.NewContainerName("test", "auth"), Command: config.Strings{"auth", "token"}, Var: "TOKEN"},
+	)
+
+	env, err := envFromExec(container, []string{"DB_PASSWORD=default", "PORT=80"}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"PORT=80", "DB_PASSWORD=s3cret", "TOKEN=abc"}, env)
+	assert.Equal(t, []string{"test.vault [vault read db]", "test.auth [auth token]"}, ran)
+}
+
+func TestEnvFromExecNone(t *testing.T) {
+	env, err := envFromExec(newEnvFromExecContainer(), []string{"PORT=80"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"PORT=80"}, env)
+}
+
+func TestEnvFromExecFails(t *testing.T) {
+	ran := []string{}
+	container := newEnvFromExecContainer(
+		config.EnvFromExec{Container: *config.NewContainerName("test", "vault"), Command: config.Strings{"vault", "read", "db"}, Var: "DB_PASSWORD"},
+	)
+
+	_, err := envFromExec(container, nil, fakeSource(map[string]string{}, &ran))
+	assert.EqualError(t, err, "Container test.app: env_from_exec DB_PASSWORD in test.vault failed, error: "+
+		"exited with code 1, output: permission denied")
+}
+
+func TestEnvFromExecSourceNotRunning(t *testing.T) {
+	ran := []string{}
+	container := newEnvFromExecContainer(
+		config.EnvFromExec{Container: *config.NewContainerName("test", "stopped"), Command: config.Strings{"cat", "token"}, Var: "TOKEN"},
+	)
+
+	_, err := envFromExec(container, nil, fakeSource(map[string]string{}, &ran))
+	assert.EqualError(t, err, "Container test.stopped is not running, cannot exec env_from_exec command in it")
+	assert.Empty(t, ran)
+}
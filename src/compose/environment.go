@@ -0,0 +1,52 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import "fmt"
+
+// scopeEnvironment returns the actual containers that belong to the environment,
+// so containers of other environments sharing the host are neither removed nor
+// recreated. Containers deployed without an environment belong to none of them, they
+// are only in scope of the runs without environment. It fails if an expected container
+// has the same name as an existing one out of scope.
+func scopeEnvironment(env string, expected, actual []*Container) ([]*Container, error) {
+	scoped := []*Container{}
+
+	for _, a := range actual {
+		if a.Environment == env {
+			scoped = append(scoped, a)
+			continue
+		}
+		for _, e := range expected {
+			if !e.IsSameKind(a) {
+				continue
+			}
+			if a.Environment == "" {
+				return nil, fmt.Errorf("Container %s was deployed without environment, cannot deploy it to %q, remove it first",
+					a.Name, env)
+			}
+			if env == "" {
+				return nil, fmt.Errorf("Container %s belongs to environment %q, it is deployed with --environment %s only",
+					a.Name, a.Environment, a.Environment)
+			}
+			return nil, fmt.Errorf("Container %s belongs to environment %q, cannot deploy it to %q",
+				a.Name, a.Environment, env)
+		}
+	}
+
+	return scoped, nil
+}
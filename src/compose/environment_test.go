@@ -0,0 +1,133 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newEnvContainer(name, env string) *Container {
+	container := newContainer("test", name)
+	container.Environment = env
+	return container
+}
+
+func TestScopeEnvironment(t *testing.T) {
+	web := newEnvContainer("web", "staging")
+	worker := newEnvContainer("worker", "prod")
+	legacy := newEnvContainer("legacy", "")
+
+	scoped, err := scopeEnvironment("staging", []*Container{newContainer("test", "web")}, []*Container{web, worker, legacy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*Container{web}, scoped, "containers deployed without environment should be out of scope")
+
+	// containers deployed without environment see only the unlabeled ones
+	scoped, err = scopeEnvironment("", []*Container{}, []*Container{web, worker, legacy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*Container{legacy}, scoped)
+
+	_, err = scopeEnvironment("staging", []*Container{newContainer("test", "worker")}, []*Container{worker})
+	assert.EqualError(t, err, `Container test.worker belongs to environment "prod", cannot deploy it to "staging"`)
+
+	_, err = scopeEnvironment("staging", []*Container{newContainer("test", "legacy")}, []*Container{legacy})
+	assert.EqualError(t, err, `Container test.legacy was deployed without environment, cannot deploy it to "staging", remove it first`)
+
+	_, err = scopeEnvironment("", []*Container{newContainer("test", "worker")}, []*Container{worker})
+	assert.EqualError(t, err, `Container test.worker belongs to environment "prod", it is deployed with --environment prod only`)
+}
+
+func TestApplyEnvironmentRemove(t *testing.T) {
+	manifest, err := config.New("test", map[string]*config.Container{}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := newEnvContainer("web", "staging")
+	worker := newEnvContainer("worker", "prod")
+	legacy := newEnvContainer("legacy", "")
+
+	client := &clientMock{actual: []*Container{web, worker, legacy}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("RemoveContainer", web).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{Remove: true, Environment: "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "RemoveContainer", worker)
+	client.AssertNotCalled(t, "RemoveContainer", legacy)
+	assert.Len(t, result.Removed, 1)
+}
+
+func TestApplyEnvironmentConflict(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"worker": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &clientMock{actual: []*Container{newEnvContainer("worker", "prod")}}
+	client.On("GetContainers").Return(nil)
+
+	_, err = Apply(client, manifest, ApplyOptions{Environment: "staging"})
+	assert.EqualError(t, err, `Container test.worker belongs to environment "prod", cannot deploy it to "staging"`)
+	client.AssertNotCalled(t, "RemoveContainer", mock.Anything)
+	client.AssertNotCalled(t, "RunContainer", mock.Anything)
+}
+
+func TestCreateContainerOptionsEnvironment(t *testing.T) {
+	image := "ubuntu:14.04"
+	cfg, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := GetContainersFromConfig(cfg)[0]
+	container.Environment = "staging"
+
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "staging", opts.Config.Labels[config.DefaultLabelPrefix.Label(config.LabelEnvironment)])
+
+	actual, err := NewContainerFromDocker(&docker.Container{
+		Name:   "/test.main",
+		Config: &docker.Config{Image: opts.Config.Image, Labels: opts.Config.Labels},
+	}, config.DotNaming, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "staging", actual.Environment)
+}
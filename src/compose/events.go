@@ -0,0 +1,80 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import "github.com/grammarly/rocker-compose/src/compose/config"
+
+// EventType is the lifecycle transition of a container, see Event
+type EventType string
+
+// Lifecycle transitions of the containers reported to EventFunc
+const (
+	EventPulling  EventType = "pulling"
+	EventCreating EventType = "creating"
+	EventStarting EventType = "starting"
+	EventStopping EventType = "stopping"
+	EventRemoving EventType = "removing"
+	EventSkipped  EventType = "skipped"
+)
+
+// Event describes the lifecycle transition of a container which is about to happen,
+// the unchanged containers of the manifest are reported as skipped
+type Event struct {
+	Container *config.ContainerName
+	Type      EventType
+}
+
+// EventFunc is called with every lifecycle transition of the containers during the run, e.g. to
+// drive a UI. The actions of the plan may run in parallel, so it should be safe for concurrent use.
+type EventFunc func(event Event)
+
+// emit calls the function if it is set
+func (fn EventFunc) emit(container *Container, eventType EventType) {
+	if fn != nil {
+		fn(Event{Container: container.Name, Type: eventType})
+	}
+}
+
+// emitSkipped reports the expected containers which are not touched by the execution plan,
+// ensuring that a dependency exists does not change it
+func (fn EventFunc) emitSkipped(plan []Action, expected []*Container) {
+	if fn == nil {
+		return
+	}
+
+	touched := map[string]struct{}{}
+	WalkActions(plan, func(action Action) {
+		switch a := action.(type) {
+		case *runContainer:
+			touched[a.container.Name.String()] = struct{}{}
+		case *removeContainer:
+			touched[a.container.Name.String()] = struct{}{}
+		case *replaceContainer:
+			touched[a.container.Name.String()] = struct{}{}
+		case *startContainer:
+			touched[a.container.Name.String()] = struct{}{}
+		case *stopContainer:
+			touched[a.container.Name.String()] = struct{}{}
+		}
+	})
+
+	for _, container := range expected {
+		if _, ok := touched[container.Name.String()]; !ok {
+			fn.emit(container, EventSkipped)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	dtesting "github.com/fsouza/go-dockerclient/testing"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// eventRecorder collects the events as "<type> <container>" strings
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) record(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf("%s %s", event.Type, event.Container))
+}
+
+func newEventsTestClient(t *testing.T, recorder *eventRecorder) (*DockerClient, func()) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dockerCli, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dockerCli.PullImage(docker.PullImageOptions{Repository: "app:1.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(&DockerClient{Docker: dockerCli, OnEvent: recorder.record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server.Stop
+}
+
+func newEventsTestContainers(t *testing.T, names ...string) []*Container {
+	image := "app:1.0"
+	specs := map[string]*config.Container{}
+	for _, name := range names {
+		specs[name] = &config.Container{Image: &image}
+	}
+	cfg, err := config.New("test", specs, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return GetContainersFromConfig(cfg)
+}
+
+func TestEventsCreateAndStart(t *testing.T) {
+	recorder := &eventRecorder{}
+	client, stop := newEventsTestClient(t, recorder)
+	defer stop()
+
+	expected := newEventsTestContainers(t, "main")
+	plan, err := NewDiff("test").Diff(expected, []*Container{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDockerClientRunner(client).Run(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"creating test.main", "starting test.main"}, recorder.events)
+
+	// removal of the container
+	recorder.events = nil
+	if err := client.RemoveContainer(expected[0]); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"removing test.main"}, recorder.events)
+}
+
+func TestEventsParallel(t *testing.T) {
+	recorder := &eventRecorder{}
+	client, stop := newEventsTestClient(t, recorder)
+	defer stop()
+
+	containers := newEventsTestContainers(t, "api", "worker")
+	plan := []Action{NewStepAction(true,
+		NewRunContainerAction(containers[0]),
+		NewRunContainerAction(containers[1]),
+	)}
+	if err := NewDockerClientRunner(client).Run(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// the order of the containers running in parallel is not defined
+	assert.Len(t, recorder.events, 4)
+	for _, container := range containers {
+		creating := indexOf(recorder.events, "creating "+container.Name.String())
+		starting := indexOf(recorder.events, "starting "+container.Name.String())
+		assert.True(t, creating >= 0 && creating < starting, "%s should be created and then started: %v",
+			container.Name, recorder.events)
+	}
+}
+
+func TestEventsSkipped(t *testing.T) {
+	recorder := &eventRecorder{}
+	containers := []*Container{
+		newContainer("test", "created"),
+		newContainer("test", "unchanged"),
+		newContainer("test", "stopped"),
+	}
+	plan := []Action{
+		NewEnsureContainerExistAction(containers[1]),
+		NewRunContainerAction(containers[0]),
+		NewStopContainerAction(containers[2]),
+	}
+
+	EventFunc(recorder.record).emitSkipped(plan, containers)
+	assert.Equal(t, []string{"skipped test.unchanged"}, recorder.events)
+
+	// no callback is fine
+	EventFunc(nil).emitSkipped(plan, containers)
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestApplyEventsSkipped(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := NewContainerFromConfig(config.NewContainerName("test", "main"), manifest.Containers["main"])
+	container.State.Running = true
+
+	client := &clientMock{actual: []*Container{container}}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	recorder := &eventRecorder{}
+	if _, err := Apply(client, manifest, ApplyOptions{OnEvent: recorder.record}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"skipped test.main"}, recorder.events)
+
+	// nothing is changed in dry run mode, so nothing is reported
+	recorder.events = nil
+	if _, err := Apply(client, manifest, ApplyOptions{OnEvent: recorder.record, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, recorder.events)
+}
@@ -0,0 +1,86 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// externalProbeTimeout limits a single attempt to reach an external service
+const externalProbeTimeout = 5 * time.Second
+
+// probeFunc makes a single attempt to reach the external service
+type probeFunc func(external config.External) error
+
+// waitExternal probes the external services given in "wait_for_external" one by one until
+// each of them is reachable. The error names the first service that is not reachable in time.
+func waitExternal(container *Container, probe probeFunc, sleep func(time.Duration)) error {
+	for _, external := range container.Config.WaitForExternal {
+		var (
+			timeout  = external.GetTimeout()
+			interval = external.GetInterval()
+			deadline = time.Now().Add(timeout)
+		)
+
+		log.Infof("Waiting for external service %s before starting %s", external, container.Name)
+
+		for {
+			err := probe(external)
+			if err == nil {
+				break
+			}
+			if !time.Now().Add(interval).Before(deadline) {
+				return fmt.Errorf("Container %s: external service %s is unreachable after %s, last error: %s",
+					container.Name, external, timeout, err)
+			}
+			log.Debugf("External service %s is unreachable: %s", external, err)
+			sleep(interval)
+		}
+	}
+	return nil
+}
+
+// probeExternal opens a TCP connection to the host and port of the external service or,
+// if url is given, expects HTTP GET of it to respond with a non-error status code
+func probeExternal(external config.External) error {
+	if external.URL == "" {
+		conn, err := net.DialTimeout("tcp", external.String(), externalProbeTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{Timeout: externalProbeTimeout}
+	resp, err := client.Get(external.URL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("responded with status %s", resp.Status)
+	}
+	return nil
+}
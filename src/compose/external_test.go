@@ -0,0 +1,111 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newExternalContainer(externals ...config.External) *Container {
+	timeout := config.Duration(100 * time.Millisecond)
+	interval := config.Duration(10 * time.Millisecond)
+	for i := range externals {
+		externals[i].Timeout = &timeout
+		externals[i].Interval = &interval
+	}
+	return &Container{
+		Name:   &config.ContainerName{Namespace: "test", Name: "main"},
+		Config: &config.Container{WaitForExternal: externals},
+	}
+}
+
+func listenerAddress(t *testing.T, listener net.Listener) (string, int) {
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, portNum
+}
+
+func TestWaitExternalTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	host, port := listenerAddress(t, listener)
+	container := newExternalContainer(config.External{Host: host, Port: port})
+
+	assert.NoError(t, waitExternal(container, probeExternal, time.Sleep))
+}
+
+func TestWaitExternalTCPUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := listenerAddress(t, listener)
+	listener.Close()
+
+	container := newExternalContainer(config.External{Host: host, Port: port})
+
+	err = waitExternal(container, probeExternal, time.Sleep)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Container test.main: external service "+listener.Addr().String()+" is unreachable after 100ms")
+}
+
+func TestWaitExternalHTTP(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	container := newExternalContainer(config.External{URL: server.URL + "/health"})
+
+	assert.NoError(t, waitExternal(container, probeExternal, time.Sleep))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWaitExternalHTTPFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	container := newExternalContainer(config.External{URL: server.URL})
+
+	err := waitExternal(container, probeExternal, time.Sleep)
+	assert.EqualError(t, err, "Container test.main: external service "+server.URL+
+		" is unreachable after 100ms, last error: responded with status 503 Service Unavailable")
+}
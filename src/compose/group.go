@@ -0,0 +1,36 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+// changedGroups returns the names of the groups (see "group" property of the container spec)
+// in which at least one container is going to be created or recreated. The other containers
+// of these groups are recreated as well, so the group is always updated as a unit.
+func changedGroups(expected []*Container, actual []*Container) map[string]struct{} {
+	groups := map[string]struct{}{}
+
+	for _, container := range expected {
+		group := container.Config.Group
+		if group == "" {
+			continue
+		}
+		if existing := find(actual, container.Name); existing == nil || !container.IsEqualTo(existing) {
+			groups[group] = struct{}{}
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,113 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newGroupContainer(name, group, cpuset string, dependencies ...config.ContainerName) *Container {
+	container := newContainer("test", name, dependencies...)
+	container.Config.Group = group
+	container.Config.CpusetCpus = &cpuset
+	return container
+}
+
+func runGroupDiff(t *testing.T, expected, actual []*Container) *clientMock {
+	actions, err := NewDiff("test").Diff(expected, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &clientMock{}
+	client.On("RemoveContainer", mock.Anything).Return(nil)
+	client.On("RunContainer", mock.Anything).Return(nil)
+	if err := NewDockerClientRunner(client).Run(actions); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDiffGroupRecreatedTogether(t *testing.T) {
+	app := config.ContainerName{Namespace: "test", Name: "app"}
+
+	// proxy depends on app, a change of proxy does not recreate app by dependency
+	expected := []*Container{
+		newGroupContainer("app", "web", "0"),
+		newGroupContainer("proxy", "web", "1", app),
+		newGroupContainer("db", "", "0"),
+	}
+	actual := []*Container{
+		newGroupContainer("app", "web", "0"),
+		newGroupContainer("proxy", "web", "0", app),
+		newGroupContainer("db", "", "0"),
+	}
+
+	client := runGroupDiff(t, expected, actual)
+
+	client.AssertCalled(t, "RemoveContainer", actual[0])
+	client.AssertCalled(t, "RemoveContainer", actual[1])
+	client.AssertNotCalled(t, "RemoveContainer", actual[2])
+	client.AssertNumberOfCalls(t, "RunContainer", 2)
+
+	// the group is recreated in the dependency order
+	run := []string{}
+	for _, call := range client.Calls {
+		if call.Method == "RunContainer" {
+			run = append(run, call.Arguments.Get(0).(*Container).Name.Name)
+		}
+	}
+	assert.Equal(t, []string{"app", "proxy"}, run)
+}
+
+func TestDiffGroupNewMember(t *testing.T) {
+	expected := []*Container{
+		newGroupContainer("app", "web", "0"),
+		newGroupContainer("worker", "web", "0"),
+	}
+	actual := []*Container{
+		newGroupContainer("app", "web", "0"),
+	}
+
+	client := runGroupDiff(t, expected, actual)
+
+	client.AssertCalled(t, "RemoveContainer", actual[0])
+	client.AssertNumberOfCalls(t, "RunContainer", 2)
+}
+
+func TestDiffGroupUnchanged(t *testing.T) {
+	expected := []*Container{
+		newGroupContainer("app", "web", "0"),
+		newGroupContainer("proxy", "web", "0"),
+		newGroupContainer("db", "", "1"),
+	}
+	actual := []*Container{
+		newGroupContainer("app", "web", "0"),
+		newGroupContainer("proxy", "web", "0"),
+		newGroupContainer("db", "", "0"),
+	}
+
+	client := runGroupDiff(t, expected, actual)
+
+	client.AssertCalled(t, "RemoveContainer", actual[2])
+	client.AssertNumberOfCalls(t, "RemoveContainer", 1)
+	client.AssertNumberOfCalls(t, "RunContainer", 1)
+}
@@ -0,0 +1,62 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// VerifyIdempotent checks that every container of the manifest is considered up to date
+// when it is read back from docker right after it was created, i.e. applying the same manifest
+// twice results in no changes on the second run. It catches the properties for which
+// NewContainerFromDocker is not the inverse of CreateContainerOptions.
+func VerifyIdempotent(manifest *config.Config) error {
+	for _, expected := range GetContainersFromConfig(manifest) {
+		actual, err := readBack(expected)
+		if err != nil {
+			return err
+		}
+		if !expected.Config.IsEqualTo(actual.Config) {
+			return fmt.Errorf("Container %s: property '%s' differs after the container is read back from docker",
+				expected.Name, expected.Config.LastCompareField())
+		}
+		if !expected.IsEqualTo(actual) {
+			return fmt.Errorf("Container %s: differs from itself after it is read back from docker", expected.Name)
+		}
+	}
+	return nil
+}
+
+// readBack returns the container as it is given by the docker api after it was created
+// and started (unless its state is "created") with the options of the given container
+func readBack(container *Container) (*Container, error) {
+	opts, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to make create options for container %s, error: %s", container.Name, err)
+	}
+
+	return NewContainerFromDocker(&docker.Container{
+		ID:         opts.Config.Labels[config.DefaultLabelPrefix.Label(config.LabelID)],
+		Name:       "/" + opts.Name,
+		Config:     opts.Config,
+		HostConfig: opts.HostConfig,
+		State:      docker.State{Running: container.State.Running},
+	}, container.naming, config.DefaultLabelPrefix)
+}
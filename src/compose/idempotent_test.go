@@ -0,0 +1,86 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVerifyIdempotent(t *testing.T) {
+	cfg, err := config.NewFromFile("config/testdata/compose.yml", containerTestVars, map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, VerifyIdempotent(cfg))
+}
+
+func TestApplyTwiceNoChanges(t *testing.T) {
+	image := "nginx:1.9"
+	memory := config.Memory(64 * 1024 * 1024)
+	manifest, err := config.New("test", map[string]*config.Container{
+		"web": &config.Container{
+			Image:   &image,
+			Memory:  &memory,
+			Env:     config.StringMap{"PORT": "80"},
+			Ports:   config.Ports{{Port: "80/tcp", HostPort: "8080"}},
+			Volumes: config.Strings{"/opt/nginx:/etc/nginx:ro", "/var/cache/nginx"},
+			Links:   config.Links{{ContainerName: config.ContainerName{Namespace: "test", Name: "db"}, Alias: "db"}},
+		},
+		"db": &config.Container{
+			Image:   &image,
+			Ulimits: []config.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+		},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := []*Container{}
+
+	client := &clientMock{}
+	client.On("GetContainers").Return(nil)
+	client.On("FetchImages", mock.Anything, manifest.Vars).Return(nil)
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+	client.On("RunContainer", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		container, err := readBack(args.Get(0).(*Container))
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, container)
+	})
+
+	result, err := Apply(client, manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, result.Changed)
+	assert.Len(t, created, 2)
+
+	client.actual = created
+
+	if result, err = Apply(client, manifest, ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, result.Changed)
+	client.AssertNumberOfCalls(t, "RunContainer", 2)
+}
@@ -0,0 +1,56 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// imageCache keeps the results of image inspection by image id, so the image shared by
+// many containers is inspected once. Image ids are content addressable, so the cached
+// values never go stale.
+type imageCache struct {
+	inspect func(id string) (*docker.Image, error)
+	images  map[string]*docker.Image
+	mutex   sync.Mutex
+}
+
+// newImageCache makes a cache that inspects the images missing in it with the given function
+func newImageCache(inspect func(id string) (*docker.Image, error)) *imageCache {
+	return &imageCache{
+		inspect: inspect,
+		images:  map[string]*docker.Image{},
+	}
+}
+
+// get returns the inspected image by id, errors are not cached
+func (c *imageCache) get(id string) (*docker.Image, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if img, ok := c.images[id]; ok {
+		return img, nil
+	}
+	img, err := c.inspect(id)
+	if err != nil {
+		return nil, err
+	}
+	c.images[id] = img
+	return img, nil
+}
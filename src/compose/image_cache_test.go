@@ -0,0 +1,50 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageCache(t *testing.T) {
+	inspected := []string{}
+	cache := newImageCache(func(id string) (*docker.Image, error) {
+		inspected = append(inspected, id)
+		if id == "missing" {
+			return nil, docker.ErrNoSuchImage
+		}
+		return &docker.Image{ID: id}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		img, err := cache.get("123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "123", img.ID)
+	}
+
+	_, err := cache.get("missing")
+	assert.Equal(t, docker.ErrNoSuchImage, err)
+	_, err = cache.get("missing")
+	assert.Equal(t, docker.ErrNoSuchImage, err)
+
+	assert.Equal(t, []string{"123", "missing", "missing"}, inspected)
+}
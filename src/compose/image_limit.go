@@ -0,0 +1,70 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import "sync"
+
+// imageLimitClient is a Client that limits the number of containers of the same image
+// started at the same time, so the containers sharing an image do not hit the shared
+// resources all at once even if the dependency graph allows it. Created containers are
+// started by RunContainer, so both it and StartContainer are limited.
+type imageLimitClient struct {
+	Client
+
+	limit int
+	mu    sync.Mutex
+	slots map[string]chan struct{} // by image
+}
+
+func newImageLimitClient(client Client, limit int) *imageLimitClient {
+	return &imageLimitClient{
+		Client: client,
+		limit:  limit,
+		slots:  map[string]chan struct{}{},
+	}
+}
+
+// RunContainer creates and starts the container once a slot of its image is free
+func (c *imageLimitClient) RunContainer(container *Container) error {
+	defer c.acquire(container)()
+	return c.Client.RunContainer(container)
+}
+
+// StartContainer starts the container once a slot of its image is free
+func (c *imageLimitClient) StartContainer(container *Container) error {
+	defer c.acquire(container)()
+	return c.Client.StartContainer(container)
+}
+
+// acquire waits for a free slot of the image of the container and returns the function releasing it
+func (c *imageLimitClient) acquire(container *Container) func() {
+	if container.Image == nil {
+		return func() {}
+	}
+
+	image := container.Image.String()
+	c.mu.Lock()
+	slots, ok := c.slots[image]
+	if !ok {
+		slots = make(chan struct{}, c.limit)
+		c.slots[image] = slots
+	}
+	c.mu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
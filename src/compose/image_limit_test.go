@@ -0,0 +1,93 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/grammarly/rocker/src/imagename"
+	"github.com/stretchr/testify/assert"
+)
+
+// startCountingClient counts the containers being started at the same time, by image
+type startCountingClient struct {
+	Client
+
+	mu      sync.Mutex
+	running map[string]int
+	max     map[string]int
+	total   int
+	maxAll  int
+}
+
+func (c *startCountingClient) start(container *Container) error {
+	image := container.Image.String()
+
+	c.mu.Lock()
+	c.running[image]++
+	c.total++
+	if c.running[image] > c.max[image] {
+		c.max[image] = c.running[image]
+	}
+	if c.total > c.maxAll {
+		c.maxAll = c.total
+	}
+	c.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	c.running[image]--
+	c.total--
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *startCountingClient) RunContainer(container *Container) error   { return c.start(container) }
+func (c *startCountingClient) StartContainer(container *Container) error { return c.start(container) }
+
+func TestImageLimitClient(t *testing.T) {
+	counter := &startCountingClient{running: map[string]int{}, max: map[string]int{}}
+	client := newImageLimitClient(counter, 2)
+
+	actions := []Action{}
+	for i := 0; i < 6; i++ {
+		actions = append(actions, NewRunContainerAction(&Container{
+			Name:  config.NewContainerName("test", fmt.Sprintf("app%d", i)),
+			Image: imagename.NewFromString("app:1.0"),
+		}))
+	}
+	for i := 0; i < 2; i++ {
+		existing := &Container{
+			Name:  config.NewContainerName("test", fmt.Sprintf("worker%d", i)),
+			Image: imagename.NewFromString("worker:1.0"),
+		}
+		actions = append(actions, NewStartContainerAction(existing, existing))
+	}
+
+	if err := NewDockerClientRunner(client).Run([]Action{NewStepAction(true, actions...)}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, counter.max["app:1.0"], "should start no more than 2 containers of the image at once")
+	assert.Equal(t, 2, counter.max["worker:1.0"])
+	assert.True(t, counter.maxAll > 2, "containers of other images should not wait, got %d at once", counter.maxAll)
+}
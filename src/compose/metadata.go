@@ -0,0 +1,44 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// ParseMetadata parses "key=value" pairs of deployment metadata, such as git revision
+// or build time, which are added as labels to all created containers. The labels are
+// not the part of the container spec, so changing them does not recreate containers.
+// Keys with the prefix of the managed labels are rejected.
+func ParseMetadata(pairs []string, prefix config.LabelPrefix) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("Invalid metadata %q, expected key=value", pair)
+		}
+		if strings.HasPrefix(key, string(prefix)) {
+			return nil, fmt.Errorf("Invalid metadata %q, %s prefix is reserved", pair, prefix)
+		}
+		metadata[key] = parts[1]
+	}
+	return metadata, nil
+}
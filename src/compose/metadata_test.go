@@ -0,0 +1,45 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata([]string{"git.revision=abc123", "build.time=2016-01-01T00:00:00Z", "empty="}, config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]string{
+		"git.revision": "abc123",
+		"build.time":   "2016-01-01T00:00:00Z",
+		"empty":        "",
+	}, metadata)
+
+	_, err = ParseMetadata([]string{"git.revision"}, config.DefaultLabelPrefix)
+	assert.EqualError(t, err, `Invalid metadata "git.revision", expected key=value`)
+
+	_, err = ParseMetadata([]string{"rocker-compose-id=123"}, config.DefaultLabelPrefix)
+	assert.EqualError(t, err, `Invalid metadata "rocker-compose-id=123", rocker-compose- prefix is reserved`)
+
+	_, err = ParseMetadata([]string{"rocker-compose-id=123"}, "myorg-compose-")
+	assert.NoError(t, err, "the default prefix is not reserved if another one is used")
+}
@@ -0,0 +1,290 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics holds statistics of a single reconcile run. Container counters
+// are taken from the execution plan, durations are measured while it runs.
+type Metrics struct {
+	Namespace string
+	Created   int
+	Recreated int
+	Removed   int
+	Unchanged int
+	Duration  time.Duration
+	Success   bool
+	Actions   []ActionMetrics
+
+	mu sync.Mutex
+}
+
+// ActionMetrics describes an executed action of the plan
+type ActionMetrics struct {
+	Container string
+	Action    string
+	Duration  time.Duration
+	Failed    bool
+}
+
+// timedAction is a wrapper of the plan action that records its duration
+type timedAction struct {
+	Action
+	metrics *Metrics
+}
+
+// NewMetrics makes an empty metrics collector for the given namespace
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Namespace: namespace,
+		Actions:   []ActionMetrics{},
+	}
+}
+
+// Metrics returns the metrics of the last reconcile run, or nil if there was none
+func (compose *Compose) Metrics() *Metrics {
+	return compose.metrics
+}
+
+// countPlan fills container counters from the execution plan: containers that
+// are removed and run again are recreated, expected ones that are not run are unchanged
+func (m *Metrics) countPlan(plan []Action, expected []*Container) {
+	run := map[string]struct{}{}
+	removed := map[string]struct{}{}
+
+	WalkActions(plan, func(action Action) {
+		switch a := action.(type) {
+		case *runContainer:
+			run[a.container.Name.String()] = struct{}{}
+		case *removeContainer:
+			removed[a.container.Name.String()] = struct{}{}
+		case *replaceContainer:
+			run[a.container.Name.String()] = struct{}{}
+			removed[a.container.Name.String()] = struct{}{}
+		}
+	})
+
+	for name := range run {
+		if _, ok := removed[name]; ok {
+			m.Recreated++
+		} else {
+			m.Created++
+		}
+	}
+	for name := range removed {
+		if _, ok := run[name]; !ok {
+			m.Removed++
+		}
+	}
+	m.Unchanged = len(expected) - m.Created - m.Recreated
+}
+
+// instrument wraps actions of the plan, steps included, so their durations are recorded
+func (m *Metrics) instrument(actions []Action) []Action {
+	result := make([]Action, len(actions))
+	for i, action := range actions {
+		switch a := action.(type) {
+		case *stepAction:
+			result[i] = &stepAction{actions: m.instrument(a.actions), async: a.async}
+		case *noAction:
+			result[i] = a
+		default:
+			result[i] = &timedAction{Action: a, metrics: m}
+		}
+	}
+	return result
+}
+
+func (m *Metrics) record(action Action, duration time.Duration, err error) {
+	var (
+		container *Container
+		kind      string
+	)
+
+	switch a := action.(type) {
+	case *runContainer:
+		container, kind = a.container, "create"
+	case *removeContainer:
+		container, kind = a.container, "remove"
+	case *replaceContainer:
+		container, kind = a.container, "replace"
+	case *startContainer:
+		container, kind = a.container, "start"
+	case *stopContainer:
+		container, kind = a.container, "stop"
+	case *quiesceContainer:
+		container, kind = a.container, "quiesce"
+	case *unquiesceContainer:
+		container, kind = a.container, "unquiesce"
+	case *waitContainerAction:
+		container, kind = a.container, "wait"
+	case *ensureContainerExist:
+		container, kind = a.container, "ensure_exist"
+	case *ensureContainerState:
+		container, kind = a.container, "ensure_state"
+	default:
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Actions = append(m.Actions, ActionMetrics{
+		Container: container.Name.String(),
+		Action:    kind,
+		Duration:  duration,
+		Failed:    err != nil,
+	})
+}
+
+// Execute runs the wrapped action and records its duration
+func (a *timedAction) Execute(client Client) error {
+	start := time.Now()
+	err := a.Action.Execute(client)
+	a.metrics.record(a.Action, time.Since(start), err)
+	return err
+}
+
+// WriteTo writes metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	ns := `namespace="` + escapeLabel(m.Namespace) + `"`
+
+	buf.WriteString("# HELP rocker_compose_containers Number of containers by the action of the last reconcile run.\n")
+	buf.WriteString("# TYPE rocker_compose_containers gauge\n")
+	for _, c := range []struct {
+		outcome string
+		value   int
+	}{
+		{"created", m.Created},
+		{"recreated", m.Recreated},
+		{"removed", m.Removed},
+		{"unchanged", m.Unchanged},
+	} {
+		fmt.Fprintf(&buf, "rocker_compose_containers{%s,outcome=%q} %d\n", ns, c.outcome, c.value)
+	}
+
+	success := 0
+	if m.Success {
+		success = 1
+	}
+	buf.WriteString("# HELP rocker_compose_reconcile_success Whether the last reconcile run succeeded.\n")
+	buf.WriteString("# TYPE rocker_compose_reconcile_success gauge\n")
+	fmt.Fprintf(&buf, "rocker_compose_reconcile_success{%s} %d\n", ns, success)
+
+	buf.WriteString("# HELP rocker_compose_reconcile_duration_seconds Duration of the last reconcile run.\n")
+	buf.WriteString("# TYPE rocker_compose_reconcile_duration_seconds gauge\n")
+	fmt.Fprintf(&buf, "rocker_compose_reconcile_duration_seconds{%s} %g\n", ns, m.Duration.Seconds())
+
+	// the same action may be executed several times for a container, e.g. waiting
+	// for a dependency of different containers, so durations are summed up
+	durations := map[actionKey]time.Duration{}
+	keys := actionKeys{}
+	m.mu.Lock()
+	for _, a := range m.Actions {
+		key := actionKey{a.Container, a.Action}
+		if _, ok := durations[key]; !ok {
+			keys = append(keys, key)
+		}
+		durations[key] += a.Duration
+	}
+	m.mu.Unlock()
+
+	sort.Sort(keys)
+
+	buf.WriteString("# HELP rocker_compose_action_duration_seconds Duration of actions executed for the container during the last reconcile run.\n")
+	buf.WriteString("# TYPE rocker_compose_action_duration_seconds gauge\n")
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "rocker_compose_action_duration_seconds{%s,container=\"%s\",action=%q} %g\n",
+			ns, escapeLabel(key.container), key.action, durations[key].Seconds())
+	}
+
+	return buf.WriteTo(w)
+}
+
+// Push sends metrics to the Prometheus pushgateway at the given address,
+// grouped by the job name and the namespace
+func (m *Metrics) Push(gateway, job string) error {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	pushURL := fmt.Sprintf("%s/metrics/job/%s/namespace/%s",
+		strings.TrimRight(gateway, "/"), pathEscape(job), pathEscape(m.Namespace))
+
+	req, err := http.NewRequest("PUT", pushURL, &buf)
+	if err != nil {
+		return fmt.Errorf("Failed to push metrics to %s, error: %s", gateway, err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to push metrics to %s, error: %s", gateway, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Failed to push metrics to %s, unexpected status: %s", gateway, resp.Status)
+	}
+
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// actionKey identifies durations of the same action of the container, see WriteTo
+type actionKey struct{ container, action string }
+
+// actionKeys is sortable by the container and then by the action
+type actionKeys []actionKey
+
+func (keys actionKeys) Len() int {
+	return len(keys)
+}
+
+func (keys actionKeys) Less(i, j int) bool {
+	if keys[i].container != keys[j].container {
+		return keys[i].container < keys[j].container
+	}
+	return keys[i].action < keys[j].action
+}
+
+func (keys actionKeys) Swap(i, j int) {
+	keys[i], keys[j] = keys[j], keys[i]
+}
+
+// pathEscape escapes the string to be a segment of the url path, slashes included
+func pathEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
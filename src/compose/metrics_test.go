@@ -0,0 +1,121 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsCollect(t *testing.T) {
+	cpusetCpus1 := "0-2"
+	cpusetCpus2 := "0-4"
+	c1x := &Container{
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus1},
+	}
+	c1y := &Container{
+		State:  &ContainerState{Running: true},
+		Name:   &config.ContainerName{Namespace: "test", Name: "1"},
+		Config: &config.Container{CpusetCpus: &cpusetCpus2},
+	}
+	c2x := newContainer("test", "2")
+	c2y := newContainer("test", "2")
+	c3 := newContainer("test", "3")
+	c4 := newContainer("test", "4")
+
+	expected := []*Container{c1x, c2x, c3}
+	actions, err := NewDiff("test").Diff(expected, []*Container{c1y, c2y, c4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := NewMetrics("test")
+	metrics.countPlan(actions, expected)
+
+	assert.Equal(t, 1, metrics.Created)
+	assert.Equal(t, 1, metrics.Recreated)
+	assert.Equal(t, 1, metrics.Removed)
+	assert.Equal(t, 1, metrics.Unchanged)
+
+	client := &clientMock{}
+	client.On("RemoveContainer", c1y).Return(nil)
+	client.On("RemoveContainer", c4).Return(nil)
+	client.On("RunContainer", c1x).Return(nil)
+	client.On("RunContainer", c3).Return(nil)
+	if err := NewDockerClientRunner(client).Run(metrics.instrument(actions)); err != nil {
+		t.Fatal(err)
+	}
+	client.AssertExpectations(t)
+
+	recorded := map[string]bool{}
+	for _, a := range metrics.Actions {
+		recorded[a.Container+" "+a.Action] = a.Failed
+	}
+	assert.Equal(t, map[string]bool{
+		"test.1 remove": false,
+		"test.1 create": false,
+		"test.3 create": false,
+		"test.4 remove": false,
+	}, recorded)
+}
+
+func TestMetricsWriteTo(t *testing.T) {
+	metrics := NewMetrics("test")
+	metrics.Created = 2
+	metrics.Unchanged = 1
+	metrics.Success = true
+	metrics.Duration = 1500 * time.Millisecond
+	metrics.Actions = []ActionMetrics{
+		{Container: "test.main", Action: "create", Duration: 500 * time.Millisecond},
+		{Container: "test.db", Action: "wait", Duration: 100 * time.Millisecond},
+		{Container: "test.db", Action: "wait", Duration: 150 * time.Millisecond},
+	}
+
+	var buf bytes.Buffer
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `# HELP rocker_compose_containers Number of containers by the action of the last reconcile run.
+# TYPE rocker_compose_containers gauge
+rocker_compose_containers{namespace="test",outcome="created"} 2
+rocker_compose_containers{namespace="test",outcome="recreated"} 0
+rocker_compose_containers{namespace="test",outcome="removed"} 0
+rocker_compose_containers{namespace="test",outcome="unchanged"} 1
+# HELP rocker_compose_reconcile_success Whether the last reconcile run succeeded.
+# TYPE rocker_compose_reconcile_success gauge
+rocker_compose_reconcile_success{namespace="test"} 1
+# HELP rocker_compose_reconcile_duration_seconds Duration of the last reconcile run.
+# TYPE rocker_compose_reconcile_duration_seconds gauge
+rocker_compose_reconcile_duration_seconds{namespace="test"} 1.5
+# HELP rocker_compose_action_duration_seconds Duration of actions executed for the container during the last reconcile run.
+# TYPE rocker_compose_action_duration_seconds gauge
+rocker_compose_action_duration_seconds{namespace="test",container="test.db",action="wait"} 0.25
+rocker_compose_action_duration_seconds{namespace="test",container="test.main",action="create"} 0.5
+`, buf.String())
+}
+
+func TestMetricsPathEscape(t *testing.T) {
+	assert.Equal(t, "rocker-compose", pathEscape("rocker-compose"))
+	assert.Equal(t, "my%20job%2Fprod", pathEscape("my job/prod"))
+}
@@ -0,0 +1,139 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// selectContainers narrows the run of the namespace down to the expected containers named
+// in "only", the names are given with or without the namespace. The rest of the expected
+// containers are substituted with the existing ones of the namespace, so they are neither
+// removed nor changed unless a selected container they depend on is recreated. It returns
+// the new list of expected containers and the selected ones.
+func selectContainers(ns string, only []string, expected, actual []*Container) (_ []*Container, selected []*Container, err error) {
+	found := map[string]bool{}
+	for _, name := range only {
+		found[name] = false
+	}
+
+	for _, e := range expected {
+		for _, name := range []string{e.Name.Name, e.Name.String()} {
+			if _, ok := found[name]; ok {
+				found[name] = true
+				selected = append(selected, e)
+				break
+			}
+		}
+	}
+
+	for _, name := range only {
+		if !found[name] {
+			return nil, nil, fmt.Errorf("Container %s given to --only is not found in the manifest", name)
+		}
+	}
+
+	result := append([]*Container{}, selected...)
+
+nextActual:
+	for _, a := range actual {
+		if a.Name.Namespace != ns {
+			continue
+		}
+		for _, s := range selected {
+			if s.IsSameKind(a) {
+				continue nextActual
+			}
+		}
+		result = append(result, a)
+	}
+
+	return result, selected, nil
+}
+
+// lastFileHash returns the manifest hash the most recently created container of the
+// namespace was labeled with, that is the hash of the last full run. It is empty if
+// no container of the namespace was labeled so far.
+func lastFileHash(ns string, actual []*Container) string {
+	var last *Container
+	for _, a := range actual {
+		if a.Name.Namespace != ns || a.FileHash == "" {
+			continue
+		}
+		if last == nil || a.Created.After(last.Created) {
+			last = a
+		}
+	}
+	if last == nil {
+		return ""
+	}
+	return last.FileHash
+}
+
+// isApplied returns true if the expected containers that are not selected are the same
+// as the existing ones, that is the manifest has no changes left for them to apply
+func isApplied(expected, selected, actual []*Container) bool {
+nextExpected:
+	for _, e := range expected {
+		for _, s := range selected {
+			if s == e {
+				continue nextExpected
+			}
+		}
+		for _, a := range actual {
+			if e.IsEqualTo(a) {
+				continue nextExpected
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// labelFileHash labels the selected containers with the manifest hash. A full run labels
+// them with the hash of the manifest, while a partial one keeps the hash of the last
+// full run, so the changes left unapplied are reported by the next partial run as well.
+// Only the created containers get the label, so the hash is outdated if the last full run
+// left the containers as they were; the manifest is compared with them in that case.
+// It returns a warning if the manifest has changes that are not applied by the partial run.
+func labelFileHash(manifest *config.Config, partial bool, expected, selected, actual []*Container) (warning string, err error) {
+	hash, err := manifest.FileHash()
+	if err != nil {
+		return "", err
+	}
+
+	if partial {
+		last := lastFileHash(manifest.Namespace, actual)
+		switch {
+		case last == "" || last == hash:
+			hash = last
+		case isApplied(expected, selected, actual):
+			// the rest of the manifest is up to date, so the current hash is recorded
+		default:
+			warning = "The manifest has changed since the last full run, changes of the containers not given to --only are not applied"
+			hash = last
+		}
+	}
+
+	for _, container := range selected {
+		container.FileHash = hash
+	}
+
+	return warning, nil
+}
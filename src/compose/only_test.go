@@ -0,0 +1,177 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectContainers(t *testing.T) {
+	expected := []*Container{
+		newRollbackContainer("db", "", "1"),
+		newRollbackContainer("main", "", "1"),
+		newRollbackContainer("worker", "", "1"),
+		newRollbackContainer("cron", "", "1"),
+	}
+	actual := []*Container{
+		newRollbackContainer("db", "old-db", "0"),
+		newRollbackContainer("main", "old-main", "0"),
+		newRollbackContainer("old", "old-old", "0"),
+		newContainer("other", "db"),
+	}
+
+	result, selected, err := selectContainers("test", []string{"main", "test.worker"}, expected, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*Container{expected[1], expected[2]}, selected)
+	assert.Equal(t, []*Container{expected[1], expected[2], actual[0], actual[2]}, result,
+		"not selected containers should be substituted with the existing ones of the namespace")
+
+	_, _, err = selectContainers("test", []string{"main", "api"}, expected, actual)
+	assert.EqualError(t, err, "Container api given to --only is not found in the manifest")
+}
+
+func TestApplyOnly(t *testing.T) {
+	image := "ubuntu:14.04"
+	cpuset := "1"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"db": &config.Container{Image: &image, CpusetCpus: &cpuset},
+		"main": &config.Container{Image: &image, CpusetCpus: &cpuset,
+			Links: config.Links{config.Link{ContainerName: config.ContainerName{Name: "db"}, Alias: "db"}}},
+		"worker": &config.Container{Image: &image, CpusetCpus: &cpuset},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &journalMock{}
+	client.actual = []*Container{
+		newRollbackContainer("db", "old-db", "0"),
+		newRollbackContainer("main", "old-main", "0"),
+		newRollbackContainer("old", "old-old", "0"),
+	}
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+
+	result, err := Apply(client, manifest, ApplyOptions{Only: []string{"main", "worker"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, client.log, 3)
+	assert.Contains(t, client.log, "remove test.main id:old-main")
+	assert.Contains(t, client.log, "run test.main cpuset:1")
+	assert.Contains(t, client.log, "run test.worker cpuset:1")
+	assert.Len(t, result.Created, 2)
+	assert.Len(t, result.Removed, 1)
+
+	_, err = Apply(&journalMock{}, manifest, ApplyOptions{Only: []string{"main"}, Remove: true})
+	assert.EqualError(t, err, "--only cannot be used with --remove")
+}
+
+func TestLabelFileHash(t *testing.T) {
+	image := "ubuntu:14.04"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := manifest.FileHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newActual := func(hashes ...string) []*Container {
+		actual := []*Container{}
+		for i, hash := range hashes {
+			container := newContainer("test", "main")
+			container.Created = time.Unix(int64(i), 0)
+			container.FileHash = hash
+			actual = append(actual, container)
+		}
+		return actual
+	}
+
+	// full run labels with the current hash
+	container := NewContainerFromConfig(config.NewContainerName("test", "main"), manifest.Containers["main"])
+	selected := []*Container{container}
+	warning, err := labelFileHash(manifest, false, selected, selected, newActual("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, warning)
+	assert.Equal(t, hash, container.FileHash)
+
+	options, err := container.CreateContainerOptions(config.DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, hash, options.Config.Labels["rocker-compose-file-hash"])
+
+	// the container not given to --only differs from the existing one
+	drifted := newContainer("test", "worker")
+	hostname := "worker"
+	drifted.Config.Hostname = &hostname
+	worker := newContainer("test", "worker")
+
+	// partial run with the matching hash of the last full run
+	container = newContainer("test", "main")
+	selected = []*Container{container}
+	warning, err = labelFileHash(manifest, true, []*Container{container, drifted}, selected, append(newActual("other", hash), worker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, warning)
+	assert.Equal(t, hash, container.FileHash)
+
+	// partial run with the mismatched hash keeps the hash of the last full run
+	container = newContainer("test", "main")
+	selected = []*Container{container}
+	warning, err = labelFileHash(manifest, true, []*Container{container, drifted}, selected, append(newActual(hash, "other"), worker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, warning, "The manifest has changed since the last full run")
+	assert.Equal(t, "other", container.FileHash)
+
+	// the last full run left the containers as they were, so they were not labeled with the new hash
+	container = newContainer("test", "main")
+	selected = []*Container{container}
+	warning, err = labelFileHash(manifest, true, []*Container{container, newContainer("test", "worker")}, selected,
+		append(newActual(hash, "other"), worker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, warning, "the containers not given to --only are up to date")
+	assert.Equal(t, hash, container.FileHash)
+
+	// nothing to compare with
+	container = newContainer("test", "main")
+	selected = []*Container{container}
+	warning, err = labelFileHash(manifest, true, []*Container{container, drifted}, selected, newActual(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, warning)
+	assert.Empty(t, container.FileHash)
+}
@@ -0,0 +1,51 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// runPreStop runs the pre-stop command of the running container and waits for the
+// configured time after it. Failures of the command are only logged, so the container
+// is stopped anyway.
+func runPreStop(container *Container, exec execFunc, sleep func(time.Duration)) {
+	preStop := container.Config.PreStop
+	if preStop == nil || container.State == nil || !container.State.Running {
+		return
+	}
+
+	cmd := []string(preStop.Exec)
+	log.Infof("Running pre-stop hook of %s: %s", container.Name, strings.Join(cmd, " "))
+
+	exitCode, output, err := execWithTimeout(exec, cmd, preStop.GetTimeout())
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exited with code %d, output: %s", exitCode, strings.TrimSpace(output))
+	}
+	if err != nil {
+		log.Warnf("Pre-stop hook of %s failed, stopping anyway: %s", container.Name, err)
+	}
+
+	if wait := preStop.GetWait(); wait > 0 {
+		log.Infof("Waiting %s before stopping %s", wait, container.Name)
+		sleep(wait)
+	}
+}
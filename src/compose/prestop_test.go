@@ -0,0 +1,96 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPreStopContainer(running bool) *Container {
+	wait := config.Duration(15 * time.Second)
+	timeout := config.Duration(50 * time.Millisecond)
+	return &Container{
+		Name:  &config.ContainerName{Namespace: "test", Name: "main"},
+		State: &ContainerState{Running: running},
+		Config: &config.Container{
+			PreStop: &config.PreStop{
+				Exec:    config.Strings{"touch", "/tmp/draining"},
+				Wait:    &wait,
+				Timeout: &timeout,
+			},
+		},
+	}
+}
+
+func TestRunPreStop(t *testing.T) {
+	events := []string{}
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		assert.Equal(t, []string{"touch", "/tmp/draining"}, cmd)
+		events = append(events, "exec")
+		return 0, "", nil
+	}
+	sleep := func(d time.Duration) {
+		events = append(events, fmt.Sprintf("sleep %s", d))
+	}
+
+	runPreStop(newPreStopContainer(true), exec, sleep)
+	assert.Equal(t, []string{"exec", "sleep 15s"}, events)
+}
+
+func TestRunPreStopFailOpen(t *testing.T) {
+	slept := time.Duration(0)
+	sleep := func(d time.Duration) { slept = d }
+
+	// failed command still waits before stopping
+	runPreStop(newPreStopContainer(true), func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		return 1, "no such file", nil
+	}, sleep)
+	assert.Equal(t, 15*time.Second, slept)
+
+	// hanging command is given up after the timeout
+	slept = 0
+	start := time.Now()
+	runPreStop(newPreStopContainer(true), func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		time.Sleep(time.Second)
+		return 0, "", nil
+	}, sleep)
+	assert.True(t, time.Since(start) < time.Second, "pre-stop hook should time out")
+	assert.Equal(t, 15*time.Second, slept)
+
+	slept = 0
+	runPreStop(newPreStopContainer(true), func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		return 0, "", fmt.Errorf("Failed to create exec")
+	}, sleep)
+	assert.Equal(t, 15*time.Second, slept)
+}
+
+func TestRunPreStopNotRunning(t *testing.T) {
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		t.Fatal("pre-stop hook should not run for stopped containers")
+		return 0, "", nil
+	}
+	sleep := func(d time.Duration) {
+		t.Fatal("should not wait for stopped containers")
+	}
+
+	runPreStop(newPreStopContainer(false), exec, sleep)
+}
@@ -0,0 +1,45 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// runHook runs the hook command inside the running container, unlike pre_stop the failures
+// are returned, so the recreation is aborted if the container cannot be quiesced
+func runHook(container *Container, name string, hook *config.Hook, exec execFunc) error {
+	if hook == nil || container.State == nil || !container.State.Running {
+		return nil
+	}
+
+	cmd := []string(hook.Exec)
+	log.Infof("Running %s hook of %s: %s", name, container.Name, strings.Join(cmd, " "))
+
+	exitCode, output, err := execWithTimeout(exec, cmd, hook.GetTimeout())
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exited with code %d, output: %s", exitCode, strings.TrimSpace(output))
+	}
+	if err != nil {
+		return fmt.Errorf("Container %s: %s hook failed, error: %s", container.Name, name, err)
+	}
+	return nil
+}
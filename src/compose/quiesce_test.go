@@ -0,0 +1,203 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookMock is a journalMock that also logs the quiesce hooks, the hook or the removal of the container
+// described as fail (e.g. "quiesce test.main id:old-main" or "remove test.main id:old-main") fail
+type hookMock struct {
+	journalMock
+	failHook string
+}
+
+func (m *hookMock) RemoveContainer(container *Container) error {
+	m.journalMock.RemoveContainer(container)
+	if entry := fmt.Sprintf("remove %s id:%s", container.Name, container.ID); entry == m.failHook {
+		return fmt.Errorf("Failed to remove container %s, error: device or resource busy", container.Name)
+	}
+	return nil
+}
+
+func (m *hookMock) QuiesceContainer(container *Container) error {
+	return m.hook("quiesce", container)
+}
+
+func (m *hookMock) UnquiesceContainer(container *Container) error {
+	return m.hook("unquiesce", container)
+}
+
+func (m *hookMock) hook(name string, container *Container) error {
+	entry := fmt.Sprintf("%s %s id:%s", name, container.Name, container.ID)
+	m.log = append(m.log, entry)
+	if entry == m.failHook {
+		return fmt.Errorf("Container %s: %s hook failed, error: exited with code 1", container.Name, name)
+	}
+	return nil
+}
+
+func newHookManifest(t *testing.T, strategy string) *config.Config {
+	image := "worker:1.0"
+	cpuset := "1"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image, CpusetCpus: &cpuset, RecreateStrategy: strategy,
+			Unquiesce: &config.Hook{Exec: config.Strings{"worker", "resume"}}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func newHookClient(failRun, failHook string) *hookMock {
+	existing := newRollbackContainer("main", "old-main", "0")
+	existing.Config.Quiesce = &config.Hook{Exec: config.Strings{"worker", "pause"}}
+	existing.Config.Unquiesce = &config.Hook{Exec: config.Strings{"worker", "resume"}}
+
+	client := &hookMock{journalMock: journalMock{fail: failRun}, failHook: failHook}
+	client.actual = []*Container{existing}
+	client.On("GetPulledImages").Return()
+	client.On("GetRemovedImages").Return()
+	return client
+}
+
+func TestApplyQuiesceStopFirst(t *testing.T) {
+	client := newHookClient("", "")
+	if _, err := Apply(client, newHookManifest(t, ""), ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"quiesce test.main id:old-main",
+		"remove test.main id:old-main",
+		"run test.main cpuset:1",
+		"unquiesce test.main id:new1",
+	}, client.log)
+}
+
+func TestApplyQuiesceStartFirst(t *testing.T) {
+	client := newHookClient("", "")
+	if _, err := Apply(client, newHookManifest(t, config.RecreateStartFirst), ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"quiesce test.main id:old-main",
+		"rename test.main id:old-main to test.main_replaced",
+		"run test.main cpuset:1",
+		"remove test.main id:old-main",
+		"unquiesce test.main id:new1",
+	}, client.log)
+}
+
+func TestApplyQuiesceFailed(t *testing.T) {
+	client := newHookClient("", "quiesce test.main id:old-main")
+	_, err := Apply(client, newHookManifest(t, ""), ApplyOptions{})
+	assert.EqualError(t, err, "Execution failed with, error: Container test.main: quiesce hook failed, error: exited with code 1")
+
+	// the existing container is not left quiesced and not recreated
+	assert.Equal(t, []string{
+		"quiesce test.main id:old-main",
+		"unquiesce test.main id:old-main",
+	}, client.log)
+}
+
+func TestApplyQuiesceStartFirstRunFailed(t *testing.T) {
+	client := newHookClient("test.main cpuset:1", "")
+	_, err := Apply(client, newHookManifest(t, config.RecreateStartFirst), ApplyOptions{})
+	assert.EqualError(t, err, "Execution failed with, error: Container test.main exited with code 1")
+
+	// the existing container is kept and put back to work without -rollback as well
+	assert.Equal(t, []string{
+		"quiesce test.main id:old-main",
+		"rename test.main id:old-main to test.main_replaced",
+		"run test.main cpuset:1",
+		"remove test.main id:new1",
+		"rename test.main id:old-main to test.main",
+		"unquiesce test.main id:old-main",
+	}, client.log)
+}
+
+func TestApplyQuiesceStopFirstRemoveFailed(t *testing.T) {
+	client := newHookClient("", "remove test.main id:old-main")
+	_, err := Apply(client, newHookManifest(t, ""), ApplyOptions{})
+	assert.EqualError(t, err, "Execution failed with, error: Failed to remove container test.main, error: device or resource busy")
+
+	assert.Equal(t, []string{
+		"quiesce test.main id:old-main",
+		"remove test.main id:old-main",
+		"unquiesce test.main id:old-main",
+	}, client.log)
+}
+
+func TestApplyQuiesceRollback(t *testing.T) {
+	client := newHookClient("test.main cpuset:1", "")
+	_, err := Apply(client, newHookManifest(t, config.RecreateStartFirst), ApplyOptions{Rollback: true})
+	assert.EqualError(t, err, "Execution failed with, error: Container test.main exited with code 1")
+
+	// the existing container gets its name back and is put back to work
+	assert.Equal(t, []string{
+		"quiesce test.main id:old-main",
+		"rename test.main id:old-main to test.main_replaced",
+		"run test.main cpuset:1",
+		"remove test.main id:new1",
+		"rename test.main id:old-main to test.main",
+		"unquiesce test.main id:old-main",
+		// rollback, the container is not unquiesced twice
+		"rename test.main id:old-main to test.main",
+	}, client.log)
+}
+
+func TestRunHook(t *testing.T) {
+	timeout := config.Duration(50 * time.Millisecond)
+	container := &Container{
+		Name:   &config.ContainerName{Namespace: "test", Name: "main"},
+		State:  &ContainerState{Running: true},
+		Config: &config.Container{},
+	}
+	hook := &config.Hook{Exec: config.Strings{"worker", "pause"}, Timeout: &timeout}
+
+	assert.NoError(t, runHook(container, "quiesce", hook, func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		assert.Equal(t, []string{"worker", "pause"}, cmd)
+		return 0, "", nil
+	}))
+
+	err := runHook(container, "quiesce", hook, func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		return 2, "queue is not reachable\n", nil
+	})
+	assert.EqualError(t, err, "Container test.main: quiesce hook failed, error: exited with code 2, output: queue is not reachable")
+
+	err = runHook(container, "quiesce", hook, func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		time.Sleep(time.Second)
+		return 0, "", nil
+	})
+	assert.EqualError(t, err, "Container test.main: quiesce hook failed, error: timed out after 50ms")
+
+	// not running containers and containers without the hook are skipped
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		t.Fatal("hook should not run")
+		return 0, "", nil
+	}
+	assert.NoError(t, runHook(container, "quiesce", nil, exec))
+	container.State.Running = false
+	assert.NoError(t, runHook(container, "quiesce", hook, exec))
+}
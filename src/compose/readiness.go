@@ -0,0 +1,184 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// execFunc runs the command inside a container and returns its exit code and output,
+// closing cancel makes it give up the command, see execWithTimeout
+type execFunc func(cmd []string, cancel <-chan struct{}) (exitCode int, output string, err error)
+
+// waitReadiness runs the readiness command of the container until it exits with zero code
+// or the number of attempts is exceeded. Every attempt is limited by the readiness timeout.
+func waitReadiness(container *Container, exec execFunc) error {
+	readiness := container.Config.Readiness
+	if readiness == nil {
+		return nil
+	}
+
+	var (
+		interval = readiness.GetInterval()
+		timeout  = readiness.GetTimeout()
+		retries  = readiness.GetRetries()
+		cmd      = []string(readiness.Exec)
+		lastErr  error
+	)
+
+	log.Infof("Waiting for %s to be ready: %s", container.Name, strings.Join(cmd, " "))
+
+	for attempt := 1; attempt <= retries; attempt++ {
+		if attempt > 1 {
+			time.Sleep(interval)
+		}
+
+		exitCode, output, err := execWithTimeout(exec, cmd, timeout)
+		if err == nil && exitCode == 0 {
+			log.Infof("Container %s is ready", container.Name)
+			return nil
+		}
+
+		if err == nil {
+			err = fmt.Errorf("exited with code %d, output: %s", exitCode, strings.TrimSpace(output))
+		}
+		lastErr = err
+
+		log.Debugf("Readiness probe of %s failed (attempt %d of %d): %s", container.Name, attempt, retries, err)
+	}
+
+	return fmt.Errorf("Container %s is not ready after %d attempts, readiness probe %s", container.Name, retries, lastErr)
+}
+
+// restartsFunc returns the number of times docker restarted the container and whether it is running now
+type restartsFunc func() (restartCount int, running bool, err error)
+
+// waitStable keeps running the readiness command of the container which is restarted on exit,
+// after it passed once, until it passes for the "stable" time without the container being
+// restarted. A crash looping container may pass a single probe while it happens to be up,
+// so it is caught here. Every failure starts the time over, the number of failures is limited
+// by the readiness retries.
+func waitStable(container *Container, exec execFunc, restarts restartsFunc) error {
+	readiness := container.Config.Readiness
+	if readiness == nil || !restartsOnExit(container.Config) {
+		return nil
+	}
+
+	var (
+		stable   = readiness.GetStable()
+		interval = readiness.GetInterval()
+		timeout  = readiness.GetTimeout()
+		retries  = readiness.GetRetries()
+		cmd      = []string(readiness.Exec)
+		failures = 0
+	)
+	if stable <= 0 {
+		return nil
+	}
+
+	restartCount, _, err := restarts()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Waiting for %s to stay ready for %s", container.Name, stable)
+
+	for since := time.Now(); time.Since(since) < stable; {
+		time.Sleep(interval)
+
+		count, running, err := restarts()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case count != restartCount:
+			err = fmt.Errorf("the container was restarted %d times", count-restartCount)
+			restartCount = count
+		case !running:
+			err = fmt.Errorf("the container is not running")
+		default:
+			err = probeReadiness(exec, cmd, timeout)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		failures++
+		if failures >= retries {
+			return fmt.Errorf("Container %s is not stable after %d failures, %s", container.Name, failures, err)
+		}
+		log.Debugf("Container %s is not stable yet (failure %d of %d): %s", container.Name, failures, retries, err)
+		since = time.Now()
+	}
+
+	log.Infof("Container %s is stable", container.Name)
+	return nil
+}
+
+// probeReadiness runs the readiness command once
+func probeReadiness(exec execFunc, cmd []string, timeout time.Duration) error {
+	exitCode, output, err := execWithTimeout(exec, cmd, timeout)
+	if err != nil {
+		return fmt.Errorf("readiness probe %s", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("readiness probe exited with code %d, output: %s", exitCode, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// restartsOnExit returns true if docker restarts the container after it exits, the running
+// containers without restart policy get "always", see config.Container.GetAPIHostConfig
+func restartsOnExit(container *config.Container) bool {
+	if container.Restart == nil {
+		return container.State.Bool()
+	}
+	return container.Restart.Name != "" && container.Restart.Name != "no"
+}
+
+// execWithTimeout calls the exec function and gives up waiting for it after the timeout,
+// then the exec is canceled, so its session does not outlive the wait
+func execWithTimeout(exec execFunc, cmd []string, timeout time.Duration) (int, string, error) {
+	type execResult struct {
+		exitCode int
+		output   string
+		err      error
+	}
+
+	// buffered, so the exec finishing after the timeout does not block on sending its result
+	done := make(chan execResult, 1)
+	cancel := make(chan struct{})
+	go func() {
+		exitCode, output, err := exec(cmd, cancel)
+		done <- execResult{exitCode, output, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.exitCode, result.output, result.err
+	case <-time.After(timeout):
+		close(cancel)
+		return 0, "", fmt.Errorf("timed out after %s", timeout)
+	}
+}
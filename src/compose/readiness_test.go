@@ -0,0 +1,212 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReadinessContainer(retries int) *Container {
+	interval := config.Duration(time.Millisecond)
+	timeout := config.Duration(50 * time.Millisecond)
+	return &Container{
+		Name: &config.ContainerName{Namespace: "test", Name: "main"},
+		Config: &config.Container{
+			Readiness: &config.Readiness{
+				Exec:     config.Strings{"pg_isready"},
+				Interval: &interval,
+				Timeout:  &timeout,
+				Retries:  &retries,
+			},
+		},
+	}
+}
+
+func TestWaitReadinessSuccess(t *testing.T) {
+	attempts := 0
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		assert.Equal(t, []string{"pg_isready"}, cmd)
+		attempts++
+		if attempts < 3 {
+			return 1, "no response", nil
+		}
+		return 0, "accepting connections", nil
+	}
+
+	assert.NoError(t, waitReadiness(newReadinessContainer(5), exec))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWaitReadinessFailure(t *testing.T) {
+	attempts := 0
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		attempts++
+		return 2, "no response\n", nil
+	}
+
+	err := waitReadiness(newReadinessContainer(3), exec)
+	assert.EqualError(t, err, "Container test.main is not ready after 3 attempts, readiness probe exited with code 2, output: no response")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWaitReadinessError(t *testing.T) {
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		return 0, "", fmt.Errorf("no such container")
+	}
+
+	err := waitReadiness(newReadinessContainer(1), exec)
+	assert.EqualError(t, err, "Container test.main is not ready after 1 attempts, readiness probe no such container")
+}
+
+func TestWaitReadinessTimeout(t *testing.T) {
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		time.Sleep(time.Second)
+		return 0, "", nil
+	}
+
+	err := waitReadiness(newReadinessContainer(1), exec)
+	assert.EqualError(t, err, "Container test.main is not ready after 1 attempts, readiness probe timed out after 50ms")
+}
+
+func newStableContainer(retries int, restart string) *Container {
+	container := newReadinessContainer(retries)
+	stable := config.Duration(20 * time.Millisecond)
+	container.Config.Readiness.Stable = &stable
+	if restart != "" {
+		container.Config.Restart = &config.RestartPolicy{Name: restart}
+	}
+	return container
+}
+
+func TestWaitStable(t *testing.T) {
+	probes := 0
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		probes++
+		return 0, "accepting connections", nil
+	}
+	restarts := func() (int, bool, error) {
+		return 2, true, nil
+	}
+
+	start := time.Now()
+	assert.NoError(t, waitStable(newStableContainer(3, ""), exec, restarts))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond, "should wait for the stable time")
+	assert.True(t, probes > 1, "should keep probing")
+}
+
+func TestWaitStableFlapping(t *testing.T) {
+	// the probe passes only every other time
+	probes := 0
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		probes++
+		if probes%2 == 0 {
+			return 1, "no response\n", nil
+		}
+		return 0, "accepting connections", nil
+	}
+	restarts := func() (int, bool, error) {
+		return 0, true, nil
+	}
+
+	err := waitStable(newStableContainer(3, "always"), exec, restarts)
+	assert.EqualError(t, err, "Container test.main is not stable after 3 failures, readiness probe exited with code 1, output: no response")
+}
+
+func TestWaitStableRestarting(t *testing.T) {
+	// the probe always passes, but docker keeps restarting the crashing container
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		return 0, "accepting connections", nil
+	}
+	count := 0
+	restarts := func() (int, bool, error) {
+		count++
+		return count, true, nil
+	}
+
+	err := waitStable(newStableContainer(2, "on-failure"), exec, restarts)
+	assert.EqualError(t, err, "Container test.main is not stable after 2 failures, the container was restarted 1 times")
+
+	// recovers after a couple of restarts
+	count = 0
+	restarts = func() (int, bool, error) {
+		if count < 3 {
+			count++
+		}
+		return count, true, nil
+	}
+	assert.NoError(t, waitStable(newStableContainer(5, "always"), exec, restarts))
+}
+
+func TestWaitStableNoRestart(t *testing.T) {
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		t.Fatal("should not probe containers that are not restarted")
+		return 0, "", nil
+	}
+	restarts := func() (int, bool, error) {
+		t.Fatal("should not inspect containers that are not restarted")
+		return 0, false, nil
+	}
+
+	assert.NoError(t, waitStable(newStableContainer(3, "no"), exec, restarts))
+
+	ran := config.State("ran")
+	container := newStableContainer(3, "")
+	container.Config.State = &ran
+	assert.NoError(t, waitStable(container, exec, restarts))
+
+	disabled := config.Duration(0)
+	container = newStableContainer(3, "always")
+	container.Config.Readiness.Stable = &disabled
+	assert.NoError(t, waitStable(container, exec, restarts))
+}
+
+func TestExecWithTimeoutCancels(t *testing.T) {
+	finished := make(chan struct{})
+	exec := func(cmd []string, cancel <-chan struct{}) (int, string, error) {
+		defer close(finished)
+		<-cancel
+		return 0, "", errStreamCanceled
+	}
+
+	_, _, err := execWithTimeout(exec, []string{"sleep", "60"}, 10*time.Millisecond)
+	assert.EqualError(t, err, "timed out after 10ms")
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("exec should be canceled after the timeout")
+	}
+}
+
+func TestCancelWriter(t *testing.T) {
+	var buf bytes.Buffer
+	cancel := make(chan struct{})
+	w := &cancelWriter{&buf, cancel}
+
+	_, err := w.Write([]byte("ok\n"))
+	assert.NoError(t, err)
+	close(cancel)
+	_, err = w.Write([]byte("late\n"))
+	assert.Equal(t, errStreamCanceled, err)
+	assert.Equal(t, "ok\n", buf.String())
+}
@@ -0,0 +1,198 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// rollbackClient is a Client that journals the changes made to containers while
+// the execution plan runs, so they can be reverted by rollback if the run fails.
+// The previous containers are snapshotted before they are removed, pinned to the image they ran.
+type rollbackClient struct {
+	Client
+
+	mu       sync.Mutex
+	created  []*Container          // containers created during the run, in order
+	previous []*Container          // snapshots of the removed containers which existed before the run
+	renamed  map[*Container]string // existing containers renamed during the run, by their names
+	started  []*Container
+	stopped  []*Container
+	quiesced []*Container // existing containers quiesced for recreation that were not removed yet
+}
+
+func newRollbackClient(client Client) *rollbackClient {
+	return &rollbackClient{
+		Client:  client,
+		renamed: map[*Container]string{},
+	}
+}
+
+// RunContainer journals the container if it is created, even if it failed to start
+func (r *rollbackClient) RunContainer(container *Container) error {
+	err := r.Client.RunContainer(container)
+	if container.ID != "" {
+		r.mu.Lock()
+		r.created = append(r.created, container)
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// RemoveContainer snapshots the container before removing it,
+// the containers created during the run are just forgotten
+func (r *rollbackClient) RemoveContainer(container *Container) error {
+	snapshot := *container
+	if err := r.Client.RemoveContainer(container); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, created := range r.created {
+		if created == container {
+			r.created = append(r.created[:i], r.created[i+1:]...)
+			return nil
+		}
+	}
+	snapshot.ID = ""
+	snapshot.pinned = true
+	r.previous = append(r.previous, &snapshot)
+	delete(r.renamed, container)
+	r.quiesced = withoutContainer(r.quiesced, container)
+	return nil
+}
+
+// RenameContainer journals the name the container had before the run
+func (r *rollbackClient) RenameContainer(container *Container, name string) error {
+	if err := r.Client.RenameContainer(container, name); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.renamed[container]; !ok {
+		r.renamed[container] = container.DockerName()
+	}
+	return nil
+}
+
+// StartContainer journals the started container
+func (r *rollbackClient) StartContainer(container *Container) error {
+	if err := r.Client.StartContainer(container); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.started = append(r.started, container)
+	r.mu.Unlock()
+	return nil
+}
+
+// StopContainer journals the stopped container
+func (r *rollbackClient) StopContainer(container *Container) error {
+	if err := r.Client.StopContainer(container); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.stopped = append(r.stopped, container)
+	r.mu.Unlock()
+	return nil
+}
+
+// QuiesceContainer journals the quiesced container, so it is unquiesced back if the run fails
+// before the container is removed
+func (r *rollbackClient) QuiesceContainer(container *Container) error {
+	if err := r.Client.QuiesceContainer(container); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.quiesced = append(r.quiesced, container)
+	r.mu.Unlock()
+	return nil
+}
+
+// UnquiesceContainer forgets the container unquiesced during the run
+func (r *rollbackClient) UnquiesceContainer(container *Container) error {
+	if err := r.Client.UnquiesceContainer(container); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.quiesced = withoutContainer(r.quiesced, container)
+	r.mu.Unlock()
+	return nil
+}
+
+// withoutContainer returns the list without the given container
+func withoutContainer(containers []*Container, container *Container) []*Container {
+	result := []*Container{}
+	for _, c := range containers {
+		if c != container {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// rollback reverts the journaled changes: the containers created during the run are removed
+// (dependent ones first), started and stopped ones get their state back, renamed ones their
+// names, quiesced ones are unquiesced, and the removed previous containers are recreated in
+// the order they were removed, which puts dependencies first. It tries to revert everything
+// and reports all failures.
+func (r *rollbackClient) rollback() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errors := []string{}
+	fail := func(err error) {
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	for i := len(r.created) - 1; i >= 0; i-- {
+		log.Infof("Rollback: removing container %s created during the run", r.created[i].Name)
+		fail(r.Client.RemoveContainer(r.created[i]))
+	}
+	for _, container := range r.started {
+		fail(r.Client.StopContainer(container))
+	}
+	for _, container := range r.stopped {
+		fail(r.Client.StartContainer(container))
+	}
+	for container, name := range r.renamed {
+		fail(r.Client.RenameContainer(container, name))
+	}
+	for _, container := range r.quiesced {
+		log.Infof("Rollback: unquiescing container %s", container.Name)
+		fail(r.Client.UnquiesceContainer(container))
+	}
+	for _, container := range r.previous {
+		log.Infof("Rollback: recreating the previous container %s", container.Name)
+		fail(r.Client.RunContainer(container))
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Rollback failed, error: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/grammarly/rocker/src/imagename"
+	"github.com/grammarly/rocker/src/template"
+	"github.com/stretchr/testify/assert"
+)
+
+// journalMock is a client that logs the changes made to containers, running the container
+// described as fail (e.g. "test.main cpuset:1" or "test.main app:latest") creates it but fails to start
+type journalMock struct {
+	clientMock
+	fail    string
+	log     []string
+	ids     int
+	images  []string // images the containers are created from, if they have any
+	imageID string   // image the tags point to, given to the containers by FetchImages
+}
+
+func (m *journalMock) GetContainers(global bool) ([]*Container, error) {
+	return m.actual, nil
+}
+
+func (m *journalMock) FetchImages(containers []*Container, vars template.Vars) error {
+	for _, container := range containers {
+		container.ImageID = m.imageID
+	}
+	return nil
+}
+
+func (m *journalMock) RunContainer(container *Container) error {
+	m.ids++
+	container.ID = fmt.Sprintf("new%d", m.ids)
+	run := fmt.Sprintf("%s cpuset:%s", container.Name, *container.Config.CpusetCpus)
+	m.log = append(m.log, "run "+run)
+	created := ""
+	if container.Image != nil {
+		created = fmt.Sprintf("%s %s", container.Name, container.createImage())
+		m.images = append(m.images, created)
+	}
+	if run == m.fail || (created != "" && created == m.fail) {
+		return fmt.Errorf("Container %s exited with code 1", container.Name)
+	}
+	return nil
+}
+
+func (m *journalMock) RemoveContainer(container *Container) error {
+	m.log = append(m.log, fmt.Sprintf("remove %s id:%s", container.Name, container.ID))
+	return nil
+}
+
+func (m *journalMock) RenameContainer(container *Container, name string) error {
+	m.log = append(m.log, fmt.Sprintf("rename %s id:%s to %s", container.Name, container.ID, name))
+	return nil
+}
+
+func (m *journalMock) StopContainer(container *Container) error {
+	m.log = append(m.log, fmt.Sprintf("stop %s id:%s", container.Name, container.ID))
+	return nil
+}
+
+func newRollbackContainer(name, id, cpuset string) *Container {
+	container := newContainer("test", name)
+	container.ID = id
+	container.Config.CpusetCpus = &cpuset
+	return container
+}
+
+func TestApplyRollback(t *testing.T) {
+	image := "ubuntu:14.04"
+	cpuset := "1"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"db": &config.Container{Image: &image, CpusetCpus: &cpuset},
+		"main": &config.Container{Image: &image, CpusetCpus: &cpuset,
+			Links: config.Links{config.Link{ContainerName: config.ContainerName{Name: "db"}, Alias: "db"}}},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newClient := func() *journalMock {
+		client := &journalMock{fail: "test.main cpuset:1"}
+		client.actual = []*Container{
+			newRollbackContainer("db", "old-db", "0"),
+			newRollbackContainer("main", "old-main", "0"),
+		}
+		return client
+	}
+
+	client := newClient()
+	_, err = Apply(client, manifest, ApplyOptions{Rollback: true})
+	assert.EqualError(t, err, "Execution failed with, error: Container test.main exited with code 1")
+
+	assert.Equal(t, []string{
+		"remove test.db id:old-db",
+		"run test.db cpuset:1",
+		"remove test.main id:old-main",
+		"run test.main cpuset:1",
+		// rollback
+		"remove test.main id:new2",
+		"remove test.db id:new1",
+		"run test.db cpuset:0",
+		"run test.main cpuset:0",
+	}, client.log)
+
+	// rollback is opt-in
+	client = newClient()
+	_, err = Apply(client, manifest, ApplyOptions{})
+	assert.Error(t, err)
+	assert.Len(t, client.log, 4)
+}
+
+func TestApplyRollbackImageUpdate(t *testing.T) {
+	image := "app:latest"
+	cpuset := "0"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"main": &config.Container{Image: &image, CpusetCpus: &cpuset},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tag points to the new image once it is pulled, which fails to start
+	client := &journalMock{fail: "test.main app:latest", imageID: "sha256:n3w"}
+	existing := newRollbackContainer("main", "old-main", "0")
+	existing.Image = imagename.NewFromString(image)
+	existing.ImageID = "sha256:0ld"
+	client.actual = []*Container{existing}
+
+	_, err = Apply(client, manifest, ApplyOptions{Rollback: true})
+	assert.EqualError(t, err, "Execution failed with, error: Container test.main exited with code 1")
+
+	assert.Equal(t, []string{
+		"test.main app:latest",
+		// rollback
+		"test.main sha256:0ld",
+	}, client.images, "the previous container should be recreated from the image it ran")
+}
+
+func TestRollbackClientReplaceAndStop(t *testing.T) {
+	client := &journalMock{}
+	journal := newRollbackClient(client)
+
+	existing := newRollbackContainer("app", "old-app", "0")
+	replacement := newRollbackContainer("app", "", "1")
+	worker := newRollbackContainer("worker", "old-worker", "0")
+
+	if err := NewReplaceContainerAction(existing, replacement).Execute(journal); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewStopContainerAction(worker).Execute(journal); err != nil {
+		t.Fatal(err)
+	}
+
+	client.log = nil
+	client.On("StartContainer", worker).Return(nil)
+
+	if err := journal.rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertCalled(t, "StartContainer", worker)
+	assert.Equal(t, []string{
+		"remove test.app id:new1",
+		"run test.app cpuset:0",
+	}, client.log, "the previous container should be recreated under its own name")
+}
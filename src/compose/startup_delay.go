@@ -0,0 +1,36 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// waitStartupDelay pauses after the container is started and ready, so dependent containers
+// are not started before it finishes initializing. It does not check anything, unlike the
+// readiness command, and is not applied to the containers with "ran" state.
+func waitStartupDelay(container *Container, sleep func(time.Duration)) {
+	delay := container.Config.StartupDelay.Get(0)
+	if delay <= 0 {
+		return
+	}
+
+	log.Infof("Waiting %s after start of %s before proceeding", delay, container.Name)
+	sleep(delay)
+}
@@ -0,0 +1,49 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitStartupDelay(t *testing.T) {
+	delay := config.Duration(3 * time.Second)
+	container := &Container{
+		Name:   &config.ContainerName{Namespace: "test", Name: "main"},
+		Config: &config.Container{StartupDelay: &delay},
+	}
+
+	slept := []time.Duration{}
+	waitStartupDelay(container, func(d time.Duration) { slept = append(slept, d) })
+
+	assert.Equal(t, []time.Duration{3 * time.Second}, slept)
+}
+
+func TestWaitStartupDelayNotGiven(t *testing.T) {
+	container := &Container{
+		Name:   &config.ContainerName{Namespace: "test", Name: "main"},
+		Config: &config.Container{},
+	}
+
+	waitStartupDelay(container, func(d time.Duration) {
+		t.Fatalf("Not expected to sleep, got %s", d)
+	})
+}
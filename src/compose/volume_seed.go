@@ -0,0 +1,118 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"path"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+)
+
+// seedTarget is the path the named volume is mounted to in the seed container
+const seedTarget = "/rocker-compose-seed"
+
+// seedAPI is the part of the docker client which is used to seed named volumes,
+// it is satisfied by docker.Client
+type seedAPI interface {
+	InspectVolume(name string) (*docker.Volume, error)
+	CreateVolume(opts docker.CreateVolumeOptions) (*docker.Volume, error)
+	RemoveVolume(name string) error
+	CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error)
+	StartContainer(id string, hostConfig *docker.HostConfig) error
+	WaitContainer(id string) (int, error)
+	RemoveContainer(opts docker.RemoveContainerOptions) error
+}
+
+// seedVolumes creates the named volumes of the mounts having "seed" which do not exist yet and
+// copies the contents of the seed image to them with a throwaway container. The existing volumes
+// are reused as is. If seeding fails, the new volume is removed, so it is seeded again next time
+// rather than reused half-populated. The seed image is pulled by the pull function if it is missing.
+func seedVolumes(container *Container, api seedAPI, pull func(image string) error) error {
+	for _, mount := range container.Config.Mounts {
+		if mount.Seed == "" {
+			continue
+		}
+
+		_, err := api.InspectVolume(mount.Volume)
+		if err == nil {
+			log.Debugf("Volume %s of %s exists, it is not seeded", mount.Volume, container.Name)
+			continue
+		}
+		if err != docker.ErrNoSuchVolume {
+			return fmt.Errorf("Failed to inspect volume %s, error: %s", mount.Volume, err)
+		}
+
+		log.Infof("Creating volume %s for %s seeded from %s:%s", mount.Volume, container.Name, mount.Seed, mount.GetSeedPath())
+		if _, err := api.CreateVolume(docker.CreateVolumeOptions{Name: mount.Volume}); err != nil {
+			return fmt.Errorf("Failed to create volume %s, error: %s", mount.Volume, err)
+		}
+
+		if err := copySeed(container, mount, api, pull); err != nil {
+			if rmErr := api.RemoveVolume(mount.Volume); rmErr != nil {
+				return fmt.Errorf("%s, also failed to remove the volume: %s", err, rmErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// copySeed runs the throwaway container of the seed image which copies the seed path to the volume
+func copySeed(container *Container, mount config.Mount, api seedAPI, pull func(image string) error) error {
+	opts := docker.CreateContainerOptions{
+		Config: &docker.Config{
+			Image:      mount.Seed,
+			Entrypoint: []string{"cp", "-a", path.Clean(mount.GetSeedPath()) + "/.", seedTarget},
+		},
+		HostConfig: &docker.HostConfig{
+			Binds: []string{mount.Volume + ":" + seedTarget},
+		},
+	}
+
+	seed, err := api.CreateContainer(opts)
+	if err == docker.ErrNoSuchImage {
+		if err := pull(mount.Seed); err != nil {
+			return fmt.Errorf("Failed to pull seed image %s, error: %s", mount.Seed, err)
+		}
+		seed, err = api.CreateContainer(opts)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to create container to seed volume %s, error: %s", mount.Volume, err)
+	}
+
+	defer func() {
+		if err := api.RemoveContainer(docker.RemoveContainerOptions{ID: seed.ID, Force: true}); err != nil {
+			log.Warnf("Failed to remove the seed container %.12s of volume %s, error: %s", seed.ID, mount.Volume, err)
+		}
+	}()
+
+	if err := api.StartContainer(seed.ID, opts.HostConfig); err != nil {
+		return fmt.Errorf("Failed to start container to seed volume %s, error: %s", mount.Volume, err)
+	}
+	exitCode, err := api.WaitContainer(seed.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to wait for container seeding volume %s, error: %s", mount.Volume, err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("Container %s: seeding volume %s from %s exited with code %d",
+			container.Name, mount.Volume, mount.Seed, exitCode)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// seedMock is the docker volume and container API that logs the calls,
+// seed containers exit with exitCode
+type seedMock struct {
+	volumes  map[string]bool
+	images   map[string]bool
+	exitCode int
+	log      []string
+}
+
+func (m *seedMock) InspectVolume(name string) (*docker.Volume, error) {
+	if !m.volumes[name] {
+		return nil, docker.ErrNoSuchVolume
+	}
+	return &docker.Volume{Name: name}, nil
+}
+
+func (m *seedMock) CreateVolume(opts docker.CreateVolumeOptions) (*docker.Volume, error) {
+	m.log = append(m.log, "create volume "+opts.Name)
+	m.volumes[opts.Name] = true
+	return &docker.Volume{Name: opts.Name}, nil
+}
+
+func (m *seedMock) RemoveVolume(name string) error {
+	m.log = append(m.log, "remove volume "+name)
+	delete(m.volumes, name)
+	return nil
+}
+
+func (m *seedMock) CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error) {
+	if !m.images[opts.Config.Image] {
+		return nil, docker.ErrNoSuchImage
+	}
+	m.log = append(m.log, fmt.Sprintf("create %s %s %s", opts.Config.Image,
+		strings.Join(opts.Config.Entrypoint, " "), strings.Join(opts.HostConfig.Binds, " ")))
+	return &docker.Container{ID: "seed1"}, nil
+}
+
+func (m *seedMock) StartContainer(id string, hostConfig *docker.HostConfig) error {
+	m.log = append(m.log, "start "+id)
+	return nil
+}
+
+func (m *seedMock) WaitContainer(id string) (int, error) {
+	return m.exitCode, nil
+}
+
+func (m *seedMock) RemoveContainer(opts docker.RemoveContainerOptions) error {
+	m.log = append(m.log, "remove "+opts.ID)
+	return nil
+}
+
+func newSeedContainer() *Container {
+	return &Container{
+		Name: &config.ContainerName{Namespace: "test", Name: "db"},
+		Config: &config.Container{
+			Mounts: []config.Mount{
+				{Volume: "db_data", Target: "/var/lib/postgresql/data", Seed: "db-fixtures:1.0"},
+				{Volume: "db_conf", Target: "/etc/db", Seed: "db-fixtures:1.0", SeedPath: "/fixtures/conf"},
+				{Volume: "cache", Target: "/cache"},
+			},
+		},
+	}
+}
+
+func TestSeedVolumesCreated(t *testing.T) {
+	api := &seedMock{volumes: map[string]bool{}, images: map[string]bool{}}
+	pulled := []string{}
+	pull := func(image string) error {
+		pulled = append(pulled, image)
+		api.images[image] = true
+		return nil
+	}
+
+	assert.NoError(t, seedVolumes(newSeedContainer(), api, pull))
+	assert.Equal(t, []string{"db-fixtures:1.0"}, pulled, "the seed image should be pulled once")
+	assert.Equal(t, []string{
+		"create volume db_data",
+		"create db-fixtures:1.0 cp -a /var/lib/postgresql/data/. /rocker-compose-seed db_data:/rocker-compose-seed",
+		"start seed1",
+		"remove seed1",
+		"create volume db_conf",
+		"create db-fixtures:1.0 cp -a /fixtures/conf/. /rocker-compose-seed db_conf:/rocker-compose-seed",
+		"start seed1",
+		"remove seed1",
+	}, api.log)
+
+	// the volumes exist now, so they are reused
+	api.log = nil
+	assert.NoError(t, seedVolumes(newSeedContainer(), api, pull))
+	assert.Empty(t, api.log)
+}
+
+func TestSeedVolumesExisting(t *testing.T) {
+	api := &seedMock{
+		volumes: map[string]bool{"db_data": true},
+		images:  map[string]bool{"db-fixtures:1.0": true},
+	}
+	pull := func(image string) error {
+		t.Fatal("the image should not be pulled")
+		return nil
+	}
+
+	assert.NoError(t, seedVolumes(newSeedContainer(), api, pull))
+	assert.Equal(t, []string{
+		"create volume db_conf",
+		"create db-fixtures:1.0 cp -a /fixtures/conf/. /rocker-compose-seed db_conf:/rocker-compose-seed",
+		"start seed1",
+		"remove seed1",
+	}, api.log, "only the missing volume should be seeded")
+}
+
+func TestSeedVolumesFailed(t *testing.T) {
+	api := &seedMock{
+		volumes:  map[string]bool{},
+		images:   map[string]bool{"db-fixtures:1.0": true},
+		exitCode: 1,
+	}
+
+	err := seedVolumes(newSeedContainer(), api, nil)
+	assert.EqualError(t, err, "Container test.db: seeding volume db_data from db-fixtures:1.0 exited with code 1")
+	assert.Equal(t, []string{
+		"create volume db_data",
+		"create db-fixtures:1.0 cp -a /var/lib/postgresql/data/. /rocker-compose-seed db_data:/rocker-compose-seed",
+		"start seed1",
+		"remove seed1",
+		"remove volume db_data",
+	}, api.log, "the half-populated volume should be removed")
+	assert.Empty(t, api.volumes)
+
+	// the seed image cannot be pulled
+	api = &seedMock{volumes: map[string]bool{}, images: map[string]bool{}}
+	err = seedVolumes(newSeedContainer(), api, func(image string) error {
+		return fmt.Errorf("not found")
+	})
+	assert.EqualError(t, err, "Failed to pull seed image db-fixtures:1.0, error: not found")
+	assert.Empty(t, api.volumes)
+}
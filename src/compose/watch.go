@@ -0,0 +1,128 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Watch keeps containers up to date with their images. Every interval it pulls images
+// of the manifest and applies it to the containers whose image tag resolves to a new
+// digest in the registry, as --only does, others are left intact. Recreations are confirmed
+// with compose.Confirm, so unattended watching needs it to be nil. Failed checks, e.g. because
+// of registry errors, are retried with the delay doubling up to maxBackoff, which is
+// 10 intervals if not given. Watch returns ErrCanceled when stop is closed.
+func (compose *Compose) Watch(stop <-chan struct{}, interval, maxBackoff time.Duration) error {
+	return compose.watch(stop, interval, maxBackoff, sleepCancel)
+}
+
+func (compose *Compose) watch(stop <-chan struct{}, interval, maxBackoff time.Duration, sleep func(<-chan struct{}, time.Duration) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("Watch interval should be positive, got %s", interval)
+	}
+	if maxBackoff == 0 {
+		maxBackoff = 10 * interval
+	}
+	if maxBackoff < interval {
+		maxBackoff = interval
+	}
+
+	pull, only := compose.Pull, compose.Only
+	defer func() {
+		compose.Pull, compose.Only = pull, only
+	}()
+
+	log.Infof("Watching images for updates every %s", interval)
+
+	delay := interval
+	for {
+		if err := sleep(stop, delay); err != nil {
+			return err
+		}
+
+		updated, err := compose.updatedContainers(only)
+		if err == nil && len(updated) > 0 {
+			// the images are already pulled
+			compose.Pull, compose.Only = false, updated
+			_, err = compose.reconcile(stop)
+			compose.Pull, compose.Only = pull, only
+		}
+		if err != nil {
+			if checkCanceled(stop) != nil {
+				return ErrCanceled
+			}
+			if delay *= 2; delay > maxBackoff {
+				delay = maxBackoff
+			}
+			log.Errorf("Failed to check images for updates, retrying in %s, error: %s", delay, err)
+			continue
+		}
+		delay = interval
+
+		if len(updated) > 0 {
+			log.Infof("Updated images of containers: %s", strings.Join(updated, ", "))
+		}
+	}
+}
+
+// updatedContainers pulls the images of the manifest and returns the names of the existing
+// containers which image tag now resolves to another image than they were created from.
+// The containers are narrowed down to the ones given in "only" if it is not empty.
+func (compose *Compose) updatedContainers(only []string) ([]string, error) {
+	actual, err := compose.client.GetContainers(compose.Manifest.HasExternalRefs())
+	if err != nil {
+		return nil, fmt.Errorf("GetContainers failed with error, error: %s", err)
+	}
+
+	expected := GetContainersFromConfig(compose.Manifest)
+	if len(only) > 0 {
+		if _, expected, err = selectContainers(compose.Manifest.Namespace, only, expected, actual); err != nil {
+			return nil, err
+		}
+	}
+	if err := compose.client.PullAll(expected, compose.Manifest.Vars); err != nil {
+		return nil, err
+	}
+
+	updated := []string{}
+	for _, container := range expected {
+		for _, existing := range actual {
+			if container.IsSameKind(existing) && container.ImageID != "" && existing.ImageID != "" &&
+				container.ImageID != existing.ImageID {
+				updated = append(updated, container.Name.Name)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// sleepCancel waits for the given duration, it returns ErrCanceled if cancel is closed earlier
+func sleepCancel(cancel <-chan struct{}, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-cancel:
+		return ErrCanceled
+	case <-timer.C:
+		return nil
+	}
+}
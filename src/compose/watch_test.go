@@ -0,0 +1,206 @@
+/*-
+ * Copyright 2015 Grammarly, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compose
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grammarly/rocker-compose/src/compose/config"
+	"github.com/grammarly/rocker/src/template"
+	"github.com/stretchr/testify/assert"
+)
+
+// registryMock is a client that keeps the list of running containers and
+// pulls images by the digests currently pushed to the mocked registry
+type registryMock struct {
+	clientMock
+	digests map[string]string // image -> id it resolves to
+	err     error             // registry error returned by PullAll
+	polls   int
+	ran     []string
+}
+
+func (m *registryMock) GetContainers(global bool) ([]*Container, error) {
+	return m.actual, nil
+}
+
+func (m *registryMock) PullAll(containers []*Container, vars template.Vars) error {
+	m.polls++
+	if m.err != nil {
+		return m.err
+	}
+	for _, container := range containers {
+		container.ImageID = m.digests[container.Image.String()]
+	}
+	return nil
+}
+
+func (m *registryMock) FetchImages(containers []*Container, vars template.Vars) error {
+	for _, container := range containers {
+		container.ImageID = m.digests[container.Image.String()]
+	}
+	return nil
+}
+
+func (m *registryMock) RunContainer(container *Container) error {
+	m.ran = append(m.ran, container.Name.Name)
+	running := *container
+	running.State = &ContainerState{Running: true}
+	m.actual = append(m.actual, &running)
+	return nil
+}
+
+func (m *registryMock) RemoveContainer(container *Container) error {
+	actual := []*Container{}
+	for _, c := range m.actual {
+		if !c.IsSameKind(container) {
+			actual = append(actual, c)
+		}
+	}
+	m.actual = actual
+	return nil
+}
+
+func (m *registryMock) EnsureContainerState(container *Container) error {
+	return nil
+}
+
+func newWatchCompose(t *testing.T) (*Compose, *registryMock) {
+	web, worker := "example/web:latest", "example/worker:latest"
+	manifest, err := config.New("test", map[string]*config.Container{
+		"web":    &config.Container{Image: &web},
+		"worker": &config.Container{Image: &worker},
+	}, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &registryMock{digests: map[string]string{web: "sha256:web1", worker: "sha256:worker1"}}
+	compose := &Compose{Manifest: manifest, client: client}
+
+	// the initial run
+	if _, err := compose.reconcile(nil); err != nil {
+		t.Fatal(err)
+	}
+	client.ran = nil
+	return compose, client
+}
+
+func TestWatchRecreatesUpdatedImages(t *testing.T) {
+	compose, registry := newWatchCompose(t)
+
+	// the worker differs from the manifest, but its image is not updated, so it is left as it is
+	memory := config.Memory(64 * 1024 * 1024)
+	for _, container := range registry.actual {
+		if container.Name.Name == "worker" {
+			drifted := *container.Config
+			drifted.Memory = &memory
+			container.Config = &drifted
+		}
+	}
+
+	stop := make(chan struct{})
+	sleep := func(_ <-chan struct{}, d time.Duration) error {
+		switch registry.polls {
+		case 1:
+			// nothing changed, so nothing is recreated
+			assert.Empty(t, registry.ran)
+			registry.digests["example/web:latest"] = "sha256:web2"
+		case 2:
+			close(stop)
+		}
+		return checkCanceled(stop)
+	}
+
+	err := compose.watch(stop, time.Minute, 0, sleep)
+	assert.Equal(t, ErrCanceled, err)
+	assert.Equal(t, []string{"web"}, registry.ran)
+	assert.False(t, compose.Pull, "pull option should be restored")
+	assert.Empty(t, compose.Only, "only option should be restored")
+}
+
+func TestWatchConfirmsRecreation(t *testing.T) {
+	compose, registry := newWatchCompose(t)
+
+	// recreation of the stateless containers is not confirmed, see isStateful
+	compose.Manifest.Containers["worker"].Volumes = config.Strings{"/data"}
+	for _, container := range registry.actual {
+		if container.Name.Name == "worker" {
+			container.Config.Volumes = config.Strings{"/data"}
+		}
+	}
+
+	confirmed := []string{}
+	compose.Confirm = func(removals []Removal) (bool, error) {
+		for _, removal := range removals {
+			confirmed = append(confirmed, removal.Container.Name.Name)
+		}
+		return false, nil
+	}
+
+	stop := make(chan struct{})
+	sleep := func(_ <-chan struct{}, d time.Duration) error {
+		switch registry.polls {
+		case 0:
+			registry.digests["example/worker:latest"] = "sha256:worker2"
+		case 1:
+			close(stop)
+		}
+		return checkCanceled(stop)
+	}
+
+	err := compose.watch(stop, time.Minute, 0, sleep)
+	assert.Equal(t, ErrCanceled, err)
+	assert.Equal(t, []string{"worker"}, confirmed)
+	assert.Empty(t, registry.ran, "declined recreation should not be executed")
+}
+
+func TestWatchBackoffOnRegistryErrors(t *testing.T) {
+	compose, registry := newWatchCompose(t)
+	registry.err = fmt.Errorf("registry is unavailable")
+
+	stop := make(chan struct{})
+	delays := []time.Duration{}
+	sleep := func(_ <-chan struct{}, d time.Duration) error {
+		delays = append(delays, d)
+		switch len(delays) {
+		case 5:
+			registry.err = nil
+		case 6:
+			close(stop)
+		}
+		return checkCanceled(stop)
+	}
+
+	err := compose.watch(stop, time.Second, 5*time.Second, sleep)
+	assert.Equal(t, ErrCanceled, err)
+	assert.Equal(t, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+		time.Second,
+	}, delays)
+	assert.Empty(t, registry.ran)
+}
+
+func TestWatchInvalidInterval(t *testing.T) {
+	compose := &Compose{}
+	assert.Error(t, compose.Watch(nil, 0, 0))
+}